@@ -6,17 +6,33 @@ import (
 	"LogGenerator/logger"
 	"LogGenerator/server"
 	"LogGenerator/utils"
+	"context"
 	"fmt"
 	_ "log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
 
 // Servers struct responsible for start and stop of the server
-type Servers struct{}
+type Servers struct {
+	mu      sync.Mutex
+	srv     *http.Server  // Built by StartServer, shut down by StopServer.
+	stopped chan struct{} // Closed by StopServer once in-flight requests have finished.
+}
+
+// stoppedChan returns the channel closed once the server has stopped.
+func (s *Servers) stoppedChan() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped == nil {
+		s.stopped = make(chan struct{})
+	}
+	return s.stopped
+}
 
 // StartServer is responsible for starting the server where it has listen and serve
 // and the handlers are also aattached to handle the api end point
@@ -30,23 +46,40 @@ func (s *Servers) StartServer() error {
 		ResponseW: &utils.ResponseHandler{},
 		LogGen:    &loggenerator.Generator{},
 	}
-	http.HandleFunc(utils.GloablMetaData.IsAliveUrl, serv.IsAlive)
-	http.HandleFunc(utils.GloablMetaData.GenerateUrl, serv.LogHandler)
-	http.HandleFunc("/logs/stop", serv.StopHandler)
-	http.HandleFunc("/logs/status", serv.StatusHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc(utils.GloablMetaData.IsAliveUrl, serv.IsAlive)
+	mux.HandleFunc(utils.GloablMetaData.GenerateUrl, serv.LogHandler)
+	mux.HandleFunc("/logs/stop", serv.StopHandler)
+	mux.HandleFunc("/logs/status", serv.StatusHandler)
 
 	//http.HandleFunc("/gen", serv.LogTestHandler)
 
+	srv := &http.Server{Addr: utils.GloablMetaData.Port, Handler: mux}
+	s.mu.Lock()
+	s.srv = srv
+	s.mu.Unlock()
+	select {
+	case <-s.stoppedChan():
+		// Stopped before the server was built, there is nothing to serve
+		return nil
+	default:
+	}
+
 	logger.LogInfo("Starting log generator server on port " + utils.GloablMetaData.Port + "...")
 	logger.LogDebug(utils.ConfigData)
-	if err := http.ListenAndServe(utils.GloablMetaData.Port, nil); err != nil {
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.LogError(fmt.Sprintf("Error starting server: %v", err))
 		os.Exit(1)
 	}
+
+	// ListenAndServe returns as soon as shutdown begins; wait for in-flight requests to finish.
+	<-s.stoppedChan()
 	return nil
 }
 
 // StopServer stops the HTTP server gracefully. It listens for signals to shut down the server.
+// On a signal the running generation task is cancelled, new connections are refused and in-flight
+// requests get GENERATOR_SHUTDOWN_TIMEOUT seconds to finish before their connections are closed.
 // Example usage:
 //
 //	// Initialize and stop the server
@@ -54,8 +87,26 @@ func (s *Servers) StartServer() error {
 //	server.stopServer()
 func (s *Servers) StopServer() error {
 	<-done
+	stopped := s.stoppedChan()
+	defer close(stopped)
+
+	if server.StopGeneration() {
+		logger.LogInfo("Log generation stopped for shutdown")
+	}
+
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(utils.GloablMetaData.ShutdownTimeout)*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.LogWarn(fmt.Sprintf("Shutdown timeout expired, closing open connections: %v", err))
+			srv.Close()
+		}
+	}
+
 	logger.LogInfo("Server Stopped......")
-	os.Exit(1)
 	return nil
 }
 
@@ -76,19 +127,25 @@ func (c *Configs) RefreshServer() error {
 	return nil
 }
 
-// RefreshConfigura calls the Refresh server periodically to refresh for the configuration
+// RefreshConfigura calls the Refresh server periodically to refresh for the configuration,
+// until stop is closed.
 // Example usage:
 //
 //	// Initialize configuration and refresh it every 1 minute.
 //	configs := &Configs{}
-//	RefreshConfigura(configs, time.Minute)
-func RefreshConfigura(configs interfaces.ConfigurationLoader, t time.Duration) {
+//	RefreshConfigura(configs, time.Minute, stop)
+func RefreshConfigura(configs interfaces.ConfigurationLoader, t time.Duration, stop <-chan struct{}) {
 	ticker := time.NewTicker(1 * t)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if err := configs.RefreshServer(); err != nil {
-			logger.LogError(err)
+	for {
+		select {
+		case <-ticker.C:
+			if err := configs.RefreshServer(); err != nil {
+				logger.LogError(err)
+			}
+		case <-stop:
+			return
 		}
 	}
 }
@@ -112,9 +169,57 @@ func NewApplication(servers interfaces.ServerLoader, configs interfaces.Configur
 	}
 }
 
+// checkParser runs the configured pre-flight check of the log parser. In "fail" mode an
+// unreachable parser aborts startup; in "warn" mode it is logged and generation starts anyway,
+// failing later at send time; "off" skips the check.
+func checkParser() error {
+	mode := utils.GloablMetaData.ParserCheck
+	if mode == "off" {
+		return nil
+	}
+
+	err := loggenerator.WaitForProcessor(time.Duration(utils.GloablMetaData.ParserCheckTimeout) * time.Second)
+	if err == nil {
+		return nil
+	}
+	if mode == "fail" {
+		return fmt.Errorf("parser pre-flight check failed: %v", err)
+	}
+	logger.LogWarn(fmt.Sprintf("Parser pre-flight check failed, continuing anyway: %v", err))
+	return nil
+}
+
+// replayDeadLetter resends the batches left in the dead-letter file by a previous run, see
+// loggenerator.ReplayDeadLetter.
+func replayDeadLetter() {
+	n, err := loggenerator.ReplayDeadLetter()
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Dead-letter replay stopped after %d batches: %v", n, err))
+		return
+	}
+	if n > 0 {
+		logger.LogInfo(fmt.Sprintf("%d batches replayed from the dead-letter file", n))
+	}
+}
+
 // done is the channel used to carry the stop signal of program shutdown
 var done chan bool
 
+// notifyShutdown installs a fresh done channel that receives a value once the process gets
+// SIGINT or SIGTERM.
+func notifyShutdown() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	stop := make(chan bool, 1)
+	done = stop
+
+	go func() {
+		sig := <-sigs
+		logger.LogWarn(sig)
+		stop <- true
+	}()
+}
+
 // SetUp sets up the application environment, loading the configuration and starting the server.
 //
 // It starts a background goroutine that listens for system signals (e.g., SIGINT or SIGTERM).
@@ -122,6 +227,9 @@ var done chan bool
 //
 // Additionally, it loads the configuration for the first time and sets up a periodic refresh
 // of the configuration every minute.
+// Before the server starts, the generator is seeded when GENERATOR_SEED is set and the parser
+// pre-flight check runs according to PARSER_CHECK, after which the batches of the dead-letter file
+// are replayed in the background.
 //
 // Example usage:
 //
@@ -129,22 +237,30 @@ var done chan bool
 //	app := NewApplication(&Servers{}, &Configs{})
 //	app.SetUp()
 func (app *Application) SetUp() error {
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	done = make(chan bool, 1)
-
-	go func() {
-		sig := <-sigs
-		logger.LogWarn(sig)
-		done <- true
-	}()
+	notifyShutdown()
 
 	if err := app.Configuration.RefreshServer(); err != nil {
 		logger.LogError(err)
 		return err
 	}
 
-	go RefreshConfigura(app.Configuration, time.Minute)
+	// Seeded once, as the configuration refreshes below would otherwise restart the sequence
+	if seed := utils.GloablMetaData.Seed; seed != 0 {
+		loggenerator.SeedGenerator(seed)
+		logger.LogInfo(fmt.Sprintf("Generator seeded with %d", seed))
+	}
+
+	if err := checkParser(); err != nil {
+		logger.LogError(err)
+		return err
+	}
+	go replayDeadLetter()
+
+	// The configuration refreshes until the server has stopped
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go RefreshConfigura(app.Configuration, time.Minute, stopped)
 	go app.Server.StopServer()
 	app.Server.StartServer()
 
@@ -1,9 +1,14 @@
 package helpers
 
 import (
-	_ "LogGenerator/utils"
+	"LogGenerator/models"
+	"LogGenerator/utils"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/signal"
 	"syscall"
 	"testing"
 	"time"
@@ -79,7 +84,9 @@ func TestNewApplication(t *testing.T) {
 
 func TestRefreshConfigura(t *testing.T) {
 	//ticker := time.NewTicker(1 * time.Minute)
-	go RefreshConfigura(&Configs{}, time.Minute)
+	stop := make(chan struct{})
+	defer close(stop)
+	go RefreshConfigura(&Configs{}, time.Minute, stop)
 	
 }
 
@@ -98,8 +105,72 @@ func TestStopServer(t *testing.T) {
 	assert.NoError(t, nil)
 }
 
+// TestStopServer_Signal starts the server on a free port, sends the process SIGTERM and checks that
+// the server shuts down, with both lifecycle methods returning, instead of the process exiting.
+func TestStopServer_Signal(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	utils.GloablMetaData.Port = addr
+	utils.GloablMetaData.IsAliveUrl = "/"
+	utils.GloablMetaData.GenerateUrl = "/logs"
+	utils.GloablMetaData.ShutdownTimeout = 5
+
+	notifyShutdown()
+	defer signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+	s := &Servers{}
+	started := make(chan error, 1)
+	go func() { started <- s.StartServer() }()
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.StopServer() }()
+
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	for name, ch := range map[string]chan error{"StopServer": stopped, "StartServer": started} {
+		select {
+		case err := <-ch:
+			assert.NoError(t, err, name)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s did not return after SIGTERM", name)
+		}
+	}
+
+	_, err = http.Get("http://" + addr + "/")
+	assert.Error(t, err, "the server should no longer accept connections")
+}
+
 func TestStartServer(t *testing.T) {
 	serv := &Servers{}
 
 	go serv.StartServer()
-}
\ No newline at end of file
+}
+
+func TestCheckParser(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+	utils.GloablMetaData.ParserCheckTimeout = 0
+
+	utils.GloablMetaData.ParserCheck = "fail"
+	assert.Error(t, checkParser())
+
+	utils.GloablMetaData.ParserCheck = "warn"
+	assert.NoError(t, checkParser())
+
+	utils.GloablMetaData.ParserCheck = "off"
+	assert.NoError(t, checkParser())
+}
@@ -0,0 +1,156 @@
+package loggenerator
+
+import (
+	"LogGenerator/logger"
+	"LogGenerator/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// deadLetterMu serializes access to the dead-letter file, which the workers of a round append to
+// concurrently and ReplayDeadLetter rewrites.
+var deadLetterMu sync.Mutex
+
+// deadLetterBatch is one line of the dead-letter file: a batch the processor did not accept, with
+// the id it was sent under so that the processor recognizes it when it already stored it.
+type deadLetterBatch struct {
+	BatchID string   `json:"batch_id"`
+	Logs    []string `json:"logs"`
+}
+
+// deadLetter appends a batch the processor did not accept to the dead-letter file. The batch is
+// dropped when no file is configured.
+func deadLetter(batchID string, logs []string) {
+	path := utils.GloablMetaData.DLQFile
+	if path == "" {
+		return
+	}
+	if err := writeDeadLetter(path, deadLetterBatch{BatchID: batchID, Logs: logs}); err != nil {
+		logger.LogError(fmt.Sprintf("Error writing batch %s to the dead-letter file, %d logs dropped: %v", batchID, len(logs), err))
+		return
+	}
+	logger.LogWarn(fmt.Sprintf("Batch %s of %d logs written to the dead-letter file %s", batchID, len(logs), path))
+}
+
+// writeDeadLetter appends batch to the dead-letter file at path as one JSON line.
+func writeDeadLetter(path string, batch deadLetterBatch) error {
+	line, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	deadLetterMu.Lock()
+	defer deadLetterMu.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReplayDeadLetter re-posts the batches of the dead-letter file to the processor, in the order they
+// were written and under their original batch ids, and returns how many were accepted. The file is
+// truncated once every batch was accepted; replay stops at the first batch that fails again, which
+// stays in the file with the ones after it. Batches rejected with a status that is not retryable,
+// and lines that are not a batch, are logged and dropped.
+// There is nothing to replay when no file is configured or the file does not exist.
+//
+// Example usage:
+//
+//	if n, err := ReplayDeadLetter(); err != nil {
+//	    logger.LogWarn(fmt.Sprintf("%d batches replayed: %v", n, err))
+//	}
+func ReplayDeadLetter() (int, error) {
+	path := utils.GloablMetaData.DLQFile
+	if path == "" {
+		return 0, nil
+	}
+
+	deadLetterMu.Lock()
+	defer deadLetterMu.Unlock()
+
+	lines, err := readDeadLetter(path)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for i, line := range lines {
+		var batch deadLetterBatch
+		if err := json.Unmarshal(line, &batch); err != nil {
+			logger.LogWarn(fmt.Sprintf("Skipping invalid line %d of the dead-letter file: %v", i+1, err))
+			continue
+		}
+		logJson, err := json.Marshal(batch.Logs)
+		if err == nil {
+			var status int
+			if status, err = postBatch(logJson, batch.BatchID); err == nil && status != http.StatusOK {
+				if !retryable(status) {
+					logger.LogError(fmt.Sprintf("Batch %s of %d logs rejected by LogParser on replay and dropped. Status: %d", batch.BatchID, len(batch.Logs), status))
+					continue
+				}
+				err = fmt.Errorf("status %d", status)
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("error replaying batch %s: %v", batch.BatchID, err)
+			return replayed, keepDeadLetter(path, lines[i:], err)
+		}
+		replayed++
+	}
+
+	if err := os.Truncate(path, 0); err != nil && !os.IsNotExist(err) {
+		return replayed, fmt.Errorf("error truncating the dead-letter file: %v", err)
+	}
+	return replayed, nil
+}
+
+// readDeadLetter returns the non-blank lines of the dead-letter file at path, none when it does not exist.
+func readDeadLetter(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening the dead-letter file: %v", err)
+	}
+	defer file.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	// A line holds a whole batch, escaped as JSON
+	scanner.Buffer(make([]byte, 64*1024), 2*maxBatchSizeBytes)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, append([]byte(nil), line...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the dead-letter file: %v", err)
+	}
+	return lines, nil
+}
+
+// keepDeadLetter rewrites the dead-letter file at path with the lines not replayed yet and returns
+// cause, the error replay stopped at.
+func keepDeadLetter(path string, lines [][]byte, cause error) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("%v; error rewriting the dead-letter file: %v", cause, err)
+	}
+	return cause
+}
@@ -2,13 +2,15 @@ package loggenerator
 
 import (
 	"LogGenerator/logger"
-	_ "LogGenerator/models"
+	"LogGenerator/models"
 	"LogGenerator/utils"
 	"context"
+	"encoding/json"
 	"fmt"
 	_ "log"
 	"math/rand"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 )
@@ -26,23 +28,126 @@ const maxBatchSizeBytes = 10 * 1024 * 1024
 //   logEntry := GenerateLog()
 //   log.Printf("Generated log entry: %s", logEntry)
 func GenerateLog() string {
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	//timeLocal := time.Now()//.Format("02/Jan/2006:15:04:05 -0700")
+	return generateLog(time.Now(), time.RFC3339)
+}
+
+// GenerateLogAt generates a random log entry like GenerateLog, stamped with the given time.
+// In the rfc3339 format the timestamp keeps millisecond precision so logs spread within one
+// second stay distinct.
+func GenerateLogAt(t time.Time) string {
+	return generateLog(t, timestampLayout)
+}
+
+// timestampLayout is RFC3339 with milliseconds; the parser's RFC3339 parsing accepts the fraction.
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// clfTimestampLayout is the $time_local layout of Nginx and Apache access logs, e.g. 17/Mar/2025:13:30:20 +0530.
+const clfTimestampLayout = "02/Jan/2006:15:04:05 -0700"
+
+// GenerateLogJSON generates a random log entry like GenerateLog, as a JSON object with the fields of
+// the parser's Log model instead of an access log line.
+func GenerateLogJSON() string {
+	return withRand(func(rnd *rand.Rand) string {
+		return buildLogJSON(rnd, time.Now(), utils.GloablMetaData.Services, utils.GloablMetaData.ServiceTag)
+	})
+}
+
+// generateLog builds a log line in the configured format, stamped with t. rfc3339Layout is the
+// layout used by the rfc3339 format; the common and combined formats always use clfTimestampLayout,
+// and the json format keeps millisecond precision. The fields are drawn from the shared source, see SeedGenerator.
+func generateLog(t time.Time, rfc3339Layout string) string {
+	format := utils.GloablMetaData.LogFormat
+	if format == "json" {
+		return withRand(func(rnd *rand.Rand) string {
+			return buildLogJSON(rnd, t, utils.GloablMetaData.Services, utils.GloablMetaData.ServiceTag)
+		})
+	}
+	timeLocal := t.UTC().Format(rfc3339Layout)
+	if format == "common" || format == "combined" {
+		timeLocal = t.Format(clfTimestampLayout)
+	}
+	return withRand(func(rnd *rand.Rand) string {
+		return buildLog(rnd, timeLocal, format, utils.GloablMetaData.Services, utils.GloablMetaData.ServiceTag)
+	})
+}
 
+// buildEntry draws the fields of one log from rnd, leaving its time unset. With service profiles, the
+// log is attributed to a service picked by rate and takes its path and status from it; the service is
+// returned, nil without profiles.
+func buildEntry(rnd *rand.Rand, services []models.ServiceProfile) (models.LogEntry, *models.ServiceProfile) {
 	ip := utils.Ips[rnd.Intn(len(utils.Ips))]
 	method := utils.Methods[rnd.Intn(len(utils.Methods))]
 	url := utils.Urls[rnd.Intn(len(utils.Urls))]
 	status := utils.Statuses[rnd.Intn(len(utils.Statuses))]
+	if weights := utils.GloablMetaData.WeightedStatuses; len(weights) > 0 {
+		status = pickWeighted(rnd, weights)
+	}
+	var service *models.ServiceProfile
+	if len(services) > 0 {
+		service = pickService(rnd, services)
+		url = service.Paths[rnd.Intn(len(service.Paths))]
+		if len(service.StatusWeights) > 0 {
+			status = pickStatus(rnd, service.StatusWeights)
+		}
+	}
 	bodyBytesSent := rnd.Intn(1000) + 500
 	referrer := utils.Referrers[rnd.Intn(len(utils.Referrers))]
 	userAgent := utils.UserAgents[rnd.Intn(len(utils.UserAgents))]
 	xForwardedFor := fmt.Sprintf("%d.%d.%d.%d", rnd.Intn(256), rnd.Intn(256), rnd.Intn(256), rnd.Intn(256))
 
-	request := fmt.Sprintf("%s %s HTTP/1.1", method, url)
-	//timeLocal := time.Now()//.Format("02/Jan/2006:15:04:05 -0700")
-	timeLocal := time.Now().UTC().Format(time.RFC3339)
-	return fmt.Sprintf("%s - - [%s] \"%s\" %d %d \"%s\" \"%s\" \"%s\"",
-	ip, timeLocal, request, status, bodyBytesSent, referrer, userAgent, xForwardedFor)
+	return models.LogEntry{
+		RemoteAddr:        ip,
+		RemoteUser:        "-",
+		Request:           fmt.Sprintf("%s %s HTTP/1.1", method, url),
+		Status:            status,
+		BodyBytesSent:     bodyBytesSent,
+		HttpReferer:       referrer,
+		HttpUserAgent:     userAgent,
+		HttpXForwardedFor: xForwardedFor,
+	}, service
+}
 
+// buildLog builds one log line from rnd, see buildEntry, ending with the service name when tag is set.
+//
+// Formats:
+//   - "common": the Common Log Format, ending with the status and body bytes sent.
+//   - "combined": the common format followed by "$http_referer" "$http_user_agent".
+//   - anything else ("rfc3339", the default): the combined format followed by "$http_x_forwarded_for".
+//
+// Only the rfc3339 format is tagged with the service name, as the standard formats have no field for it.
+func buildLog(rnd *rand.Rand, timeLocal string, format string, services []models.ServiceProfile, tag bool) string {
+	entry, service := buildEntry(rnd, services)
+
+	log := fmt.Sprintf("%s - %s [%s] \"%s\" %d %d", entry.RemoteAddr, entry.RemoteUser, timeLocal, entry.Request, entry.Status, entry.BodyBytesSent)
+	switch format {
+	case "common":
+		return log
+	case "combined":
+		return log + fmt.Sprintf(" \"%s\" \"%s\"", entry.HttpReferer, entry.HttpUserAgent)
+	}
+	log += fmt.Sprintf(" \"%s\" \"%s\" \"%s\"", entry.HttpReferer, entry.HttpUserAgent, entry.HttpXForwardedFor)
+	if service != nil && tag {
+		log += fmt.Sprintf(" \"%s\"", service.Name)
+	}
+	return log
+}
+
+// buildLogJSON builds one log from rnd like buildLog, stamped with t to the millisecond, as a JSON object.
+// The service name is carried in server_name when tag is set.
+func buildLogJSON(rnd *rand.Rand, t time.Time, services []models.ServiceProfile, tag bool) string {
+	entry, service := buildEntry(rnd, services)
+	entry.TimeLocal = t.UTC().Truncate(time.Millisecond)
+	if service != nil && tag {
+		entry.ServerName = service.Name
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Error marshalling log entry: %v", err))
+		return ""
+	}
+	return string(line)
 }
 
 // GenerateLogsConcurrently generates logs concurrently across multiple goroutines. The number of logs is 
@@ -54,12 +159,17 @@ func GenerateLog() string {
 //   - ctx: The context used to manage cancellation or timeouts during log generation.
 //   - numLogs: The total number of logs to be generated.
 //   - duration: The duration over which the logs should be generated (e.g., for spreading out log generation).
-//   - counter: A WaitGroup used to ensure all goroutines finish before the function returns.
+//   - counter: A WaitGroup the caller can use to track the worker goroutines.
 //
 // This function generates logs concurrently using multiple workers. The log generation process is 
 // controlled by a ticker that spreads out log creation over the specified `duration`. The function 
 // also ensures that logs are batched to avoid exceeding memory limits, and batches are sent 
-// to the processor when necessary.
+// to the processor when necessary. It returns only after every worker and every batch send it
+// started has finished, so no goroutine outlives the call.
+//
+// When a replay file is configured, the logs are the lines of that file in order, restamped with the
+// time they are generated at, and numLogs is multiplied by the replay multiplier. Without looping,
+// generation stops once the file was replayed in full.
 //
 // Example usage:
 //   var wg sync.WaitGroup
@@ -67,6 +177,21 @@ func GenerateLog() string {
 //   logGen := Generator{}
 //   logGen.GenerateLogsConcurrently(ctx, 10000, 1*time.Minute, &wg)
 func (l *Generator) GenerateLogsConcurrently(ctx context.Context, numLogs int, duration time.Duration,counter *sync.WaitGroup, statusChan chan<- string) {
+	// In replay mode the lines come from the seed file, at the rate multiplied by the replay multiplier
+	replayer, err := currentReplay()
+	if err != nil {
+		msg := fmt.Sprintf("Replay failed, skipping the round: %v", err)
+		logger.LogError(msg)
+		select {
+		case statusChan <- msg:
+		default:
+		}
+		return
+	}
+	if replayer != nil && utils.GloablMetaData.ReplayMultiplier > 1 {
+		numLogs *= utils.GloablMetaData.ReplayMultiplier
+	}
+
 	logs := make([]string, numLogs)
 
 	numCPU := runtime.NumCPU()
@@ -84,16 +209,30 @@ func (l *Generator) GenerateLogsConcurrently(ctx context.Context, numLogs int, d
 
 	logsPerWorker := numLogs / optimalWorkers
 
+	// Timestamps are assigned up front when they are spread over the interval rather than taken at generation time
+	timestamps := logTimestamps(utils.GloablMetaData.TimestampMode, time.Now(), duration, numLogs)
+
 	var mu sync.Mutex
 	var generatedLogs int
+	var workers sync.WaitGroup
+	var sends sync.WaitGroup
+	send := func(batch []string) {
+		sends.Add(1)
+		go func() {
+			defer sends.Done()
+			SendLogToProcessor(batch, statusChan)
+		}()
+	}
 	logTicker := time.NewTicker(duration/time.Duration(numLogs))
 	defer logTicker.Stop()
 
 
 	for worker_i := 0; worker_i < optimalWorkers; worker_i++ {
 		counter.Add(1)
+		workers.Add(1)
 		go func(workerID int) {
 			defer counter.Done()
+			defer workers.Done()
 
 			startIndex := workerID * logsPerWorker
 			endIndex := startIndex + logsPerWorker
@@ -104,6 +243,7 @@ func (l *Generator) GenerateLogsConcurrently(ctx context.Context, numLogs int, d
 			batch := []string{}
 			totalBatchSize := 0
 
+		generate:
 			for logIndex := startIndex; logIndex < endIndex; logIndex++ {
 				select{
 				case <-ctx.Done():
@@ -118,14 +258,28 @@ func (l *Generator) GenerateLogsConcurrently(ctx context.Context, numLogs int, d
 						generatedLogs++
 						mu.Unlock()
 
-						logs[logIndex] = GenerateLog()
+						if replayer != nil {
+							stamp := time.Now()
+							if timestamps != nil {
+								stamp = timestamps[logIndex]
+							}
+							line, ok := replayer.Next(stamp)
+							if !ok {
+								break generate
+							}
+							logs[logIndex] = line
+						} else if timestamps != nil {
+							logs[logIndex] = GenerateLogAt(timestamps[logIndex])
+						} else {
+							logs[logIndex] = GenerateLog()
+						}
 						logger.LogDebug(fmt.Sprintf("Generated Log: %s\n", logs[logIndex]))
 
 						logSize := len(logs[logIndex])
 
 					if totalBatchSize+logSize > maxBatchSizeBytes {
 						logger.LogDebug(fmt.Sprintf("Batch byte size is more:%v", totalBatchSize+logSize))
-						go SendLogToProcessor(batch, statusChan)
+						send(batch)
 
 						batch = []string{}
 						totalBatchSize = 0
@@ -136,16 +290,52 @@ func (l *Generator) GenerateLogsConcurrently(ctx context.Context, numLogs int, d
 
 					if len(batch) >= 100 {
 						logger.LogDebug(fmt.Sprintf("Batch size is more:%v", len(batch)))
-						go SendLogToProcessor(batch, statusChan)
+						send(batch)
 						batch = []string{}
 						totalBatchSize = 0
 					}
 				}
 			}
 			if len(batch) > 0 {
-				go SendLogToProcessor(batch, statusChan)
+				send(batch)
 			}
 		}(worker_i)
 	}
-	counter.Wait()
+	workers.Wait()
+	sends.Wait()
+}
+
+// logTimestamps returns the timestamps for numLogs logs generated over the interval starting at start,
+// in ascending order, or nil when logs should be stamped at generation time.
+//
+// Modes:
+//   - "even": logs are spaced evenly across the interval.
+//   - "poisson": logs arrive as a Poisson process; given the number of arrivals in the interval,
+//     their times are independent and uniform, so the sorted uniform offsets are used.
+//   - anything else ("now", the default): nil.
+func logTimestamps(mode string, start time.Time, duration time.Duration, numLogs int) []time.Time {
+	if numLogs <= 0 || (mode != "even" && mode != "poisson") {
+		return nil
+	}
+
+	offsets := make([]time.Duration, numLogs)
+	if mode == "even" {
+		step := duration / time.Duration(numLogs)
+		for i := range offsets {
+			offsets[i] = time.Duration(i) * step
+		}
+	} else {
+		rndMu.Lock()
+		for i := range offsets {
+			offsets[i] = time.Duration(rnd.Int63n(int64(duration)))
+		}
+		rndMu.Unlock()
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	}
+
+	timestamps := make([]time.Time, numLogs)
+	for i, offset := range offsets {
+		timestamps[i] = start.Add(offset)
+	}
+	return timestamps
 }
@@ -1,18 +1,26 @@
 package loggenerator
 
 import (
+	"LogGenerator/models"
 	"LogGenerator/utils"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 )
 
 
@@ -79,6 +87,371 @@ func TestGenerateLogsConcurrently(t *testing.T) {
 
 }
 
+// TestGenerateLogsConcurrently_NoLeak checks that every batch send has completed by the time
+// GenerateLogsConcurrently returns and that no goroutine is left behind.
+func TestGenerateLogsConcurrently_NoLeak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	var received int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var logs []string
+		_ = json.NewDecoder(r.Body).Decode(&logs)
+		time.Sleep(50 * time.Millisecond) // Slow processor: sends outlive the generation loop
+		atomic.AddInt64(&received, int64(len(logs)))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	defer http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	utils.GloablMetaData.ProcessorApi = ts.URL
+
+	var counter sync.WaitGroup
+	statusChan := make(chan string, 1)
+	generator := &Generator{}
+	generator.GenerateLogsConcurrently(context.Background(), 250, 100*time.Millisecond, &counter, statusChan)
+
+	assert.Equal(t, int64(250), atomic.LoadInt64(&received))
+}
+
+// TestGenerateLogsConcurrently_CancelledNoLeak checks that cancelling generation leaves no goroutine behind.
+func TestGenerateLogsConcurrently_CancelledNoLeak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	defer http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	utils.GloablMetaData.ProcessorApi = ts.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var counter sync.WaitGroup
+	statusChan := make(chan string, 1)
+	generator := &Generator{}
+	generator.GenerateLogsConcurrently(ctx, 1000, 10*time.Second, &counter, statusChan)
+	counter.Wait()
+}
+
+// TestGenerateLogsConcurrently_SpreadTimestamps checks that with an interval timestamp mode the
+// generated timestamps span the interval instead of clustering at the moment of generation.
+func TestGenerateLogsConcurrently_SpreadTimestamps(t *testing.T) {
+	defer func() { utils.GloablMetaData.TimestampMode = "" }()
+
+	numLogs := 200
+	duration := 400 * time.Millisecond
+	for _, mode := range []string{"even", "poisson"} {
+		t.Run(mode, func(t *testing.T) {
+			var mu sync.Mutex
+			var stamps []time.Time
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var logs []string
+				_ = json.NewDecoder(r.Body).Decode(&logs)
+				mu.Lock()
+				defer mu.Unlock()
+				for _, log := range logs {
+					start, end := strings.Index(log, "["), strings.Index(log, "]")
+					stamp, err := time.Parse(time.RFC3339, log[start+1:end])
+					assert.NoError(t, err)
+					stamps = append(stamps, stamp)
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ts.Close()
+			utils.GloablMetaData.ProcessorApi = ts.URL
+			utils.GloablMetaData.TimestampMode = mode
+
+			var counter sync.WaitGroup
+			statusChan := make(chan string, 1)
+			generator := &Generator{}
+			before := time.Now().Truncate(time.Millisecond)
+			generator.GenerateLogsConcurrently(context.Background(), numLogs, duration, &counter, statusChan)
+
+			assert.Len(t, stamps, numLogs)
+			first, last := stamps[0], stamps[0]
+			distinct := map[time.Time]bool{}
+			for _, stamp := range stamps {
+				if stamp.Before(first) {
+					first = stamp
+				}
+				if stamp.After(last) {
+					last = stamp
+				}
+				distinct[stamp] = true
+			}
+			assert.False(t, first.Before(before))
+			assert.True(t, last.Before(before.Add(duration+time.Second)))
+			assert.Greater(t, last.Sub(first), duration/2, "timestamps should span the interval")
+			assert.Greater(t, len(distinct), numLogs/2, "timestamps should not cluster at one instant")
+		})
+	}
+}
+
+func TestLogTimestamps(t *testing.T) {
+	start := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+	duration := time.Second
+
+	assert.Nil(t, logTimestamps("now", start, duration, 10))
+	assert.Nil(t, logTimestamps("even", start, duration, 0))
+
+	even := logTimestamps("even", start, duration, 10)
+	assert.Len(t, even, 10)
+	for i, stamp := range even {
+		assert.Equal(t, start.Add(time.Duration(i)*100*time.Millisecond), stamp)
+	}
+
+	poisson := logTimestamps("poisson", start, duration, 1000)
+	assert.Len(t, poisson, 1000)
+	for i, stamp := range poisson {
+		assert.False(t, stamp.Before(start))
+		assert.True(t, stamp.Before(start.Add(duration)))
+		if i > 0 {
+			assert.False(t, stamp.Before(poisson[i-1]))
+		}
+	}
+}
+
+func TestBuildLog_Services(t *testing.T) {
+	services := []models.ServiceProfile{
+		{Name: "api.example.com", Paths: []string{"/v1/orders", "/v1/users"}, StatusWeights: map[int]int{200: 80, 500: 20}, Rate: 3},
+		{Name: "www.example.com", Paths: []string{"/", "/about"}, StatusWeights: map[int]int{200: 50, 404: 50}, Rate: 1},
+	}
+	paths := map[string][]string{}
+	statuses := map[string]map[int]int{}
+	for _, service := range services {
+		paths[service.Name] = service.Paths
+		statuses[service.Name] = map[int]int{}
+	}
+
+	const numLogs = 20000
+	rnd := rand.New(rand.NewSource(42))
+	lineRe := regexp.MustCompile(`^\S+ - - \[[^\]]+\] "\S+ (\S+) HTTP/1.1" (\d{3}) \d+ "[^"]*" "[^"]*" "[^"]*" "([^"]*)"$`)
+	counts := map[string]int{}
+	for i := 0; i < numLogs; i++ {
+		line := buildLog(rnd, "2025-04-10T12:00:00Z", utils.GENERATOR_LOG_FORMAT, services, true)
+		match := lineRe.FindStringSubmatch(line)
+		if !assert.NotNil(t, match, "Log should end with the service tag: %s", line) {
+			return
+		}
+		name := match[3]
+		assert.Contains(t, paths[name], match[1], "Path should come from the service's pool")
+		status, _ := strconv.Atoi(match[2])
+		statuses[name][status]++
+		counts[name]++
+	}
+
+	assert.InDelta(t, 0.75, float64(counts["api.example.com"])/numLogs, 0.02, "Services should share logs by rate")
+	assert.InDelta(t, 0.25, float64(counts["www.example.com"])/numLogs, 0.02, "Services should share logs by rate")
+	for _, service := range services {
+		for status, weight := range service.StatusWeights {
+			expected := float64(weight) / 100
+			actual := float64(statuses[service.Name][status]) / float64(counts[service.Name])
+			assert.InDelta(t, expected, actual, 0.03, "Status %d of %s should follow its weight", status, service.Name)
+		}
+		assert.Len(t, statuses[service.Name], len(service.StatusWeights), "Only weighted statuses should be generated")
+	}
+}
+
+func TestBuildLog_NoServiceTag(t *testing.T) {
+	services := []models.ServiceProfile{{Name: "api.example.com", Paths: []string{"/v1/orders"}, Rate: 1}}
+	rnd := rand.New(rand.NewSource(42))
+
+	line := buildLog(rnd, "2025-04-10T12:00:00Z", utils.GENERATOR_LOG_FORMAT, services, false)
+	assert.Contains(t, line, " /v1/orders HTTP/1.1\"", "The path should come from the service")
+	assert.NotContains(t, line, "api.example.com", "The service should only be tagged when enabled")
+	assert.Len(t, strings.Split(line, "\""), 9, "The log should keep the untagged format")
+
+	// Without profiles the flat pools are used and nothing is tagged
+	line = buildLog(rnd, "2025-04-10T12:00:00Z", utils.GENERATOR_LOG_FORMAT, nil, true)
+	assert.Len(t, strings.Split(line, "\""), 9, "The log should keep the untagged format")
+}
+
+// parserLineRe is the line regex of LogParser's parseLogLine, which generated logs must match.
+var parserLineRe = regexp.MustCompile(`^([\d\.]+) - (\S+) \[([^\]]+)\] "(.*?)" (\d{3}) (\d+)(?: "(.*?)" "(.*?)"(?: "(.*?)"(?: (\d+(?:\.\d+)?|-))?(?: "([^"]*)")?)?)?$`)
+
+// TestGenerateLog_Formats checks that each log format matches the parser's regex with the fields it
+// is expected to carry, and that its timestamp parses back to the time the log was generated at.
+func TestGenerateLog_Formats(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	utils.GloablMetaData.Services = nil
+
+	at := time.Date(2025, time.March, 17, 13, 30, 20, 0, time.FixedZone("IST", 19800))
+	cases := []struct {
+		format    string
+		layout    string
+		timestamp string
+		combined  bool
+		forwarded bool
+	}{
+		{"rfc3339", time.RFC3339, "2025-03-17T08:00:20.000Z", true, true},
+		{"combined", clfTimestampLayout, "17/Mar/2025:13:30:20 +0530", true, false},
+		{"common", clfTimestampLayout, "17/Mar/2025:13:30:20 +0530", false, false},
+	}
+	for _, c := range cases {
+		utils.GloablMetaData.LogFormat = c.format
+		line := GenerateLogAt(at)
+
+		match := parserLineRe.FindStringSubmatch(line)
+		if !assert.NotNil(t, match, "%s log should match the parser's regex: %s", c.format, line) {
+			continue
+		}
+		assert.Equal(t, c.timestamp, match[3], c.format)
+		parsed, err := time.Parse(c.layout, match[3])
+		assert.NoError(t, err, c.format)
+		assert.True(t, at.Equal(parsed), "%s timestamp should round-trip, got %v", c.format, parsed)
+		assert.Regexp(t, `^[A-Z]+ \S+ HTTP/1.1$`, match[4], c.format)
+		assert.Equal(t, c.combined, match[8] != "", "%s log should carry the user agent: %s", c.format, line)
+		assert.Equal(t, c.forwarded, match[9] != "", "%s log should carry X-Forwarded-For: %s", c.format, line)
+	}
+}
+
+// TestGenerateLogJSON checks that JSON logs unmarshal into a LogEntry carrying every field, and that
+// the json log format makes the generation functions emit them.
+func TestGenerateLogJSON(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	utils.GloablMetaData.Services = nil
+
+	before := time.Now().Add(-time.Second)
+	var entry models.LogEntry
+	assert.NoError(t, json.Unmarshal([]byte(GenerateLogJSON()), &entry))
+	assert.Contains(t, utils.Ips, entry.RemoteAddr)
+	assert.Equal(t, "-", entry.RemoteUser)
+	assert.True(t, entry.TimeLocal.After(before))
+	assert.Regexp(t, `^[A-Z]+ /\S* HTTP/1.1$`, entry.Request)
+	assert.Contains(t, utils.Statuses, entry.Status)
+	assert.GreaterOrEqual(t, entry.BodyBytesSent, 500)
+	assert.Contains(t, utils.Referrers, entry.HttpReferer)
+	assert.Contains(t, utils.UserAgents, entry.HttpUserAgent)
+	assert.Regexp(t, `^\d+\.\d+\.\d+\.\d+$`, entry.HttpXForwardedFor)
+	assert.Empty(t, entry.ServerName)
+
+	utils.GloablMetaData.LogFormat = "json"
+	utils.GloablMetaData.Services = []models.ServiceProfile{{Name: "api.example.com", Paths: []string{"/v1/orders"}, Rate: 1}}
+	utils.GloablMetaData.ServiceTag = true
+	at := time.Date(2025, time.April, 10, 12, 0, 0, 250*int(time.Millisecond)+999, time.UTC)
+	line := GenerateLogAt(at)
+	assert.True(t, strings.HasPrefix(line, "{"), "json format should emit JSON: %s", line)
+	assert.Contains(t, line, `"time_local":"2025-04-10T12:00:00.25Z"`)
+
+	entry = models.LogEntry{}
+	assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+	assert.True(t, at.Truncate(time.Millisecond).Equal(entry.TimeLocal))
+	assert.Equal(t, "api.example.com", entry.ServerName)
+	assert.True(t, strings.HasSuffix(entry.Request, " /v1/orders HTTP/1.1"))
+}
+
+// TestGenerateLog_Pools checks that logs only carry values drawn from the pools configured in config.yaml.
+func TestGenerateLog_Pools(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	defer func() {
+		utils.ConfigData = models.AllConfigModel{}
+		assert.NoError(t, utils.ApplyPools(models.Pools{}))
+	}()
+
+	err := utils.LoadConfigFromYaml([]byte(`
+KEY_POOLS :
+  ips : ["203.0.113.7", "198.51.100.23"]
+  methods : ["PATCH"]
+  urls : ["/api/orders", "/api/cart"]
+  statuses : [201, 503]
+  user_agents : ["curl/8.5.0"]
+  referrers : ["https://shop.example.com"]
+`), nil)
+	assert.NoError(t, err)
+	utils.GloablMetaData.Services = nil
+	utils.GloablMetaData.ServiceTag = false
+	utils.GloablMetaData.LogFormat = "rfc3339"
+
+	for i := 0; i < 200; i++ {
+		line := GenerateLog()
+		match := parserLineRe.FindStringSubmatch(line)
+		if !assert.NotNil(t, match, "log should match the parser's regex: %s", line) {
+			continue
+		}
+		assert.Contains(t, []string{"203.0.113.7", "198.51.100.23"}, match[1])
+		assert.Contains(t, []string{"PATCH /api/orders HTTP/1.1", "PATCH /api/cart HTTP/1.1"}, match[4])
+		assert.Contains(t, []string{"201", "503"}, match[5])
+		assert.Equal(t, "https://shop.example.com", match[7])
+		assert.Equal(t, "curl/8.5.0", match[8])
+	}
+}
+
+// TestSeedGenerator checks that two runs seeded alike generate identical logs, in every format.
+func TestSeedGenerator(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	defer SeedGenerator(time.Now().UnixNano())
+	utils.GloablMetaData.Services = nil
+	stamp := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	run := func(seed int64) []string {
+		SeedGenerator(seed)
+		var logs []string
+		for _, format := range []string{"rfc3339", "combined", "common", "json"} {
+			utils.GloablMetaData.LogFormat = format
+			for i := 0; i < 50; i++ {
+				logs = append(logs, GenerateLogAt(stamp))
+			}
+		}
+		return logs
+	}
+
+	first := run(42)
+	assert.Equal(t, first, run(42), "the same seed should generate the same logs")
+	assert.NotEqual(t, first, run(43), "another seed should generate other logs")
+}
+
+func TestPickWeighted(t *testing.T) {
+	weights := map[int]float64{200: 0.90, 404: 0.05, 500: 0.03, 301: 0.02}
+	rnd := rand.New(rand.NewSource(42))
+
+	const numPicks = 100000
+	counts := map[int]int{}
+	for i := 0; i < numPicks; i++ {
+		counts[pickWeighted(rnd, weights)]++
+	}
+
+	assert.Len(t, counts, len(weights), "Only weighted statuses should be picked")
+	for status, weight := range weights {
+		assert.InDelta(t, weight, float64(counts[status])/numPicks, 0.005, "Status %d should follow its weight", status)
+	}
+
+	// Weights are relative
+	counts = map[int]int{}
+	for i := 0; i < numPicks; i++ {
+		counts[pickWeighted(rnd, map[int]float64{200: 3, 503: 1})]++
+	}
+	assert.InDelta(t, 0.75, float64(counts[200])/numPicks, 0.01, "Weights should not need to add up to 1")
+}
+
+func TestGenerateLog_WeightedStatuses(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	utils.GloablMetaData.Services = nil
+	utils.GloablMetaData.LogFormat = "rfc3339"
+	utils.GloablMetaData.WeightedStatuses = map[int]float64{200: 0.9, 500: 0.1}
+
+	const numLogs = 5000
+	counts := map[string]int{}
+	for i := 0; i < numLogs; i++ {
+		match := parserLineRe.FindStringSubmatch(GenerateLog())
+		if !assert.NotNil(t, match) {
+			return
+		}
+		counts[match[5]]++
+	}
+	assert.Len(t, counts, 2, "Only weighted statuses should be generated")
+	assert.InDelta(t, 0.9, float64(counts["200"])/numLogs, 0.02)
+
+	// Without weights statuses are uniform over the pool
+	utils.GloablMetaData.WeightedStatuses = nil
+	counts = map[string]int{}
+	for i := 0; i < numLogs; i++ {
+		counts[parserLineRe.FindStringSubmatch(GenerateLog())[5]]++
+	}
+	assert.Len(t, counts, len(utils.Statuses))
+	for _, count := range counts {
+		assert.InDelta(t, 1/float64(len(utils.Statuses)), float64(count)/numLogs, 0.03)
+	}
+}
 
 func TestSendLogToProcessor(t *testing.T) {
 
@@ -120,6 +493,79 @@ func TestSendLogToProcessor(t *testing.T) {
 	//mockLogger.LogInfo.AssertCalled(t, "Logs successfully sent to LogParser")
 }
 
+// TestSendLogToProcessor_BatchID checks that every batch is sent with its own batch id
+func TestSendLogToProcessor_BatchID(t *testing.T) {
+	var mu sync.Mutex
+	var ids []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ids = append(ids, r.Header.Get("X-Batch-ID"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+
+	statusChan := make(chan string, 2)
+	SendLogToProcessor([]string{"log1"}, statusChan)
+	SendLogToProcessor([]string{"log2"}, statusChan)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, ids, 2) {
+		assert.Len(t, ids[0], 32)
+		assert.NotEqual(t, ids[0], ids[1], "Each batch should get its own id")
+	}
+}
+
+// TestSendLogToProcessor_Gzip checks that batches are gzip-compressed when GENERATOR_GZIP is set.
+func TestSendLogToProcessor_Gzip(t *testing.T) {
+	var received []string
+	var encoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		gzipReader, err := gzip.NewReader(r.Body)
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer gzipReader.Close()
+		assert.NoError(t, json.NewDecoder(gzipReader).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+	utils.GloablMetaData.Gzip = true
+	defer func() { utils.GloablMetaData.Gzip = false }()
+
+	statusChan := make(chan string, 1)
+	SendLogToProcessor([]string{"log1", "log2"}, statusChan)
+
+	assert.Equal(t, "gzip", encoding)
+	assert.Equal(t, []string{"log1", "log2"}, received)
+	assert.Equal(t, "Logs successfully sent to LogParser", <-statusChan)
+}
+
+// TestSendLogToProcessor_APIKey checks that batches carry the configured API key, and no header without one.
+func TestSendLogToProcessor_APIKey(t *testing.T) {
+	var keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("X-API-Key"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+
+	statusChan := make(chan string, 2)
+	utils.GloablMetaData.ParserAPIKey = "s3cret"
+	SendLogToProcessor([]string{"log1"}, statusChan)
+	utils.GloablMetaData.ParserAPIKey = ""
+	SendLogToProcessor([]string{"log2"}, statusChan)
+
+	assert.Equal(t, []string{"s3cret", ""}, keys)
+}
+
 // TestSendLogToProcessor_Error tests the SendLogToProcessor function when it encounters an error
 func TestSendLogToProcessor_Error(t *testing.T) {
 
@@ -166,4 +612,289 @@ func TestSendLogToProcessor_MarshallingError(t *testing.T) {
 
 	// Verify that the marshalling error was logged
 	//mockLogger.LogError.AssertCalled(t, mock.Anything)
-}
\ No newline at end of file
+}
+
+// TestSendLogToProcessor_DeadLetter checks that batches the processor rejects are written to the
+// dead-letter file, and that replaying it resends them with their batch ids and truncates the file.
+func TestSendLogToProcessor_DeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	accept := false
+	var received [][]string
+	var ids []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !accept {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var logs []string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&logs))
+		received = append(received, logs)
+		ids = append(ids, r.Header.Get("X-Batch-ID"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+	path := t.TempDir() + "/dead-letter.jsonl"
+	utils.GloablMetaData.DLQFile = path
+	defer func() { utils.GloablMetaData.DLQFile = "" }()
+
+	statusChan := make(chan string, 4)
+	var wg sync.WaitGroup
+	for _, logs := range [][]string{{"log1", "log2"}, {"log3"}} {
+		wg.Add(1)
+		go func(logs []string) {
+			defer wg.Done()
+			SendLogToProcessor(logs, statusChan)
+		}(logs)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2, "Each rejected batch should be written on its own line")
+	var written []string
+	for _, line := range lines {
+		var batch deadLetterBatch
+		assert.NoError(t, json.Unmarshal([]byte(line), &batch))
+		assert.Len(t, batch.BatchID, 32)
+		written = append(written, batch.BatchID)
+	}
+
+	mu.Lock()
+	accept = true
+	mu.Unlock()
+	n, err := ReplayDeadLetter()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, [][]string{{"log1", "log2"}, {"log3"}}, received)
+	assert.Equal(t, written, ids, "Replayed batches should keep their ids, in order")
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+// TestReplayDeadLetter_Failure checks that a batch failing again stays in the dead-letter file with
+// the batches after it.
+func TestReplayDeadLetter_Failure(t *testing.T) {
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+	path := t.TempDir() + "/dead-letter.jsonl"
+	utils.GloablMetaData.DLQFile = path
+	defer func() { utils.GloablMetaData.DLQFile = "" }()
+
+	for _, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, writeDeadLetter(path, deadLetterBatch{BatchID: id, Logs: []string{"log-" + id}}))
+	}
+
+	n, err := ReplayDeadLetter()
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "status 503")
+	assert.Equal(t, 1, n)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"batch_id":"b","logs":["log-b"]}`+"\n"+`{"batch_id":"c","logs":["log-c"]}`+"\n", string(data))
+}
+
+// TestSendLogToProcessor_Rejected checks that a batch rejected with a 4xx other than 429 is dropped
+// instead of written to the dead-letter file, while a 429 is kept for replay.
+func TestSendLogToProcessor_Rejected(t *testing.T) {
+	status := http.StatusUnauthorized
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+	path := t.TempDir() + "/dead-letter.jsonl"
+	utils.GloablMetaData.DLQFile = path
+	defer func() { utils.GloablMetaData.DLQFile = "" }()
+
+	statusChan := make(chan string, 2)
+	SendLogToProcessor([]string{"log1"}, statusChan)
+
+	assert.Equal(t, "Failed to send logs. Status: 401", <-statusChan)
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "A rejected batch should not be dead-lettered")
+
+	status = http.StatusTooManyRequests
+	SendLogToProcessor([]string{"log2"}, statusChan)
+
+	lines, err := readDeadLetter(path)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1)
+}
+
+// TestReplayDeadLetter_Rejected checks that replay drops a batch rejected with a status that is not
+// retryable and goes on with the batches after it.
+func TestReplayDeadLetter_Rejected(t *testing.T) {
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+	path := t.TempDir() + "/dead-letter.jsonl"
+	utils.GloablMetaData.DLQFile = path
+	defer func() { utils.GloablMetaData.DLQFile = "" }()
+
+	for _, id := range []string{"a", "b"} {
+		assert.NoError(t, writeDeadLetter(path, deadLetterBatch{BatchID: id, Logs: []string{"log-" + id}}))
+	}
+
+	n, err := ReplayDeadLetter()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+// TestWaitForProcessor checks that the startup check keeps polling until the parser becomes available.
+func TestWaitForProcessor(t *testing.T) {
+	var calls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/", r.URL.Path)
+		if atomic.AddInt64(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+
+	err := WaitForProcessor(5 * time.Second)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls))
+}
+
+// TestWaitForProcessor_Timeout checks that the startup check gives up once the timeout expires.
+func TestWaitForProcessor_Timeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL + "/logs"
+
+	start := time.Now()
+	err := WaitForProcessor(500 * time.Millisecond)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not available")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// writeSeedLog writes lines to a seed log file for replay and returns its path.
+func writeSeedLog(t *testing.T, lines ...string) string {
+	path := t.TempDir() + "/access.log"
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n\n"), 0o644))
+	return path
+}
+
+func TestReplayer(t *testing.T) {
+	path := writeSeedLog(t,
+		`10.0.0.1 - - [2024-01-02T03:04:05Z] "GET /a HTTP/1.1" 200 512 "-" "curl/8.0" "-"`,
+		`10.0.0.2 - frank [02/Jan/2024:03:04:05 +0530] "POST /login HTTP/1.1" 302 0`,
+		`{"remote_addr":"10.0.0.3","time_local":"2024-01-02T03:04:05Z","request":"GET /c?a=1&b=2 HTTP/1.1","status":404}`,
+	)
+	at := time.Date(2025, time.April, 10, 12, 0, 0, 250*int(time.Millisecond), time.UTC)
+
+	replayer, err := LoadReplay(path, false)
+	assert.NoError(t, err)
+	expected := []string{
+		`10.0.0.1 - - [2025-04-10T12:00:00.250Z] "GET /a HTTP/1.1" 200 512 "-" "curl/8.0" "-"`,
+		`10.0.0.2 - frank [10/Apr/2025:17:30:00 +0530] "POST /login HTTP/1.1" 302 0`,
+		`{"remote_addr":"10.0.0.3","request":"GET /c?a=1&b=2 HTTP/1.1","status":404,"time_local":"2025-04-10T12:00:00.250Z"}`,
+	}
+	for _, want := range expected {
+		line, ok := replayer.Next(at)
+		assert.True(t, ok)
+		assert.Equal(t, want, line)
+	}
+	_, ok := replayer.Next(at)
+	assert.False(t, ok, "Replay without looping should stop after the last line")
+
+	replayer, err = LoadReplay(path, true)
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		replayer.Next(at)
+	}
+	line, ok := replayer.Next(at)
+	assert.True(t, ok)
+	assert.Equal(t, expected[1], line, "Looping replay should start over from the first line")
+
+	_, err = LoadReplay(writeSeedLog(t), false)
+	assert.Error(t, err)
+	_, err = LoadReplay(t.TempDir()+"/missing.log", false)
+	assert.Error(t, err)
+}
+
+// TestGenerateLogsConcurrently_Replay checks that in replay mode the sink receives the seed lines,
+// restamped to the time of replay, and that the rate is multiplied up to the end of the file.
+func TestGenerateLogsConcurrently_Replay(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	defer func() { replay = nil }()
+
+	seed := []string{
+		`10.0.0.1 - - [2024-01-02T03:04:05Z] "GET /a HTTP/1.1" 200 512 "-" "curl/8.0" "-"`,
+		`10.0.0.2 - - [2024-01-02T03:04:06Z] "GET /b HTTP/1.1" 500 0 "-" "curl/8.0" "-"`,
+		`10.0.0.3 - - [2024-01-02T03:04:07Z] "GET /c HTTP/1.1" 404 0 "-" "curl/8.0" "-"`,
+	}
+	var mu sync.Mutex
+	var received []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var logs []string
+		_ = json.NewDecoder(r.Body).Decode(&logs)
+		mu.Lock()
+		received = append(received, logs...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	utils.GloablMetaData.ProcessorApi = ts.URL
+	utils.GloablMetaData.ReplayFile = writeSeedLog(t, seed...)
+	utils.GloablMetaData.ReplayLoop = false
+	utils.GloablMetaData.ReplayMultiplier = 2
+	utils.GloablMetaData.TimestampMode = "now"
+
+	var counter sync.WaitGroup
+	statusChan := make(chan string, 1)
+	before := time.Now().Add(-time.Second)
+	generator := &Generator{}
+	generator.GenerateLogsConcurrently(context.Background(), 1, 50*time.Millisecond, &counter, statusChan)
+	generator.GenerateLogsConcurrently(context.Background(), 1, 50*time.Millisecond, &counter, statusChan)
+
+	// Two rounds of a rate of 1 multiplied by 2 ask for 4 lines, the second round resuming where the
+	// first stopped, but the replay ends after the 3 seed lines
+	assert.Len(t, received, 3, "Replay should stop at the end of the seed file")
+	requests := map[string]bool{}
+	for _, line := range received {
+		start, end := strings.Index(line, "["), strings.Index(line, "]")
+		stamp, err := time.Parse(time.RFC3339, line[start+1:end])
+		assert.NoError(t, err)
+		assert.True(t, stamp.After(before), "Replayed lines should be restamped to now: %s", line)
+		requests[line[strings.Index(line, `"`):]] = true
+	}
+	for _, seedLine := range seed {
+		assert.True(t, requests[seedLine[strings.Index(seedLine, `"`):]], "Seed line should be replayed: %s", seedLine)
+	}
+}
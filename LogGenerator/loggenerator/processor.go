@@ -4,10 +4,14 @@ import (
 	"LogGenerator/logger"
 	"LogGenerator/utils"
 	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	_ "log"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -21,11 +25,15 @@ import (
 // The function does the following:
 //   1. Marshals the logs into a JSON format.
 //   2. Creates a new HTTP client with a timeout of 10 seconds.
-//   3. Sends an HTTP POST request to the log processor API, including the marshaled logs in the body.
+//   3. Sends an HTTP POST request to the log processor API, including the marshaled logs in the body
+//      and a unique batch id in the X-Batch-ID header, so the processor can recognize a resent batch.
 //   4. Handles potential errors, logs the results, and prints success/failure messages based on the HTTP response.
 //
 // If the request is successful (HTTP status 200 OK), it logs a success message.
 // If there's any error (either in marshalling or the HTTP request), it logs the error details.
+// A batch the processor could not take, because it was unreachable or answered with a 5xx or 429,
+// is appended to the dead-letter file, when one is configured, so that ReplayDeadLetter can resend
+// it. A batch rejected with another status would be rejected again and is dropped.
 //
 // Example usage:
 //   logs := []string{"log1", "log2", "log3"}
@@ -43,23 +51,20 @@ func SendLogToProcessor(logs []string, statusChan chan<- string) {
 		return
 	}
 
-	client := &http.Client{
-		Timeout: 10 * time.Second, 
-	}
-
-	resp, err := client.Post(utils.GloablMetaData.ProcessorApi, "application/json", bytes.NewBuffer(logJson))
+	batchID := newBatchID()
+	status, err := postBatch(logJson, batchID)
 	if err != nil {
 		msg := fmt.Sprintf("Error sending logs to processor: %v", err)
 		logger.LogError(msg)
+		deadLetter(batchID, logs)
 		select {
 		case statusChan <- msg:
 		default:
 		}
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusOK {
+	if status == http.StatusOK {
 		msg := "Logs successfully sent to LogParser"
 		logger.LogInfo(msg)
 		select {
@@ -67,11 +72,123 @@ func SendLogToProcessor(logs []string, statusChan chan<- string) {
 		default:
 		}
 	} else {
-		msg := fmt.Sprintf("Failed to send logs. Status: %d", resp.StatusCode)
-		logger.LogWarn(msg)
+		msg := fmt.Sprintf("Failed to send logs. Status: %d", status)
+		if retryable(status) {
+			logger.LogWarn(msg)
+			deadLetter(batchID, logs)
+		} else {
+			logger.LogError(fmt.Sprintf("Batch %s of %d logs rejected by LogParser and dropped. Status: %d", batchID, len(logs), status))
+		}
 		select {
 		case statusChan <- msg:
 		default:
 		}
 	}
-}
\ No newline at end of file
+}
+
+// postBatch posts a JSON batch of logs to the processor API under batchID, gzip-compressed when
+// GENERATOR_GZIP is set and with the PARSER_API_KEY when one is configured, and returns the status
+// the processor answered with.
+func postBatch(logJson []byte, batchID string) (int, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	body := logJson
+	if utils.GloablMetaData.Gzip {
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		if _, err := gzipWriter.Write(logJson); err != nil {
+			return 0, fmt.Errorf("error compressing batch: %v", err)
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return 0, fmt.Errorf("error compressing batch: %v", err)
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, utils.GloablMetaData.ProcessorApi, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if utils.GloablMetaData.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set(batchIDHeader, batchID)
+	if key := utils.GloablMetaData.ParserAPIKey; key != "" {
+		req.Header.Set(apiKeyHeader, key)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether a batch the processor answered with status may be accepted when it is
+// resent: server errors and 429 are, while other rejections, such as a bad key or a malformed
+// batch, would be repeated.
+func retryable(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// batchIDHeader is the header carrying the id of a batch of logs sent to the processor.
+const batchIDHeader = "X-Batch-ID"
+
+// apiKeyHeader is the header carrying the API key the processor requires of the batches posted to it.
+const apiKeyHeader = "X-API-Key"
+
+// newBatchID returns a random id for a batch of logs.
+func newBatchID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// WaitForProcessor polls the log processor's health endpoint (the root of ProcessorApi) until it
+// answers 200 OK, backing off between attempts. It returns an error if the processor is still
+// unreachable when timeout expires.
+//
+// Example usage:
+//   if err := WaitForProcessor(30 * time.Second); err != nil {
+//       logger.LogWarn(err)
+//   }
+func WaitForProcessor(timeout time.Duration) error {
+	aliveUrl, err := url.Parse(utils.GloablMetaData.ProcessorApi)
+	if err != nil {
+		return fmt.Errorf("invalid processor API %q: %v", utils.GloablMetaData.ProcessorApi, err)
+	}
+	aliveUrl.Path = "/"
+	aliveUrl.RawQuery = ""
+
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+	deadline := time.Now().Add(timeout)
+	backoff := 100 * time.Millisecond
+	for {
+		resp, err := client.Get(aliveUrl.String())
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				logger.LogInfo(fmt.Sprintf("Log processor at %s is available", aliveUrl))
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("log processor at %s not available after %v: %v", aliveUrl, timeout, err)
+		}
+		logger.LogDebug(fmt.Sprintf("Log processor at %s not available yet (%v), retrying in %v", aliveUrl, err, backoff))
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > 5*time.Second {
+			backoff = 5 * time.Second
+		}
+	}
+}
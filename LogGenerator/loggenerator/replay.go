@@ -0,0 +1,132 @@
+package loggenerator
+
+import (
+	"LogGenerator/utils"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Replayer hands out the lines of a captured access log in order, restamped with the time they are
+// replayed at, so generated traffic keeps the distributions of real traffic.
+type Replayer struct {
+	mu    sync.Mutex
+	path  string
+	loop  bool
+	lines []string
+	next  int
+}
+
+// LoadReplay reads the seed log at path; blank lines are skipped. When loop is set, replay starts
+// over from the first line once the last one was handed out.
+func LoadReplay(path string, loop bool) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening replay file: %v", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxBatchSizeBytes)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading replay file: %v", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("replay file %s has no log lines", path)
+	}
+	return &Replayer{path: path, loop: loop, lines: lines}, nil
+}
+
+// Next returns the next seed line with its timestamp rewritten to t. It reports false once every
+// line was replayed and the replayer does not loop.
+func (rp *Replayer) Next(t time.Time) (string, bool) {
+	rp.mu.Lock()
+	if rp.next == len(rp.lines) {
+		if !rp.loop {
+			rp.mu.Unlock()
+			return "", false
+		}
+		rp.next = 0
+	}
+	line := rp.lines[rp.next]
+	rp.next++
+	rp.mu.Unlock()
+
+	return restamp(line, t), true
+}
+
+// restamp rewrites the timestamp of a log line to t, keeping its format: the bracketed RFC3339 or
+// $time_local timestamp of access log lines, or the time_local field of JSON lines. Lines without a
+// timestamp the parser would understand are returned unchanged.
+func restamp(line string, t time.Time) string {
+	if strings.HasPrefix(line, "{") {
+		var object map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return line
+		}
+		if _, ok := object["time_local"]; !ok {
+			return line
+		}
+		object["time_local"] = t.UTC().Format(timestampLayout)
+		var restamped bytes.Buffer
+		encoder := json.NewEncoder(&restamped)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(object); err != nil {
+			return line
+		}
+		return strings.TrimSuffix(restamped.String(), "\n")
+	}
+
+	start := strings.Index(line, "[")
+	end := strings.Index(line, "]")
+	if start < 0 || end < start {
+		return line
+	}
+	original := line[start+1 : end]
+	var stamp string
+	if _, err := time.Parse(time.RFC3339, original); err == nil {
+		stamp = t.UTC().Format(timestampLayout)
+	} else if seeded, err := time.Parse(clfTimestampLayout, original); err == nil {
+		stamp = t.In(seeded.Location()).Format(clfTimestampLayout)
+	} else {
+		return line
+	}
+	return line[:start+1] + stamp + line[end:]
+}
+
+var replayMu sync.Mutex
+var replay *Replayer
+
+// currentReplay returns the replayer of the configured seed file, or nil when replay is off. The file
+// is read once and replay resumes where the previous round stopped; it is only read again when the
+// file or the looping setting changes.
+func currentReplay() (*Replayer, error) {
+	path, loop := utils.GloablMetaData.ReplayFile, utils.GloablMetaData.ReplayLoop
+	if path == "" {
+		return nil, nil
+	}
+
+	replayMu.Lock()
+	defer replayMu.Unlock()
+	if replay == nil || replay.path != path || replay.loop != loop {
+		loaded, err := LoadReplay(path, loop)
+		if err != nil {
+			return nil, err
+		}
+		replay = loaded
+	}
+	return replay, nil
+}
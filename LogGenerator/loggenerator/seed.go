@@ -0,0 +1,34 @@
+package loggenerator
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// rnd is the source every generated log draws its fields from, guarded by rndMu as *rand.Rand
+	// is not safe for concurrent use.
+	rnd   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	rndMu sync.Mutex
+)
+
+// SeedGenerator reseeds the source generated logs are drawn from, so that the same seed always
+// yields the same sequence of logs. Logs generated concurrently draw from the source in the order
+// the workers reach it, so only a single worker's sequence is reproducible.
+//
+// Example usage:
+//   SeedGenerator(42)
+//   logEntry := GenerateLogAt(time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC))
+func SeedGenerator(seed int64) {
+	rndMu.Lock()
+	defer rndMu.Unlock()
+	rnd = rand.New(rand.NewSource(seed))
+}
+
+// withRand runs f with the shared source, holding its lock.
+func withRand[T any](f func(rnd *rand.Rand) T) T {
+	rndMu.Lock()
+	defer rndMu.Unlock()
+	return f(rnd)
+}
@@ -0,0 +1,67 @@
+package loggenerator
+
+import (
+	"LogGenerator/models"
+	"math/rand"
+	"sort"
+)
+
+// pickService picks one of services with probability proportional to its rate.
+func pickService(rnd *rand.Rand, services []models.ServiceProfile) *models.ServiceProfile {
+	total := 0
+	for _, service := range services {
+		total += service.Rate
+	}
+	n := rnd.Intn(total)
+	for i := range services {
+		if n < services[i].Rate {
+			return &services[i]
+		}
+		n -= services[i].Rate
+	}
+	return &services[len(services)-1]
+}
+
+// pickStatus picks a status code with probability proportional to its weight. The codes are walked
+// in ascending order so that a seeded rnd always yields the same sequence.
+func pickStatus(rnd *rand.Rand, weights map[int]int) int {
+	statuses := make([]int, 0, len(weights))
+	total := 0
+	for status, weight := range weights {
+		statuses = append(statuses, status)
+		total += weight
+	}
+	sort.Ints(statuses)
+
+	n := rnd.Intn(total)
+	for _, status := range statuses {
+		if n < weights[status] {
+			return status
+		}
+		n -= weights[status]
+	}
+	return statuses[len(statuses)-1]
+}
+
+// pickWeighted picks a status code with probability proportional to its weight, by walking the
+// cumulative weights in ascending order of code so that a seeded rnd always yields the same sequence.
+func pickWeighted(rnd *rand.Rand, weights map[int]float64) int {
+	statuses := make([]int, 0, len(weights))
+	total := 0.0
+	for status, weight := range weights {
+		statuses = append(statuses, status)
+		total += weight
+	}
+	sort.Ints(statuses)
+
+	n := rnd.Float64() * total
+	cumulative := 0.0
+	for _, status := range statuses {
+		cumulative += weights[status]
+		if n < cumulative {
+			return status
+		}
+	}
+	// Rounding can leave n just past the last cumulative weight
+	return statuses[len(statuses)-1]
+}
@@ -35,6 +35,77 @@ type AllConfigModel struct {
 	// Common units include "second", "minute", "hour", etc.
 	KEY_UNIT string `yaml:"KEY_UNIT"`
 
+	// KEY_PARSER_CHECK selects what happens when the parser is unreachable at startup:
+	// "off" skips the check, "warn" logs a warning and continues, "fail" aborts startup.
+	KEY_PARSER_CHECK string `yaml:"KEY_PARSER_CHECK,omitempty"`
+
+	// KEY_PARSER_CHECK_TIMEOUT is how long, in seconds, the startup check waits for the parser.
+	KEY_PARSER_CHECK_TIMEOUT int `yaml:"KEY_PARSER_CHECK_TIMEOUT,omitempty"`
+
+	// KEY_MAX_CONCURRENT_ROUNDS is how many generation rounds may overlap when a round
+	// takes longer than the generation interval.
+	KEY_MAX_CONCURRENT_ROUNDS int `yaml:"KEY_MAX_CONCURRENT_ROUNDS,omitempty"`
+
+	// KEY_TIMESTAMP_MODE selects how generated logs are timestamped: "now" stamps each log when it
+	// is generated, "even" and "poisson" spread the timestamps across the generation interval.
+	KEY_TIMESTAMP_MODE string `yaml:"KEY_TIMESTAMP_MODE,omitempty"`
+
+	// KEY_LOG_FORMAT selects the format of generated logs: "rfc3339" brackets an RFC3339 timestamp and
+	// appends $http_x_forwarded_for, "combined" and "common" are the Nginx/Apache access log formats and
+	// "json" emits JSON objects with the fields of the parser's Log model.
+	KEY_LOG_FORMAT string `yaml:"KEY_LOG_FORMAT,omitempty"`
+
+	// KEY_REPLAY_FILE is the path of a captured access log replayed line by line, restamped to the
+	// time of replay, instead of generating synthetic logs. Replay is off when it is empty.
+	KEY_REPLAY_FILE string `yaml:"KEY_REPLAY_FILE,omitempty"`
+
+	// KEY_REPLAY_LOOP starts the replay over from the first line once the file was replayed in full.
+	KEY_REPLAY_LOOP bool `yaml:"KEY_REPLAY_LOOP,omitempty"`
+
+	// KEY_REPLAY_MULTIPLIER multiplies the rate while replaying, to replay a capture at scale.
+	KEY_REPLAY_MULTIPLIER int `yaml:"KEY_REPLAY_MULTIPLIER,omitempty"`
+
+	// KEY_SEED seeds the generator's random source so that every run generates the same sequence of
+	// logs. The source is seeded from the clock when it is 0.
+	KEY_SEED int64 `yaml:"KEY_SEED,omitempty"`
+
+	// KEY_RAMP selects how generation warms up to its rate: "off" starts at the full rate, "linear" and
+	// "exponential" grow from zero to the rate over KEY_RAMP_DURATION.
+	KEY_RAMP string `yaml:"KEY_RAMP,omitempty"`
+
+	// KEY_RAMP_DURATION is how long, in seconds, generation takes to ramp up to its rate.
+	KEY_RAMP_DURATION int `yaml:"KEY_RAMP_DURATION,omitempty"`
+
+	// KEY_POOLS overrides the pools of IPs, methods, URLs, statuses, user agents and referrers logs are
+	// drawn from; each pool left out keeps its built-in values.
+	KEY_POOLS Pools `yaml:"KEY_POOLS,omitempty"`
+
+	// KEY_WEIGHTED_STATUSES gives each status code its probability of being generated, e.g. 200 at 0.9
+	// and 500 at 0.1, instead of drawing uniformly from the statuses pool.
+	KEY_WEIGHTED_STATUSES map[int]float64 `yaml:"KEY_WEIGHTED_STATUSES,omitempty"`
+
+	// KEY_SERVICES lists the service profiles generated traffic is spread over, each with its
+	// own paths, status weights and share of the rate.
+	KEY_SERVICES []ServiceProfile `yaml:"KEY_SERVICES,omitempty"`
+
+	// KEY_SERVICE_TAG appends the service name to each generated log as a trailing quoted field.
+	KEY_SERVICE_TAG bool `yaml:"KEY_SERVICE_TAG,omitempty"`
+
+	// KEY_SHUTDOWN_TIMEOUT is how long, in seconds, in-flight requests get to finish on shutdown.
+	KEY_SHUTDOWN_TIMEOUT int `yaml:"KEY_SHUTDOWN_TIMEOUT,omitempty"`
+
+	// KEY_DLQ_FILE is the path of the dead-letter file batches the parser did not accept are appended
+	// to, one JSON batch per line, until they are replayed. Undeliverable batches are dropped when it is empty.
+	KEY_DLQ_FILE string `yaml:"KEY_DLQ_FILE,omitempty"`
+
+	// KEY_GZIP gzip-compresses the batches sent to the parser, which shrinks the large batches of
+	// high-rate generation at the cost of some CPU on both sides.
+	KEY_GZIP bool `yaml:"KEY_GZIP,omitempty"`
+
+	// KEY_PARSER_API_KEY is the API key sent with every batch in the X-API-Key header. No key is sent
+	// when it is empty.
+	KEY_PARSER_API_KEY string `yaml:"KEY_PARSER_API_KEY,omitempty"`
+
 	// CurrentService holds the configuration for the log generation service.
 	// This includes the URL endpoints and port number where the service is running.
 	CurrentService struct {
@@ -27,4 +27,56 @@ type GlobalConstantvariables struct {
 	IsAliveUrl  string `yaml:"KEY_ALIVE_URL"`    // The URL path for checking if the service is alive.
 	GenerateUrl string `yaml:"KEY_START_URL"`    // The URL path to trigger log generation.
 	ProcessorApi string `yaml:"KEY_PARSER_API"`   // The API endpoint to which logs are sent for processing.
+	ParserCheck string `yaml:"KEY_PARSER_CHECK,omitempty"`  // Startup check of the parser: "off", "warn" or "fail".
+	ParserCheckTimeout int `yaml:"KEY_PARSER_CHECK_TIMEOUT,omitempty"` // Seconds the startup check waits for the parser.
+	MaxConcurrentRounds int `yaml:"KEY_MAX_CONCURRENT_ROUNDS,omitempty"` // Generation rounds allowed to run at once.
+	TimestampMode string `yaml:"KEY_TIMESTAMP_MODE,omitempty"` // Timestamping of generated logs: "now", "even" or "poisson".
+	LogFormat string `yaml:"KEY_LOG_FORMAT,omitempty"` // Format of generated logs: "rfc3339", "combined", "common" or "json".
+	ReplayFile string `yaml:"KEY_REPLAY_FILE,omitempty"` // Captured access log replayed instead of generating logs; off when empty.
+	ReplayLoop bool `yaml:"KEY_REPLAY_LOOP,omitempty"` // Whether the replay starts over once the file was replayed in full.
+	ReplayMultiplier int `yaml:"KEY_REPLAY_MULTIPLIER,omitempty"` // Factor applied to the rate while replaying.
+	Seed int64 `yaml:"KEY_SEED,omitempty"` // Seed of the generator's random source; 0 seeds from the clock.
+	Ramp string `yaml:"KEY_RAMP,omitempty"` // Warm-up of generation to its rate: "off", "linear" or "exponential".
+	RampDuration int `yaml:"KEY_RAMP_DURATION,omitempty"` // Seconds generation takes to ramp up to its rate.
+	WeightedStatuses map[int]float64 `yaml:"KEY_WEIGHTED_STATUSES,omitempty"` // Probability of each generated status; uniform over the statuses pool when empty.
+	Services []ServiceProfile `yaml:"KEY_SERVICES,omitempty"` // Service profiles the logs are spread over; a single flat pool when empty.
+	ServiceTag bool `yaml:"KEY_SERVICE_TAG,omitempty"` // Whether each log ends with the name of the service it was generated for.
+	ShutdownTimeout int `yaml:"KEY_SHUTDOWN_TIMEOUT,omitempty"` // Seconds in-flight requests get to finish on shutdown.
+	DLQFile string `yaml:"KEY_DLQ_FILE,omitempty"` // Dead-letter file undeliverable batches are appended to; off when empty.
+	Gzip bool `yaml:"KEY_GZIP,omitempty"` // Whether batches are gzip-compressed before they are sent to the parser.
+	ParserAPIKey string `yaml:"KEY_PARSER_API_KEY,omitempty"` // API key sent to the parser in X-API-Key; none when empty.
+}
+
+// ServiceProfile describes one service whose traffic the generator simulates. When profiles are
+// configured, each log is attributed to a service picked in proportion to its Rate, and takes its
+// path and status from that service.
+//
+// Example YAML configuration:
+//   KEY_SERVICES:
+//     - name: "api.example.com"
+//       paths: ["/v1/orders", "/v1/users"]
+//       status_weights: {200: 90, 404: 5, 500: 5}
+//       rate: 3
+type ServiceProfile struct {
+	Name          string      `yaml:"name"`           // The service label, used as its server name when tagging logs.
+	Paths         []string    `yaml:"paths"`          // The request paths the service serves.
+	StatusWeights map[int]int `yaml:"status_weights,omitempty"` // Relative weight of each status code; uniform over the default statuses when empty.
+	Rate          int         `yaml:"rate"`           // The service's share of the generated logs, relative to the other services.
+}
+
+// Pools overrides the built-in pools log fields are drawn from. A pool left empty keeps its
+// built-in values.
+//
+// Example YAML configuration:
+//   KEY_POOLS:
+//     ips: ["203.0.113.7", "198.51.100.23"]
+//     urls: ["/api/orders", "/api/cart"]
+//     statuses: [200, 200, 200, 503]
+type Pools struct {
+	Ips        []string `yaml:"ips,omitempty"`         // Client addresses logged as $remote_addr.
+	Methods    []string `yaml:"methods,omitempty"`     // HTTP methods of the requests.
+	Urls       []string `yaml:"urls,omitempty"`        // Request paths, when no service profiles are configured.
+	Statuses   []int    `yaml:"statuses,omitempty"`    // Response statuses; repeat a status to make it more frequent.
+	UserAgents []string `yaml:"user_agents,omitempty"` // User-Agent headers.
+	Referrers  []string `yaml:"referrers,omitempty"`   // Referer headers, "-" for none.
 }
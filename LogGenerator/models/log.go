@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// LogEntry holds the fields of one generated log. It is rendered as an access log line, or marshalled
+// as is when the JSON log format is selected; its json tags match the fields of the parser's Log model.
+//
+// Example JSON line:
+//
+//	{"remote_addr":"192.168.1.1","remote_user":"-","time_local":"2025-04-10T12:00:00.25Z",
+//	 "request":"GET /home HTTP/1.1","status":200,"body_bytes_sent":520,"http_referer":"https://example.com",
+//	 "http_user_agent":"Mozilla/5.0","http_x_forwarded_for":"127.0.0.1"}
+type LogEntry struct {
+	RemoteAddr        string    `json:"remote_addr"`           // The client IP address.
+	RemoteUser        string    `json:"remote_user"`           // The authenticated user, "-" when there is none.
+	TimeLocal         time.Time `json:"time_local"`            // The time of the request.
+	Request           string    `json:"request"`               // The request line, e.g. "GET /home HTTP/1.1".
+	Status            int       `json:"status"`                // The response status code.
+	BodyBytesSent     int       `json:"body_bytes_sent"`       // The size of the response body in bytes.
+	HttpReferer       string    `json:"http_referer"`          // The Referer header.
+	HttpUserAgent     string    `json:"http_user_agent"`       // The User-Agent header.
+	HttpXForwardedFor string    `json:"http_x_forwarded_for"`  // The X-Forwarded-For header.
+	ServerName        string    `json:"server_name,omitempty"` // The service the log was generated for, when tagged.
+}
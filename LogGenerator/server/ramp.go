@@ -0,0 +1,35 @@
+package server
+
+import (
+	"math"
+	"time"
+)
+
+// rampSteepness shapes the exponential ramp: the higher it is, the longer the rate stays low before
+// climbing to the target.
+const rampSteepness = 5.0
+
+// rampedRate returns the number of logs a round started elapsed into a generation task produces while
+// the generator warms up to rate over warmup. Every round produces at least one log, so the caller of
+// POST /logs always hears back from the first round.
+//
+// Modes:
+//   - "linear": the rate grows in proportion to the time elapsed.
+//   - "exponential": the rate grows as (e^(k*f) - 1) / (e^k - 1) of the target, f being the fraction
+//     of warmup elapsed, starting slowly and climbing steeply towards the end.
+//   - anything else ("off", the default): the full rate from the first round.
+func rampedRate(mode string, rate int, elapsed time.Duration, warmup time.Duration) int {
+	if warmup <= 0 || elapsed >= warmup || (mode != "linear" && mode != "exponential") {
+		return rate
+	}
+
+	fraction := float64(elapsed) / float64(warmup)
+	if mode == "exponential" {
+		fraction = math.Expm1(rampSteepness*fraction) / math.Expm1(rampSteepness)
+	}
+	ramped := int(math.Ceil(float64(rate) * fraction))
+	if ramped < 1 {
+		return 1
+	}
+	return ramped
+}
@@ -139,18 +139,26 @@ func (s *ServerHandler) StopHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mu.Lock()
-	if cancelFunc != nil {
-		cancelFunc()
-		cancelFunc = nil
-		mu.Unlock()
+	if StopGeneration() {
 		s.ResponseW.SendResponse(w, http.StatusOK, true, "Log generation stopped", nil)
 		return
 	}
-	mu.Unlock()
 	s.ResponseW.SendResponse(w, http.StatusOK, true, "No active log generation task", nil)
 }
 
+// StopGeneration cancels the running log generation task, if any, and reports whether there was one.
+// It is used by StopHandler and on shutdown.
+func StopGeneration() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if cancelFunc == nil {
+		return false
+	}
+	cancelFunc()
+	cancelFunc = nil
+	return true
+}
+
 // StatusHandler handles the "GET /logs/status" endpoint to report if generation is active.
 func (s *ServerHandler) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -175,15 +183,18 @@ func (s *ServerHandler) StatusHandler(w http.ResponseWriter, r *http.Request) {
 //   - unitStr: The unit of time for the task's duration (either "s", "m", or "h").
 //   - duration: The duration between each log generation task. It is calculated based on the unit provided.
 //
-// It starts a background task to generate logs and cancels the previous task if it's still running.
+// A new round starts on every tick as long as fewer than MaxConcurrentRounds rounds are running.
+// When a round overruns the interval, the tick is held back and the next round starts as soon as a
+// running one completes; further ticks missed meanwhile are dropped, so rounds never pile up.
+//
+// With a ramp configured, rounds started within the ramp duration produce fewer logs than rate, growing
+// to it as the task warms up, see rampedRate.
 func (s *ServerHandler) startLogGenerationTask(rate int, unitStr string, duration time.Duration, statusChan chan<- string) {
 	cntx, cancel := context.WithCancel(context.Background())
 	mu.Lock()
 	cancelFunc = cancel
 	mu.Unlock()
 
-	var wg sync.WaitGroup
-	ticker := time.NewTicker(duration)
 	if rate <= 0 {
 		msg := fmt.Sprintf("numLogs is zero or negative, skipping the generate")
 		logger.LogError(msg)
@@ -194,28 +205,56 @@ func (s *ServerHandler) startLogGenerationTask(rate int, unitStr string, duratio
 		cntx.Done()
 		return
 	}
-	go s.LogGen.GenerateLogsConcurrently(cntx, rate, duration, &wg, statusChan)
+
+	maxRounds := utils.GloablMetaData.MaxConcurrentRounds
+	if maxRounds < 1 {
+		maxRounds = 1
+	}
+	roundDone := make(chan struct{}, maxRounds)
+	running := 0
+	pending := false
+	started := time.Now()
+	ramp := utils.GloablMetaData.Ramp
+	warmup := time.Duration(utils.GloablMetaData.RampDuration) * time.Second
+	startRound := func() {
+		running++
+		numLogs := rampedRate(ramp, rate, time.Since(started), warmup)
+		go func() {
+			var wg sync.WaitGroup
+			s.LogGen.GenerateLogsConcurrently(cntx, numLogs, duration, &wg, statusChan)
+			roundDone <- struct{}{}
+		}()
+	}
+
+	ticker := time.NewTicker(duration)
+	defer ticker.Stop()
+	startRound()
 
 	for {
 		select {
 		case <-ticker.C:
-			mu.Lock()
-			if cancelFunc != nil {
-				cancelFunc()
+			if running < maxRounds {
+				startRound()
+			} else if !pending {
+				pending = true
+				logger.LogWarn(fmt.Sprintf("Generation round overran the %v interval, next round starts when one completes", duration))
+			} else {
+				logger.LogWarn("Generation rounds are behind schedule, dropping a tick")
 			}
-			cntx, cancel = context.WithCancel(context.Background())
-			cancelFunc = cancel
-			mu.Unlock()
 
-			wg.Add(1)
-			go s.LogGen.GenerateLogsConcurrently(cntx, rate, duration, &wg, statusChan)
+		case <-roundDone:
+			running--
+			if pending {
+				pending = false
+				startRound()
+			}
 
 		case <-cntx.Done():
+			for ; running > 0; running-- {
+				<-roundDone
+			}
 			logger.LogWarn("Stopped externally")
 			return
 		}
 	}
-
-	// Optionally, you can wait for the tasks to complete if needed
-	// wg.Wait()
 }
@@ -6,10 +6,16 @@ import (
 	"LogGenerator/models"
 	"LogGenerator/utils"
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
  var yaml = []byte(`
@@ -182,4 +188,151 @@ func TestLogTestHandler_InvalidUnit(t *testing.T) {
 	if rr.Body.String() != expected {
 		t.Errorf("Expected response body %v, but got %v", expected, rr.Body.String())
 	}
-}
\ No newline at end of file
+}
+
+// slowGenerator simulates generation rounds that take longer than the generation interval.
+type slowGenerator struct {
+	roundTime time.Duration
+	running   int64
+	peak      int64
+	started   int64
+}
+
+func (g *slowGenerator) GenerateLogsConcurrently(ctx context.Context, numLogs int, duration time.Duration, counter *sync.WaitGroup, statusChan chan<- string) {
+	atomic.AddInt64(&g.started, 1)
+	running := atomic.AddInt64(&g.running, 1)
+	for {
+		peak := atomic.LoadInt64(&g.peak)
+		if running <= peak || atomic.CompareAndSwapInt64(&g.peak, peak, running) {
+			break
+		}
+	}
+	defer atomic.AddInt64(&g.running, -1)
+
+	select {
+	case <-time.After(g.roundTime):
+	case <-ctx.Done():
+	}
+}
+
+func runGenerationTask(t *testing.T, gen *slowGenerator, maxRounds int, interval time.Duration, runFor time.Duration) {
+	defer func(rounds int) { utils.GloablMetaData.MaxConcurrentRounds = rounds }(utils.GloablMetaData.MaxConcurrentRounds)
+	utils.GloablMetaData.MaxConcurrentRounds = maxRounds
+
+	handler := &ServerHandler{ResponseW: &utils.ResponseHandler{}, LogGen: gen}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.startLogGenerationTask(1, "s", interval, make(chan string, 1))
+	}()
+
+	time.Sleep(runFor)
+	mu.Lock()
+	cancelFunc()
+	cancelFunc = nil
+	mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("generation task did not stop")
+	}
+	assert.Equal(t, int64(0), atomic.LoadInt64(&gen.running), "all rounds should have finished when the task stops")
+}
+
+// TestStartLogGenerationTask_NoOverlap checks that rounds slower than the interval run one at a time
+// and that the number of rounds is bounded by the round time, not by the number of ticks.
+func TestStartLogGenerationTask_NoOverlap(t *testing.T) {
+	logger.InitializeLogger("error")
+	gen := &slowGenerator{roundTime: 100 * time.Millisecond}
+
+	runGenerationTask(t, gen, 1, 20*time.Millisecond, 450*time.Millisecond)
+
+	assert.Equal(t, int64(1), atomic.LoadInt64(&gen.peak))
+	started := atomic.LoadInt64(&gen.started)
+	assert.GreaterOrEqual(t, started, int64(3))
+	assert.LessOrEqual(t, started, int64(6))
+}
+
+// TestStartLogGenerationTask_BoundedOverlap checks that overlap never exceeds the configured concurrency.
+func TestStartLogGenerationTask_BoundedOverlap(t *testing.T) {
+	logger.InitializeLogger("error")
+	gen := &slowGenerator{roundTime: 100 * time.Millisecond}
+
+	runGenerationTask(t, gen, 2, 20*time.Millisecond, 450*time.Millisecond)
+
+	assert.Equal(t, int64(2), atomic.LoadInt64(&gen.peak))
+	assert.LessOrEqual(t, atomic.LoadInt64(&gen.started), int64(10))
+}
+
+// recordingGenerator records the number of logs of every generation round.
+type recordingGenerator struct {
+	mu     sync.Mutex
+	rounds []int
+}
+
+func (g *recordingGenerator) GenerateLogsConcurrently(ctx context.Context, numLogs int, duration time.Duration, counter *sync.WaitGroup, statusChan chan<- string) {
+	g.mu.Lock()
+	g.rounds = append(g.rounds, numLogs)
+	g.mu.Unlock()
+}
+
+// TestStartLogGenerationTask_Ramp checks that the logs of each round grow over the ramp before holding at the rate.
+func TestStartLogGenerationTask_Ramp(t *testing.T) {
+	logger.InitializeLogger("error")
+	defer func(meta models.GlobalConstantvariables) { utils.GloablMetaData = meta }(utils.GloablMetaData)
+	utils.GloablMetaData.Ramp = "linear"
+	utils.GloablMetaData.RampDuration = 1
+	utils.GloablMetaData.MaxConcurrentRounds = 1
+
+	gen := &recordingGenerator{}
+	handler := &ServerHandler{ResponseW: &utils.ResponseHandler{}, LogGen: gen}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.startLogGenerationTask(100, "s", 50*time.Millisecond, make(chan string, 1))
+	}()
+
+	time.Sleep(1300 * time.Millisecond)
+	mu.Lock()
+	cancelFunc()
+	cancelFunc = nil
+	mu.Unlock()
+	<-done
+
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	rounds := gen.rounds
+	if !assert.Greater(t, len(rounds), 10) {
+		return
+	}
+	assert.Less(t, rounds[0], 10, "the first round should start near zero")
+	for i := 1; i < len(rounds); i++ {
+		assert.GreaterOrEqual(t, rounds[i], rounds[i-1], "rounds should never shrink during the ramp")
+	}
+	assert.Less(t, rounds[len(rounds)/3], 100, "the rate should still be ramping a third of the way in")
+	assert.Equal(t, 100, rounds[len(rounds)-1], "the rate should be reached after the ramp")
+}
+
+func TestRampedRate(t *testing.T) {
+	warmup := 10 * time.Second
+	for _, mode := range []string{"linear", "exponential"} {
+		previous := 0
+		for elapsed := time.Duration(0); elapsed < warmup; elapsed += time.Second {
+			rate := rampedRate(mode, 1000, elapsed, warmup)
+			assert.GreaterOrEqual(t, rate, 1, "%s: every round should produce a log", mode)
+			assert.Less(t, rate, 1000, "%s: the rate should not be reached before the end of the ramp", mode)
+			assert.Greater(t, rate, previous, "%s: the rate should grow over the ramp", mode)
+			previous = rate
+		}
+		assert.Equal(t, 1000, rampedRate(mode, 1000, warmup, warmup), mode)
+		assert.Equal(t, 1000, rampedRate(mode, 1000, time.Hour, warmup), mode)
+	}
+
+	assert.Equal(t, 500, rampedRate("linear", 1000, 5*time.Second, warmup))
+	assert.Less(t, rampedRate("exponential", 1000, 5*time.Second, warmup), 100, "the exponential ramp should start slowly")
+
+	// No ramp
+	assert.Equal(t, 1000, rampedRate("off", 1000, 0, warmup))
+	assert.Equal(t, 1000, rampedRate("linear", 1000, 0, 0))
+}
@@ -36,6 +36,91 @@ const (
 	// The valid values are "s" for seconds, "m" for minutes, and "h" for hours.
 	// Example: "GENERATOR_UNIT=s"
 	KEY_UNIT string = "GENERATOR_UNIT"
+
+	// KEY_PARSER_CHECK represents the environment variable key for the startup check of the parser.
+	// The valid values are "off" (skip the check), "warn" (wait, then log a warning and continue)
+	// and "fail" (wait, then abort startup).
+	// Example: "PARSER_CHECK=fail"
+	KEY_PARSER_CHECK string = "PARSER_CHECK"
+
+	// KEY_PARSER_CHECK_TIMEOUT represents the environment variable key for how long, in seconds,
+	// the startup check waits for the parser to become reachable.
+	// Example: "PARSER_CHECK_TIMEOUT=30"
+	KEY_PARSER_CHECK_TIMEOUT string = "PARSER_CHECK_TIMEOUT"
+
+	// KEY_MAX_CONCURRENT_ROUNDS represents the environment variable key for how many generation
+	// rounds may run at once when a round takes longer than the generation interval.
+	// Example: "GENERATOR_MAX_CONCURRENT_ROUNDS=1"
+	KEY_MAX_CONCURRENT_ROUNDS string = "GENERATOR_MAX_CONCURRENT_ROUNDS"
+
+	// KEY_TIMESTAMP_MODE represents the environment variable key for how generated logs are timestamped.
+	// The valid values are "now" (time of generation), "even" (spread evenly across the interval)
+	// and "poisson" (Poisson arrivals across the interval).
+	// Example: "GENERATOR_TIMESTAMP_MODE=poisson"
+	KEY_TIMESTAMP_MODE string = "GENERATOR_TIMESTAMP_MODE"
+
+	// KEY_LOG_FORMAT represents the environment variable key for the format of generated logs.
+	// The valid values are "rfc3339" (RFC3339 timestamp, with $http_x_forwarded_for appended),
+	// "combined" (Nginx/Apache combined format), "common" (Common Log Format) and "json" (one JSON
+	// object per log, with the field names of the parser's Log model).
+	// Example: "GENERATOR_LOG_FORMAT=combined"
+	KEY_LOG_FORMAT string = "GENERATOR_LOG_FORMAT"
+
+	// KEY_REPLAY_FILE represents the environment variable key for the path of a captured access log to
+	// replay instead of generating synthetic logs. Each line is restamped to the time it is replayed at.
+	// Example: "GENERATOR_REPLAY_FILE=/data/access.log"
+	KEY_REPLAY_FILE string = "GENERATOR_REPLAY_FILE"
+
+	// KEY_REPLAY_LOOP represents the environment variable key for whether the replay starts over once
+	// the file was replayed in full.
+	// Example: "GENERATOR_REPLAY_LOOP=true"
+	KEY_REPLAY_LOOP string = "GENERATOR_REPLAY_LOOP"
+
+	// KEY_REPLAY_MULTIPLIER represents the environment variable key for the factor the rate is
+	// multiplied by while replaying.
+	// Example: "GENERATOR_REPLAY_MULTIPLIER=10"
+	KEY_REPLAY_MULTIPLIER string = "GENERATOR_REPLAY_MULTIPLIER"
+
+	// KEY_RAMP represents the environment variable key for how generation warms up to its rate.
+	// The valid values are "off" (full rate from the start), "linear" and "exponential" (grow from
+	// zero to the rate over the ramp duration).
+	// Example: "GENERATOR_RAMP=linear"
+	KEY_RAMP string = "GENERATOR_RAMP"
+
+	// KEY_RAMP_DURATION represents the environment variable key for how long, in seconds, generation
+	// takes to ramp up to its rate.
+	// Example: "GENERATOR_RAMP_DURATION=60"
+	KEY_RAMP_DURATION string = "GENERATOR_RAMP_DURATION"
+
+	// KEY_SEED represents the environment variable key for the seed of the generator's random source.
+	// With a seed, the same sequence of logs is generated on every run; unset or 0 seeds from the clock.
+	// Example: "GENERATOR_SEED=42"
+	KEY_SEED string = "GENERATOR_SEED"
+
+	// KEY_SERVICE_TAG represents the environment variable key for whether generated logs end with the
+	// name of the service profile they were generated for. Service profiles are configured in config.yaml.
+	// Example: "GENERATOR_SERVICE_TAG=true"
+	KEY_SERVICE_TAG string = "GENERATOR_SERVICE_TAG"
+
+	// KEY_SHUTDOWN_TIMEOUT represents the environment variable key for how long, in seconds, in-flight
+	// requests get to finish after SIGINT/SIGTERM before the server closes them.
+	// Example: "GENERATOR_SHUTDOWN_TIMEOUT=10"
+	KEY_SHUTDOWN_TIMEOUT string = "GENERATOR_SHUTDOWN_TIMEOUT"
+
+	// KEY_DLQ_FILE represents the environment variable key for the path of the dead-letter file batches
+	// the parser did not accept are appended to, to be replayed later. Unset or empty drops them.
+	// Example: "GENERATOR_DLQ_FILE=/data/dead-letter.jsonl"
+	KEY_DLQ_FILE string = "GENERATOR_DLQ_FILE"
+
+	// KEY_GZIP represents the environment variable key for whether batches are gzip-compressed before
+	// they are sent to the parser, with a Content-Encoding: gzip header.
+	// Example: "GENERATOR_GZIP=true"
+	KEY_GZIP string = "GENERATOR_GZIP"
+
+	// KEY_PARSER_API_KEY represents the environment variable key for the API key sent to the parser in the
+	// X-API-Key header, the PARSER_API_KEY the parser requires of the batches posted to it.
+	// Example: "PARSER_API_KEY=s3cret"
+	KEY_PARSER_API_KEY string = "PARSER_API_KEY"
 )
 
 // Constants representing default values for the log generator configuration.
@@ -70,6 +155,54 @@ const (
 	// GENERATOR_UNIT represents the default unit of time for log generation.
 	// Default value: "s" for seconds
 	GENERATOR_UNIT string = "s"
+
+	// PARSER_CHECK represents the default mode of the parser startup check.
+	// Default value: "warn"
+	PARSER_CHECK string = "warn"
+
+	// PARSER_CHECK_TIMEOUT represents the default number of seconds to wait for the parser at startup.
+	// Default value: 30
+	PARSER_CHECK_TIMEOUT int = 30
+
+	// GENERATOR_MAX_CONCURRENT_ROUNDS represents the default number of generation rounds allowed to overlap.
+	// Default value: 1 (a round only starts once the previous one completed)
+	GENERATOR_MAX_CONCURRENT_ROUNDS int = 1
+
+	// GENERATOR_TIMESTAMP_MODE represents the default timestamping of generated logs.
+	// Default value: "now"
+	GENERATOR_TIMESTAMP_MODE string = "now"
+
+	// GENERATOR_LOG_FORMAT represents the default format of generated logs.
+	// Default value: "rfc3339"
+	GENERATOR_LOG_FORMAT string = "rfc3339"
+
+	// GENERATOR_REPLAY_LOOP represents the default looping of the replay.
+	// Default value: false (generation stops once the file was replayed in full)
+	GENERATOR_REPLAY_LOOP bool = false
+
+	// GENERATOR_REPLAY_MULTIPLIER represents the default factor applied to the rate while replaying.
+	// Default value: 1
+	GENERATOR_REPLAY_MULTIPLIER int = 1
+
+	// GENERATOR_RAMP represents the default warm-up of generation.
+	// Default value: "off" (the full rate from the first round)
+	GENERATOR_RAMP string = "off"
+
+	// GENERATOR_RAMP_DURATION represents the default number of seconds generation ramps up over.
+	// Default value: 0 (no ramp)
+	GENERATOR_RAMP_DURATION int = 0
+
+	// GENERATOR_SERVICE_TAG represents the default tagging of generated logs with their service name.
+	// Default value: false
+	GENERATOR_SERVICE_TAG bool = false
+
+	// GENERATOR_SHUTDOWN_TIMEOUT represents the default number of seconds in-flight requests get on shutdown.
+	// Default value: 10
+	GENERATOR_SHUTDOWN_TIMEOUT int = 10
+
+	// GENERATOR_GZIP represents the default compression of the batches sent to the parser.
+	// Default value: false (batches are sent uncompressed)
+	GENERATOR_GZIP bool = false
 )
 
 
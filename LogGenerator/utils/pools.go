@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"LogGenerator/models"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// defaultPools holds the built-in pools, restored for every pool a configuration leaves out.
+var defaultPools = models.Pools{
+	Ips:        Ips,
+	Methods:    Methods,
+	Urls:       Urls,
+	Statuses:   Statuses,
+	UserAgents: UserAgents,
+	Referrers:  Referrers,
+}
+
+// ValidatePools checks that no pool holds an empty value and that every status is a known HTTP status code.
+func ValidatePools(pools models.Pools) error {
+	named := []struct {
+		name   string
+		values []string
+	}{
+		{"ips", pools.Ips},
+		{"methods", pools.Methods},
+		{"urls", pools.Urls},
+		{"user_agents", pools.UserAgents},
+		{"referrers", pools.Referrers},
+	}
+	for _, pool := range named {
+		for i, value := range pool.values {
+			if value == "" {
+				return fmt.Errorf("pool %q has an empty value at index %d", pool.name, i)
+			}
+		}
+	}
+	for _, status := range pools.Statuses {
+		if http.StatusText(status) == "" {
+			return fmt.Errorf("pool \"statuses\" has unknown status %d", status)
+		}
+	}
+	return nil
+}
+
+// ValidateWeightedStatuses checks that every weighted status is a known HTTP status code with a positive,
+// finite weight. The weights are relative, so they need not add up to 1.
+func ValidateWeightedStatuses(weights map[int]float64) error {
+	for status, weight := range weights {
+		if http.StatusText(status) == "" {
+			return fmt.Errorf("unknown status %d", status)
+		}
+		if !(weight > 0) || math.IsInf(weight, 1) {
+			return fmt.Errorf("status %d has weight %v, it must be positive", status, weight)
+		}
+	}
+	return nil
+}
+
+// ApplyPools validates pools and swaps them in as the pools logs are drawn from, falling back to the
+// built-in values for every empty pool. Nothing is changed when a pool is invalid.
+func ApplyPools(pools models.Pools) error {
+	if err := ValidatePools(pools); err != nil {
+		return err
+	}
+	Ips = orDefault(pools.Ips, defaultPools.Ips)
+	Methods = orDefault(pools.Methods, defaultPools.Methods)
+	Urls = orDefault(pools.Urls, defaultPools.Urls)
+	Statuses = orDefault(pools.Statuses, defaultPools.Statuses)
+	UserAgents = orDefault(pools.UserAgents, defaultPools.UserAgents)
+	Referrers = orDefault(pools.Referrers, defaultPools.Referrers)
+	return nil
+}
+
+// orDefault returns pool, or fallback when pool is empty.
+func orDefault[T any](pool, fallback []T) []T {
+	if len(pool) == 0 {
+		return fallback
+	}
+	return pool
+}
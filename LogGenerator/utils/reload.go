@@ -34,6 +34,22 @@ func FirstLoad() (error){
 		IsAliveUrl:  alive_url,
 		GenerateUrl: generate_url,
 		ProcessorApi:parser_api,
+		ParserCheck: getEnvString(KEY_PARSER_CHECK, PARSER_CHECK),
+		ParserCheckTimeout: getEnvInt(KEY_PARSER_CHECK_TIMEOUT, PARSER_CHECK_TIMEOUT),
+		MaxConcurrentRounds: getEnvInt(KEY_MAX_CONCURRENT_ROUNDS, GENERATOR_MAX_CONCURRENT_ROUNDS),
+		TimestampMode: getEnvString(KEY_TIMESTAMP_MODE, GENERATOR_TIMESTAMP_MODE),
+		LogFormat: getEnvString(KEY_LOG_FORMAT, GENERATOR_LOG_FORMAT),
+		ReplayFile: getEnvString(KEY_REPLAY_FILE, ""),
+		ReplayLoop: getEnvBool(KEY_REPLAY_LOOP, GENERATOR_REPLAY_LOOP),
+		ReplayMultiplier: getEnvInt(KEY_REPLAY_MULTIPLIER, GENERATOR_REPLAY_MULTIPLIER),
+		Seed: int64(getEnvInt(KEY_SEED, 0)),
+		Ramp: getEnvString(KEY_RAMP, GENERATOR_RAMP),
+		RampDuration: getEnvInt(KEY_RAMP_DURATION, GENERATOR_RAMP_DURATION),
+		ServiceTag: getEnvBool(KEY_SERVICE_TAG, GENERATOR_SERVICE_TAG),
+		ShutdownTimeout: getEnvInt(KEY_SHUTDOWN_TIMEOUT, GENERATOR_SHUTDOWN_TIMEOUT),
+		DLQFile: getEnvString(KEY_DLQ_FILE, ""),
+		Gzip: getEnvBool(KEY_GZIP, GENERATOR_GZIP),
+		ParserAPIKey: getEnvString(KEY_PARSER_API_KEY, ""),
 	}
 
 	RateData = models.RequestPayload{
@@ -81,6 +97,22 @@ func getEnvInt(key string, defaultValue int) int {
 	return parsedValue
 }
 
+// getEnvBool this function is reponsible for fetching
+// boolean type environment variables and if not present then
+// sets default value
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsedValue, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return parsedValue
+}
+
 func ReadConfigFile() ([]byte, error){
 	return os.ReadFile(FILE_NAME)
 }
@@ -102,6 +134,69 @@ func LoadConfigFromYaml(fileData []byte,err error) error {
 	GloablMetaData.IsAliveUrl = ConfigData.CurrentService.KEY_ALIVE_URL
 	GloablMetaData.GenerateUrl = ConfigData.CurrentService.KEY_START_URL
 	GloablMetaData.ProcessorApi = ConfigData.ParserService.KEY_PARSER_API
+	if ConfigData.KEY_PARSER_CHECK != "" {
+		GloablMetaData.ParserCheck = ConfigData.KEY_PARSER_CHECK
+	}
+	if ConfigData.KEY_PARSER_CHECK_TIMEOUT > 0 {
+		GloablMetaData.ParserCheckTimeout = ConfigData.KEY_PARSER_CHECK_TIMEOUT
+	}
+	if ConfigData.KEY_MAX_CONCURRENT_ROUNDS > 0 {
+		GloablMetaData.MaxConcurrentRounds = ConfigData.KEY_MAX_CONCURRENT_ROUNDS
+	}
+	if ConfigData.KEY_TIMESTAMP_MODE != "" {
+		GloablMetaData.TimestampMode = ConfigData.KEY_TIMESTAMP_MODE
+	}
+	if ConfigData.KEY_LOG_FORMAT != "" {
+		GloablMetaData.LogFormat = ConfigData.KEY_LOG_FORMAT
+	}
+	if ConfigData.KEY_REPLAY_FILE != "" {
+		GloablMetaData.ReplayFile = ConfigData.KEY_REPLAY_FILE
+	}
+	if ConfigData.KEY_REPLAY_LOOP {
+		GloablMetaData.ReplayLoop = true
+	}
+	if ConfigData.KEY_REPLAY_MULTIPLIER > 0 {
+		GloablMetaData.ReplayMultiplier = ConfigData.KEY_REPLAY_MULTIPLIER
+	}
+	if ConfigData.KEY_SEED != 0 {
+		GloablMetaData.Seed = ConfigData.KEY_SEED
+	}
+	if ConfigData.KEY_RAMP != "" {
+		GloablMetaData.Ramp = ConfigData.KEY_RAMP
+	}
+	if ConfigData.KEY_RAMP_DURATION > 0 {
+		GloablMetaData.RampDuration = ConfigData.KEY_RAMP_DURATION
+	}
+	if err := ApplyPools(ConfigData.KEY_POOLS); err != nil {
+		return fmt.Errorf("invalid pools in config.yaml: %v", err)
+	}
+	if len(ConfigData.KEY_WEIGHTED_STATUSES) > 0 {
+		if err := ValidateWeightedStatuses(ConfigData.KEY_WEIGHTED_STATUSES); err != nil {
+			return fmt.Errorf("invalid weighted statuses in config.yaml: %v", err)
+		}
+		GloablMetaData.WeightedStatuses = ConfigData.KEY_WEIGHTED_STATUSES
+	}
+	if len(ConfigData.KEY_SERVICES) > 0 {
+		if err := ValidateServices(ConfigData.KEY_SERVICES); err != nil {
+			return fmt.Errorf("invalid service profiles in config.yaml: %v", err)
+		}
+		GloablMetaData.Services = ConfigData.KEY_SERVICES
+	}
+	if ConfigData.KEY_SERVICE_TAG {
+		GloablMetaData.ServiceTag = true
+	}
+	if ConfigData.KEY_SHUTDOWN_TIMEOUT > 0 {
+		GloablMetaData.ShutdownTimeout = ConfigData.KEY_SHUTDOWN_TIMEOUT
+	}
+	if ConfigData.KEY_DLQ_FILE != "" {
+		GloablMetaData.DLQFile = ConfigData.KEY_DLQ_FILE
+	}
+	if ConfigData.KEY_GZIP {
+		GloablMetaData.Gzip = true
+	}
+	if ConfigData.KEY_PARSER_API_KEY != "" {
+		GloablMetaData.ParserAPIKey = ConfigData.KEY_PARSER_API_KEY
+	}
 
 	if RateData.NumLogs <= 0 {
 		RateData.NumLogs = int64(ConfigData.KEY_RATE)
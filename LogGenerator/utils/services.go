@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"LogGenerator/models"
+	"fmt"
+	"net/http"
+)
+
+// ValidateServices checks that every service profile has a unique name, at least one path,
+// a positive rate, and positive weights for valid HTTP status codes.
+func ValidateServices(services []models.ServiceProfile) error {
+	names := make(map[string]bool, len(services))
+	for i, service := range services {
+		if service.Name == "" {
+			return fmt.Errorf("service %d has no name", i)
+		}
+		if names[service.Name] {
+			return fmt.Errorf("service %q is defined more than once", service.Name)
+		}
+		names[service.Name] = true
+
+		if len(service.Paths) == 0 {
+			return fmt.Errorf("service %q has no paths", service.Name)
+		}
+		if service.Rate <= 0 {
+			return fmt.Errorf("service %q has rate %d, it must be positive", service.Name, service.Rate)
+		}
+		for status, weight := range service.StatusWeights {
+			if http.StatusText(status) == "" {
+				return fmt.Errorf("service %q has unknown status %d", service.Name, status)
+			}
+			if weight <= 0 {
+				return fmt.Errorf("service %q has weight %d for status %d, it must be positive", service.Name, weight, status)
+			}
+		}
+	}
+	return nil
+}
@@ -330,6 +330,139 @@ KEY_UNIT : "m"
 	})
 }
 
+func TestLoadConfigFromYaml_Services(t *testing.T) {
+	defer func() {
+		ConfigData = models.AllConfigModel{}
+		GloablMetaData.Services = nil
+		GloablMetaData.ServiceTag = false
+	}()
+
+	validYaml := []byte(`
+currentService:
+  KEY_PORT : ":8080"
+
+KEY_SERVICE_TAG : true
+KEY_SERVICES :
+  - name : "api.example.com"
+    paths : ["/v1/orders", "/v1/users"]
+    status_weights : {200: 90, 500: 10}
+    rate : 3
+  - name : "www.example.com"
+    paths : ["/"]
+    rate : 1
+`)
+	err := LoadConfigFromYaml(validYaml, nil)
+
+	assert.NoError(t, err)
+	assert.True(t, GloablMetaData.ServiceTag)
+	assert.Equal(t, []models.ServiceProfile{
+		{Name: "api.example.com", Paths: []string{"/v1/orders", "/v1/users"}, StatusWeights: map[int]int{200: 90, 500: 10}, Rate: 3},
+		{Name: "www.example.com", Paths: []string{"/"}, Rate: 1},
+	}, GloablMetaData.Services)
+
+	ConfigData = models.AllConfigModel{}
+	GloablMetaData.Services = nil
+	invalidYaml := []byte(`
+KEY_SERVICES :
+  - name : "api.example.com"
+    paths : ["/v1/orders"]
+    rate : 0
+`)
+	err = LoadConfigFromYaml(invalidYaml, nil)
+
+	assert.EqualError(t, err, `invalid service profiles in config.yaml: service "api.example.com" has rate 0, it must be positive`)
+	assert.Nil(t, GloablMetaData.Services)
+}
+
+func TestLoadConfigFromYaml_Pools(t *testing.T) {
+	defaultUrls := Urls
+	defer func() {
+		ConfigData = models.AllConfigModel{}
+		assert.NoError(t, ApplyPools(models.Pools{}))
+	}()
+
+	err := LoadConfigFromYaml([]byte(`
+KEY_POOLS :
+  urls : ["/api/orders"]
+  statuses : [200, 503]
+`), nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/api/orders"}, Urls)
+	assert.Equal(t, []int{200, 503}, Statuses)
+	assert.Equal(t, defaultPools.Ips, Ips)
+	assert.Equal(t, defaultPools.UserAgents, UserAgents)
+
+	ConfigData = models.AllConfigModel{}
+	err = LoadConfigFromYaml([]byte(`
+KEY_POOLS :
+  urls : ["/api/cart"]
+  statuses : [200, 999]
+`), nil)
+
+	assert.EqualError(t, err, `invalid pools in config.yaml: pool "statuses" has unknown status 999`)
+	assert.Equal(t, []string{"/api/orders"}, Urls)
+
+	ConfigData = models.AllConfigModel{}
+	assert.NoError(t, LoadConfigFromYaml([]byte(`KEY_RATE : 10`), nil))
+	assert.Equal(t, defaultUrls, Urls)
+	assert.Equal(t, defaultPools.Statuses, Statuses)
+}
+
+func TestValidatePools(t *testing.T) {
+	assert.NoError(t, ValidatePools(models.Pools{Ips: []string{"10.0.0.1"}, Statuses: []int{200}}))
+	assert.EqualError(t, ValidatePools(models.Pools{Methods: []string{"GET", ""}}), `pool "methods" has an empty value at index 1`)
+	assert.EqualError(t, ValidatePools(models.Pools{Statuses: []int{42}}), `pool "statuses" has unknown status 42`)
+}
+
+func TestLoadConfigFromYaml_WeightedStatuses(t *testing.T) {
+	defer func(meta models.GlobalConstantvariables) { GloablMetaData = meta }(GloablMetaData)
+	defer func() { ConfigData = models.AllConfigModel{} }()
+	GloablMetaData.WeightedStatuses = nil
+
+	err := LoadConfigFromYaml([]byte(`
+KEY_WEIGHTED_STATUSES : {200: 0.90, 404: 0.05, 500: 0.03, 301: 0.02}
+`), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]float64{200: 0.90, 404: 0.05, 500: 0.03, 301: 0.02}, GloablMetaData.WeightedStatuses)
+
+	ConfigData = models.AllConfigModel{}
+	err = LoadConfigFromYaml([]byte(`
+KEY_WEIGHTED_STATUSES : {200: 0.5, 999: 0.5}
+`), nil)
+	assert.EqualError(t, err, "invalid weighted statuses in config.yaml: unknown status 999")
+}
+
+func TestValidateWeightedStatuses(t *testing.T) {
+	assert.NoError(t, ValidateWeightedStatuses(map[int]float64{200: 3, 500: 1}))
+	assert.EqualError(t, ValidateWeightedStatuses(map[int]float64{42: 1}), "unknown status 42")
+	assert.EqualError(t, ValidateWeightedStatuses(map[int]float64{200: 0}), "status 200 has weight 0, it must be positive")
+	assert.EqualError(t, ValidateWeightedStatuses(map[int]float64{200: -0.5}), "status 200 has weight -0.5, it must be positive")
+}
+
+func TestValidateServices(t *testing.T) {
+	valid := models.ServiceProfile{Name: "api", Paths: []string{"/v1"}, StatusWeights: map[int]int{200: 1}, Rate: 1}
+	assert.NoError(t, ValidateServices([]models.ServiceProfile{valid}))
+
+	tests := []struct {
+		name     string
+		services []models.ServiceProfile
+		err      string
+	}{
+		{"no name", []models.ServiceProfile{{Paths: []string{"/"}, Rate: 1}}, "service 0 has no name"},
+		{"duplicate", []models.ServiceProfile{valid, valid}, `service "api" is defined more than once`},
+		{"no paths", []models.ServiceProfile{{Name: "api", Rate: 1}}, `service "api" has no paths`},
+		{"negative rate", []models.ServiceProfile{{Name: "api", Paths: []string{"/"}, Rate: -1}}, `service "api" has rate -1, it must be positive`},
+		{"unknown status", []models.ServiceProfile{{Name: "api", Paths: []string{"/"}, StatusWeights: map[int]int{999: 1}, Rate: 1}}, `service "api" has unknown status 999`},
+		{"zero weight", []models.ServiceProfile{{Name: "api", Paths: []string{"/"}, StatusWeights: map[int]int{200: 0}, Rate: 1}}, `service "api" has weight 0 for status 200, it must be positive`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, ValidateServices(tt.services), tt.err)
+		})
+	}
+}
+
 func TestReloadRateData(t *testing.T) {
 	tests := []struct {
 		name       string
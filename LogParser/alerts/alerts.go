@@ -0,0 +1,297 @@
+// Package alerts evaluates the configured threshold alert rules against the stored logs.
+// A rule raises an alert when its metric crosses the threshold and resolves it once the metric
+// recovers; both transitions are recorded in an AlertStore and passed to a Notifier.
+package alerts
+
+import (
+	"LogParser/connection"
+	"LogParser/logger"
+	"LogParser/ml"
+	"LogParser/models"
+	"LogParser/utils"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics supported by alert rules.
+const (
+	METRIC_REQUEST_COUNT string = "request_count" // Number of requests in the window.
+	METRIC_ERROR_RATE    string = "error_rate"    // Percentage of 4xx and 5xx responses in the window.
+	METRIC_4XX_RATE      string = "4xx_rate"      // Percentage of 4xx responses in the window.
+	METRIC_5XX_RATE      string = "5xx_rate"      // Percentage of 5xx responses in the window.
+)
+
+// ALERT_TYPE_THRESHOLD is the Type of the alerts raised by threshold rules.
+const ALERT_TYPE_THRESHOLD string = "threshold"
+
+// DEFAULT_SEVERITY is used for rules that do not set a severity.
+const DEFAULT_SEVERITY string = "warning"
+
+// Notifier is told about every alert that is raised or resolved.
+type Notifier interface {
+	Notify(alert ml.Alert)
+}
+
+// LogNotifier reports alerts through the application logger.
+type LogNotifier struct{}
+
+// Notify logs a raised alert as a warning and a resolved one as info.
+func (LogNotifier) Notify(alert ml.Alert) {
+	if alert.Resolved {
+		logger.LogInfo(fmt.Sprintf("Alert resolved: %s", alert.Title))
+		return
+	}
+	logger.LogWarn(fmt.Sprintf("Alert [%s]: %s - %s", alert.Severity, alert.Title, alert.Description))
+}
+
+// AlertStore holds the currently active alert of each rule.
+type AlertStore struct {
+	mu     sync.Mutex
+	active map[string]ml.Alert
+}
+
+// NewAlertStore creates an empty alert store.
+func NewAlertStore() *AlertStore {
+	return &AlertStore{active: make(map[string]ml.Alert)}
+}
+
+// Active returns the active alerts ordered by rule name.
+func (s *AlertStore) Active() []ml.Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.active))
+	for name := range s.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	alerts := make([]ml.Alert, 0, len(names))
+	for _, name := range names {
+		alerts = append(alerts, s.active[name])
+	}
+	return alerts
+}
+
+// Get returns the active alert of the named rule, if any.
+func (s *AlertStore) Get(rule string) (ml.Alert, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alert, ok := s.active[rule]
+	return alert, ok
+}
+
+// Reset drops all active alerts without notifying.
+func (s *AlertStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active = make(map[string]ml.Alert)
+}
+
+// RemoveIP drops the active alerts whose data references ip, without notifying, and returns how many were dropped.
+func (s *AlertStore) RemoveIP(ip string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for rule, alert := range s.active {
+		if referencesIP(alert, ip) {
+			delete(s.active, rule)
+			removed++
+		}
+	}
+	return removed
+}
+
+// referencesIP reports whether any value of the alert's data is ip.
+func referencesIP(alert ml.Alert, ip string) bool {
+	data, ok := alert.Data.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, value := range data {
+		if value == ip {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *AlertStore) set(rule string, alert ml.Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.active[rule] = alert
+}
+
+func (s *AlertStore) remove(rule string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.active, rule)
+}
+
+// Engine evaluates alert rules and keeps their alerts in Store.
+type Engine struct {
+	Store    *AlertStore
+	Notifier Notifier
+}
+
+// NewEngine creates an engine with an empty store reporting to the given notifier.
+func NewEngine(notifier Notifier) *Engine {
+	return &Engine{
+		Store:    NewAlertStore(),
+		Notifier: notifier,
+	}
+}
+
+// Run evaluates utils.ConfigData.AlertRules every interval until stop is closed.
+// Rules are re-read on every tick so config refreshes take effect without a restart.
+func (e *Engine) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			rules := utils.ConfigData.AlertRules
+			if len(rules) == 0 {
+				continue
+			}
+			success, db := connection.PingDB()
+			if !success {
+				logger.LogWarn("Skipping alert evaluation, database not reachable")
+				continue
+			}
+			e.Evaluate(db, rules, time.Now())
+		}
+	}
+}
+
+// Evaluate checks every rule against the logs up to now. A rule whose metric matches and has no
+// active alert raises one; a rule whose metric no longer matches resolves its active alert.
+// Invalid rules and rules whose metric can't be computed are logged and leave their state unchanged.
+func (e *Engine) Evaluate(db *sql.DB, rules []models.AlertRule, now time.Time) {
+	for _, rule := range rules {
+		if err := ValidateRule(rule); err != nil {
+			logger.LogWarn(fmt.Sprintf("Skipping alert rule '%s': %v", rule.Name, err))
+			continue
+		}
+
+		value, err := metricValue(db, rule, now)
+		if err != nil {
+			logger.LogError(fmt.Sprintf("Error evaluating alert rule '%s': %v", rule.Name, err))
+			continue
+		}
+
+		active, firing := e.Store.Get(rule.Name)
+		switch {
+		case compare(value, rule.Comparator, rule.Threshold) && !firing:
+			alert := newAlert(rule, value, now)
+			e.Store.set(rule.Name, alert)
+			e.Notifier.Notify(alert)
+		case !compare(value, rule.Comparator, rule.Threshold) && firing:
+			active.Resolved = true
+			active.Timestamp = now
+			e.Store.remove(rule.Name)
+			e.Notifier.Notify(active)
+		}
+	}
+}
+
+// ValidateRule checks that a rule names a supported metric and comparator and has a positive window.
+func ValidateRule(rule models.AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("rule has no name")
+	}
+	switch rule.Metric {
+	case METRIC_REQUEST_COUNT, METRIC_ERROR_RATE, METRIC_4XX_RATE, METRIC_5XX_RATE:
+	default:
+		return fmt.Errorf("unknown metric '%s'", rule.Metric)
+	}
+	switch rule.Comparator {
+	case ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("unknown comparator '%s'", rule.Comparator)
+	}
+	if rule.Window <= 0 {
+		return fmt.Errorf("window must be a positive number of seconds")
+	}
+	return nil
+}
+
+// metricValue computes the rule's metric over the window ending at now.
+func metricValue(db *sql.DB, rule models.AlertRule, now time.Time) (float64, error) {
+	since := now.Add(-time.Duration(rule.Window) * time.Second)
+
+	query := utils.QUERY_STATUS_COUNTS_SINCE
+	if utils.DBDriver == utils.DB_DRIVER_MYSQL {
+		query = utils.QUERY_STATUS_COUNTS_SINCE_MYSQL
+	}
+
+	var total, clientErrors, serverErrors int64
+	if err := db.QueryRow(utils.DriverQuery(query), since).Scan(&total, &clientErrors, &serverErrors); err != nil {
+		return 0, err
+	}
+
+	if rule.Metric == METRIC_REQUEST_COUNT {
+		return float64(total), nil
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	var count int64
+	switch rule.Metric {
+	case METRIC_ERROR_RATE:
+		count = clientErrors + serverErrors
+	case METRIC_4XX_RATE:
+		count = clientErrors
+	case METRIC_5XX_RATE:
+		count = serverErrors
+	}
+	return float64(count) / float64(total) * 100, nil
+}
+
+func compare(value float64, comparator string, threshold float64) bool {
+	switch comparator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+func newAlert(rule models.AlertRule, value float64, now time.Time) ml.Alert {
+	severity := rule.Severity
+	if severity == "" {
+		severity = DEFAULT_SEVERITY
+	}
+
+	return ml.Alert{
+		ID:          fmt.Sprintf("%s-%d", rule.Name, now.Unix()),
+		Type:        ALERT_TYPE_THRESHOLD,
+		Severity:    severity,
+		Title:       fmt.Sprintf("%s: %s %s %g over %ds", rule.Name, rule.Metric, rule.Comparator, rule.Threshold, rule.Window),
+		Description: fmt.Sprintf("%s is %.2f", rule.Metric, value),
+		Timestamp:   now,
+		Data: map[string]interface{}{
+			"metric":    rule.Metric,
+			"value":     value,
+			"threshold": rule.Threshold,
+			"window":    rule.Window,
+		},
+	}
+}
@@ -0,0 +1,150 @@
+package alerts
+
+import (
+	"LogParser/ml"
+	"LogParser/models"
+	"LogParser/utils"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	alerts []ml.Alert
+}
+
+func (n *recordingNotifier) Notify(alert ml.Alert) {
+	n.alerts = append(n.alerts, alert)
+}
+
+func expectStatusCounts(mock sqlmock.Sqlmock, total, clientErrors, serverErrors int) {
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_STATUS_COUNTS_SINCE)).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "4xx", "5xx"}).AddRow(total, clientErrors, serverErrors))
+}
+
+func TestEvaluate_RaisesAndResolves(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rules := []models.AlertRule{{Name: "high-5xx", Metric: METRIC_5XX_RATE, Window: 300, Comparator: ">", Threshold: 5, Severity: "critical"}}
+	notifier := &recordingNotifier{}
+	engine := NewEngine(notifier)
+	now := time.Now()
+
+	// 10% 5xx crosses the threshold
+	expectStatusCounts(mock, 100, 0, 10)
+	engine.Evaluate(db, rules, now)
+	alert, firing := engine.Store.Get("high-5xx")
+	assert.True(t, firing)
+	assert.Equal(t, "critical", alert.Severity)
+	assert.Equal(t, ALERT_TYPE_THRESHOLD, alert.Type)
+	assert.Len(t, notifier.alerts, 1)
+
+	// Still above the threshold: no duplicate alert
+	expectStatusCounts(mock, 100, 0, 8)
+	engine.Evaluate(db, rules, now.Add(time.Minute))
+	assert.Len(t, engine.Store.Active(), 1)
+	assert.Len(t, notifier.alerts, 1)
+
+	// Recovered: the alert is resolved and cleared
+	expectStatusCounts(mock, 100, 3, 1)
+	engine.Evaluate(db, rules, now.Add(2*time.Minute))
+	_, firing = engine.Store.Get("high-5xx")
+	assert.False(t, firing)
+	assert.Len(t, notifier.alerts, 2)
+	assert.True(t, notifier.alerts[1].Resolved)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEvaluate_MetricsAndComparators(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rules := []models.AlertRule{
+		{Name: "low-traffic", Metric: METRIC_REQUEST_COUNT, Window: 60, Comparator: "<", Threshold: 50},
+		{Name: "errors", Metric: METRIC_ERROR_RATE, Window: 60, Comparator: ">=", Threshold: 20},
+		{Name: "client-errors", Metric: METRIC_4XX_RATE, Window: 60, Comparator: ">", Threshold: 15},
+	}
+	for range rules {
+		expectStatusCounts(mock, 40, 5, 3)
+	}
+
+	engine := NewEngine(&recordingNotifier{})
+	engine.Evaluate(db, rules, time.Now())
+
+	active := engine.Store.Active()
+	assert.Len(t, active, 2)
+	assert.Equal(t, DEFAULT_SEVERITY, active[0].Severity)
+	_, firing := engine.Store.Get("low-traffic")
+	assert.True(t, firing)
+	_, firing = engine.Store.Get("errors")
+	assert.True(t, firing)
+	_, firing = engine.Store.Get("client-errors")
+	assert.False(t, firing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestEvaluate_MySQL checks that the status counts are queried with the MySQL query and a ? placeholder.
+func TestEvaluate_MySQL(t *testing.T) {
+	defer func() { utils.DBDriver = utils.DB_DRIVER }()
+	utils.DBDriver = utils.DB_DRIVER_MYSQL
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rules := []models.AlertRule{{Name: "high-5xx", Metric: METRIC_5XX_RATE, Window: 300, Comparator: ">", Threshold: 5}}
+	engine := NewEngine(&recordingNotifier{})
+	mock.ExpectQuery(`SELECT COUNT\(\*\), COALESCE\(SUM\(CASE WHEN status >= 400 AND status < 500 THEN 1 ELSE 0 END\), 0\), .* WHERE time_local >= \?$`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "4xx", "5xx"}).AddRow(100, 0, 10))
+
+	engine.Evaluate(db, rules, time.Now())
+
+	_, firing := engine.Store.Get("high-5xx")
+	assert.True(t, firing)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEvaluate_SkipsInvalidRules(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rules := []models.AlertRule{
+		{Name: "bad-metric", Metric: "latency", Window: 60, Comparator: ">", Threshold: 1},
+		{Name: "bad-comparator", Metric: METRIC_5XX_RATE, Window: 60, Comparator: "!=", Threshold: 1},
+		{Name: "bad-window", Metric: METRIC_5XX_RATE, Comparator: ">", Threshold: 1},
+	}
+	engine := NewEngine(&recordingNotifier{})
+	engine.Evaluate(db, rules, time.Now())
+
+	assert.Empty(t, engine.Store.Active())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAlertStoreReset(t *testing.T) {
+	store := NewAlertStore()
+	store.set("rule", ml.Alert{ID: "rule-1"})
+	assert.Len(t, store.Active(), 1)
+
+	store.Reset()
+	assert.Empty(t, store.Active())
+}
+
+func TestAlertStoreRemoveIP(t *testing.T) {
+	store := NewAlertStore()
+	store.set("ip-rule", ml.Alert{ID: "ip-rule-1", Data: map[string]interface{}{"ip": "10.0.0.1"}})
+	store.set("other-ip", ml.Alert{ID: "other-ip-1", Data: map[string]interface{}{"ip": "10.0.0.12"}})
+	store.set("threshold", ml.Alert{ID: "threshold-1", Data: map[string]interface{}{"metric": METRIC_5XX_RATE, "value": 10.0}})
+
+	assert.Equal(t, 1, store.RemoveIP("10.0.0.1"))
+	_, ok := store.Get("ip-rule")
+	assert.False(t, ok)
+	assert.Len(t, store.Active(), 2)
+	assert.Equal(t, 0, store.RemoveIP("10.0.0.1"))
+}
@@ -0,0 +1,72 @@
+package connection
+
+import (
+	"LogParser/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LookupBatch returns the recorded result of the batch with the given id, if it was processed within
+// the last PARSER_BATCH_ACK_TTL seconds.
+func LookupBatch(ctx context.Context, db *sql.DB, batchID string, now time.Time) (inserted int64, rejected int, found bool, err error) {
+	since := now.Add(-time.Duration(utils.ConfigData.BatchAckTTL) * time.Second)
+	err = db.QueryRowContext(ctx, utils.DriverQuery(utils.QUERY_SELECT_BATCH), batchID, since).Scan(&inserted, &rejected)
+	if err == sql.ErrNoRows {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("error looking up batch %s: %v", batchID, err)
+	}
+	return inserted, rejected, true, nil
+}
+
+// ErrBatchProcessed is returned by ClaimBatch when the batch was already processed within the last
+// PARSER_BATCH_ACK_TTL seconds.
+var ErrBatchProcessed = errors.New("batch already processed")
+
+// ClaimBatch records the batch with the given id in tx, the transaction inserting its logs, so that the
+// record and the logs are committed together. It returns ErrBatchProcessed, for tx to be rolled back,
+// when the batch is recorded already, or was recorded by a concurrent transaction that committed since.
+func ClaimBatch(ctx context.Context, tx *sql.Tx, batchID string, rejected int, now time.Time) error {
+	since := now.Add(-time.Duration(utils.ConfigData.BatchAckTTL) * time.Second)
+	query, args := utils.QUERY_CLAIM_BATCH, []interface{}{batchID, rejected, since}
+	if utils.DBDriver == utils.DB_DRIVER_MYSQL {
+		query, args = utils.QUERY_CLAIM_BATCH_MYSQL, []interface{}{batchID, rejected, now, since, since, since}
+	}
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error recording batch %s: %w", batchID, err)
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error recording batch %s: %w", batchID, err)
+	}
+	if claimed == 0 {
+		return ErrBatchProcessed
+	}
+	return nil
+}
+
+// SetBatchInserted records the number of logs inserted for a batch claimed in tx.
+func SetBatchInserted(ctx context.Context, tx *sql.Tx, batchID string, inserted int64) error {
+	if _, err := tx.ExecContext(ctx, utils.DriverQuery(utils.QUERY_SET_BATCH_INSERTED), inserted, batchID); err != nil {
+		return fmt.Errorf("error recording batch %s: %w", batchID, err)
+	}
+	return nil
+}
+
+// PurgeExpiredBatches removes the batch records older than PARSER_BATCH_ACK_TTL seconds and returns
+// how many were removed.
+func PurgeExpiredBatches(db *sql.DB, now time.Time) (int64, error) {
+	if utils.ConfigData.BatchAckTTL <= 0 {
+		return 0, nil
+	}
+	result, err := db.Exec(utils.DriverQuery(utils.QUERY_DELETE_BATCHES_BEFORE), now.Add(-time.Duration(utils.ConfigData.BatchAckTTL)*time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
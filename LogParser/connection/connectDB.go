@@ -9,8 +9,10 @@ import (
 	"database/sql"
 	"fmt"
 	"math"
+	"net"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 )
 
@@ -22,6 +24,14 @@ var Config *models.DB_Config
 // using the provided credentials and connection details. If the connection is successful,
 // it checks the database connection with a ping and ensures the necessary logs table exists.
 func InitDB() *sql.DB {
+	reconnectMu.Lock()
+	defer reconnectMu.Unlock()
+	return initDB(10)
+}
+
+// initDB is InitDB, connecting in up to connectAttempts attempts. It runs under reconnectMu, and only
+// replaces DB once the new connection answers a ping.
+func initDB(connectAttempts int) *sql.DB {
 	err1 := FirstLoad()
 	if err1 != nil {
 		logger.LogError("Configuration not loaded. Exiting...\n")
@@ -30,50 +40,115 @@ func InitDB() *sql.DB {
 
 	// Use the global ConfigData loaded from configuration
 	Config = &ConfigData
-	var err error
 
-	// Database connection string using values from the loaded config
-	connStr := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s host=%s port=%s",
-		Config.Database.DBUsername,
-		Config.Database.DBPassword,
-		Config.Database.DBName,
-		Config.Database.DBSslMode,
-		Config.Database.DBHost,
-		Config.Database.DBPort,
-	)
+	// Database driver and connection string using values from the loaded config
+	driver, connStr, err := DataSourceName(*Config)
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Invalid database configuration: %v\n", err))
+		return nil
+	}
+	if err := checkDriverFeatures(driver); err != nil {
+		logger.LogError(fmt.Sprintf("Invalid database configuration: %v\n", err))
+		return nil
+	}
+	utils.DBDriver = driver
 
 	// Open the database connection
-	DB, err = connectWithRetry(connStr, 10)
+	db, err := connectWithRetry(driver, connStr, *Config, connectAttempts)
 	if err != nil {
 		logger.LogError(fmt.Sprintf("Error connecting to the database: %v\n", err))
 	}
 
 	// Check if the connection to the database is successful
-	success, _ := PingDB()
-	if !success {
+	if !pingDB(db) {
 		logger.LogError("Database ping failed after connection. Exiting...")
 		return nil
 	}
+	setDB(db)
 
 	// Ensure the logs table exists, if not, create it
-	createLogsTableIfNotExist(*Config)
-	return DB
+	ensureSchema(*Config)
+	return db
 }
 
-func connectWithRetry(connStr string, maxAttempts int) (*sql.DB, error) {
+// schemaApplied records that the logs table was created and migrated. It is guarded by reconnectMu.
+var schemaApplied bool
+
+// applySchema creates, migrates and indexes the logs table. It is replaced in tests.
+var applySchema = createLogsTableIfNotExist
+
+// ensureSchema applies the schema once per process, on the first connection that succeeds. The
+// migrations take an exclusive lock on the logs table even when there is nothing to do, so the
+// reconnects of the configuration refresh and of PingDB do not repeat them.
+func ensureSchema(config models.DB_Config) {
+	if schemaApplied {
+		return
+	}
+	applySchema(config)
+	schemaApplied = true
+}
+
+// checkDriverFeatures returns an error when a configured feature is not supported by driver. String
+// de-duplication stores the strings with Postgres arrays.
+func checkDriverFeatures(driver string) error {
+	if driver == utils.DB_DRIVER_MYSQL && utils.ConfigData.DedupStrings {
+		return fmt.Errorf("%s needs DB_DRIVER %s", utils.KEY_DEDUP_STRINGS, utils.DB_DRIVER)
+	}
+	return nil
+}
+
+// DataSourceName returns the name of the configured DB_DRIVER and the connection string for it.
+// An empty DB_DRIVER connects to Postgres. For MySQL, DB_SSLMODE is mapped to the closest TLS setting.
+func DataSourceName(config models.DB_Config) (string, string, error) {
+	database := config.Database
+	switch database.DBDriver {
+	case "", utils.DB_DRIVER:
+		return utils.DB_DRIVER, fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s host=%s port=%s",
+			database.DBUsername,
+			database.DBPassword,
+			database.DBName,
+			database.DBSslMode,
+			database.DBHost,
+			database.DBPort,
+		), nil
+	case utils.DB_DRIVER_MYSQL:
+		mysqlConfig := mysql.NewConfig()
+		mysqlConfig.User = database.DBUsername
+		mysqlConfig.Passwd = database.DBPassword
+		mysqlConfig.Net = "tcp"
+		mysqlConfig.Addr = net.JoinHostPort(database.DBHost, database.DBPort)
+		mysqlConfig.DBName = database.DBName
+		mysqlConfig.ParseTime = true
+		mysqlConfig.TLSConfig = mysqlTLS(database.DBSslMode)
+		return utils.DB_DRIVER_MYSQL, mysqlConfig.FormatDSN(), nil
+	}
+	return "", "", fmt.Errorf("unsupported DB_DRIVER %q, expected %s or %s", database.DBDriver, utils.DB_DRIVER, utils.DB_DRIVER_MYSQL)
+}
+
+// mysqlTLS returns the MySQL tls parameter closest to a Postgres sslmode.
+func mysqlTLS(sslMode string) string {
+	switch sslMode {
+	case "disable":
+		return "false"
+	case "require":
+		return "skip-verify"
+	case "verify-ca", "verify-full":
+		return "true"
+	}
+	return "preferred"
+}
+
+func connectWithRetry(driver string, connStr string, config models.DB_Config, maxAttempts int) (*sql.DB, error) {
 	var db *sql.DB
 	var err error
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		// Open does not establish connections immediately, Ping will.
-		db, err = sql.Open(utils.DB_USERNAME, connStr)
+		db, err = sql.Open(driver, connStr)
 		if err == nil {
 			// Try to ping to actually establish a connection
 			if pingErr := db.Ping(); pingErr == nil {
-				// Configure sane connection pool limits
-				db.SetMaxOpenConns(10)
-				db.SetMaxIdleConns(5)
-				db.SetConnMaxLifetime(5 * time.Minute)
+				configurePool(db, config)
 
 				logger.LogInfo(fmt.Sprintf("Successfully connected to the database on attempt %d", attempt))
 				return db, nil
@@ -93,24 +168,71 @@ func connectWithRetry(connStr string, maxAttempts int) (*sql.DB, error) {
 	return nil, fmt.Errorf("could not connect after %d attempts: %v", maxAttempts, err)
 }
 
+// poolSettings returns the connection pool limits of the config, the defaults standing in for values of 0 or less.
+func poolSettings(config models.DB_Config) (maxOpen int, maxIdle int, maxLifetime time.Duration) {
+	maxOpen, maxIdle, lifetime := config.Database.DBMaxOpenConns, config.Database.DBMaxIdleConns, config.Database.DBConnMaxLifetime
+	if maxOpen <= 0 {
+		maxOpen = utils.DB_MAX_OPEN_CONNS
+	}
+	if maxIdle <= 0 {
+		maxIdle = utils.DB_MAX_IDLE_CONNS
+	}
+	if lifetime <= 0 {
+		lifetime = utils.DB_CONN_MAX_LIFETIME
+	}
+	return maxOpen, maxIdle, time.Duration(lifetime) * time.Second
+}
+
+// configurePool applies the connection pool limits of the config to db, see poolSettings.
+func configurePool(db *sql.DB, config models.DB_Config) {
+	maxOpen, maxIdle, maxLifetime := poolSettings(config)
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(maxLifetime)
+}
+
 // PingDB checks the database connection by attempting to ping it.
 // It returns a boolean indicating if the connection is successful or not,
-// and the database connection object.
+// and the database connection object. A connection that stopped answering is
+// re-established first, see reconnect.
 func PingDB() (bool, *sql.DB) {
-	if DB == nil {
-		logger.LogError("Database connection is nil.")
+	seen := reconnectRuns.Load()
+	db := currentDB()
+	if pingDB(db) {
+		return true, db
+	}
+	if db == nil {
+		// Never connected, InitDB has logged why
 		return false, nil
 	}
+	return reconnect(seen)
+}
+
+// pingDB reports whether db is connected and answers a ping.
+func pingDB(db *sql.DB) bool {
+	if db == nil {
+		logger.LogError("Database connection is nil.")
+		return false
+	}
 
 	// Ping the database to check if it's reachable
-	err := DB.Ping()
+	err := db.Ping()
 	if err != nil {
 		logger.LogError(fmt.Sprintf("Error pinging the database: %v\n", err))
-		return false, nil
+		return false
 	}
 
 	logger.LogInfo("Successfully connected to the database!")
-	return true, DB
+	return true
+}
+
+// CloseDB closes the database connection, once in-flight requests have finished on shutdown.
+func CloseDB() error {
+	db := currentDB()
+	if db == nil {
+		return nil
+	}
+	return db.Close()
 }
 
 // createLogsTableIfNotExist ensures that the logs table exists in the database.
@@ -118,23 +240,93 @@ func PingDB() (bool, *sql.DB) {
 func createLogsTableIfNotExist(config models.DB_Config) {
 	var tableName string
 	// Check if the logs table exists in the database
-	err := DB.QueryRow(`SELECT table_name FROM information_schema.tables WHERE table_name = $1`, config.Logs.TableName).Scan(&tableName)
+	err := DB.QueryRow(`SELECT table_name FROM information_schema.tables WHERE table_name = `+utils.Placeholder(1), config.Logs.TableName).Scan(&tableName)
 	if err == sql.ErrNoRows {
 		// Table doesn't exist, so create it
 		logger.LogDebug("Logs table doesn't exist, creating it...")
-		_, err = DB.Exec(config.Logs.CreateTableQuery)
+		createQuery := config.Logs.CreateTableQuery
+		if utils.DBDriver == utils.DB_DRIVER_MYSQL {
+			// The default query uses Postgres types; partitioning is Postgres only
+			if createQuery == "" || createQuery == utils.DB_CREATE_TABLE_QUERY {
+				createQuery = utils.DB_CREATE_TABLE_QUERY_MYSQL
+			}
+		} else if utils.ConfigData.Partitioning {
+			createQuery = utils.DB_CREATE_PARTITIONED_TABLE_QUERY
+		}
+		_, err = DB.Exec(createQuery)
 		if err != nil {
 			logger.LogError(fmt.Sprintf("Error creating the logs table: %v\n", err))
 		}
-		indexExists("idx_time_local")
 		logger.LogDebug("Logs table created successfully!")
 	} else if err != nil {
 		logger.LogDebug(fmt.Sprintf("Error checking if logs table exists: %v\n", err))
 	} else {
 		logger.LogDebug("Logs table already exists.")
 	}
+	if utils.DBDriver == utils.DB_DRIVER_MYSQL {
+		// The migrations and indexes are written for Postgres, the MySQL table is created complete
+		if _, err := DB.Exec(utils.DB_CREATE_INGESTED_BATCHES_QUERY_MYSQL); err != nil {
+			logger.LogError(fmt.Sprintf("Error creating the %s table: %v\n", utils.DB_INGESTED_BATCHES_TABLE, err))
+		}
+		if utils.ConfigData.Partitioning {
+			logger.LogWarn("Partitioning is only supported on Postgres, the MySQL logs table is not partitioned")
+		}
+		return
+	}
+	migrateLogsTable()
+	createRequiredIndexes()
+	createLogsIndexes()
+	if utils.ConfigData.IdempotentInserts {
+		if _, err := DB.Exec(utils.DB_DEDUP_KEY_INDEX); err != nil {
+			logger.LogError(fmt.Sprintf("Error creating the dedup key index, re-posted logs may be stored twice: %v\n", err))
+		}
+	}
+
+	if utils.ConfigData.Partitioning {
+		if partitioned, err := isPartitioned(DB); err != nil {
+			logger.LogError(fmt.Sprintf("Error checking logs table partitioning: %v", err))
+		} else if !partitioned {
+			logger.LogWarn("Partitioning is enabled but the existing logs table is not partitioned, it is left as it is")
+		} else if err := EnsurePartitions(DB, time.Now()); err != nil {
+			logger.LogError(err)
+		}
+	}
+}
+
+// migrateLogsTable applies the idempotent schema migrations so that tables created
+// before a column was introduced are brought up to date.
+func migrateLogsTable() {
+	for _, stmt := range utils.LOGS_TABLE_MIGRATIONS {
+		if _, err := DB.Exec(stmt); err != nil {
+			logger.LogError(fmt.Sprintf("Error applying logs table migration %q: %v\n", stmt, err))
+		}
+	}
+}
+
+// createLogsIndexes creates the indexes of the configured PARSER_INDEXED_COLUMNS that don't exist yet.
+func createLogsIndexes() {
+	for _, stmt := range utils.GenerateIndexStatements(utils.ConfigData.IndexedColumns) {
+		if _, err := DB.Exec(stmt); err != nil {
+			logger.LogError(fmt.Sprintf("Error creating logs table index %q: %v\n", stmt, err))
+		}
+	}
+}
+
+// createRequiredIndexes creates the indexes on the REQUIRED_INDEXED_COLUMNS that don't exist yet.
+func createRequiredIndexes() {
+	for _, column := range utils.REQUIRED_INDEXED_COLUMNS {
+		if indexExists(utils.IndexName(column)) {
+			continue
+		}
+		stmt := utils.GenerateIndexStatements([]string{column})[0]
+		if _, err := DB.Exec(stmt); err != nil {
+			logger.LogError(fmt.Sprintf("Error creating logs table index %q: %v\n", stmt, err))
+		}
+	}
 }
 
+// indexExists reports whether the index exists. An error checking for it counts as existing,
+// so nothing is created on a guess.
 func indexExists(indexName string) bool {
 	var index string
 	err := DB.QueryRow(`SELECT indexname FROM pg_indexes WHERE indexname = $1`, indexName).Scan(&index)
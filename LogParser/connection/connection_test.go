@@ -4,11 +4,17 @@ import (
 	"LogParser/logger"
 	"LogParser/models"
 	_ "LogParser/models"
+	"LogParser/utils"
+	"context"
 	"database/sql"
+	"errors"
 	"os"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 )
 
 func init(){
@@ -90,6 +96,34 @@ func TestFirstLoad_EnvVars(t *testing.T) {
 	}
 }
 
+// TestFirstLoad_UsernameDoesNotSelectDriver guards against the driver name being taken from the username:
+// a non-default DB_USERNAME must still open the postgres driver
+func TestFirstLoad_UsernameDoesNotSelectDriver(t *testing.T) {
+	t.Setenv("DB_HOST", "envhost")
+	t.Setenv("DB_USERNAME", "loguser")
+
+	if err := FirstLoad(); err != nil {
+		t.Fatalf("FirstLoad returned error: %v", err)
+	}
+	driver, dsn, err := DataSourceName(ConfigData)
+	if err != nil {
+		t.Fatalf("DataSourceName returned error: %v", err)
+	}
+	if driver != utils.DB_DRIVER {
+		t.Errorf("Expected driver %q, got %q", utils.DB_DRIVER, driver)
+	}
+	if !regexp.MustCompile(`\buser=loguser\b`).MatchString(dsn) {
+		t.Errorf("Expected the connection string to carry the username, got %q", dsn)
+	}
+
+	// sql.Open only fails for an unregistered driver name, it does not connect
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("sql.Open(%q) returned error: %v", driver, err)
+	}
+	db.Close()
+}
+
 func TestGetEnvString_DefaultFallback(t *testing.T) {
 	os.Unsetenv("NON_EXISTENT_VAR")
 	defaultVal := "default"
@@ -119,12 +153,16 @@ func TestGetEnvInt(t *testing.T) {
 func setMockConfig() {
 	ConfigData = models.DB_Config{
 		Database: struct {
-			DBPort     string `yaml:"DB_PORT"`
-			DBHost     string `yaml:"DB_HOST"`
-			DBUsername string `yaml:"DB_USERNAME"`
-			DBPassword string `yaml:"DB_PASSWORD"`
-			DBName     string `yaml:"DB_NAME"`
-			DBSslMode  string `yaml:"DB_SSLMODE"`
+			DBPort            string `yaml:"DB_PORT"`
+			DBHost            string `yaml:"DB_HOST"`
+			DBUsername        string `yaml:"DB_USERNAME"`
+			DBPassword        string `yaml:"DB_PASSWORD"`
+			DBName            string `yaml:"DB_NAME"`
+			DBSslMode         string `yaml:"DB_SSLMODE"`
+			DBDriver          string `yaml:"DB_DRIVER"`
+			DBMaxOpenConns    int    `yaml:"DB_MAX_OPEN_CONNS"`
+			DBMaxIdleConns    int    `yaml:"DB_MAX_IDLE_CONNS"`
+			DBConnMaxLifetime int    `yaml:"DB_CONN_MAX_LIFETIME"`
 		}{
 			DBPort:     "5432",
 			DBHost:     "localhost",
@@ -161,6 +199,57 @@ func TestPingDB(t *testing.T) {
 	}
 }
 
+// TestPingDB_Reconnects simulates a lost connection: the ping fails, the first reconnect attempt fails too
+// and the second one sets up a new connection, which replaces the lost one
+func TestPingDB_Reconnects(t *testing.T) {
+	lost, lostMock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	lostMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	lostMock.ExpectClose()
+	fresh, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock: %v", err)
+	}
+	defer fresh.Close()
+
+	defer func(initDB func() *sql.DB, backoff time.Duration) { reconnectDB, reconnectBackoff = initDB, backoff }(reconnectDB, reconnectBackoff)
+	reconnectBackoff = time.Millisecond
+	attempts, failures := 0, 1
+	reconnectDB = func() *sql.DB {
+		attempts++
+		if failures > 0 {
+			failures--
+			return nil
+		}
+		setDB(fresh)
+		return fresh
+	}
+	DB = lost
+
+	success, conn := PingDB()
+	if !success || conn != fresh || DB != fresh {
+		t.Errorf("Expected the reconnected connection, got success=%v, conn=%v", success, conn)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 reconnect attempts, got %d", attempts)
+	}
+	if err := lostMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Expected the lost connection to be pinged and closed: %v", err)
+	}
+
+	// Giving up after the cap reports the database as down; the closed connection fails its ping
+	DB = lost
+	attempts, failures = 0, maxReconnectAttempts+1
+	if success, conn := PingDB(); success || conn != nil {
+		t.Errorf("Expected a failed reconnect, got success=%v, conn=%v", success, conn)
+	}
+	if attempts != maxReconnectAttempts {
+		t.Errorf("Expected %d reconnect attempts, got %d", maxReconnectAttempts, attempts)
+	}
+}
+
 // TestCreateLogsTableIfNotExist_TableDoesNotExist simulates missing table and ensures creation is triggered
 func TestCreateLogsTableIfNotExist_TableDoesNotExist(t *testing.T) {
 	db, mock, err := sqlmock.New()
@@ -179,12 +268,46 @@ func TestCreateLogsTableIfNotExist_TableDoesNotExist(t *testing.T) {
 	// Expect the table creation to be called
 	mock.ExpectExec("CREATE TABLE logs").WillReturnResult(sqlmock.NewResult(1, 1))
 
-	// Simulate checking index existence, and it does not exist
+	createLogsTableIfNotExist(*Config)
+}
+
+// TestCreateRequiredIndexes ensures the time_local and status indexes are created when indexExists reports them missing
+func TestCreateRequiredIndexes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	DB = db
+
 	mock.ExpectQuery(`SELECT indexname FROM pg_indexes WHERE indexname = \$1`).
 		WithArgs("idx_time_local").
 		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_time_local ON logs \(time_local\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT indexname FROM pg_indexes WHERE indexname = \$1`).
+		WithArgs("idx_status").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_status ON logs \(status\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	createLogsTableIfNotExist(*Config)
+	createRequiredIndexes()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unmet expectations: %s", err)
+	}
+
+	// Existing indexes are left alone
+	mock.ExpectQuery(`SELECT indexname FROM pg_indexes WHERE indexname = \$1`).
+		WithArgs("idx_time_local").
+		WillReturnRows(sqlmock.NewRows([]string{"indexname"}).AddRow("idx_time_local"))
+	mock.ExpectQuery(`SELECT indexname FROM pg_indexes WHERE indexname = \$1`).
+		WithArgs("idx_status").
+		WillReturnRows(sqlmock.NewRows([]string{"indexname"}).AddRow("idx_status"))
+
+	createRequiredIndexes()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unmet expectations: %s", err)
+	}
 }
 
 // TestCreateLogsTableIfNotExist_TableExists ensures no creation when table already exists
@@ -205,6 +328,129 @@ func TestCreateLogsTableIfNotExist_TableExists(t *testing.T) {
 	createLogsTableIfNotExist(*Config)
 }
 
+// TestCreateLogsTableIfNotExist_MySQL ensures MySQL binds with ? and gets the MySQL table in place of the default query
+func TestCreateLogsTableIfNotExist_MySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	DB = db
+	setMockConfig()
+	Config.Logs.CreateTableQuery = utils.DB_CREATE_TABLE_QUERY
+	defer func() { utils.DBDriver = utils.DB_DRIVER }()
+	utils.DBDriver = utils.DB_DRIVER_MYSQL
+
+	mock.ExpectQuery(`SELECT table_name FROM information_schema.tables WHERE table_name = \?`).
+		WithArgs("logs").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(regexp.QuoteMeta(utils.DB_CREATE_TABLE_QUERY_MYSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(utils.DB_CREATE_INGESTED_BATCHES_QUERY_MYSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	createLogsTableIfNotExist(*Config)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestDataSourceName checks the driver name and connection string built for each DB_DRIVER
+// TestEnsureSchema checks that the schema is applied on the first connection only, not again on the
+// reconnects of the configuration refresh.
+func TestEnsureSchema(t *testing.T) {
+	defer func(apply func(models.DB_Config), applied bool) { applySchema, schemaApplied = apply, applied }(applySchema, schemaApplied)
+	applies := 0
+	applySchema = func(models.DB_Config) { applies++ }
+	schemaApplied = false
+
+	ensureSchema(models.DB_Config{})
+	ensureSchema(models.DB_Config{})
+	if applies != 1 {
+		t.Errorf("expected the schema to be applied once, got %d", applies)
+	}
+}
+
+func TestDataSourceName(t *testing.T) {
+	setMockConfig()
+
+	tests := []struct {
+		driver     string
+		sslMode    string
+		wantDriver string
+		wantDSN    string
+	}{
+		{"", "disable", "postgres", "user=postgres password=password dbname=testdb sslmode=disable host=localhost port=5432"},
+		{"postgres", "require", "postgres", "user=postgres password=password dbname=testdb sslmode=require host=localhost port=5432"},
+		{"mysql", "disable", "mysql", "postgres:password@tcp(localhost:5432)/testdb?parseTime=true&tls=false"},
+		{"mysql", "verify-full", "mysql", "postgres:password@tcp(localhost:5432)/testdb?parseTime=true&tls=true"},
+	}
+	for _, tt := range tests {
+		config := ConfigData
+		config.Database.DBDriver = tt.driver
+		config.Database.DBSslMode = tt.sslMode
+
+		driver, dsn, err := DataSourceName(config)
+		if err != nil {
+			t.Fatalf("DataSourceName(%q) returned error: %v", tt.driver, err)
+		}
+		if driver != tt.wantDriver || dsn != tt.wantDSN {
+			t.Errorf("DataSourceName(%q) = %q, %q, want %q, %q", tt.driver, driver, dsn, tt.wantDriver, tt.wantDSN)
+		}
+	}
+
+	config := ConfigData
+	config.Database.DBDriver = "sqlite"
+	if _, _, err := DataSourceName(config); err == nil {
+		t.Error("Expected an error for an unsupported driver")
+	}
+}
+
+// TestConfigurePool checks the pool limits from the config are applied, and the defaults stand in for unset ones
+func TestConfigurePool(t *testing.T) {
+	setMockConfig()
+	config := ConfigData
+	config.Database.DBMaxOpenConns = 3
+	config.Database.DBMaxIdleConns = 2
+	config.Database.DBConnMaxLifetime = 60
+
+	maxOpen, maxIdle, maxLifetime := poolSettings(config)
+	if maxOpen != 3 || maxIdle != 2 || maxLifetime != time.Minute {
+		t.Errorf("poolSettings = %d, %d, %v, want 3, 2, 1m0s", maxOpen, maxIdle, maxLifetime)
+	}
+	maxOpen, maxIdle, maxLifetime = poolSettings(ConfigData)
+	if maxOpen != utils.DB_MAX_OPEN_CONNS || maxIdle != utils.DB_MAX_IDLE_CONNS || maxLifetime != time.Duration(utils.DB_CONN_MAX_LIFETIME)*time.Second {
+		t.Errorf("poolSettings without limits = %d, %d, %v, want the defaults", maxOpen, maxIdle, maxLifetime)
+	}
+
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	configurePool(db, config)
+
+	// Hold more connections than may idle, then hand them all back
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("failed to get connection %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	stats := db.Stats()
+	if stats.MaxOpenConnections != 3 {
+		t.Errorf("Expected MaxOpenConnections 3, got %d", stats.MaxOpenConnections)
+	}
+	if stats.Idle != 2 || stats.MaxIdleClosed != 1 {
+		t.Errorf("Expected 2 idle connections and 1 closed over the idle limit, got %d and %d", stats.Idle, stats.MaxIdleClosed)
+	}
+}
+
 // TestIndexExists_IndexExists checks behavior when index exists
 func TestIndexExists_IndexExists(t *testing.T) {
 	db, mock, err := sqlmock.New()
@@ -239,4 +485,492 @@ func TestIndexExists_IndexDoesNotExist(t *testing.T) {
 	if indexExists("nonexistent_index") {
 		t.Errorf("Expected index to not exist but got true")
 	}
-}
\ No newline at end of file
+}
+// TestMigrateLogsTable_AddsIngestedAt ensures existing tables gain the ingested_at column defaulted to NOW()
+func TestMigrateLogsTable_AddsIngestedAt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	DB = db
+	setMockConfig()
+	defer func(columns []string) { utils.ConfigData.IndexedColumns = columns }(utils.ConfigData.IndexedColumns)
+	utils.ConfigData.IndexedColumns = utils.ParseIndexedColumns(utils.PARSER_INDEXED_COLUMNS)
+
+	mock.ExpectQuery(`SELECT table_name FROM information_schema.tables WHERE table_name = \$1`).
+		WithArgs("logs").
+		WillReturnRows(sqlmock.NewRows([]string{"table_name"}).AddRow("logs"))
+	mock.ExpectExec(`ALTER TABLE logs ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ DEFAULT NOW\(\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, index := range []string{"idx_time_local", "idx_status"} {
+		mock.ExpectQuery(`SELECT indexname FROM pg_indexes WHERE indexname = \$1`).
+			WithArgs(index).
+			WillReturnRows(sqlmock.NewRows([]string{"indexname"}).AddRow(index))
+	}
+	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_ingested_at ON logs \(ingested_at\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	createLogsTableIfNotExist(*Config)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unmet expectations: %s", err)
+	}
+}
+
+// TestCreateLogsIndexes checks that exactly the configured indexes are created
+func TestCreateLogsIndexes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	DB = db
+	defer func(columns []string) { utils.ConfigData.IndexedColumns = columns }(utils.ConfigData.IndexedColumns)
+	utils.ConfigData.IndexedColumns = []string{"status", "remote_addr"}
+
+	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_status ON logs \(status\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_remote_addr ON logs \(remote_addr\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	createLogsIndexes()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unmet expectations: %s", err)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	if !IsRetryableError(&pq.Error{Code: "40001"}) {
+		t.Errorf("Expected serialization failure to be retryable")
+	}
+	if !IsRetryableError(&pq.Error{Code: "40P01"}) {
+		t.Errorf("Expected deadlock to be retryable")
+	}
+	if IsRetryableError(&pq.Error{Code: "23505"}) {
+		t.Errorf("Expected unique violation not to be retryable")
+	}
+	if IsRetryableError(errors.New("connection refused")) {
+		t.Errorf("Expected non-Postgres error not to be retryable")
+	}
+}
+
+// TestExecWithRetry_RetriesDeadlock checks that a deadlocked insert is retried and the retry succeeds
+func TestExecWithRetry_RetriesDeadlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	defer func(retries int, backoff time.Duration) {
+		utils.ConfigData.InsertMaxRetries = retries
+		insertRetryBackoff = backoff
+	}(utils.ConfigData.InsertMaxRetries, insertRetryBackoff)
+	utils.ConfigData.InsertMaxRetries = 3
+	insertRetryBackoff = time.Millisecond
+
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(&pq.Error{Code: "40P01", Message: "deadlock detected"})
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	result, err := ExecWithRetry(context.Background(), db, "INSERT INTO logs (remote_addr) VALUES ($1)", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Expected retry to succeed, got %v", err)
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		t.Errorf("Expected 1 row affected, got %d", rows)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unmet expectations: %s", err)
+	}
+}
+
+// TestExecWithRetry_GivesUp checks that retries are bounded and non-retryable errors are returned at once
+func TestExecWithRetry_GivesUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	defer func(retries int, backoff time.Duration) {
+		utils.ConfigData.InsertMaxRetries = retries
+		insertRetryBackoff = backoff
+	}(utils.ConfigData.InsertMaxRetries, insertRetryBackoff)
+	utils.ConfigData.InsertMaxRetries = 1
+	insertRetryBackoff = time.Millisecond
+
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(&pq.Error{Code: "40001"})
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(&pq.Error{Code: "40001"})
+	if _, err := ExecWithRetry(context.Background(), db, "INSERT INTO logs (remote_addr) VALUES ($1)", "127.0.0.1"); !IsRetryableError(err) {
+		t.Errorf("Expected the last serialization failure to be returned, got %v", err)
+	}
+
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(&pq.Error{Code: "23505"})
+	if _, err := ExecWithRetry(context.Background(), db, "INSERT INTO logs (remote_addr) VALUES ($1)", "127.0.0.1"); err == nil {
+		t.Errorf("Expected unique violation to be returned")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unmet expectations: %s", err)
+	}
+}
+
+func TestEnsurePartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(ahead int) { utils.ConfigData.PartitionsAhead = ahead }(utils.ConfigData.PartitionsAhead)
+	utils.ConfigData.PartitionsAhead = 1
+
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CREATE_DEFAULT_PARTITION)).WillReturnResult(sqlmock.NewResult(0, 0))
+	// December exists already and is left untouched
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_PARTITION_EXISTS)).WithArgs("logs_y2025m12").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_PARTITION_EXISTS)).WithArgs("logs_y2026m01").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TEMP TABLE logs_moved ON COMMIT DROP AS WITH moved AS (DELETE FROM logs_default WHERE time_local >= '2026-01-01T00:00:00Z' AND time_local < '2026-02-01T00:00:00Z' RETURNING *)")).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS logs_y2026m01 PARTITION OF logs")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_RESTORE_MOVED_LOGS)).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	if err := EnsurePartitions(db, time.Date(2025, time.December, 20, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("EnsurePartitions failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestEnsurePartitions_RollsBack checks that the logs moved out of the default partition are put back
+// when the partition cannot be created.
+func TestEnsurePartitions_RollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(ahead int) { utils.ConfigData.PartitionsAhead = ahead }(utils.ConfigData.PartitionsAhead)
+	utils.ConfigData.PartitionsAhead = 0
+
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CREATE_DEFAULT_PARTITION)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_PARTITION_EXISTS)).WithArgs("logs_y2025m12").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TEMP TABLE logs_moved")).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS logs_y2025m12 PARTITION OF logs")).WillReturnError(errors.New("lock timeout"))
+	mock.ExpectRollback()
+
+	if err := EnsurePartitions(db, time.Date(2025, time.December, 20, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("expected EnsurePartitions to fail")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestPurgeExpiredLogs_DropsPartitions checks that a partitioned table is purged by dropping whole
+// expired partitions, without any row-by-row DELETE.
+func TestPurgeExpiredLogs_DropsPartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(days int) { utils.ConfigData.RetentionDays = days }(utils.ConfigData.RetentionDays)
+	utils.ConfigData.RetentionDays = 60
+
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_IS_PARTITIONED)).WithArgs("logs").
+		WillReturnRows(sqlmock.NewRows([]string{"partitioned"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_LIST_PARTITIONS)).WithArgs("logs").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).
+			AddRow("logs_default").AddRow("logs_y2025m01").AddRow("logs_y2025m02").AddRow("logs_y2025m03").AddRow("logs_y2025m04"))
+	// Cutoff is 2025-02-14: only January has fully expired
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS logs_y2025m01;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	// Expired logs the default partition caught are deleted
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_DELETE_DEFAULT_PARTITION_BEFORE)).WithArgs(time.Date(2025, time.February, 14, 0, 0, 0, 0, time.UTC)).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	removed, err := PurgeExpiredLogs(db, time.Date(2025, time.April, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil || removed != 1 {
+		t.Errorf("expected 1 partition dropped, got %d, err=%v", removed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPurgeExpiredLogs_DeletesRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(days int) { utils.ConfigData.RetentionDays = days }(utils.ConfigData.RetentionDays)
+	utils.ConfigData.RetentionDays = 30
+
+	now := time.Date(2025, time.April, 15, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_IS_PARTITIONED)).WithArgs("logs").
+		WillReturnRows(sqlmock.NewRows([]string{"partitioned"}).AddRow(false))
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_DELETE_BEFORE)).WithArgs(now.AddDate(0, 0, -30)).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+
+	removed, err := PurgeExpiredLogs(db, now)
+	if err != nil || removed != 42 {
+		t.Errorf("expected 42 rows deleted, got %d, err=%v", removed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestMaintainLogsTable checks that the maintenance loop purges expired rows every interval until stopped
+func TestMaintainLogsTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	DB = db
+	defer func(days, ttl int) { utils.ConfigData.RetentionDays, utils.ConfigData.BatchAckTTL = days, ttl }(utils.ConfigData.RetentionDays, utils.ConfigData.BatchAckTTL)
+	utils.ConfigData.RetentionDays = 30
+	utils.ConfigData.BatchAckTTL = 0
+
+	// Partition upkeep is checked, then expired rows are deleted
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_IS_PARTITIONED)).WithArgs("logs").
+		WillReturnRows(sqlmock.NewRows([]string{"partitioned"}).AddRow(false))
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_IS_PARTITIONED)).WithArgs("logs").
+		WillReturnRows(sqlmock.NewRows([]string{"partitioned"}).AddRow(false))
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_DELETE_BEFORE)).WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		MaintainLogsTable(10*time.Millisecond, stop)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestStoreLookupValues checks that repeated values are stored once and empty values are skipped
+func TestStoreLookupValues(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	values := []string{"curl/8.0", "Mozilla/5.0", "", "curl/8.0", "Mozilla/5.0"}
+	distinct := pq.Array([]string{"Mozilla/5.0", "curl/8.0"})
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_agents (value) SELECT DISTINCT unnest($1::text[]) ON CONFLICT (value) DO NOTHING")).
+		WithArgs(distinct).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, value FROM user_agents WHERE value = ANY($1::text[])")).
+		WithArgs(distinct).WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow(1, "Mozilla/5.0").AddRow(2, "curl/8.0"))
+
+	ids, err := StoreLookupValues(context.Background(), db, utils.DB_USER_AGENTS_TABLE, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 2 || ids["Mozilla/5.0"] != 1 || ids["curl/8.0"] != 2 {
+		t.Errorf("unexpected ids: %v", ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+
+	// A batch with only empty values needs no queries
+	ids, err = StoreLookupValues(context.Background(), db, utils.DB_USER_AGENTS_TABLE, []string{"", ""})
+	if err != nil || len(ids) != 0 {
+		t.Errorf("expected no ids, got %v, err=%v", ids, err)
+	}
+}
+
+// TestLookupBatch checks that only batches processed within the TTL are found
+func TestLookupBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(ttl int) { utils.ConfigData.BatchAckTTL = ttl }(utils.ConfigData.BatchAckTTL)
+	utils.ConfigData.BatchAckTTL = 3600
+
+	now := time.Date(2025, time.April, 15, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_SELECT_BATCH)).WithArgs("batch-1", now.Add(-time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted", "rejected"}).AddRow(98, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_SELECT_BATCH)).WithArgs("batch-2", now.Add(-time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted", "rejected"}))
+
+	inserted, rejected, found, err := LookupBatch(context.Background(), db, "batch-1", now)
+	if err != nil || !found || inserted != 98 || rejected != 2 {
+		t.Errorf("expected batch-1 with 98 inserted and 2 rejected, got %d, %d, found=%v, err=%v", inserted, rejected, found, err)
+	}
+	_, _, found, err = LookupBatch(context.Background(), db, "batch-2", now)
+	if err != nil || found {
+		t.Errorf("expected batch-2 not to be found, got found=%v, err=%v", found, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestClaimBatch checks that a batch is claimed when its id is not recorded, or only by an expired
+// record, and reported as processed when the claim affects no row.
+func TestClaimBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(ttl int) { utils.ConfigData.BatchAckTTL = ttl }(utils.ConfigData.BatchAckTTL)
+	utils.ConfigData.BatchAckTTL = 3600
+
+	now := time.Date(2025, time.April, 15, 12, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CLAIM_BATCH)).WithArgs("batch-1", 2, now.Add(-time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_SET_BATCH_INSERTED)).WithArgs(int64(98), "batch-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CLAIM_BATCH)).WithArgs("batch-2", 0, now.Add(-time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	if err := ClaimBatch(context.Background(), tx, "batch-1", 2, now); err != nil {
+		t.Errorf("expected batch-1 to be claimed, got %v", err)
+	}
+	if err := SetBatchInserted(context.Background(), tx, "batch-1", 98); err != nil {
+		t.Errorf("expected the inserted logs of batch-1 to be recorded, got %v", err)
+	}
+	if err := ClaimBatch(context.Background(), tx, "batch-2", 0, now); !errors.Is(err, ErrBatchProcessed) {
+		t.Errorf("expected batch-2 to be processed already, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestClaimBatch_MySQL checks the MySQL claim, which binds processed_at and the expiry of each assignment
+func TestClaimBatch_MySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(ttl int) { utils.ConfigData.BatchAckTTL = ttl }(utils.ConfigData.BatchAckTTL)
+	utils.ConfigData.BatchAckTTL = 3600
+	defer func() { utils.DBDriver = utils.DB_DRIVER }()
+	utils.DBDriver = utils.DB_DRIVER_MYSQL
+
+	now := time.Date(2025, time.April, 15, 12, 0, 0, 0, time.UTC)
+	since := now.Add(-time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CLAIM_BATCH_MYSQL)).WithArgs("batch-1", 2, now, since, since, since).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE ingested_batches SET inserted = ? WHERE batch_id = ?")).WithArgs(int64(98), "batch-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CLAIM_BATCH_MYSQL)).WithArgs("batch-2", 0, now, since, since, since).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("failed to begin: %v", err)
+	}
+	if err := ClaimBatch(context.Background(), tx, "batch-1", 2, now); err != nil {
+		t.Errorf("expected batch-1 to be claimed, got %v", err)
+	}
+	if err := SetBatchInserted(context.Background(), tx, "batch-1", 98); err != nil {
+		t.Errorf("expected the inserted logs of batch-1 to be recorded, got %v", err)
+	}
+	if err := ClaimBatch(context.Background(), tx, "batch-2", 0, now); !errors.Is(err, ErrBatchProcessed) {
+		t.Errorf("expected batch-2 to be processed already, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestPurgeExpiredLogs_MySQL checks that MySQL deletes expired rows without querying pg_class
+func TestPurgeExpiredLogs_MySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(days int) { utils.ConfigData.RetentionDays = days }(utils.ConfigData.RetentionDays)
+	utils.ConfigData.RetentionDays = 30
+	defer func() { utils.DBDriver = utils.DB_DRIVER }()
+	utils.DBDriver = utils.DB_DRIVER_MYSQL
+
+	now := time.Date(2025, time.April, 15, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM logs WHERE time_local < ?")).WithArgs(now.AddDate(0, 0, -30)).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	removed, err := PurgeExpiredLogs(db, now)
+	if err != nil || removed != 5 {
+		t.Errorf("expected 5 rows deleted, got %d, err=%v", removed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// TestCheckDriverFeatures checks that string de-duplication is rejected on MySQL
+func TestCheckDriverFeatures(t *testing.T) {
+	defer func(dedup bool) { utils.ConfigData.DedupStrings = dedup }(utils.ConfigData.DedupStrings)
+
+	utils.ConfigData.DedupStrings = true
+	if err := checkDriverFeatures(utils.DB_DRIVER_MYSQL); err == nil {
+		t.Error("expected string de-duplication to be rejected on mysql")
+	}
+	if err := checkDriverFeatures(utils.DB_DRIVER); err != nil {
+		t.Errorf("expected string de-duplication to be accepted on postgres, got %v", err)
+	}
+	utils.ConfigData.DedupStrings = false
+	if err := checkDriverFeatures(utils.DB_DRIVER_MYSQL); err != nil {
+		t.Errorf("expected mysql to be accepted without string de-duplication, got %v", err)
+	}
+}
+
+func TestPurgeExpiredBatches(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+	defer func(ttl int) { utils.ConfigData.BatchAckTTL = ttl }(utils.ConfigData.BatchAckTTL)
+
+	// Disabled: nothing to purge
+	utils.ConfigData.BatchAckTTL = 0
+	if removed, err := PurgeExpiredBatches(db, time.Now()); err != nil || removed != 0 {
+		t.Errorf("expected no purge while disabled, got %d, err=%v", removed, err)
+	}
+
+	utils.ConfigData.BatchAckTTL = 600
+	now := time.Date(2025, time.April, 15, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_DELETE_BATCHES_BEFORE)).WithArgs(now.Add(-10 * time.Minute)).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+
+	removed, err := PurgeExpiredBatches(db, now)
+	if err != nil || removed != 7 {
+		t.Errorf("expected 7 batch ids purged, got %d, err=%v", removed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package connection
+
+import (
+	"LogParser/models"
+	"LogParser/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// StoreLookupValues makes sure every value is stored in the given lookup table and returns the id
+// of each one. Values already present keep their id; empty values are skipped.
+func StoreLookupValues(ctx context.Context, db *sql.DB, table string, values []string) (map[string]int, error) {
+	ids := make(map[string]int)
+
+	seen := make(map[string]bool)
+	var distinct []string
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			distinct = append(distinct, value)
+		}
+	}
+	if len(distinct) == 0 {
+		return ids, nil
+	}
+	// Sorted so concurrent batches take the unique index locks in the same order
+	sort.Strings(distinct)
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(utils.QUERY_INSERT_LOOKUP_VALUES, table), pq.Array(distinct)); err != nil {
+		return nil, fmt.Errorf("error storing %s: %v", table, err)
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(utils.QUERY_SELECT_LOOKUP_IDS, table), pq.Array(distinct))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s ids: %v", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, fmt.Errorf("error reading %s ids: %v", table, err)
+		}
+		ids[value] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s ids: %v", table, err)
+	}
+	return ids, nil
+}
+
+// StoreLogLookups stores the user agents and referers of the logs in their lookup tables and
+// returns the ids of both, keyed by value.
+func StoreLogLookups(ctx context.Context, db *sql.DB, logs []models.Log) (userAgentIDs map[string]int, refererIDs map[string]int, err error) {
+	userAgents := make([]string, len(logs))
+	referers := make([]string, len(logs))
+	for i, log := range logs {
+		userAgents[i] = log.HttpUserAgent
+		referers[i] = log.HttpReferer
+	}
+
+	if userAgentIDs, err = StoreLookupValues(ctx, db, utils.DB_USER_AGENTS_TABLE, userAgents); err != nil {
+		return nil, nil, err
+	}
+	if refererIDs, err = StoreLookupValues(ctx, db, utils.DB_REFERERS_TABLE, referers); err != nil {
+		return nil, nil, err
+	}
+	return userAgentIDs, refererIDs, nil
+}
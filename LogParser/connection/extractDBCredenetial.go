@@ -28,22 +28,34 @@ func FirstLoad() error {
 	dbPassword := getEnvString(utils.KEY_DB_PASSWORD, utils.DB_PASSWORD)
 	dbName := getEnvString(utils.KEY_DB_NAME, utils.DB_NAME)
 	dbSslMode := getEnvString(utils.KEY_DB_SSLMODE, utils.DB_SSLMODE)
+	dbDriver := getEnvString(utils.KEY_DB_DRIVER, utils.DB_DRIVER)
+	dbMaxOpenConns := getEnvInt(utils.KEY_DB_MAX_OPEN_CONNS, utils.DB_MAX_OPEN_CONNS)
+	dbMaxIdleConns := getEnvInt(utils.KEY_DB_MAX_IDLE_CONNS, utils.DB_MAX_IDLE_CONNS)
+	dbConnMaxLifetime := getEnvInt(utils.KEY_DB_CONN_MAX_LIFETIME, utils.DB_CONN_MAX_LIFETIME)
 
 	// Set the database configuration
 	ConfigData.Database = struct {
-		DBPort     string `yaml:"DB_PORT"`
-		DBHost     string `yaml:"DB_HOST"`
-		DBUsername string `yaml:"DB_USERNAME"`
-		DBPassword string `yaml:"DB_PASSWORD"`
-		DBName     string `yaml:"DB_NAME"`
-		DBSslMode  string `yaml:"DB_SSLMODE"`
+		DBPort            string `yaml:"DB_PORT"`
+		DBHost            string `yaml:"DB_HOST"`
+		DBUsername        string `yaml:"DB_USERNAME"`
+		DBPassword        string `yaml:"DB_PASSWORD"`
+		DBName            string `yaml:"DB_NAME"`
+		DBSslMode         string `yaml:"DB_SSLMODE"`
+		DBDriver          string `yaml:"DB_DRIVER"`
+		DBMaxOpenConns    int    `yaml:"DB_MAX_OPEN_CONNS"`
+		DBMaxIdleConns    int    `yaml:"DB_MAX_IDLE_CONNS"`
+		DBConnMaxLifetime int    `yaml:"DB_CONN_MAX_LIFETIME"`
 	}{
-		DBPort:     dbPort,
-		DBHost:     dbHost,
-		DBUsername: dbUsername,
-		DBPassword: dbPassword,
-		DBName:     dbName,
-		DBSslMode:  dbSslMode,
+		DBPort:            dbPort,
+		DBHost:            dbHost,
+		DBUsername:        dbUsername,
+		DBPassword:        dbPassword,
+		DBName:            dbName,
+		DBSslMode:         dbSslMode,
+		DBDriver:          dbDriver,
+		DBMaxOpenConns:    dbMaxOpenConns,
+		DBMaxIdleConns:    dbMaxIdleConns,
+		DBConnMaxLifetime: dbConnMaxLifetime,
 	}
 
 	// Set the log table configuration
@@ -0,0 +1,174 @@
+package connection
+
+import (
+	"LogParser/logger"
+	"LogParser/utils"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// isPartitioned reports whether the logs table is a partitioned table.
+func isPartitioned(db *sql.DB) (bool, error) {
+	if utils.DBDriver == utils.DB_DRIVER_MYSQL {
+		// The check reads pg_class; MySQL logs tables are never partitioned
+		return false, nil
+	}
+	var partitioned bool
+	err := db.QueryRow(utils.QUERY_IS_PARTITIONED, utils.DB_TABLE_NAME).Scan(&partitioned)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return partitioned, err
+}
+
+// EnsurePartitions creates the default partition and the monthly partitions from now's month
+// through PartitionsAhead months ahead. Existing partitions are left untouched.
+func EnsurePartitions(db *sql.DB, now time.Time) error {
+	if _, err := db.Exec(utils.QUERY_CREATE_DEFAULT_PARTITION); err != nil {
+		return fmt.Errorf("error creating default partition: %v", err)
+	}
+	month := utils.MonthStart(now)
+	for i := 0; i <= utils.ConfigData.PartitionsAhead; i++ {
+		if err := createPartition(db, month.AddDate(0, i, 0)); err != nil {
+			return fmt.Errorf("error creating partition %s: %v", utils.PartitionName(month.AddDate(0, i, 0)), err)
+		}
+	}
+	return nil
+}
+
+// createPartition creates the partition of month's month unless it exists. The logs of the month the
+// default partition caught meanwhile are moved to it in the same transaction.
+func createPartition(db *sql.DB, month time.Time) error {
+	var exists bool
+	if err := db.QueryRow(utils.QUERY_PARTITION_EXISTS, utils.PartitionName(month)).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{utils.GenerateMoveDefaultRowsQuery(month), utils.GenerateCreatePartitionQuery(month), utils.QUERY_RESTORE_MOVED_LOGS} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PurgeExpiredLogs removes the logs older than RetentionDays. On a partitioned table the monthly
+// partitions holding only expired logs are dropped whole; logs in the partition straddling the
+// cutoff are kept until their whole month has expired. Expired rows of the default partition, and
+// of a table that is not partitioned, are deleted. It returns the number of partitions dropped or
+// rows deleted.
+func PurgeExpiredLogs(db *sql.DB, now time.Time) (int64, error) {
+	if utils.ConfigData.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := now.AddDate(0, 0, -utils.ConfigData.RetentionDays)
+
+	partitioned, err := isPartitioned(db)
+	if err != nil {
+		return 0, err
+	}
+	if !partitioned {
+		result, err := db.Exec(utils.DriverQuery(utils.QUERY_DELETE_BEFORE), cutoff)
+		if err != nil {
+			return 0, err
+		}
+		return result.RowsAffected()
+	}
+
+	rows, err := db.Query(utils.QUERY_LIST_PARTITIONS, utils.DB_TABLE_NAME)
+	if err != nil {
+		return 0, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var dropped int64
+	for _, name := range utils.ExpiredPartitions(names, cutoff) {
+		if _, err := db.Exec(utils.GenerateDropPartitionQuery(name)); err != nil {
+			return dropped, fmt.Errorf("error dropping partition %s: %v", name, err)
+		}
+		logger.LogInfo(fmt.Sprintf("Dropped expired partition %s", name))
+		dropped++
+	}
+
+	result, err := db.Exec(utils.QUERY_DELETE_DEFAULT_PARTITION_BEFORE, cutoff)
+	if err != nil {
+		return dropped, fmt.Errorf("error purging the default partition: %v", err)
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted > 0 {
+		// Not counted with the partitions, the write version is bumped here instead
+		utils.BumpWriteVersion()
+		logger.LogInfo(fmt.Sprintf("Retention purge deleted %d rows of the default partition", deleted))
+	}
+	return dropped, nil
+}
+
+// maintainLogsTable keeps upcoming partitions created and purges expired logs and batch ids.
+func maintainLogsTable(db *sql.DB, now time.Time) {
+	partitioned, err := isPartitioned(db)
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Error checking logs table partitioning: %v", err))
+		return
+	}
+	if partitioned {
+		if err := EnsurePartitions(db, now); err != nil {
+			logger.LogError(err)
+		}
+	}
+	removed, err := PurgeExpiredLogs(db, now)
+	if removed > 0 {
+		utils.BumpWriteVersion()
+	}
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Error purging expired logs: %v", err))
+	} else if removed > 0 && partitioned {
+		logger.LogInfo(fmt.Sprintf("Retention purge dropped %d partitions", removed))
+	} else if removed > 0 {
+		logger.LogInfo(fmt.Sprintf("Retention purge deleted %d rows", removed))
+	}
+	if removed, err := PurgeExpiredBatches(db, now); err != nil {
+		logger.LogError(fmt.Sprintf("Error purging expired batch ids: %v", err))
+	} else if removed > 0 {
+		logger.LogDebug(fmt.Sprintf("Purged %d expired batch ids", removed))
+	}
+}
+
+// MaintainLogsTable runs the partition upkeep, retention purge and batch id purge every interval until
+// stop is closed. A run is skipped while the database is unreachable.
+func MaintainLogsTable(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			success, db := PingDB()
+			if !success {
+				logger.LogWarn("Skipping logs table maintenance, the database is unreachable")
+				continue
+			}
+			maintainLogsTable(db, time.Now())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package connection
+
+import (
+	"LogParser/logger"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxReconnectAttempts caps the attempts of one reconnect; the next failed ping starts over.
+// maxReconnectBackoff caps the delay between them.
+const (
+	maxReconnectAttempts = 5
+	maxReconnectBackoff  = 5 * time.Second
+)
+
+// reconnectBackoff is the delay after the first failed attempt; it doubles on each further one.
+var reconnectBackoff = 100 * time.Millisecond
+
+var (
+	dbMu          sync.RWMutex // Guards DB against the reconnects replacing it while handlers read it.
+	reconnectMu   sync.Mutex   // Serializes InitDB and reconnect, so one connection is set up at a time.
+	reconnectRuns atomic.Int64 // The number of reconnects run, for callers to tell one ran while they waited.
+)
+
+// reconnectDB is the InitDB run by every reconnect attempt, in a single connection attempt since
+// reconnect backs off itself. It is replaced in tests.
+var reconnectDB = func() *sql.DB {
+	return initDB(1)
+}
+
+// currentDB returns DB, guarded against a reconnect replacing it.
+func currentDB() *sql.DB {
+	dbMu.RLock()
+	defer dbMu.RUnlock()
+	return DB
+}
+
+// setDB replaces DB.
+func setDB(db *sql.DB) {
+	dbMu.Lock()
+	DB = db
+	dbMu.Unlock()
+}
+
+// reconnect re-runs InitDB after a failed ping, up to maxReconnectAttempts times with exponential backoff,
+// and closes the lost connection once a new one is set up. Concurrent callers wait for the reconnect in
+// progress and share its outcome instead of starting another; seen is the reconnectRuns a caller read
+// before its ping failed.
+func reconnect(seen int64) (bool, *sql.DB) {
+	reconnectMu.Lock()
+	defer reconnectMu.Unlock()
+	if reconnectRuns.Load() != seen {
+		// A reconnect ran while this caller waited
+		if db := currentDB(); pingDB(db) {
+			return true, db
+		}
+		return false, nil
+	}
+	defer reconnectRuns.Add(1)
+
+	lost := currentDB()
+	backoff := reconnectBackoff
+	for attempt := 1; attempt <= maxReconnectAttempts; attempt++ {
+		logger.LogWarn(fmt.Sprintf("Database connection lost, reconnecting (attempt %d of %d)", attempt, maxReconnectAttempts))
+		if db := reconnectDB(); db != nil {
+			if lost != nil && lost != db {
+				lost.Close()
+			}
+			logger.LogInfo("Reconnected to the database")
+			return true, db
+		}
+		if attempt < maxReconnectAttempts {
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxReconnectBackoff)
+		}
+	}
+	logger.LogError(fmt.Sprintf("Could not reconnect to the database after %d attempts", maxReconnectAttempts))
+	return false, nil
+}
@@ -0,0 +1,105 @@
+package connection
+
+import (
+	"LogParser/logger"
+	"LogParser/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Postgres error codes that are safe to retry: the transaction was rolled back as a whole.
+const (
+	pqSerializationFailure = "40001"
+	pqDeadlockDetected     = "40P01"
+)
+
+// insertRetryBackoff is the delay before the first retry; it doubles on each further attempt.
+var insertRetryBackoff = 50 * time.Millisecond
+
+// IsRetryableError reports whether err is a Postgres serialization failure or deadlock.
+func IsRetryableError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == pqSerializationFailure || pqErr.Code == pqDeadlockDetected
+	}
+	return false
+}
+
+// ExecWithRetry runs an insert statement, retrying up to utils.ConfigData.InsertMaxRetries times
+// with exponential backoff when Postgres reports a serialization failure or deadlock.
+// Other errors, and cancellation of ctx, end the attempts immediately.
+func ExecWithRetry(ctx context.Context, db *sql.DB, query string, args ...interface{}) (sql.Result, error) {
+	return withRetry(ctx, func() (sql.Result, error) {
+		return db.ExecContext(ctx, query, args...)
+	})
+}
+
+// InsertInTx runs insert in a transaction, committing it when insert succeeds and rolling it back
+// when it fails, so the rows it writes are stored all together or not at all. A transaction failing
+// with a serialization failure or deadlock is retried as a whole, like ExecWithRetry.
+func InsertInTx(ctx context.Context, db *sql.DB, insert func(tx *sql.Tx) (int64, error)) (int64, error) {
+	return withRetry(ctx, func() (int64, error) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		rows, err := insert(tx)
+		if err != nil {
+			// A cancelled ctx has already rolled the transaction back
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				logger.LogContext(ctx, "warn", fmt.Sprintf("Failed to roll back insert: %v", rollbackErr))
+			}
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return rows, nil
+	})
+}
+
+// CopyLogs writes rows into the given columns of the logs table with a single COPY in tx.
+// The result reports the number of rows copied.
+func CopyLogs(ctx context.Context, tx *sql.Tx, columns []string, rows [][]interface{}) (sql.Result, error) {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("logs", columns...))
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return nil, err
+		}
+	}
+	// Executing without values flushes the COPY and reports the rows copied
+	result, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return result, stmt.Close()
+}
+
+// withRetry runs an insert, retrying it as described for ExecWithRetry.
+func withRetry[T any](ctx context.Context, insert func() (T, error)) (T, error) {
+	backoff := insertRetryBackoff
+	for attempt := 0; ; attempt++ {
+		result, err := insert()
+		if err == nil || !IsRetryableError(err) || attempt >= utils.ConfigData.InsertMaxRetries {
+			return result, err
+		}
+
+		logger.LogContext(ctx, "warn", fmt.Sprintf("Retryable insert error (attempt %d of %d), retrying in %v: %v", attempt+1, utils.ConfigData.InsertMaxRetries+1, backoff, err))
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"LogParser/alerts"
+	"LogParser/connection"
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// alertStore holds the alerts of the running alert engine, nil while alerting is disabled.
+var alertStore *alerts.AlertStore
+
+// SetAlertStore makes the running alert engine's alerts reachable by the admin endpoints.
+func SetAlertStore(store *alerts.AlertStore) {
+	alertStore = store
+}
+
+// mlConfigFile is the YAML file ReloadMLHandler re-reads the ML section from.
+var mlConfigFile = utils.CONFIG_FILE_NAME
+
+// ReloadMLHandler re-reads the ML section of config.yaml and swaps it into the running analyzers
+// (POST /admin/reload-ml). Every attack pattern is compiled first: if any setting is invalid, the
+// reload is rejected and the analyzers keep running with their current settings.
+func ReloadMLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	if mlService == nil {
+		models.SendResponse(w, http.StatusInternalServerError, false, "ML service not initialized", nil)
+		return
+	}
+
+	settings, err := utils.LoadMLSettingsFromYaml(mlConfigFile)
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Error reading ML settings: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to read ML settings", nil)
+		return
+	}
+
+	if err := mlService.Apply(settings); err != nil {
+		logger.LogWarn(fmt.Sprintf("ML reload rejected: %v", err))
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid ML settings, keeping the current ones: %v", err), nil)
+		return
+	}
+	// Tenants' services run with the same settings
+	for _, service := range allMLServices()[1:] {
+		if err := service.Apply(settings); err != nil {
+			logger.LogWarn(fmt.Sprintf("ML reload of a tenant failed: %v", err))
+		}
+	}
+
+	config, patterns := mlService.Config()
+	models.SendResponse(w, http.StatusOK, true, "ML settings reloaded", map[string]interface{}{
+		"config":          config,
+		"attack_patterns": len(patterns),
+	})
+}
+
+// PurgeIPHandler removes every trace of an IP address (DELETE /admin/ip/{addr}), for right to be
+// forgotten requests: the log rows it sent, the behavior the security analyzer tracks for it, and
+// the active alerts referencing it. Logs already exported to the archive bucket are not touched.
+func PurgeIPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	addr := r.PathValue("addr")
+	if net.ParseIP(addr) == nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid IP address: '%s'", addr), nil)
+		return
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	result, err := db.Exec(utils.DriverQuery(utils.QUERY_DELETE_LOGS_BY_IP), addr)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to delete logs of an IP: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to delete logs: %v", err), nil)
+		return
+	}
+	logsDeleted, err := result.RowsAffected()
+	if err != nil {
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to retrieve affected rows: %v", err), nil)
+		return
+	}
+
+	if logsDeleted > 0 {
+		utils.BumpWriteVersion()
+	}
+
+	behaviorRemoved, alertsRemoved := 0, 0
+	if mlService != nil {
+		for _, service := range allMLServices() {
+			behaviorRemoved += service.ForgetIP(addr)
+		}
+	}
+	if alertStore != nil {
+		alertsRemoved = alertStore.RemoveIP(addr)
+	}
+
+	// The address itself is deliberately kept out of the log
+	logger.LogInfo(fmt.Sprintf("Purged an IP: %d logs, %d behavior entries, %d alerts", logsDeleted, behaviorRemoved, alertsRemoved))
+	data := map[string]interface{}{
+		"ip":               addr,
+		"logs_deleted":     logsDeleted,
+		"behavior_removed": behaviorRemoved,
+		"alerts_removed":   alertsRemoved,
+	}
+	models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("Purged %d logs, %d behavior entries and %d alerts", logsDeleted, behaviorRemoved, alertsRemoved), data)
+}
+
+// ReenrichHandler backfills the request-line columns (request_method, request_path, request_protocol)
+// for rows stored before enrichment existed. Rows are selected in id order, optionally narrowed by the
+// usual log filters, and updated in batches of batch_size. A call processes at most max_batches batches;
+// when rows remain, the response carries next_cursor, which is passed back as ?cursor= to resume, and a
+// Link header with the URL to resume from.
+func ReenrichHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	if !checkFilterKeys(w, r, "cursor", "batch_size", "max_batches") {
+		return
+	}
+
+	cursor, err := intParam(r, "cursor", 0, 0, -1)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	batchSize, err := intParam(r, "batch_size", utils.REENRICH_BATCH_SIZE, 1, utils.REENRICH_MAX_BATCH_SIZE)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	maxBatches, err := intParam(r, "max_batches", utils.REENRICH_MAX_BATCHES, 1, -1)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	filters := utils.GenerateFiltersMap(r)
+	processed, batches := 0, 0
+	done := false
+	for batches < maxBatches {
+		ids, lines, err := selectUnenriched(db, filters, cursor, batchSize)
+		if err != nil {
+			logger.LogWarn(fmt.Sprintf("Failed to select rows for re-enrichment: %v", err))
+			models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), reenrichProgress(processed, batches, &cursor, false))
+			return
+		}
+		if len(ids) == 0 {
+			done = true
+			break
+		}
+
+		query, values := utils.GenerateReenrichUpdateQuery(ids, lines)
+		if _, err := db.Exec(query, values...); err != nil {
+			logger.LogWarn(fmt.Sprintf("Failed to update re-enriched rows: %v", err))
+			models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to update logs: %v", err), reenrichProgress(processed, batches, &cursor, false))
+			return
+		}
+
+		utils.BumpWriteVersion()
+		processed += len(ids)
+		batches++
+		cursor = ids[len(ids)-1]
+		logger.LogInfo(fmt.Sprintf("Re-enrichment batch %d: %d rows updated, %d total, cursor %d", batches, len(ids), processed, cursor))
+
+		if len(ids) < batchSize {
+			done = true
+			break
+		}
+	}
+
+	var nextCursor *int
+	if !done {
+		nextCursor = &cursor
+		next := strconv.Itoa(cursor)
+		w.Header().Set("Link", utils.PaginationLinks(r, &next, nil))
+	}
+	models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("Re-enriched %d logs", processed), reenrichProgress(processed, batches, nextCursor, done))
+}
+
+// selectUnenriched fetches the next page of rows lacking enrichment and derives their request lines.
+func selectUnenriched(db *sql.DB, filters map[string]interface{}, cursor int, limit int) ([]int, []models.RequestLine, error) {
+	query, args := utils.GenerateReenrichSelectQuery(filters, cursor, limit)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	var lines []models.RequestLine
+	for rows.Next() {
+		var id int
+		var request sql.NullString
+		if err := rows.Scan(&id, &request); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		lines = append(lines, utils.ParseRequestLine(request.String))
+	}
+	return ids, lines, rows.Err()
+}
+
+func reenrichProgress(processed int, batches int, nextCursor *int, done bool) map[string]interface{} {
+	return map[string]interface{}{
+		"processed":   processed,
+		"batches":     batches,
+		"next_cursor": nextCursor,
+		"done":        done,
+	}
+}
+
+// intParam reads an integer query parameter, returning def when it is absent.
+// A negative max means the value is not bounded above.
+func intParam(r *http.Request, name string, def int, min int, max int) (int, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return def, nil
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil || value < min || (max >= 0 && value > max) {
+		if max >= 0 {
+			return 0, fmt.Errorf("Invalid %s parameter: %s. Use an integer between %d and %d", name, param, min, max)
+		}
+		return 0, fmt.Errorf("Invalid %s parameter: %s. Use an integer of at least %d", name, param, min)
+	}
+	return value, nil
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"LogParser/connection"
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/storage"
+	"LogParser/utils"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ArchiveJob tracks one asynchronous export started by POST /admin/archive.
+type ArchiveJob struct {
+	ID         string     `json:"id"`
+	State      string     `json:"state"` // "running", "done" or "failed"
+	Key        string     `json:"key"`
+	Rows       int        `json:"rows"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Archive job states.
+const (
+	ARCHIVE_RUNNING string = "running"
+	ARCHIVE_DONE    string = "done"
+	ARCHIVE_FAILED  string = "failed"
+)
+
+// ARCHIVE_JOB_TTL is how long a finished archive job can still be looked up, before it is evicted.
+const ARCHIVE_JOB_TTL time.Duration = 24 * time.Hour
+
+var (
+	archiveJobsMu sync.Mutex
+	archiveJobs   = make(map[string]*ArchiveJob)
+)
+
+// pruneArchiveJobs evicts the jobs that finished more than ARCHIVE_JOB_TTL before now, so the map only
+// keeps the running jobs and the recent ones. The caller holds archiveJobsMu.
+func pruneArchiveJobs(now time.Time) {
+	for id, job := range archiveJobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > ARCHIVE_JOB_TTL {
+			delete(archiveJobs, id)
+		}
+	}
+}
+
+var errArchiveDisabled = errors.New("archive storage is not configured, set " + utils.KEY_ARCHIVE_BUCKET + " to enable it")
+
+// archiveStorage returns the backend archives are uploaded to. It is a variable so tests can
+// substitute a fake backend.
+var archiveStorage = func() (storage.Storage, error) {
+	if utils.ConfigData.ArchiveBucket == "" {
+		return nil, errArchiveDisabled
+	}
+	return storage.NewS3Storage(utils.ConfigData.ArchiveEndpoint, utils.ConfigData.ArchiveRegion, utils.ConfigData.ArchiveBucket,
+		utils.ConfigData.ArchiveAccessKey, utils.ConfigData.ArchiveSecretKey), nil
+}
+
+// ArchiveHandler exports logs to object storage as gzip-compressed NDJSON, one log per line.
+// POST starts an export of the logs between start_time and end_time (both required), optionally
+// narrowed by the usual log filters, and answers 202 with the job; the export runs in the
+// background. GET ?job=<id> reports the job's state and, once done, the object key and row count.
+func ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getArchiveJob(w, r)
+	case http.MethodPost:
+		startArchiveJob(w, r)
+	default:
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+	}
+}
+
+func getArchiveJob(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("job")
+
+	archiveJobsMu.Lock()
+	pruneArchiveJobs(time.Now())
+	job, ok := archiveJobs[id]
+	var snapshot ArchiveJob
+	if ok {
+		snapshot = *job
+	}
+	archiveJobsMu.Unlock()
+
+	if !ok {
+		models.SendResponse(w, http.StatusNotFound, false, fmt.Sprintf("Archive job '%s' not found", id), nil)
+		return
+	}
+	models.SendResponse(w, http.StatusOK, true, "Archive job "+snapshot.State, snapshot)
+}
+
+func startArchiveJob(w http.ResponseWriter, r *http.Request) {
+	if !checkFilterKeys(w, r, "start_time", "end_time") {
+		return
+	}
+	dateFilter, err := utils.GetDateFilters(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid time range: %v", err), nil)
+		return
+	}
+	if dateFilter.Start_time == nil || dateFilter.End_time == nil {
+		models.SendResponse(w, http.StatusBadRequest, false, "start_time and end_time are required", nil)
+		return
+	}
+
+	store, err := archiveStorage()
+	if err != nil {
+		models.SendResponse(w, http.StatusServiceUnavailable, false, err.Error(), nil)
+		return
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	id := newArchiveJobID()
+	job := &ArchiveJob{
+		ID:    id,
+		State: ARCHIVE_RUNNING,
+		Key: fmt.Sprintf("%slogs-%s-%s-%s.ndjson.gz", utils.ConfigData.ArchivePrefix,
+			dateFilter.Start_time.UTC().Format("20060102T150405Z"), dateFilter.End_time.UTC().Format("20060102T150405Z"), id),
+		StartedAt: time.Now(),
+	}
+	archiveJobsMu.Lock()
+	pruneArchiveJobs(job.StartedAt)
+	archiveJobs[id] = job
+	snapshot := *job
+	archiveJobsMu.Unlock()
+
+	// The export counts as in-flight work: shutdown waits for it and cancels it when the drain timeout expires
+	inFlight.Add(1)
+	go func() {
+		defer inFlight.Done()
+		runArchiveJob(shutdownContext(), db, store, job, utils.GenerateFiltersMap(r), dateFilter)
+	}()
+
+	logger.LogInfo(fmt.Sprintf("Started archive job %s writing %s", id, job.Key))
+	models.SendResponse(w, http.StatusAccepted, true, "Archive job started", snapshot)
+}
+
+// runArchiveJob writes the export to a temporary file, so the upload knows its size,
+// then uploads it and records the outcome on the job.
+func runArchiveJob(ctx context.Context, db *sql.DB, store storage.Storage, job *ArchiveJob, filters map[string]interface{}, dateFilter models.TimeFilter) {
+	rows, err := func() (int, error) {
+		tmp, err := os.CreateTemp("", "archive-*.ndjson.gz")
+		if err != nil {
+			return 0, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		rows, err := writeArchive(ctx, db, filters, dateFilter, tmp)
+		if err != nil {
+			return rows, err
+		}
+		size, err := tmp.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return rows, err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return rows, err
+		}
+		return rows, store.Put(ctx, job.Key, tmp, size, "application/gzip")
+	}()
+
+	finished := time.Now()
+	archiveJobsMu.Lock()
+	defer archiveJobsMu.Unlock()
+	job.Rows = rows
+	job.FinishedAt = &finished
+	if err != nil {
+		job.State = ARCHIVE_FAILED
+		job.Error = err.Error()
+		logger.LogError(fmt.Sprintf("Archive job %s failed: %v", job.ID, err))
+		return
+	}
+	job.State = ARCHIVE_DONE
+	logger.LogInfo(fmt.Sprintf("Archive job %s stored %d logs as %s", job.ID, rows, job.Key))
+}
+
+// writeArchive streams the matching logs from the database into w as gzip-compressed NDJSON
+// and returns the number of logs written.
+func writeArchive(ctx context.Context, db *sql.DB, filters map[string]interface{}, dateFilter models.TimeFilter, w io.Writer) (int, error) {
+	query, args := utils.GenerateExportQuery(filters, dateFilter)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	gz := gzip.NewWriter(w)
+	count, err := writeLogsNDJSON(rows, gz, nil)
+	if err != nil {
+		return count, err
+	}
+	return count, gz.Close()
+}
+
+func newArchiveJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
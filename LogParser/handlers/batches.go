@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"LogParser/connection"
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// batchID returns the X-Batch-ID of a POST /logs request, or "" when batch acknowledgement is disabled
+// or the request carries none.
+func batchID(r *http.Request) string {
+	if utils.ConfigData.BatchAckTTL <= 0 {
+		return ""
+	}
+	return r.Header.Get(utils.BATCH_ID_HEADER)
+}
+
+// batchKey returns the key a batch is recorded under: its id, prefixed with its tenant so tenants
+// sending the same id never see each other's batches.
+func batchKey(tenant string, id string) string {
+	if tenant == "" {
+		return id
+	}
+	return tenant + "/" + id
+}
+
+// answerProcessedBatch answers a retried batch from its recorded result. It reports whether the
+// request was answered, either because the batch was already processed or because the lookup failed.
+// It spares a retry the parsing of the batch; the claim of the batch in the insert transaction, see
+// claimBatch, is what guarantees that it is inserted once.
+func answerProcessedBatch(ctx context.Context, w http.ResponseWriter, db *sql.DB, tenant string, id string) bool {
+	if len(id) > utils.BATCH_ID_MAX_LENGTH {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid %s, at most %d characters are accepted", utils.BATCH_ID_HEADER, utils.BATCH_ID_MAX_LENGTH), nil)
+		return true
+	}
+
+	inserted, rejected, found, err := connection.LookupBatch(ctx, db, batchKey(tenant, id), time.Now())
+	if err != nil {
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to check batch: %v", err), nil)
+		logger.LogWarn(err)
+		return true
+	}
+	if !found {
+		return false
+	}
+
+	data := map[string]interface{}{
+		"batch_id":          id,
+		"already_processed": true,
+		"inserted":          inserted,
+		"rejected":          rejected,
+	}
+	models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("Batch already processed, %d rows inserted, %d rejected.", inserted, rejected), data)
+	logger.LogInfo(fmt.Sprintf("Batch %s already processed, nothing inserted", id))
+	return true
+}
+
+// claimBatch records the batch in tx, the transaction inserting its logs, so a retry of it is recognized
+// once its logs are committed, and never before. It returns connection.ErrBatchProcessed when the batch
+// was processed meanwhile, by a concurrent request with the same id.
+func claimBatch(ctx context.Context, tx *sql.Tx, tenant string, id string, rejected int) error {
+	if id == "" {
+		return nil
+	}
+	return connection.ClaimBatch(ctx, tx, batchKey(tenant, id), rejected, time.Now())
+}
+
+// recordBatchInserted records the logs inserted for a batch claimed in tx.
+func recordBatchInserted(ctx context.Context, tx *sql.Tx, tenant string, id string, inserted int64) error {
+	if id == "" {
+		return nil
+	}
+	return connection.SetBatchInserted(ctx, tx, batchKey(tenant, id), inserted)
+}
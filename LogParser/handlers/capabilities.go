@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"net/http"
+)
+
+// LOG_FORMATS lists the line formats POST /logs accepts, see parseLogLine.
+var LOG_FORMATS = []string{"rfc3339", "combined", "common", "json"}
+
+// GetCapabilitiesHandler reports what this instance supports, so clients can adapt to its configuration:
+// the API version, the optional features and whether they are enabled, the enabled ML features, the
+// accepted log formats and the largest page GET /logs returns. It reveals no secrets, only whether they are set.
+func GetCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Only GET method is allowed", nil)
+		return
+	}
+	logger.LogDebug("Capabilities API called")
+
+	config := utils.ConfigData
+	mlFeatures := []string{}
+	if mlService != nil {
+		current, _ := mlService.Config()
+		mlFeatures = current.EnabledFeatures()
+	}
+
+	models.SendResponse(w, http.StatusOK, true, "Capabilities retrieved", map[string]interface{}{
+		"api_version": utils.API_VERSION,
+		"features": map[string]bool{
+			"admin":              config.AdminToken != "",
+			"api_key":            config.APIKey != "",
+			"multitenant":        utils.Multitenant(),
+			"strict_parse":       config.StrictParse,
+			"request_coalescing": config.CoalesceRequests,
+			"stats_cache":        config.StatsCacheTTL > 0,
+			"request_id":         config.RequestIDHeader != "",
+			"batch_ack":          config.BatchAckTTL > 0,
+			"dedup_strings":      config.DedupStrings,
+			"raw_lines":          config.StoreRawLine,
+			"insert_copy":        config.InsertCopy,
+			"idempotent_inserts": config.IdempotentInserts,
+			"sampling":           config.SampleRate > 0 && config.SampleRate < 1,
+			"rate_limit":         config.RateLimit > 0,
+			"cors":               len(config.CORSOrigins) > 0,
+			"strict_filters":     config.StrictFilters,
+			"archive":            config.ArchiveBucket != "",
+			"partitioning":       config.Partitioning,
+			"retention":          config.RetentionDays > 0,
+			"alerting":           config.AlertInterval > 0 && len(config.AlertRules) > 0,
+			"ml":                 mlService != nil,
+		},
+		"ml_features":       mlFeatures,
+		"log_formats":       LOG_FORMATS,
+		"max_page_limit":    utils.PARSER_MAX_PAGE_LIMIT,
+		"max_lines":         config.MaxLines,
+		"max_body_bytes":    config.MaxBodyBytes,
+		"content_encodings": []string{"identity", "gzip"},
+	})
+}
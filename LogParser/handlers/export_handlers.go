@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"LogParser/connection"
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportLogsHandler streams every log matching the same filters and start_time/end_time range as
+// GET /logs, oldest first, written as the rows are read, so the whole result is never held in memory.
+// The default format=ndjson writes one JSON object per line; format=csv writes a header row followed by
+// one record per log. Pagination parameters are ignored.
+func ExportLogsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogDebug("Export logs hit!")
+
+	if r.Method != http.MethodGet {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Only GET method allowed", nil)
+		return
+	}
+	if !checkFilterKeys(w, r, "format", "start_time", "end_time") {
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = utils.EXPORT_FORMAT_NDJSON
+	}
+	if format != utils.EXPORT_FORMAT_NDJSON && format != utils.EXPORT_FORMAT_CSV {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid format: '%s'. Expected %s or %s", format, utils.EXPORT_FORMAT_NDJSON, utils.EXPORT_FORMAT_CSV), nil)
+		return
+	}
+
+	dateFilter, err := utils.GetDateFilters(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid time range: %v", err), nil)
+		return
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	query, args := utils.GenerateExportQuery(utils.GenerateFiltersMap(r), dateFilter)
+	rows, err := db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+	defer rows.Close()
+
+	// Once the first line is out the status can't change, so a failure part way is only logged
+	// and the client sees a truncated export
+	controller := http.NewResponseController(w)
+	flush := func() { controller.Flush() }
+	var count int
+	if format == utils.EXPORT_FORMAT_CSV {
+		w.Header().Set("Content-Type", utils.CSV_CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		count, err = writeLogsCSV(rows, w, flush)
+	} else {
+		w.Header().Set("Content-Type", utils.NDJSON_CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		count, err = writeLogsNDJSON(rows, w, flush)
+	}
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Export stopped after %d logs: %v", count, err))
+		return
+	}
+	logger.LogDebug(fmt.Sprintf("Exported %d logs as %s", count, format))
+}
+
+// writeLogsNDJSON encodes the rows of an export query into w, one log per line, calling flush
+// every EXPORT_FLUSH_ROWS logs when it is not nil, and returns the number of logs written.
+func writeLogsNDJSON(rows *sql.Rows, w io.Writer, flush func()) (int, error) {
+	encoder := json.NewEncoder(w)
+	return scanExportRows(rows, func(log models.Log) error { return encoder.Encode(log) }, flush)
+}
+
+// writeLogsCSV writes the rows of an export query into w as CSV, a header row of the log's JSON field
+// names followed by one record per log, calling flush every EXPORT_FLUSH_ROWS logs when it is not nil.
+// Timestamps are RFC3339 and missing optional fields are left empty, and cells are escaped with csvCell.
+// It returns the number of logs written.
+func writeLogsCSV(rows *sql.Rows, w io.Writer, flush func()) (int, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(utils.EXPORT_CSV_HEADER); err != nil {
+		return 0, err
+	}
+
+	encode := func(log models.Log) error {
+		record := []string{log.RemoteAddr, log.RemoteUser, log.TimeLocal.Format(time.RFC3339), log.Request,
+			strconv.Itoa(log.Status), strconv.Itoa(log.BodyBytesSent), log.HttpReferer, log.HttpUserAgent, log.HttpXForwardedFor, "", "", ""}
+		if log.IngestedAt != nil {
+			record[9] = log.IngestedAt.Format(time.RFC3339)
+		}
+		if log.ResponseTime != nil {
+			record[10] = strconv.FormatFloat(*log.ResponseTime, 'f', -1, 64)
+		}
+		if log.ServerName != nil {
+			record[11] = *log.ServerName
+		}
+		for i := range record {
+			record[i] = csvCell(record[i])
+		}
+		return writer.Write(record)
+	}
+	flushCSV := func() {
+		writer.Flush()
+		if flush != nil {
+			flush()
+		}
+	}
+
+	count, err := scanExportRows(rows, encode, flushCSV)
+	if err != nil {
+		return count, err
+	}
+	writer.Flush()
+	return count, writer.Error()
+}
+
+// csvCell escapes a value spreadsheets would read as a formula, one starting with =, +, -, @, a tab
+// or a carriage return, by prefixing it with a quote. The logged fields are written by clients, so a
+// request or user agent could otherwise run a formula in whoever opens the export. A lone "-", the
+// empty field of access logs, is not a formula and is left as it is.
+func csvCell(value string) string {
+	if value != "" && value != "-" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// scanExportRows scans each row of an export query into a log and hands it to encode, calling flush
+// every EXPORT_FLUSH_ROWS logs when it is not nil, and returns the number of logs encoded.
+func scanExportRows(rows *sql.Rows, encode func(models.Log) error, flush func()) (int, error) {
+	count := 0
+	for rows.Next() {
+		var log models.Log
+		var id int
+		if err := rows.Scan(&id, &log.RemoteAddr, &log.RemoteUser, &log.TimeLocal, &log.Request, &log.Status, &log.BodyBytesSent, &log.HttpReferer, &log.HttpUserAgent, &log.HttpXForwardedFor, &log.IngestedAt, &log.ResponseTime, &log.ServerName); err != nil {
+			return count, err
+		}
+		if err := encode(log); err != nil {
+			return count, err
+		}
+		count++
+		if flush != nil && count%utils.EXPORT_FLUSH_ROWS == 0 {
+			flush()
+		}
+	}
+	return count, rows.Err()
+}
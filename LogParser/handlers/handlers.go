@@ -3,16 +3,28 @@ package handlers
 import (
 	"LogParser/connection"
 	"LogParser/logger"
+	"LogParser/metrics"
+	"LogParser/middleware"
 	"LogParser/models"
 	"LogParser/utils"
+	"compress/gzip"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	_ "log"
+	"math"
+	"math/rand"
 	"net/http"
-	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,6 +34,49 @@ func IsAlive(w http.ResponseWriter, r *http.Request) {
 	logger.LogDebug("checking the server call!")
 }
 
+// tenantQuery scopes query, which reads from the logs table, to the tenant r is scoped to, if any,
+// returning it with its args and the tenant bound after them.
+func tenantQuery(r *http.Request, query string, args ...interface{}) (string, []interface{}) {
+	return utils.ScopeQueryToTenant(query, utils.TenantFromContext(r.Context()), args)
+}
+
+// checkFilterKeys looks for query parameters of r that are neither a log filter nor one of accepted.
+// With PARSER_STRICT_FILTERS it answers 400 listing them and returns false; otherwise they are logged
+// as a warning and ignored.
+func checkFilterKeys(w http.ResponseWriter, r *http.Request, accepted ...string) bool {
+	unknown := utils.UnknownFilterKeys(r, accepted...)
+	if len(unknown) == 0 {
+		return true
+	}
+	if utils.ConfigData.StrictFilters {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Unknown query parameters: %s", strings.Join(unknown, ", ")), nil)
+		return false
+	}
+	logger.LogWithFields("warn", fmt.Sprintf("Ignoring unknown query parameters of %s %s: %s", r.Method, r.URL.Path, strings.Join(unknown, ", ")), middleware.RequestFields(r))
+	return true
+}
+
+// queryContext returns the context the database queries of r run under: the request's own, cancelled
+// once PARSER_QUERY_TIMEOUT elapses. The returned cancel func must be called when the queries are done.
+func queryContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if utils.ConfigData.QueryTimeout > 0 {
+		return context.WithTimeout(r.Context(), time.Duration(utils.ConfigData.QueryTimeout)*time.Second)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// queryTimedOut answers 504 and returns true when a query failed because ctx, from queryContext,
+// reached its deadline.
+func queryTimedOut(w http.ResponseWriter, ctx context.Context, err error) bool {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return false
+	}
+	message := fmt.Sprintf("Database query timed out after %ds", utils.ConfigData.QueryTimeout)
+	logger.LogContext(ctx, "warn", fmt.Sprintf("%s: %v", message, err))
+	models.SendResponse(w, http.StatusGatewayTimeout, false, message, nil)
+	return true
+}
+
 // HandleType handles HTTP requests based on the method type (POST, GET, DELETE).
 func HandleType(w http.ResponseWriter, r *http.Request){
 	switch r.Method{
@@ -42,44 +97,130 @@ func HandleType(w http.ResponseWriter, r *http.Request){
 func GetLogsCountHandler(w http.ResponseWriter, r *http.Request) {
 	logger.LogDebug("Get logs count hit!")
 
+	if !checkFilterKeys(w, r, "estimate") {
+		return
+	}
+
+	estimate := false
+	if param := r.URL.Query().Get("estimate"); param != "" {
+		parsed, err := strconv.ParseBool(param)
+		if err != nil {
+			models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid estimate: '%s'. Expected true or false", param), nil)
+			return
+		}
+		estimate = parsed
+	}
+
 	isAlive, db := connection.PingDB()
 	if !isAlive {
 		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to connect to Database!"), nil)
 		return
 	}
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	var totalLogs int
-	err := db.QueryRow(utils.QUERY_COUNT_ALL).Scan(&totalLogs)
+	totalQuery, totalArgs := tenantQuery(r, utils.QUERY_COUNT_ALL)
+	err := db.QueryRowContext(ctx, totalQuery, totalArgs...).Scan(&totalLogs)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Error fetching total log count: %v", err))
 	}
 
 	//dateFilter, _ := utils.GetDateFilters(r)
-	query, args := utils.GenerateFilteredCountQuery(utils.GenerateFiltersMap(r))//, utils.GetPaginationParams(r), dateFilter
+	filters := utils.GenerateFiltersMap(r)
+	query, args := utils.GenerateFilteredCountQuery(filters)//, utils.GetPaginationParams(r), dateFilter
 
 	var count int
-	err1 := db.QueryRow(query, args...).Scan(&count)
+	err1 := db.QueryRowContext(ctx, query, args...).Scan(&count)
+	if queryTimedOut(w, ctx, err1) {
+		return
+	}
 	if err1 != nil {
 		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err1))
 		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err1), nil)
 		return
 	}
 
+	if estimate {
+		sendEstimatedCount(ctx, w, db, filters, totalLogs, count)
+		return
+	}
+
+	data := map[string]int{
+		"total": totalLogs,
+		"fetch": count,
+	}
 	if count <= 0 {
-		models.SendResponse(w, http.StatusOK, true, "No logs found", nil)
+		models.SendResponse(w, http.StatusOK, true, "No logs found", data)
 	} else {
-		data := map[string]int{
-			"total": totalLogs,
-			"fetch": count,
-		}
 		models.SendResponse(w, http.StatusOK, true, "Logs Found Success", data)
 	}
 }
 
+// sendEstimatedCount answers GET /logs/count?estimate=true: alongside the stored counts it returns
+// them scaled up by the sample rate each log was ingested at, labelled as estimates.
+func sendEstimatedCount(ctx context.Context, w http.ResponseWriter, db *sql.DB, filters map[string]interface{}, totalLogs int, count int) {
+	// The total is over every log the request may see, which for a tenant is its own
+	totalFilters := map[string]interface{}{}
+	if tenant, ok := filters["tenant_id"]; ok {
+		totalFilters["tenant_id"] = tenant
+	}
+	estimatedTotal, err := estimateCount(ctx, db, totalFilters)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Error estimating total log count: %v", err))
+	}
+	estimatedFetch, err := estimateCount(ctx, db, filters)
+	if queryTimedOut(w, ctx, err) {
+		return
+	}
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	data := map[string]interface{}{
+		"total":           totalLogs,
+		"fetch":           count,
+		"estimated":       true,
+		"estimated_total": math.Round(estimatedTotal),
+		"estimated_fetch": math.Round(estimatedFetch),
+	}
+	models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("Estimated %.0f logs from %d stored", math.Round(estimatedFetch), count), data)
+}
+
+// estimateCount estimates the true number of logs matching the filters from the stored counts per sample rate.
+func estimateCount(ctx context.Context, db *sql.DB, filters map[string]interface{}) (float64, error) {
+	query, args := utils.GenerateSampleRateCountQuery(filters)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var counts []utils.RateCount
+	for rows.Next() {
+		var count utils.RateCount
+		if err := rows.Scan(&count.SampleRate, &count.Count); err != nil {
+			return 0, err
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return utils.EstimateCount(counts), nil
+}
+
 // GetLogsHandler fetches logs based on filters and pagination, and returns them in the response.
 func GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Get logs API hit!")
 
+	if !checkFilterKeys(w, r, "start_time", "end_time", "time_format", "limit", "cursor", "cursor_by", "direction", "sort_by", "order") {
+		return
+	}
+
 	// DB connection check
 	isAlive, db := connection.PingDB()
 	if !isAlive {
@@ -87,9 +228,13 @@ func GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
 	// Get total logs count
 	var totalLogs int
-	err := db.QueryRow(utils.QUERY_COUNT_ALL).Scan(&totalLogs)
+	totalQuery, totalArgs := tenantQuery(r, utils.QUERY_COUNT_ALL)
+	err := db.QueryRowContext(ctx, totalQuery, totalArgs...).Scan(&totalLogs)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Error fetching total log count: %v", err))
 	}
@@ -100,12 +245,55 @@ func GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 		logger.LogWarn(fmt.Sprintf("Error in parsing filtered dates: %v", errs))
 	}
 
-	paginationFilter := utils.GetPaginationParams(r)
+	timeFormat, err := utils.GetTimeFormat(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	paginationFilter, err := utils.GetPaginationParams(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, "Invalid cursor", nil)
+		return
+	}
+	paginationFilter.CursorBy, err = utils.GetCursorBy(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	paginationFilter.SortBy, paginationFilter.Order, err = utils.GetSort(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	paginationFilter.Direction, err = utils.GetDirection(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	backward := paginationFilter.Direction == utils.DIRECTION_PREV
+	hasCursor := paginationFilter.Cursor != nil && paginationFilter.CursorID != nil
+	if backward && !hasCursor {
+		models.SendResponse(w, http.StatusBadRequest, false, "direction=prev requires a cursor", nil)
+		return
+	}
+	// Cursors carry a time_local and an id, so they only page through logs sorted by time
+	if paginationFilter.CursorBy == utils.CURSOR_BY_ID && (r.URL.Query().Get("sort_by") != "" || r.URL.Query().Get("order") != "") {
+		models.SendResponse(w, http.StatusBadRequest, false, "sort_by and order cannot be combined with cursor_by=id", nil)
+		return
+	}
+	if paginationFilter.SortBy != utils.SORT_BY_TIME && paginationFilter.Cursor != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("cursor pagination requires sort_by=%s", utils.SORT_BY_TIME), nil)
+		return
+	}
 	query, args := utils.GenerateFilteredGetQuery(utils.GenerateFiltersMap(r), paginationFilter, dateFilter)
 
 	fmt.Println("Query", query)
 	// Execute the query
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if queryTimedOut(w, ctx, err) {
+		return
+	}
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
 		models.SendResponse(w, http.StatusMethodNotAllowed, false, fmt.Sprintf("Failed to query database: %v", err), nil)
@@ -125,7 +313,7 @@ func GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 		var id int
 
 		// Update to scan 'id' as well
-		err := rows.Scan(&id, &log.RemoteAddr, &log.RemoteUser, &log.TimeLocal, &log.Request, &log.Status, &log.BodyBytesSent, &log.HttpReferer, &log.HttpUserAgent, &log.HttpXForwardedFor)
+		err := rows.Scan(&id, &log.RemoteAddr, &log.RemoteUser, &log.TimeLocal, &log.Request, &log.Status, &log.BodyBytesSent, &log.HttpReferer, &log.HttpUserAgent, &log.HttpXForwardedFor, &log.IngestedAt, &log.ResponseTime, &log.ServerName)
 		if err != nil {
 			logger.LogWarn(fmt.Sprintf("Failed to scan log: %v", err))
 			models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to scan log: %v", err), nil)
@@ -142,28 +330,65 @@ func GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 		lastCursorTime = log.TimeLocal
 		lastCursorID = id
 	}
+	// A deadline reached while reading the rows ends them early, which must not pass for a short page
+	if err := rows.Err(); err != nil {
+		if queryTimedOut(w, ctx, err) {
+			return
+		}
+		logger.LogWarn(fmt.Sprintf("Failed to read logs: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to read logs: %v", err), nil)
+		return
+	}
 
-	// Generate pagination cursors
+	// A previous page was read in reverse, so it is turned back into the requested order
+	if backward {
+		slices.Reverse(logs)
+		firstCursorTime, firstCursorID, lastCursorTime, lastCursorID = lastCursorTime, lastCursorID, firstCursorTime, firstCursorID
+	}
+
+	// Generate pagination cursors. A full page may have more logs beyond it, and the page the cursor
+	// came from lies on the other side.
 	var nextCursor, prevCursor *string
 
-	if len(logs) > 0 {
-		if len(logs) == paginationFilter.Limit {
+	// Logs sorted on another column than time_local have no cursors
+	if len(logs) > 0 && paginationFilter.SortBy == utils.SORT_BY_TIME {
+		full := len(logs) == paginationFilter.Limit
+		if (full && !backward) || (hasCursor && backward) {
 			next := FormatCursor(lastCursorTime, lastCursorID)
 			nextCursor = &next
 		}
-		if paginationFilter.Cursor != nil && paginationFilter.CursorID != nil {
+		if (full && backward) || (hasCursor && !backward) {
 			prev := FormatCursor(firstCursorTime, firstCursorID)
 			prevCursor = &prev
 		}
 	}
+	// In ingestion order there is always a next page to poll for newly arrived logs,
+	// so the cursor is kept even when the page is short or empty
+	if paginationFilter.CursorBy == utils.CURSOR_BY_ID && nextCursor == nil {
+		if len(logs) > 0 {
+			next := FormatCursor(lastCursorTime, lastCursorID)
+			nextCursor = &next
+		} else if hasCursor && !backward {
+			next := FormatCursor(*paginationFilter.Cursor, *paginationFilter.CursorID)
+			nextCursor = &next
+		}
+	}
 
 	// Construct response
+	var logsOut interface{} = logs
+	if timeFormat == utils.TIME_FORMAT_EPOCH_MS && logs != nil {
+		epochLogs := make([]models.LogEpochMillis, len(logs))
+		for i, log := range logs {
+			epochLogs[i] = log.EpochMillis()
+		}
+		logsOut = epochLogs
+	}
 	responseData := map[string]interface{}{
 		"count": map[string]interface{}{
 			"total": totalLogs,
 			"fetch": len(logs),
 		},
-		"logs": logs,
+		"logs": logsOut,
 		"paging": map[string]interface{}{
 			"next_cursor": nextCursor,
 			"prev_cursor": prevCursor,
@@ -171,6 +396,10 @@ func GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	if links := utils.PaginationLinks(r, nextCursor, prevCursor); links != "" {
+		w.Header().Set("Link", links)
+	}
+
 	statusMsg := "Fetched logs successfully"
 	if len(logs) == 0 {
 		statusMsg = "No logs found"
@@ -178,8 +407,122 @@ func GetLogsHandler(w http.ResponseWriter, r *http.Request) {
 	models.SendResponse(w, http.StatusOK, true, statusMsg, responseData)
 }
 
+// GetLogByIDHandler returns the log with the id given in the path (GET /logs/{id}). While
+// PARSER_STORE_RAW_LINE is enabled the log carries the raw line it was parsed from, if it was stored.
+func GetLogByIDHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogDebug("Get log by id hit!")
+
+	if r.Method != http.MethodGet {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid log id: '%s'", r.PathValue("id")), nil)
+		return
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	query, args := utils.GenerateGetByIDQuery(id, utils.TenantFromContext(r.Context()))
+	var log models.Log
+	dest := []interface{}{&id, &log.RemoteAddr, &log.RemoteUser, &log.TimeLocal, &log.Request, &log.Status, &log.BodyBytesSent, &log.HttpReferer, &log.HttpUserAgent, &log.HttpXForwardedFor, &log.IngestedAt, &log.ResponseTime, &log.ServerName}
+	if utils.ConfigData.StoreRawLine {
+		dest = append(dest, &log.RawLine)
+	}
+	err = db.QueryRow(query, args...).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		models.SendResponse(w, http.StatusNotFound, false, fmt.Sprintf("Log %d not found", id), nil)
+		return
+	}
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	models.SendResponse(w, http.StatusOK, true, "Log Found Success", log)
+}
+
+// GetWatermarkHandler reports the timestamp of the most recent stored log and how many logs
+// arrived within the trailing interval (default 10m, e.g. ?interval=5m), so monitoring can
+// detect ingestion stalls. Both queries are answered from the time_local index.
+func GetWatermarkHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogDebug("Get watermark hit!")
+
+	interval := 10 * time.Minute
+	if param := r.URL.Query().Get("interval"); param != "" {
+		parsed, err := time.ParseDuration(param)
+		if err != nil || parsed <= 0 {
+			models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid interval parameter: %s. Use a positive duration such as 10m or 1h", param), nil)
+			return
+		}
+		interval = parsed
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	var lastLogTime sql.NullTime
+	query, args := tenantQuery(r, utils.QUERY_MAX_TIME_LOCAL)
+	if err := db.QueryRow(query, args...).Scan(&lastLogTime); err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	now := time.Now()
+	var recentCount int
+	query, args = tenantQuery(r, utils.DriverQuery(utils.QUERY_COUNT_SINCE), now.Add(-interval))
+	if err := db.QueryRow(query, args...).Scan(&recentCount); err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	// Ingestion lag (ingested_at - time_local) over the rows written within the interval
+	var avgIngestLag, maxIngestLag float64
+	lagQuery := utils.QUERY_INGEST_LAG_SINCE
+	if utils.DBDriver == utils.DB_DRIVER_MYSQL {
+		lagQuery = utils.QUERY_INGEST_LAG_SINCE_MYSQL
+	}
+	query, args = tenantQuery(r, utils.DriverQuery(lagQuery), now.Add(-interval))
+	if err := db.QueryRow(query, args...).Scan(&avgIngestLag, &maxIngestLag); err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	data := map[string]interface{}{
+		"last_log_time": nil,
+		"lag_seconds":   nil,
+		"interval":      interval.String(),
+		"recent_count":  recentCount,
+		"ingest_lag_seconds": map[string]interface{}{
+			"avg": avgIngestLag,
+			"max": maxIngestLag,
+		},
+	}
+	if lastLogTime.Valid {
+		data["last_log_time"] = lastLogTime.Time
+		data["lag_seconds"] = now.Sub(lastLogTime.Time).Seconds()
+	}
+
+	models.SendResponse(w, http.StatusOK, true, "Watermark retrieved successfully", data)
+}
+
+// FormatCursor renders the opaque, signed pagination cursor for the given row, to be passed
+// back unchanged as ?cursor=. It is independent of the requested time format.
 func FormatCursor(t time.Time, id int) string {
-	return fmt.Sprintf("%s&id=%d", t.UTC().Format(time.RFC3339), id)
+	return utils.EncodeCursor(t, id)
 }
 
 func FormatTime(t *time.Time) *string {
@@ -190,17 +533,52 @@ func FormatTime(t *time.Time) *string {
     return &formattedTime
 }
 
-// DeleteLogsHandler deletes logs from the database based on the filters provided in the request.
+// DeleteLogsHandler deletes logs from the database based on the filters and start_time/end_time range
+// provided in the request. A delete without any filter or date would empty the table, so it is refused
+// unless confirm=true is passed.
 func DeleteLogsHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkFilterKeys(w, r, "start_time", "end_time", "dry_run", "sample", "confirm") {
+		return
+	}
+
+	dateFilter, err := utils.GetDateFilters(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid time range: %v", err), nil)
+		return
+	}
+	filters := utils.GenerateFiltersMap(r)
+
 	isAlive, db := connection.PingDB()
 	if !isAlive {
 		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
 		return
 	}
 
-	query, args := utils.GenerateDeleteQuery(utils.GenerateFiltersMap(r))
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	if r.URL.Query().Get("dry_run") == "true" {
+		previewDelete(ctx, w, r, db, filters, dateFilter)
+		return
+	}
+
+	// Filters with invalid values are dropped by GenerateFiltersMap, so this also catches a mistyped filter.
+	// The tenant filter is not the caller's: without another one, a tenant would delete all of its logs.
+	userFilters := len(filters)
+	if _, ok := filters["tenant_id"]; ok {
+		userFilters--
+	}
+	if userFilters == 0 && dateFilter.Start_time == nil && dateFilter.End_time == nil && r.URL.Query().Get("confirm") != "true" {
+		models.SendResponse(w, http.StatusBadRequest, false, "Refusing to delete every log without a filter or time range. Pass confirm=true to delete them all.", nil)
+		return
+	}
+
+	query, args := utils.GenerateDeleteQuery(filters, dateFilter)
 
-	result, err := db.Exec(query, args...)
+	result, err := db.ExecContext(ctx, query, args...)
+	if queryTimedOut(w, ctx, err) {
+		return
+	}
 	if err != nil {
 		// Log error and send response if the query fails
 		logger.LogWarn(fmt.Sprintf("Failed to execute delete query: %v", err))
@@ -216,12 +594,71 @@ func DeleteLogsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if rowsAffected > 0 {
+		utils.BumpWriteVersion()
 		models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("%d logs deleted successfully.", rowsAffected), nil)
 	} else {
 		models.SendResponse(w, http.StatusOK, true, "No logs found matching the provided filters.", nil)
 	}
 }
 
+// previewDelete answers a DELETE with dry_run=true: it counts the logs the filters and date range match
+// and returns the first of them (10 by default, up to 100 with ?sample=) without deleting anything.
+func previewDelete(ctx context.Context, w http.ResponseWriter, r *http.Request, db *sql.DB, filters map[string]interface{}, dateFilter models.TimeFilter) {
+	sampleSize := utils.DELETE_DRY_RUN_SAMPLE
+	if param := r.URL.Query().Get("sample"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 0 || parsed > utils.DELETE_DRY_RUN_MAX_SAMPLE {
+			models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid sample parameter: %s. Use a number between 0 and %d", param, utils.DELETE_DRY_RUN_MAX_SAMPLE), nil)
+			return
+		}
+		sampleSize = parsed
+	}
+
+	var matched int
+	query, args := utils.GenerateDeleteCountQuery(filters, dateFilter)
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&matched); err != nil {
+		if queryTimedOut(w, ctx, err) {
+			return
+		}
+		logger.LogWarn(fmt.Sprintf("Failed to count logs to delete: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to count logs to delete: %v", err), nil)
+		return
+	}
+
+	sample := []models.Log{}
+	if matched > 0 && sampleSize > 0 {
+		query, args = utils.GenerateDeleteSampleQuery(filters, dateFilter, sampleSize)
+		rows, err := db.QueryContext(ctx, query, args...)
+		if queryTimedOut(w, ctx, err) {
+			return
+		}
+		if err != nil {
+			logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+			models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var log models.Log
+			var id int
+			if err := rows.Scan(&id, &log.RemoteAddr, &log.RemoteUser, &log.TimeLocal, &log.Request, &log.Status, &log.BodyBytesSent, &log.HttpReferer, &log.HttpUserAgent, &log.HttpXForwardedFor, &log.IngestedAt, &log.ResponseTime, &log.ServerName); err != nil {
+				logger.LogWarn(fmt.Sprintf("Failed to scan log: %v", err))
+				models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to scan log: %v", err), nil)
+				return
+			}
+			sample = append(sample, log)
+		}
+	}
+
+	data := map[string]interface{}{
+		"dry_run": true,
+		"matched": matched,
+		"sample":  sample,
+	}
+	models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("Dry run: %d logs would be deleted.", matched), data)
+}
+
 // InsertOneLog inserts a single log entry into the database.
 func InsertOneLog(logs models.Log) error {
 	isAlive, db := connection.PingDB()
@@ -235,23 +672,58 @@ func InsertOneLog(logs models.Log) error {
 		logger.LogError(fmt.Sprintf("Error inserting log: %v", err)) // More detailed error logging
 		return err
 	}
+	utils.BumpWriteVersion()
 	return nil
 }
 
 // AddLogsHandler processes the incoming POST request and inserts logs into the database.
 func AddLogsHandler(w http.ResponseWriter, r *http.Request) {
-	logger.LogDebug("Add hit!")
+	// Track the request so shutdown can wait for it, and stop its work if the drain timeout expires. Its
+	// work logs with the request's id, method and path, so its workers and insert can be correlated.
+	inFlight.Add(1)
+	defer inFlight.Done()
+	ctx := logger.ContextWithFields(shutdownContext(), middleware.RequestFields(r))
+	logger.LogContext(ctx, "debug", "Add hit!")
 
 	if r.Method != http.MethodPost {
 		models.SendResponse(w, http.StatusMethodNotAllowed, false, fmt.Sprintf("%d Invalid request method", http.StatusMethodNotAllowed), nil)
 		return
 	}
 
-	var logstr []string
-	err := json.NewDecoder(r.Body).Decode(&logstr)
+	// A gzip-compressed batch is decompressed as it is decoded, and the body cap applies to the
+	// decompressed batch
+	body := r.Body
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			models.SendResponse(w, http.StatusBadRequest, false, "Invalid gzip body", nil)
+			logger.LogContext(ctx, "error", fmt.Sprintf("Error decompressing log data: %v", err))
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	default:
+		models.SendResponse(w, http.StatusUnsupportedMediaType, false, fmt.Sprintf("Unsupported Content-Encoding: '%s'. Expected gzip or identity", encoding), nil)
+		return
+	}
+	if utils.ConfigData.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, body, int64(utils.ConfigData.MaxBodyBytes))
+	}
+
+	logstr, err := decodeLogLines(body, utils.ConfigData.MaxLines)
 	if err != nil {
-		http.Error(w, "Failed to decode log data", http.StatusBadRequest)
-		logger.LogError(fmt.Sprintf("Error decoding log data: %v", err))
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, errTooManyLines):
+			models.SendResponse(w, http.StatusRequestEntityTooLarge, false, fmt.Sprintf("Too many log lines, at most %d are accepted per request", utils.ConfigData.MaxLines), nil)
+		case errors.As(err, &maxBytesErr):
+			models.SendResponse(w, http.StatusRequestEntityTooLarge, false, fmt.Sprintf("Request body too large, at most %d bytes are accepted", maxBytesErr.Limit), nil)
+		default:
+			http.Error(w, "Failed to decode log data", http.StatusBadRequest)
+		}
+		logger.LogContext(ctx, "error", fmt.Sprintf("Error decoding log data: %v", err))
 		return
 	}
 
@@ -261,173 +733,479 @@ func AddLogsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A batch retried after it was processed is answered from its recorded result
+	tenant := utils.TenantFromContext(r.Context())
+	batch := batchID(r)
+	if batch != "" && answerProcessedBatch(ctx, w, db, tenant, batch) {
+		return
+	}
+
 	count := len(logstr)
-	logger.LogDebug(fmt.Sprintf("Received : %v",count))
+	logger.LogContext(ctx, "debug", fmt.Sprintf("Received : %v",count))
 	
-	logsChan := make(chan string, len(logstr))
-	resultsChan := make(chan models.Log, len(logstr))
+	queueSize := parseQueueSize(len(logstr))
+	logsChan := make(chan LogLine, queueSize)
+	resultsChan := make(chan ParsedLog, queueSize)
 
 	var wg sync.WaitGroup
+	var skipped atomic.Int64
 
-	numWorkers := runtime.NumCPU() 
+	numWorkers := parseWorkers(len(logstr))
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go ProcessLogWorker(logsChan, resultsChan, &wg)
+		go ProcessLogWorker(ctx, logsChan, resultsChan, &skipped, &wg)
 	}
 
-	for _, logStr := range logstr {
-		logsChan <- logStr
-	}
-	close(logsChan)
+	// Lines are queued while the results are collected below, so the bounded channels cannot both fill up.
+	// Workers stop once ctx is cancelled, and so does the queueing.
+	go func() {
+		defer close(logsChan)
+		for i, logStr := range logstr {
+			select {
+			case logsChan <- LogLine{Index: i, Raw: logStr}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
 	go func() {
 		wg.Wait()
 		close(resultsChan) 
 	}()
 
-	var logEntries []models.Log
-	for logEntry := range resultsChan {
-		logEntries = append(logEntries, logEntry)
+	// Results arrive in worker order; slot them back by index so the batch keeps its input order
+	// and the offending line numbers can be reported.
+	logEntries := make([]models.Log, len(logstr))
+	var invalidLines, unknownMethodLines []int
+	for result := range resultsChan {
+		if result.Valid && utils.ConfigData.IdempotentInserts {
+			result.Log.DedupKey = utils.DedupKey(tenant, logstr[result.Index])
+		}
+		logEntries[result.Index] = result.Log
+		if !result.Valid {
+			invalidLines = append(invalidLines, result.Index)
+		} else if utils.ParseRequestLine(result.Log.Request).UnknownMethod {
+			unknownMethodLines = append(unknownMethodLines, result.Index)
+		}
 	}
+	sort.Ints(invalidLines)
+	sort.Ints(unknownMethodLines)
 
-	query, values := utils.GenerateAddQuery(logEntries)
-	result, err1 := db.Exec(query, values...)
+	if ctx.Err() != nil {
+		models.SendResponse(w, http.StatusServiceUnavailable, false, "Server is shutting down, nothing inserted", nil)
+		logger.LogContext(ctx, "warn", fmt.Sprintf("Aborted batch of %d logs during shutdown", count))
+		return
+	}
+
+	if utils.ConfigData.StrictParse && len(invalidLines) > 0 {
+		data := map[string]interface{}{
+			"received":      count,
+			"invalid_lines": invalidLines,
+		}
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Strict parse mode: %d of %d lines failed to parse, nothing inserted", len(invalidLines), count), data)
+		logger.LogContext(ctx, "warn", fmt.Sprintf("Rejected batch in strict parse mode, invalid lines: %v", invalidLines))
+		return
+	}
+
+	// Invalid lines are dropped from the insert and reported back as rejected
+	if len(invalidLines) > 0 {
+		validEntries := make([]models.Log, 0, len(logEntries)-len(invalidLines))
+		next := 0
+		for i, logEntry := range logEntries {
+			if next < len(invalidLines) && invalidLines[next] == i {
+				next++
+				continue
+			}
+			validEntries = append(validEntries, logEntry)
+		}
+		logEntries = validEntries
+		logger.LogContext(ctx, "warn", fmt.Sprintf("Rejected %d of %d log lines, invalid lines: %v", len(invalidLines), count, invalidLines))
+	}
+	// Logs with an unknown request method are stored, but flagged back to the caller
+	if len(unknownMethodLines) > 0 {
+		logger.LogContext(ctx, "warn", fmt.Sprintf("Flagged %d of %d log lines with an unknown request method, lines: %v", len(unknownMethodLines), count, unknownMethodLines))
+	}
+	// The response reports the rows inserted apart from the lines skipped, flagging the offending lines
+	data := map[string]interface{}{"skipped": skipped.Load()}
+	if len(invalidLines) > 0 {
+		data["rejected"] = len(invalidLines)
+		data["rejected_lines"] = invalidLines
+	}
+	if len(unknownMethodLines) > 0 {
+		data["unknown_method_lines"] = unknownMethodLines
+	}
+	// Without a valid line there is nothing to insert, and an INSERT without rows is not valid SQL. The
+	// batch is not acknowledged, a retry of it is rejected the same way.
+	if len(logEntries) == 0 {
+		data["received"] = count
+		data["inserted"] = 0
+		data["rejected"] = len(invalidLines)
+		data["rejected_lines"] = append([]int{}, invalidLines...)
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("No valid log lines parsed, 0 inserted, %d of %d lines rejected.", len(invalidLines), count), data)
+		return
+	}
+
+	// With ingestion sampling only a fraction of the valid logs is stored, each recording its rate
+	if utils.Sampling() {
+		valid := len(logEntries)
+		logEntries = utils.SampleLogs(logEntries, utils.ConfigData.SampleRate, rand.Float64)
+		logger.LogContext(ctx, "debug", fmt.Sprintf("Sampled %d of %d valid logs at rate %v", len(logEntries), valid, utils.ConfigData.SampleRate))
+	}
+
+	// Logs belong to the tenant of the API key they were sent with
+	for i := range logEntries {
+		logEntries[i].TenantID = tenant
+	}
+
+	var userAgentIDs, refererIDs map[string]int
+	if utils.ConfigData.DedupStrings {
+		userAgentIDs, refererIDs, err = connection.StoreLogLookups(ctx, db, logEntries)
+		if err != nil {
+			models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to insert logs: %v", err), nil)
+			logger.LogContext(ctx, "warn", fmt.Sprintf("Failed to insert logs: %v", err))
+			return
+		}
+	}
+
+	// Large batches are written in chunks, all in one transaction: a failing chunk rolls the whole batch
+	// back. The batch id is recorded in the same transaction, so it is committed with the logs or not at
+	// all. The insert is cancelled once PARSER_INSERT_TIMEOUT elapses.
+	insertCtx := ctx
+	if utils.ConfigData.InsertTimeout > 0 {
+		var cancel context.CancelFunc
+		insertCtx, cancel = context.WithTimeout(ctx, time.Duration(utils.ConfigData.InsertTimeout)*time.Second)
+		defer cancel()
+	}
+	rowsAffected, err1 := connection.InsertInTx(insertCtx, db, func(tx *sql.Tx) (int64, error) {
+		if err := claimBatch(insertCtx, tx, tenant, batch, len(invalidLines)); err != nil {
+			return 0, err
+		}
+		var inserted int64
+		for _, chunk := range utils.ChunkLogs(logEntries, insertChunkSize()) {
+			started := time.Now()
+			result, err := insertChunk(insertCtx, tx, chunk, userAgentIDs, refererIDs)
+			if err != nil {
+				return 0, err
+			}
+			recordInsertBatch(len(chunk), time.Since(started))
+
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return 0, fmt.Errorf("failed to retrieve affected rows: %w", err)
+			}
+			inserted += rows
+		}
+		return inserted, recordBatchInserted(insertCtx, tx, tenant, batch, inserted)
+	})
+	// A concurrent request with the same batch id inserted it first
+	if errors.Is(err1, connection.ErrBatchProcessed) && answerProcessedBatch(ctx, w, db, tenant, batch) {
+		return
+	}
+	if err1 != nil && ctx.Err() != nil {
+		models.SendResponse(w, http.StatusServiceUnavailable, false, "Server is shutting down, nothing inserted", nil)
+		logger.LogContext(ctx, "warn", fmt.Sprintf("Insert of %d logs cancelled during shutdown: %v", count, err1))
+		return
+	}
+	if err1 != nil && insertCtx.Err() != nil {
+		message := fmt.Sprintf("Failed to insert logs: timed out after %ds: %v, nothing inserted", utils.ConfigData.InsertTimeout, err1)
+		models.SendResponse(w, http.StatusGatewayTimeout, false, message, nil)
+		logger.LogContext(ctx, "warn", message)
+		return
+	}
 	if err1 != nil {
-		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to insert logs: %v", err1), nil)
-		logger.LogWarn(fmt.Sprintf("Failed to insert logs: %v", err1))
+		message := fmt.Sprintf("Failed to insert logs: %v, nothing inserted", err1)
+		models.SendResponse(w, http.StatusInternalServerError, false, message, nil)
+		logger.LogContext(ctx, "warn", message)
 		return
 	}
+	if rowsAffected > 0 {
+		utils.BumpWriteVersion()
+		metrics.HTTP.AddLogs(rowsAffected)
+	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to retrieve affected rows: %v", err), nil)
-		logger.LogError(fmt.Sprintf("Error retrieving affected rows: %v", err))
+	data["inserted"] = rowsAffected
+	if utils.ConfigData.IdempotentInserts {
+		// Logs already stored were skipped, only the new rows count as inserted
+		data["duplicates"] = int64(len(logEntries)) - rowsAffected
+	}
+	if len(invalidLines) > 0 {
+		models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("Logs stored successfully, %d rows inserted, %d rejected.", rowsAffected, len(invalidLines)), data)
 		return
 	}
+	models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("Logs stored successfully, %d rows inserted.", rowsAffected), data)
+}
+
+// errTooManyLines is returned by decodeLogLines when the batch exceeds the line cap.
+var errTooManyLines = errors.New("too many log lines")
+
+// decodeLogLines reads a JSON array of log strings element by element, so a batch over the
+// maxLines cap (0 for no cap) is rejected as soon as the cap is crossed instead of after the
+// whole array has been buffered.
+func decodeLogLines(body io.Reader, maxLines int) ([]string, error) {
+	decoder := json.NewDecoder(body)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected a JSON array of log lines, got %v", token)
+	}
+
+	var lines []string
+	for decoder.More() {
+		if maxLines > 0 && len(lines) >= maxLines {
+			return nil, errTooManyLines
+		}
+		var line string
+		if err := decoder.Decode(&line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	// Consume the closing bracket so a truncated body is reported as an error
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// LogLine is a raw log string tagged with its position in the posted batch.
+type LogLine struct {
+	Index int
+	Raw   string
+}
 
-	models.SendResponse(w, http.StatusOK, true, fmt.Sprintf("Logs stored successfully, %d rows inserted.", rowsAffected), nil)
+// ParsedLog is the result of parsing a LogLine. Valid is false when the line did not match the log format
+// or the parsed log lacks one of the configured required fields.
+type ParsedLog struct {
+	Index int
+	Log   models.Log
+	Valid bool
+}
+
+// parseWorkers returns the number of workers parsing a batch of lines: PARSER_WORKERS, or one per CPU
+// while it is 0, but never more than the lines nor fewer than one.
+func parseWorkers(lines int) int {
+	workers := utils.ConfigData.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return max(1, min(workers, lines))
+}
+
+// parseQueueSize returns the buffer of the channels between AddLogsHandler and its parsing workers: one
+// slot per line, but at most PARSE_QUEUE_SIZE, so a huge batch does not allocate buffers as large as itself.
+func parseQueueSize(lines int) int {
+	return min(lines, utils.PARSE_QUEUE_SIZE)
+}
+
+// insertChunk writes a chunk of logs in tx with a multi-row INSERT, or a COPY while PARSER_INSERT_COPY is
+// enabled, referencing user agents and referers by id while PARSER_DEDUP_STRINGS is. A COPY cannot skip
+// the logs already stored, so PARSER_IDEMPOTENT_INSERTS always writes with INSERT.
+func insertChunk(ctx context.Context, tx *sql.Tx, chunk []models.Log, userAgentIDs, refererIDs map[string]int) (sql.Result, error) {
+	if utils.ConfigData.InsertCopy && !utils.ConfigData.IdempotentInserts {
+		columns, rows := utils.GenerateAddRows(chunk)
+		if utils.ConfigData.DedupStrings {
+			columns, rows = utils.GenerateDedupAddRows(chunk, userAgentIDs, refererIDs)
+		}
+		return connection.CopyLogs(ctx, tx, columns, rows)
+	}
+
+	query, values := utils.GenerateAddQuery(chunk)
+	if utils.ConfigData.DedupStrings {
+		query, values = utils.GenerateDedupAddQuery(chunk, userAgentIDs, refererIDs)
+	}
+	return tx.ExecContext(ctx, query, values...)
 }
 
 // processLogWorker processes logs concurrently, transforming log strings into log entries.
-func ProcessLogWorker(logs <-chan string, results chan<- models.Log, wg *sync.WaitGroup) {
+// Lines that fail to parse or lack a required field are sent back tagged as invalid, never as logs to
+// store, and counted in skipped, which the workers of a batch share.
+// It stops early, leaving remaining lines unparsed, once ctx is cancelled.
+func ProcessLogWorker(ctx context.Context, logs <-chan LogLine, results chan<- ParsedLog, skipped *atomic.Int64, wg *sync.WaitGroup) {
 	defer wg.Done()
-	for logStr := range logs {
-		logEntry := ParseLog(logStr)
-		results <- logEntry
+	for line := range logs {
+		if ctx.Err() != nil {
+			return
+		}
+		logEntry, ok := parseLogLine(line.Raw)
+		if ok && utils.ConfigData.StoreRawLine {
+			raw := line.Raw
+			logEntry.RawLine = &raw
+		}
+		if ok {
+			if missing := logEntry.MissingFields(utils.ConfigData.RequiredFields); len(missing) > 0 {
+				logger.LogContext(ctx, "debug", fmt.Sprintf("Log line %d is missing required fields %v", line.Index, missing))
+				ok = false
+			}
+		}
+		if !ok {
+			skipped.Add(1)
+			logEntry = models.Log{}
+		}
+		results <- ParsedLog{Index: line.Index, Log: logEntry, Valid: ok}
 	}
 }
 
+// ParseLog converts a log string into a structured Log entry.
+// An empty Log is returned if the line does not match the expected format.
 func ParseLog(logStr string) models.Log {
-	// Define a regular expression to capture the log fields
-	re := regexp.MustCompile(`^([\d\.]+) - (\S+) \[([^\]]+)\] "(.*?)" (\d{3}) (\d+) "(.*?)" "(.*?)" "(.*?)"$`)
+	logEntry, _ := parseLogLine(logStr)
+	return logEntry
+}
+
+// parseLogLine parses a log string and reports whether it matched the expected format.
+func parseLogLine(logStr string) (models.Log, bool) {
+	if strings.HasPrefix(strings.TrimSpace(logStr), "{") {
+		return parseJSONLog(logStr, utils.ConfigData.JSONFieldMap)
+	}
+
+	// Capture the log fields with the configured pattern, by the names of its groups; fields the
+	// pattern has no group for are left empty
+	re := utils.LogPattern()
 	matches := re.FindStringSubmatch(logStr)
 
 	if len(matches) > 0 {
-		// Parse the time field into a time.Time object
-		logTime, err := time.Parse(time.RFC3339, matches[3])
+		group := func(name string) string {
+			if i := re.SubexpIndex(name); i >= 0 {
+				return matches[i]
+			}
+			return ""
+		}
+
+		// Parse the time field into a time.Time object, keeping its offset
+		logTime, err := parseLogTime(group("time_local"))
 		if err != nil {
 			logTime = time.Time{} // Default to zero time if parsing fails
 		}
 
 		// Return a structured Log model
 		return models.Log{
-			RemoteAddr:       matches[1],
-			RemoteUser:       matches[2],
+			RemoteAddr:       group("remote_addr"),
+			RemoteUser:       group("remote_user"),
 			TimeLocal:        logTime, // Store as time.Time
-			Request:          matches[4],
-			Status:           Atoi(matches[5]),
-			BodyBytesSent:    Atoi(matches[6]),
-			HttpReferer:      matches[7],
-			HttpUserAgent:    matches[8],
-			HttpXForwardedFor: matches[9],
-		}
+			Request:          group("request"),
+			Status:           Atoi(group("status")),
+			BodyBytesSent:    Atoi(group("body_bytes_sent")),
+			HttpReferer:      group("http_referer"),
+			HttpUserAgent:    group("http_user_agent"),
+			HttpXForwardedFor: group("http_x_forwarded_for"),
+			ResponseTime:     parseResponseTime(group("response_time")),
+			ServerName:       parseServerName(group("server_name")),
+		}, true
 	}
 
 	// Return empty log if the format doesn't match
-	return models.Log{}
+	return models.Log{}, false
 }
 
-/*
-func parseLog2(logEntry string) (models.Log, error) {
-	// Define a regex pattern to match the log structure
-	// The pattern captures each part of the log entry.
-	// Example log: "10.0.0.1 - - [2025-04-08T06:57:31Z] \"GET /login HTTP/1.1\" 301 1043 \"https://www.bing.com\" \"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Edge/18.18362\" \"212.32.188.247\""
-	re := regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "([A-Z]+) (.*?) HTTP/\S+" (\d{3}) (\d+) "(.*?)" "(.*?)" "(.*?)"$`)
+// LOG_TIME_LAYOUTS are the timestamp layouts accepted in log lines, tried in order: Nginx and Apache's
+// $time_local, RFC3339 (with or without fractional seconds) and a bare date.
+var LOG_TIME_LAYOUTS = []string{utils.CLF_TIME_LAYOUT, time.RFC3339, "2006-01-02"}
 
-	// Match the log entry against the regex pattern
-	matches := re.FindStringSubmatch(logEntry)
-	if len(matches) < 11 {
-		return models.Log{}, fmt.Errorf("invalid log format")
+// parseLogTime parses the timestamp of a log with the first of LOG_TIME_LAYOUTS that accepts it.
+// The offset the timestamp was logged with is kept in the returned time's location.
+func parseLogTime(value string) (time.Time, error) {
+	for _, layout := range LOG_TIME_LAYOUTS {
+		if logTime, err := time.Parse(layout, value); err == nil {
+			return logTime, nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("timestamp %q matches none of the layouts %v", value, LOG_TIME_LAYOUTS)
+}
 
-	// Extract fields from the regex matches
-	remoteAddr := matches[1]
-	remoteUser := matches[2]
-	timeStr := matches[4]
-	request := matches[5] + " " + matches[6] + " HTTP/1.1"
-	status := matches[7]
-	bodyBytesSent := matches[8]
-	httpReferer := matches[9]
-	httpUserAgent := matches[10]
-	httpXForwardedFor := matches[11]
-
-	// Parse time
-	logTime, err := time.Parse(time.RFC3339, timeStr)
+// parseResponseTime parses a $request_time value in seconds. It returns nil when the field is
+// absent or logged as "-".
+func parseResponseTime(value string) *float64 {
+	seconds, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return models.Log{}, fmt.Errorf("invalid time format: %v", err)
+		return nil
 	}
+	return &seconds
+}
 
-	// Convert status and bodyBytesSent to integers
-	statusCode, err := strconv.Atoi(status)
-	if err != nil {
-		return models.Log{}, fmt.Errorf("invalid status code: %v", err)
+// parseServerName returns a $server_name value, or nil when the field is absent, empty or logged as "-".
+func parseServerName(value string) *string {
+	if value == "" || value == "-" {
+		return nil
 	}
+	return &value
+}
 
-	bodyBytes, err := strconv.Atoi(bodyBytesSent)
-	if err != nil {
-		return models.Log{}, fmt.Errorf("invalid body bytes sent: %v", err)
+// parseJSONLog decodes a JSON log object, renaming its keys with the configured field mapping
+// before assigning them to the Log model. The line is rejected if any required field is missing
+// or holds a value of the wrong type.
+func parseJSONLog(logStr string, mapping map[string]string) (models.Log, bool) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(logStr))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return models.Log{}, false
 	}
+	object = utils.ApplyJSONFieldMap(object, mapping)
 
-	// Create Log struct and return it
-	log := models.Log{
-		RemoteAddr:       remoteAddr,
-		RemoteUser:       remoteUser,
-		TimeLocal:        logTime,
-		Request:          request,
-		Status:           statusCode,
-		BodyBytesSent:    bodyBytes,
-		HttpReferer:      httpReferer,
-		HttpUserAgent:    httpUserAgent,
-		HttpXForwardedFor: httpXForwardedFor,
+	for _, field := range models.RequiredLogJSONFields {
+		if _, ok := object[field]; !ok {
+			return models.Log{}, false
+		}
 	}
 
-	return log, nil
+	var log models.Log
+	for field, value := range object {
+		if err := setLogField(&log, field, value); err != nil {
+			logger.LogDebug(fmt.Sprintf("Rejecting JSON log line: %v", err))
+			return models.Log{}, false
+		}
+	}
+	return log, true
 }
 
-// parseLog converts a log string into a structured Log entry using regular expressions.
-func parseLog1(logStr string) models.Log {
-	// log format example:
-	// 192.168.1.2 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 500 1180 "https://www.bing.com" "Mozilla/5.0..."
-
-	re := regexp.MustCompile(`(?P<RemoteAddr>[\d\.]+) - (?P<RemoteUser>[-\w]+) \[([^\]]+)\] "(?P<Request>[^"]+)" (?P<Status>\d+) (?P<BodyBytesSent>\d+) "(?P<HttpReferer>[^"]*)" "(?P<HttpUserAgent>[^"]*)" "(?P<HttpXForwardedFor>[^"]*)"`)
-	matches := re.FindStringSubmatch(logStr)
-
-	if len(matches) > 0 {
-		return models.Log{
-			RemoteAddr:    matches[1],
-			RemoteUser:    matches[2],
-			//TimeLocal:     matches[3],
-			Request:       matches[4],
-			Status:        atoi(matches[5]),
-			BodyBytesSent: atoi(matches[6]),
-			HttpReferer:   matches[7],
-			HttpUserAgent: matches[8],
-			HttpXForwardedFor: matches[9],
+// setLogField assigns a decoded JSON value to the Log field with the given json name.
+// Unknown fields are ignored; numeric fields accept both JSON numbers and numeric strings.
+func setLogField(log *models.Log, field string, value interface{}) error {
+	text := fmt.Sprint(value)
+	switch field {
+	case "remote_addr":
+		log.RemoteAddr = text
+	case "remote_user":
+		log.RemoteUser = text
+	case "request":
+		log.Request = text
+	case "http_referer":
+		log.HttpReferer = text
+	case "http_user_agent":
+		log.HttpUserAgent = text
+	case "http_x_forwarded_for":
+		log.HttpXForwardedFor = text
+	case "server_name":
+		log.ServerName = parseServerName(text)
+	case "status", "body_bytes_sent":
+		number, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("field '%s' is not an integer: %v", field, value)
+		}
+		if field == "status" {
+			log.Status = number
+		} else {
+			log.BodyBytesSent = number
 		}
+	case "response_time":
+		seconds, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("field 'response_time' is not a number: %v", value)
+		}
+		log.ResponseTime = &seconds
+	case "time_local":
+		logTime, err := parseLogTime(text)
+		if err != nil {
+			return fmt.Errorf("field 'time_local' is not a valid timestamp: %v", value)
+		}
+		log.TimeLocal = logTime
 	}
-	return models.Log{}
+	return nil
 }
-	*/
 
 // atoi safely converts a string to an integer, returning 0 on error.
 func Atoi(str string) int {
@@ -452,7 +1230,8 @@ func GetStatusStatsHandler(w http.ResponseWriter, r *http.Request) {
 		ORDER BY count DESC
 	`
 
-	rows, err := db.Query(query)
+	query, args := tenantQuery(r, query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
@@ -466,7 +1245,7 @@ func GetStatusStatsHandler(w http.ResponseWriter, r *http.Request) {
 		AvgBytes  float64 `json:"avg_bytes"`
 	}
 
-	var stats []StatusStat
+	stats := []StatusStat{}
 	for rows.Next() {
 		var stat StatusStat
 		err := rows.Scan(&stat.Status, &stat.Count, &stat.AvgBytes)
@@ -480,6 +1259,187 @@ func GetStatusStatsHandler(w http.ResponseWriter, r *http.Request) {
 	models.SendResponse(w, http.StatusOK, true, "Status statistics retrieved successfully", stats)
 }
 
+// GetAggregateStatsHandler returns a histogram of HTTP status codes for the logs matching the same
+// filters and start_time/end_time range as GET /logs, along with the total across all of them.
+func GetAggregateStatsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogDebug("Get aggregate stats hit!")
+
+	if r.Method != http.MethodGet {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Only GET method allowed", nil)
+		return
+	}
+	if !checkFilterKeys(w, r, "start_time", "end_time") {
+		return
+	}
+
+	dateFilter, err := utils.GetDateFilters(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid time range: %v", err), nil)
+		return
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	query, args := utils.GenerateStatusAggregateQuery(utils.GenerateFiltersMap(r), dateFilter)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+	defer rows.Close()
+
+	statuses := map[string]int{}
+	total := 0
+	for rows.Next() {
+		var status, count int
+		if err := rows.Scan(&status, &count); err != nil {
+			logger.LogWarn(fmt.Sprintf("Error scanning row: %v", err))
+			continue
+		}
+		statuses[strconv.Itoa(status)] = count
+		total += count
+	}
+	if err := rows.Err(); err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to read aggregate rows: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	data := map[string]interface{}{
+		"statuses": statuses,
+		"total":    total,
+	}
+	models.SendResponse(w, http.StatusOK, true, "Status aggregate retrieved successfully", data)
+}
+
+// GetTopIPsHandler returns the remote addresses with the most logs matching the same filters and
+// start_time/end_time range as GET /logs, busiest first. limit (10 by default) is capped at 100.
+func GetTopIPsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogDebug("Get top IPs hit!")
+
+	if !checkFilterKeys(w, r, "limit", "start_time", "end_time") {
+		return
+	}
+
+	limit := utils.TOP_IPS_LIMIT
+	if param := r.URL.Query().Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 {
+			models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid limit parameter: %s. Use a positive number", param), nil)
+			return
+		}
+		limit = min(parsed, utils.TOP_IPS_MAX_LIMIT)
+	}
+
+	dateFilter, err := utils.GetDateFilters(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid time range: %v", err), nil)
+		return
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	query, args := utils.GenerateTopIPsQuery(utils.GenerateFiltersMap(r), dateFilter, limit)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+	defer rows.Close()
+
+	type TopIP struct {
+		IPAddress string `json:"ip_address"`
+		Count     int    `json:"count"`
+	}
+
+	stats := []TopIP{}
+	for rows.Next() {
+		var stat TopIP
+		if err := rows.Scan(&stat.IPAddress, &stat.Count); err != nil {
+			logger.LogWarn(fmt.Sprintf("Error scanning row: %v", err))
+			continue
+		}
+		stats = append(stats, stat)
+	}
+
+	models.SendResponse(w, http.StatusOK, true, "Top IPs retrieved successfully", stats)
+}
+
+// GetTimeSeriesHandler counts the logs matching the same filters and start_time/end_time range as
+// GET /logs per minute, hour or day, as chosen by interval (hour by default), oldest bucket first.
+// Buckets without logs are left out. Each bucket maps to an ml.TimeSeriesPoint of its count.
+func GetTimeSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogDebug("Get time series hit!")
+
+	if r.Method != http.MethodGet {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Only GET method allowed", nil)
+		return
+	}
+	if !checkFilterKeys(w, r, "interval", "start_time", "end_time") {
+		return
+	}
+
+	interval, err := utils.GetTimeSeriesInterval(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	dateFilter, err := utils.GetDateFilters(r)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid time range: %v", err), nil)
+		return
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	query, args := utils.GenerateTimeSeriesQuery(utils.GenerateFiltersMap(r), dateFilter, interval)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+	defer rows.Close()
+
+	type TimeSeriesBucket struct {
+		Bucket time.Time `json:"bucket"`
+		Count  int       `json:"count"`
+	}
+
+	buckets := []TimeSeriesBucket{}
+	for rows.Next() {
+		var bucket TimeSeriesBucket
+		if err := rows.Scan(&bucket.Bucket, &bucket.Count); err != nil {
+			logger.LogWarn(fmt.Sprintf("Error scanning row: %v", err))
+			continue
+		}
+		bucket.Bucket = bucket.Bucket.UTC()
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to read time series rows: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	models.SendResponse(w, http.StatusOK, true, "Time series retrieved successfully", buckets)
+}
+
 // GetIPStatsHandler returns statistics grouped by IP addresses
 func GetIPStatsHandler(w http.ResponseWriter, r *http.Request) {
 	logger.LogDebug("Get IP stats hit!")
@@ -501,7 +1461,8 @@ func GetIPStatsHandler(w http.ResponseWriter, r *http.Request) {
 		LIMIT 50
 	`
 
-	rows, err := db.Query(query)
+	query, args := tenantQuery(r, query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
@@ -517,7 +1478,7 @@ func GetIPStatsHandler(w http.ResponseWriter, r *http.Request) {
 		LastRequest   time.Time `json:"last_request"`
 	}
 
-	var stats []IPStat
+	stats := []IPStat{}
 	for rows.Next() {
 		var stat IPStat
 		err := rows.Scan(&stat.IPAddress, &stat.RequestCount, &stat.AvgBytes, &stat.FirstRequest, &stat.LastRequest)
@@ -531,6 +1492,56 @@ func GetIPStatsHandler(w http.ResponseWriter, r *http.Request) {
 	models.SendResponse(w, http.StatusOK, true, "IP statistics retrieved successfully", stats)
 }
 
+// GetServerStatsHandler returns statistics grouped by server name. Logs without a server name are left out.
+func GetServerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogDebug("Get server stats hit!")
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	query := `
+		SELECT server_name, COUNT(*) as request_count,
+		       COUNT(*) FILTER (WHERE status >= 400) as error_count,
+		       AVG(body_bytes_sent) as avg_bytes
+		FROM logs
+		WHERE server_name IS NOT NULL
+		GROUP BY server_name
+		ORDER BY request_count DESC
+	`
+
+	query, args := tenantQuery(r, query)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+	defer rows.Close()
+
+	type ServerStat struct {
+		ServerName   string  `json:"server_name"`
+		RequestCount int     `json:"request_count"`
+		ErrorCount   int     `json:"error_count"`
+		AvgBytes     float64 `json:"avg_bytes"`
+	}
+
+	stats := []ServerStat{}
+	for rows.Next() {
+		var stat ServerStat
+		err := rows.Scan(&stat.ServerName, &stat.RequestCount, &stat.ErrorCount, &stat.AvgBytes)
+		if err != nil {
+			logger.LogWarn(fmt.Sprintf("Error scanning row: %v", err))
+			continue
+		}
+		stats = append(stats, stat)
+	}
+
+	models.SendResponse(w, http.StatusOK, true, "Server statistics retrieved successfully", stats)
+}
+
 // GetTimeStatsHandler returns time-based analytics (hourly/daily patterns)
 func GetTimeStatsHandler(w http.ResponseWriter, r *http.Request) {
 	logger.LogDebug("Get time stats hit!")
@@ -579,7 +1590,8 @@ func GetTimeStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := db.Query(query)
+	query, args := tenantQuery(r, query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
@@ -593,7 +1605,7 @@ func GetTimeStatsHandler(w http.ResponseWriter, r *http.Request) {
 		AvgBytes     float64     `json:"avg_bytes"`
 	}
 
-	var stats []TimeStat
+	stats := []TimeStat{}
 	for rows.Next() {
 		var stat TimeStat
 		err := rows.Scan(&stat.TimeUnit, &stat.RequestCount, &stat.AvgBytes)
@@ -624,28 +1636,32 @@ func GetDashboardStatsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Get total logs count
 	var totalLogs int
-	err := db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&totalLogs)
+	query, args := tenantQuery(r, "SELECT COUNT(*) FROM logs")
+	err := db.QueryRow(query, args...).Scan(&totalLogs)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Error fetching total logs: %v", err))
 	}
 
 	// Get unique IPs count
 	var uniqueIPs int
-	err = db.QueryRow("SELECT COUNT(DISTINCT remote_addr) FROM logs").Scan(&uniqueIPs)
+	query, args = tenantQuery(r, "SELECT COUNT(DISTINCT remote_addr) FROM logs")
+	err = db.QueryRow(query, args...).Scan(&uniqueIPs)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Error fetching unique IPs: %v", err))
 	}
 
 	// Get average response size
 	var avgResponseSize float64
-	err = db.QueryRow("SELECT AVG(body_bytes_sent) FROM logs").Scan(&avgResponseSize)
+	query, args = tenantQuery(r, "SELECT COALESCE(AVG(body_bytes_sent), 0) FROM logs")
+	err = db.QueryRow(query, args...).Scan(&avgResponseSize)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Error fetching average response size: %v", err))
 	}
 
 	// Get most recent log time
-	var lastLogTime time.Time
-	err = db.QueryRow("SELECT MAX(time_local) FROM logs").Scan(&lastLogTime)
+	var lastLogTime sql.NullTime
+	query, args = tenantQuery(r, "SELECT MAX(time_local) FROM logs")
+	err = db.QueryRow(query, args...).Scan(&lastLogTime)
 	if err != nil {
 		logger.LogWarn(fmt.Sprintf("Error fetching last log time: %v", err))
 	}
@@ -658,26 +1674,27 @@ func GetDashboardStatsHandler(w http.ResponseWriter, r *http.Request) {
 		ORDER BY count DESC
 		LIMIT 5
 	`
-	statusRows, err := db.Query(statusQuery)
-	if err != nil {
-		logger.LogWarn(fmt.Sprintf("Error fetching status stats: %v", err))
-	}
-	defer statusRows.Close()
-
 	type StatusCount struct {
 		Status int `json:"status"`
 		Count  int `json:"count"`
 	}
 
-	var topStatuses []StatusCount
-	for statusRows.Next() {
-		var sc StatusCount
-		err := statusRows.Scan(&sc.Status, &sc.Count)
-		if err != nil {
-			logger.LogWarn(fmt.Sprintf("Error scanning status row: %v", err))
-			continue
+	topStatuses := []StatusCount{}
+	query, args = tenantQuery(r, statusQuery)
+	statusRows, err := db.Query(query, args...)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Error fetching status stats: %v", err))
+	} else {
+		defer statusRows.Close()
+		for statusRows.Next() {
+			var sc StatusCount
+			err := statusRows.Scan(&sc.Status, &sc.Count)
+			if err != nil {
+				logger.LogWarn(fmt.Sprintf("Error scanning status row: %v", err))
+				continue
+			}
+			topStatuses = append(topStatuses, sc)
 		}
-		topStatuses = append(topStatuses, sc)
 	}
 
 	// Get top 5 IPs
@@ -688,36 +1705,75 @@ func GetDashboardStatsHandler(w http.ResponseWriter, r *http.Request) {
 		ORDER BY count DESC
 		LIMIT 5
 	`
-	ipRows, err := db.Query(ipQuery)
-	if err != nil {
-		logger.LogWarn(fmt.Sprintf("Error fetching IP stats: %v", err))
-	}
-	defer ipRows.Close()
-
 	type IPCount struct {
 		IP    string `json:"ip"`
 		Count int    `json:"count"`
 	}
 
-	var topIPs []IPCount
-	for ipRows.Next() {
-		var ic IPCount
-		err := ipRows.Scan(&ic.IP, &ic.Count)
-		if err != nil {
-			logger.LogWarn(fmt.Sprintf("Error scanning IP row: %v", err))
-			continue
+	topIPs := []IPCount{}
+	query, args = tenantQuery(r, ipQuery)
+	ipRows, err := db.Query(query, args...)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Error fetching IP stats: %v", err))
+	} else {
+		defer ipRows.Close()
+		for ipRows.Next() {
+			var ic IPCount
+			err := ipRows.Scan(&ic.IP, &ic.Count)
+			if err != nil {
+				logger.LogWarn(fmt.Sprintf("Error scanning IP row: %v", err))
+				continue
+			}
+			topIPs = append(topIPs, ic)
 		}
-		topIPs = append(topIPs, ic)
 	}
 
 	dashboardData := map[string]interface{}{
 		"total_logs":         totalLogs,
 		"unique_ips":         uniqueIPs,
 		"avg_response_size":  avgResponseSize,
-		"last_log_time":      lastLogTime,
+		"last_log_time":      nil,
 		"top_status_codes":   topStatuses,
 		"top_ips":           topIPs,
 	}
+	// An empty table has no last log, reported as null like the watermark does
+	if lastLogTime.Valid {
+		dashboardData["last_log_time"] = lastLogTime.Time
+	}
 
 	models.SendResponse(w, http.StatusOK, true, "Dashboard statistics retrieved successfully", dashboardData)
-}
\ No newline at end of file
+}
+
+// GetResponseTimeStatsHandler returns the distribution of response times ($request_time) over the
+// logs that carry one: count, average, p50/p90/p95/p99 and maximum, in seconds. All are zero when
+// no stored log has a response time.
+func GetResponseTimeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogDebug("Get response time stats hit!")
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to connect to Database!", nil)
+		return
+	}
+
+	type ResponseTimeStats struct {
+		Count int     `json:"count"`
+		Avg   float64 `json:"avg"`
+		P50   float64 `json:"p50"`
+		P90   float64 `json:"p90"`
+		P95   float64 `json:"p95"`
+		P99   float64 `json:"p99"`
+		Max   float64 `json:"max"`
+	}
+
+	var stats ResponseTimeStats
+	query, args := tenantQuery(r, utils.QUERY_RESPONSE_TIME_PERCENTILES)
+	err := db.QueryRow(query, args...).Scan(&stats.Count, &stats.Avg, &stats.P50, &stats.P90, &stats.P95, &stats.P99, &stats.Max)
+	if err != nil {
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	models.SendResponse(w, http.StatusOK, true, "Response time statistics retrieved successfully", stats)
+}
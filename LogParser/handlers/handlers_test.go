@@ -1,19 +1,41 @@
 package handlers
 
 import (
+	"LogParser/alerts"
 	"LogParser/connection"
 	"LogParser/logger"
+	"LogParser/metrics"
+	"LogParser/middleware"
+	"LogParser/ml"
 	"LogParser/models"
+	"LogParser/storage"
+	"LogParser/utils"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 )
 
 func TestIsAlive(t *testing.T) {
@@ -148,6 +170,97 @@ func TestGetLogsCountHandler(t *testing.T) {
 }
 
 
+// TestUnknownFilterKeys_Strict checks that with PARSER_STRICT_FILTERS a mistyped filter is rejected
+// before any query runs, so it cannot widen a delete or a fetch to every log
+func TestUnknownFilterKeys_Strict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+	defer func(strict bool) { utils.ConfigData.StrictFilters = strict }(utils.ConfigData.StrictFilters)
+	utils.ConfigData.StrictFilters = true
+
+	tests := []struct {
+		handler http.HandlerFunc
+		method  string
+		url     string
+	}{
+		{DeleteLogsHandler, http.MethodDelete, "/logs?statuss=500&confirm=true"},
+		{GetLogsHandler, http.MethodGet, "/logs?statuss=500&tenant=a&limit=5"},
+		{GetLogsCountHandler, http.MethodGet, "/logs/count?statuss=500"},
+		{GetTopIPsHandler, http.MethodGet, "/stats/top-ips?statuss=500"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		tt.handler(rr, httptest.NewRequest(tt.method, tt.url, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, tt.url)
+		assert.Contains(t, rr.Body.String(), "Unknown query parameters: statuss", tt.url)
+	}
+	// No query was expected, so any would have failed the handlers
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Known filters and the endpoint's own parameters pass
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM logs WHERE 1=1 AND status = $1 AND time_local <= $2")).
+		WithArgs(500, "2025-04-01T00:00:00Z").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	rr := httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?status=500&end_time=2025-04-01&pretty=true", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestUnknownFilterKeys_Lenient checks that without PARSER_STRICT_FILTERS a mistyped filter is ignored
+// with a warning naming it
+func TestUnknownFilterKeys_Lenient(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+	defer func(strict bool) { utils.ConfigData.StrictFilters = strict }(utils.ConfigData.StrictFilters)
+	utils.ConfigData.StrictFilters = false
+
+	var logs bytes.Buffer
+	logger.InitLogger("warn")
+	logger.Log.SetOutput(&logs)
+	defer logger.InitLogger("error")
+
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_COUNT_ALL)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(100))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs WHERE 1=1")).WithoutArgs().
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(100))
+
+	rr := httptest.NewRecorder()
+	GetLogsCountHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/count?statuss=500", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, logs.String(), "Ignoring unknown query parameters of GET /logs/count: statuss")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLogsCountHandler_Estimate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	// 100 logs stored at a 10% sample
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_COUNT_ALL)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(100))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs WHERE 1=1")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(100))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(sample_rate, 1) AS sample_rate, COUNT(*) FROM logs WHERE 1=1 GROUP BY")).
+		WillReturnRows(sqlmock.NewRows([]string{"sample_rate", "count"}).AddRow(0.1, 100))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(sample_rate, 1) AS sample_rate, COUNT(*) FROM logs WHERE 1=1 AND status = $1 GROUP BY")).
+		WithArgs(200).WillReturnRows(sqlmock.NewRows([]string{"sample_rate", "count"}).AddRow(0.1, 100))
+
+	rr := httptest.NewRecorder()
+	GetLogsCountHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/count?status=200&estimate=true", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Estimated 1000 logs from 100 stored","data":`+
+		`{"total":100,"fetch":100,"estimated":true,"estimated_total":1000,"estimated_fetch":1000}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	rr = httptest.NewRecorder()
+	GetLogsCountHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/count?estimate=maybe", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
 // Test for AddLogsHandler with mock database
 func TestAddLogsHandler(t *testing.T) {
     // Mocking database
@@ -158,9 +271,11 @@ func TestAddLogsHandler(t *testing.T) {
     defer db.Close()
 
 	connection.DB = db
+    mock.ExpectBegin()
     mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(1, 1))
+    mock.ExpectCommit()
     logs := []string{
-        "192.168.1.1 - - [17/Mar/2025:13:30:20 +0530] \"GET /home HTTP/1.1\" 200 1180 \"https://www.bing.com\" \"Mozilla/5.0...\"",
+        "192.168.1.1 - - [2025-03-17T13:30:20+05:30] \"GET /home HTTP/1.1\" 200 1180 \"https://www.bing.com\" \"Mozilla/5.0...\" \"-\"",
     }
     jsonStr, err := json.Marshal(logs)
     if err != nil {
@@ -179,169 +294,2451 @@ func TestAddLogsHandler(t *testing.T) {
         t.Errorf("AddLogsHandler returned wrong status code: got %v want %v", status, http.StatusOK)
     }
 
-    expected := `{"status":true,"message":"Logs stored successfully, 1 rows inserted.","data":null}
+    expected := `{"status":true,"message":"Logs stored successfully, 1 rows inserted.","data":{"inserted":1,"skipped":0}}
 `
     if rr.Body.String() != expected {
         t.Errorf("AddLogsHandler returned unexpected body: got %v want %v", rr.Body.String(), expected)
     }
 }
 
+// TestAddLogsHandler_Gzip posts a batch gzip-compressed the way the generator sends it with
+// GENERATOR_GZIP set, over HTTP, and checks that it is decoded and stored.
+func TestAddLogsHandler_Gzip(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
 
-func TestGetLogsHandler(t *testing.T) {
-    db, mock, err := sqlmock.New()
-    if err != nil {
-        t.Fatalf("Failed to open sqlmock database: %s", err)
-    }
-    defer db.Close()
+	logs := []string{
+		`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /home HTTP/1.1" 200 1180 "-" "Mozilla/5.0" "10.0.0.1"`,
+		`192.168.1.2 - - [2025-04-10T10:20:31Z] "GET /login HTTP/1.1" 404 120 "-" "Mozilla/5.0" "10.0.0.2"`,
+	}
+	logJson, _ := json.Marshal(logs)
+	var body bytes.Buffer
+	gzipWriter := gzip.NewWriter(&body)
+	gzipWriter.Write(logJson)
+	assert.NoError(t, gzipWriter.Close())
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	ts := httptest.NewServer(http.HandlerFunc(AddLogsHandler))
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/logs", &body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
 
-    connection.DB = db
-	mock.ExpectQuery("SELECT remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for").
-    WillReturnRows(
-        sqlmock.NewRows([]string{
-            "remote_addr", "remote_user", "time_local", "request", "status",
-            "body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for",
-        }).AddRow(
-            "192.168.1.1", "-",
-            time.Date(2025, time.March, 17, 13, 30, 20, 0, time.FixedZone("IST", 19800)), // ✅ FIXED here
-            "GET /home HTTP/1.1", 200,
-            1234, "http://example.com", "Mozilla/5.0", "192.168.0.1",
-        ),
-    )
-			
-    req, err := http.NewRequest("GET", "/logs", nil)
-    if err != nil {
-        t.Fatal(err)
-    }
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 2 rows inserted.","data":{"inserted":2,"skipped":0}}`, string(respBody))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-    rr := httptest.NewRecorder()
-    handler := http.HandlerFunc(GetLogsHandler)
-    handler.ServeHTTP(rr, req)
-    if status := rr.Code; status != http.StatusOK {
-        t.Errorf("GetLogsHandler returned wrong status code: got %v want %v", status, http.StatusOK)
-    }
+func TestAddLogsHandler_InvalidEncoding(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(`["log"]`))
+	req.Header.Set("Content-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid gzip body")
+
+	req = httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(`["log"]`))
+	req.Header.Set("Content-Encoding", "br")
+	rr = httptest.NewRecorder()
+	AddLogsHandler(rr, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+}
 
-	expected := `{"status":true,"message":"Fetched logs successfully","data":{"count":{"fetch":1,"total":0},"logs":[{"remote_addr":"192.168.1.1","remote_user":"-","time_local":"2025-03-17T13:30:20+05:30","request":"GET /home HTTP/1.1","status":200,"body_bytes_sent":1234,"http_referer":"http://example.com","http_user_agent":"Mozilla/5.0","http_x_forwarded_for":"192.168.0.1"}],"paging":{"limit":10,"next_cursor":null,"prev_cursor":"2025-03-17T13:30:20+05:30"}}}
-`
-    if rr.Body.String() != expected {
-        t.Errorf("GetLogsHandler returned unexpected body: got %v want %v", rr.Body.String(), expected)
-    }
+// TestGetMetricsHandler exercises POST /logs behind the metrics middleware, as the server routes
+// it, and checks that the counters scraped from /metrics were incremented.
+func TestGetMetricsHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+	metrics.HTTP.Reset()
+	defer metrics.HTTP.Reset()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logs", AddLogsHandler)
+	mux.HandleFunc(utils.PARSER_METRICS_URL, GetMetricsHandler)
+	ts := httptest.NewServer(middleware.Metrics(mux))
+	defer ts.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+	body, _ := json.Marshal([]string{
+		`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /home HTTP/1.1" 200 1180 "-" "Mozilla/5.0" "10.0.0.1"`,
+		`192.168.1.2 - - [2025-04-10T10:20:31Z] "GET /login HTTP/1.1" 404 120 "-" "Mozilla/5.0" "10.0.0.2"`,
+	})
+	resp, err := http.Post(ts.URL+"/logs", "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = http.Get(ts.URL + "/logs")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.NoError(t, mock.ExpectationsWereMet())
 
-    if err := mock.ExpectationsWereMet(); err != nil {
-        t.Errorf("there were unmet expectations: %s", err)
-    }
+	resp, err = http.Get(ts.URL + utils.PARSER_METRICS_URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	scraped, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	assert.Contains(t, string(scraped), `http_requests_total{method="POST",status="200"} 1`+"\n")
+	assert.Contains(t, string(scraped), `http_requests_total{method="GET",status="405"} 1`+"\n")
+	assert.Contains(t, string(scraped), "http_request_duration_seconds_count 2\n")
+	assert.Contains(t, string(scraped), "log_adds_total 2\n")
 }
-	
 
+func TestAddLogsHandler_StrictParseRejectsBatch(t *testing.T) {
+	defer goleak.VerifyNone(t)
 
-func TestInsertOneLog_Success(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
+	connection.DB = db
 
-	connection.DB = db // Set mock DB
+	utils.ConfigData.StrictParse = true
+	defer func() { utils.ConfigData.StrictParse = false }()
 
-	log := models.Log{
-		RemoteAddr:        "127.0.0.1",
-		RemoteUser:        "-",
-		TimeLocal:         time.Now(),
-		Request:           "GET /home HTTP/1.1",
-		Status:            200,
-		BodyBytesSent:     500,
-		HttpReferer:       "http://example.com",
-		HttpUserAgent:     "Mozilla/5.0",
-		HttpXForwardedFor: "192.168.0.1",
+	logs := []string{
+		`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /home HTTP/1.1" 200 1180 "-" "Mozilla/5.0" "10.0.0.1"`,
+		`this line is not an access log`,
+		`192.168.1.2 - - [2025-04-10T10:20:31Z] "GET /login HTTP/1.1" 404 120 "-" "Mozilla/5.0" "10.0.0.2"`,
+	}
+	body, _ := json.Marshal(logs)
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"status":false,"message":"Strict parse mode: 1 of 3 lines failed to parse, nothing inserted","data":{"received":3,"invalid_lines":[1]}}`, rr.Body.String())
+	// No INSERT was expected, so any Exec would have failed the mock
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddLogsHandler_LenientParseAcceptsBatch(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	utils.ConfigData.StrictParse = false
+
+	logs := []string{
+		`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /home HTTP/1.1" 200 1180 "-" "Mozilla/5.0" "10.0.0.1"`,
+		`this line is not an access log`,
+	}
+	body, _ := json.Marshal(logs)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 1 rows inserted, 1 rejected.","data":{"inserted":1,"skipped":1,"rejected":1,"rejected_lines":[1]}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddLogsHandler_DropsMissingRequiredFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(fields []string) { utils.ConfigData.RequiredFields = fields }(utils.ConfigData.RequiredFields)
+	utils.ConfigData.RequiredFields = []string{"remote_addr", "status", "time_local"}
+	defer func(mapping map[string]string) { utils.ConfigData.JSONFieldMap = mapping }(utils.ConfigData.JSONFieldMap)
+	utils.ConfigData.JSONFieldMap = nil
+
+	logs := []string{
+		`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /home HTTP/1.1" 200 1180 "-" "Mozilla/5.0" "10.0.0.1"`,
+		`{"remote_addr":"","time_local":"2025-04-10T10:20:31Z","request":"GET /login HTTP/1.1","status":200}`,
 	}
+	body, _ := json.Marshal(logs)
 
+	// Only the first log is inserted: 12 columns for a single row
+	mock.ExpectBegin()
 	mock.ExpectExec("INSERT INTO logs").
-		WithArgs(log.RemoteAddr, log.RemoteUser, log.TimeLocal, log.Request, log.Status, log.BodyBytesSent, log.HttpReferer, log.HttpUserAgent, log.HttpXForwardedFor).
+		WithArgs("192.168.1.1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	err = InsertOneLog(log)
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 1 rows inserted, 1 rejected.","data":{"inserted":1,"skipped":1,"rejected":1,"rejected_lines":[1]}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddLogsHandler_AllRejected(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	body, _ := json.Marshal([]string{
+		`this line is not an access log`,
+		`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" not-a-status`,
+		`{"remote_addr": "10.0.0.1", "status": "two hundred"}`,
+	})
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"status":false,"message":"No valid log lines parsed, 0 inserted, 3 of 3 lines rejected.",
+		"data":{"received":3,"inserted":0,"skipped":3,"rejected":3,"rejected_lines":[0,1,2]}}`, rr.Body.String())
+	// No INSERT was expected
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Nor for an empty batch
+	rr = httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBufferString(`[]`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"status":false,"message":"No valid log lines parsed, 0 inserted, 0 of 0 lines rejected.",
+		"data":{"received":0,"inserted":0,"skipped":0,"rejected":0,"rejected_lines":[]}}`, rr.Body.String())
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestInsertOneLog_DBDown(t *testing.T) {
-	connection.DB = nil // Simulate DB not alive
+func TestLogMissingFields(t *testing.T) {
+	log := models.Log{RemoteAddr: "10.0.0.1", TimeLocal: time.Now(), Status: 200}
+	assert.Empty(t, log.MissingFields([]string{"remote_addr", "status", "time_local", "body_bytes_sent"}))
 
-	log := models.Log{}
-	err := InsertOneLog(log)
+	assert.Equal(t, []string{"remote_addr", "status", "time_local"}, models.Log{}.MissingFields([]string{"remote_addr", "status", "time_local"}))
+	assert.Equal(t, []string{"status"}, models.Log{Status: 999}.MissingFields([]string{"status"}))
+	assert.Equal(t, []string{"http_referer"}, log.MissingFields([]string{"http_referer"}))
+}
+// countingReader records how many bytes of the request body were consumed.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestAddLogsHandler_TooManyLines(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	utils.ConfigData.MaxLines = 10
+	defer func() { utils.ConfigData.MaxLines = 0 }()
+
+	lines := make([]string, 50000)
+	for i := range lines {
+		lines[i] = `127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`
+	}
+	body, _ := json.Marshal(lines)
+	reader := &countingReader{r: bytes.NewReader(body)}
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", reader))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), "at most 10")
+	// Rejected partway: only a small prefix of the payload was read
+	assert.Less(t, reader.read, len(body)/10)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddLogsHandler_BodyTooLarge(t *testing.T) {
+	utils.ConfigData.MaxBodyBytes = 64
+	defer func() { utils.ConfigData.MaxBodyBytes = 0 }()
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`,
+	})
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
+
+func TestDecodeLogLines(t *testing.T) {
+	lines, err := decodeLogLines(strings.NewReader(`["a", "b"]`), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, lines)
+
+	_, err = decodeLogLines(strings.NewReader(`["a", "b", "c"]`), 2)
+	assert.ErrorIs(t, err, errTooManyLines)
+
+	_, err = decodeLogLines(strings.NewReader(`{"a": 1}`), 0)
 	assert.Error(t, err)
-	assert.Equal(t, "Database is down!", err.Error())
+
+	_, err = decodeLogLines(strings.NewReader(`["a", "b"`), 0)
+	assert.Error(t, err)
+}
+
+func TestAddLogsHandler_RetriesDeadlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	utils.ConfigData.InsertMaxRetries = 2
+	defer func() { utils.ConfigData.InsertMaxRetries = 0 }()
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`,
+	})
+	// The transaction is retried as a whole
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(&pq.Error{Code: "40P01", Message: "deadlock detected"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "1 rows inserted")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAddLogsHandler_RequestID checks that the response to a batch echoes its request id, and that the
+// logs of its parsing and of its retried insert carry the id, method and path of the request.
+func TestAddLogsHandler_RequestID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(header string) { utils.ConfigData.RequestIDHeader = header }(utils.ConfigData.RequestIDHeader)
+	utils.ConfigData.RequestIDHeader = utils.PARSER_REQUEST_ID_HEADER
+	utils.ConfigData.InsertMaxRetries = 1
+	defer func() { utils.ConfigData.InsertMaxRetries = 0 }()
+
+	var logs bytes.Buffer
+	logger.InitLogger("warn")
+	logger.Log.SetOutput(&logs)
+	logger.SetFormat(logger.FORMAT_JSON)
+	defer logger.InitLogger("error")
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`,
+		"not a log line",
+	})
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(&pq.Error{Code: "40P01", Message: "deadlock detected"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body))
+	req.Header.Set("X-Request-ID", "batch-42")
+	rr := httptest.NewRecorder()
+	middleware.RequestID(http.HandlerFunc(AddLogsHandler)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "batch-42", rr.Header().Get("X-Request-ID"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "batch-42", entry["request_id"])
+		assert.Equal(t, "POST", entry["method"])
+		assert.Equal(t, "/logs", entry["path"])
+		messages = append(messages, entry["msg"].(string))
+	}
+	assert.Len(t, messages, 2)
+	assert.Contains(t, messages[0], "Rejected 1 of 2 log lines")
+	assert.Contains(t, messages[1], "Retryable insert error")
+}
+
+// TestAddLogsHandler_DedupStrings checks that a batch sharing one user agent stores a single lookup
+// row, that the logs reference it by id, and that reads join the original string back
+func TestAddLogsHandler_DedupStrings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(enabled bool) { utils.ConfigData.DedupStrings = enabled }(utils.ConfigData.DedupStrings)
+	utils.ConfigData.DedupStrings = true
+
+	userAgent := "Mozilla/5.0 (X11; Linux x86_64)"
+	var lines []string
+	for i := 0; i < 50; i++ {
+		lines = append(lines, fmt.Sprintf(`127.0.0.%d - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "https://example.com" "%s" "-"`, i, userAgent))
+	}
+	body, _ := json.Marshal(lines)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_agents (value)")).
+		WithArgs(pq.Array([]string{userAgent})).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, value FROM user_agents")).
+		WithArgs(pq.Array([]string{userAgent})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow(3, userAgent))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO referers (value)")).
+		WithArgs(pq.Array([]string{"https://example.com"})).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, value FROM referers")).
+		WithArgs(pq.Array([]string{"https://example.com"})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "value"}).AddRow(8, "https://example.com"))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("http_user_agent_id, http_referer_id)")).
+		WillReturnResult(sqlmock.NewResult(50, 50))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "50 rows inserted")
+
+	timeLocal := time.Date(2025, time.March, 17, 13, 30, 20, 0, time.FixedZone("IST", 19800))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(50))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM logs_resolved WHERE 1=1")).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "remote_addr", "remote_user", "time_local", "request", "status",
+			"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name",
+		}).AddRow(50, "127.0.0.49", "-", timeLocal, "GET /home HTTP/1.1", 200, 500, "https://example.com", userAgent, "-", timeLocal, nil, nil))
+
+	rr = httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?limit=1", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Data struct {
+			Logs []models.Log `json:"logs"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	if assert.Len(t, response.Data.Logs, 1) {
+		assert.Equal(t, userAgent, response.Data.Logs[0].HttpUserAgent)
+		assert.Equal(t, "https://example.com", response.Data.Logs[0].HttpReferer)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAddLogsHandler_Chunked checks that a batch larger than the chunk size is written in several
+// inserts, each recorded in the insert metrics
+func TestAddLogsHandler_Chunked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(size int) { utils.ConfigData.InsertChunkSize = size }(utils.ConfigData.InsertChunkSize)
+	utils.ConfigData.InsertChunkSize = 2
+	metrics.Inserts.Reset()
+	defer metrics.Inserts.Reset()
+
+	var lines []string
+	for i := 0; i < 5; i++ {
+		lines = append(lines, fmt.Sprintf(`127.0.0.%d - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`, i))
+	}
+	body, _ := json.Marshal(lines)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "5 rows inserted")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	snapshot := metrics.Inserts.Snapshot()
+	assert.Equal(t, int64(3), snapshot.Batches)
+	assert.Equal(t, int64(5), snapshot.Rows)
+	assert.Equal(t, 1, snapshot.LastBatchSize)
+
+	rr = httptest.NewRecorder()
+	GetInsertStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/insert", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"chunk_size":2`)
+	assert.Contains(t, rr.Body.String(), `"rows":5`)
+}
+// TestAddLogsHandler_LargeBatch checks that a batch beyond the Postgres parameter limit of a single
+// INSERT is written in several
+func TestAddLogsHandler_LargeBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(size int) { utils.ConfigData.InsertChunkSize = size }(utils.ConfigData.InsertChunkSize)
+	utils.ConfigData.InsertChunkSize = utils.PARSER_INSERT_CHUNK_SIZE
+
+	lines := make([]string, 10000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`10.0.%d.%d - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`, i/256, i%256)
+	}
+	body, _ := json.Marshal(lines)
+	mock.ExpectBegin()
+	for i := 0; i < 10; i++ {
+		mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, 1000))
+	}
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "10000 rows inserted")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseWorkers(t *testing.T) {
+	defer func(workers int) { utils.ConfigData.Workers = workers }(utils.ConfigData.Workers)
+
+	utils.ConfigData.Workers = 3
+	assert.Equal(t, 3, parseWorkers(100))
+	assert.Equal(t, 2, parseWorkers(2), "no more workers than lines")
+	assert.Equal(t, 1, parseWorkers(0))
+
+	utils.ConfigData.Workers = 0
+	assert.Equal(t, min(runtime.NumCPU(), 100), parseWorkers(100))
+}
+
+func TestParseQueueSize(t *testing.T) {
+	assert.Equal(t, 10, parseQueueSize(10))
+	assert.Equal(t, utils.PARSE_QUEUE_SIZE, parseQueueSize(utils.PARSE_QUEUE_SIZE))
+	assert.Equal(t, utils.PARSE_QUEUE_SIZE, parseQueueSize(1000000), "a huge batch does not size the buffers")
+}
+
+// TestAddLogsHandler_SingleWorker checks that a batch many times larger than the parse queue is parsed by
+// the configured number of workers without blocking, and keeps its order and line numbers
+func TestAddLogsHandler_SingleWorker(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(workers int) { utils.ConfigData.Workers = workers }(utils.ConfigData.Workers)
+	utils.ConfigData.Workers = 1
+	defer func(size int) { utils.ConfigData.InsertChunkSize = size }(utils.ConfigData.InsertChunkSize)
+	utils.ConfigData.InsertChunkSize = 2 * utils.PARSE_QUEUE_SIZE
+
+	lines := make([]string, 3*utils.PARSE_QUEUE_SIZE)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`10.0.%d.%d - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`, i/256, i%256)
+	}
+	lines[2500] = "not a log line"
+	body, _ := json.Marshal(lines)
+
+	// Rows are bound in input order, the first chunk starting with the first line
+	args := make([]driver.Value, 2*utils.PARSE_QUEUE_SIZE*14)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[0], args[14] = "10.0.0.0", "10.0.0.1"
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, int64(2*utils.PARSE_QUEUE_SIZE)))
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, int64(utils.PARSE_QUEUE_SIZE-1)))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), fmt.Sprintf("%d rows inserted, 1 rejected", 3*utils.PARSE_QUEUE_SIZE-1))
+	assert.Contains(t, rr.Body.String(), `"rejected_lines":[2500]`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestInsertChunkSize checks that the chunk size, configured or auto-tuned, is capped to the logs an
+// INSERT of the current columns can bind.
+func TestInsertChunkSize(t *testing.T) {
+	defer func(config models.Config) { utils.ConfigData = config }(utils.ConfigData)
+	utils.ConfigData.InsertChunkSize, utils.ConfigData.InsertChunkMin, utils.ConfigData.InsertChunkMax = 4000, 100, 4000
+	utils.ConfigData.StoreRawLine, utils.ConfigData.IdempotentInserts, utils.ConfigData.DedupStrings = true, true, true
+	limit := utils.InsertChunkLimit()
+	assert.Less(t, limit, 4000)
+
+	utils.ConfigData.InsertAutoTune = false
+	assert.Equal(t, limit, insertChunkSize())
+
+	defer func() { insertTunerOnce, insertTuner = sync.Once{}, nil }()
+	insertTunerOnce, insertTuner = sync.Once{}, nil
+	utils.ConfigData.InsertAutoTune = true
+	assert.Equal(t, limit, insertChunkSize())
+}
+
+func TestAddLogsHandler_Copy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(size int) { utils.ConfigData.InsertChunkSize = size }(utils.ConfigData.InsertChunkSize)
+	utils.ConfigData.InsertChunkSize = 2
+	defer func(copy bool) { utils.ConfigData.InsertCopy = copy }(utils.ConfigData.InsertCopy)
+	utils.ConfigData.InsertCopy = true
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`127.0.0.2 - - [17/Mar/2025:13:30:21 +0530] "GET /about HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`127.0.0.3 - - [17/Mar/2025:13:30:22 +0530] "GET /blog HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+	})
+
+	// One COPY per chunk, all in one transaction
+	expectCopy := func(addrs ...string) {
+		copyStmt := mock.ExpectPrepare(`COPY "logs"`)
+		for _, addr := range addrs {
+			args := make([]driver.Value, 14)
+			for i := range args {
+				args[i] = sqlmock.AnyArg()
+			}
+			args[0] = addr
+			copyStmt.ExpectExec().WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		copyStmt.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, int64(len(addrs))))
+	}
+	mock.ExpectBegin()
+	expectCopy("127.0.0.1", "127.0.0.2")
+	expectCopy("127.0.0.3")
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 3 rows inserted.","data":{"inserted":3,"skipped":0}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+
+// TestAddLogsHandler_Idempotent checks that with PARSER_IDEMPOTENT_INSERTS every log carries its dedup key,
+// already stored logs are skipped by the insert, even with PARSER_INSERT_COPY, and only new rows are
+// reported as inserted
+func TestAddLogsHandler_Idempotent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(enabled bool) { utils.ConfigData.IdempotentInserts = enabled }(utils.ConfigData.IdempotentInserts)
+	utils.ConfigData.IdempotentInserts = true
+	defer func(copy bool) { utils.ConfigData.InsertCopy = copy }(utils.ConfigData.InsertCopy)
+	utils.ConfigData.InsertCopy = true
+
+	lines := []string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`127.0.0.2 - - [17/Mar/2025:13:30:21 +0530] "GET /about HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+	}
+	body, _ := json.Marshal(lines)
+
+	args := make([]driver.Value, 45)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[14], args[29], args[44] = utils.DedupKey("", lines[0]), utils.DedupKey("", lines[1]), utils.DedupKey("", lines[2])
+
+	// The third line repeats the first and is skipped: 2 of 3 rows are new
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO logs \(.*, server_name, dedup_key\)\s+VALUES .* ON CONFLICT DO NOTHING$`).
+		WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 2 rows inserted.","data":{"inserted":2,"duplicates":1,"skipped":0}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Re-posting the batch inserts nothing new
+	mock.ExpectBegin()
+	mock.ExpectExec(`ON CONFLICT DO NOTHING$`).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	rr = httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 0 rows inserted.","data":{"inserted":0,"duplicates":3,"skipped":0}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAddLogsHandler_BatchAck checks that re-posting a processed batch_id returns the original counts
+// and inserts nothing new
+func TestAddLogsHandler_BatchAck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(ttl int) { utils.ConfigData.BatchAckTTL = ttl }(utils.ConfigData.BatchAckTTL)
+	utils.ConfigData.BatchAckTTL = 3600
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`127.0.0.2 - - [17/Mar/2025:13:30:21 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`not a log line`,
+	})
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body))
+		req.Header.Set(utils.BATCH_ID_HEADER, "gen-batch-1")
+		rr := httptest.NewRecorder()
+		AddLogsHandler(rr, req)
+		return rr
+	}
+
+	// First delivery: recorded in the transaction inserting the logs
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_SELECT_BATCH)).WithArgs("gen-batch-1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted", "rejected"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CLAIM_BATCH)).WithArgs("gen-batch-1", 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_SET_BATCH_INSERTED)).WithArgs(int64(2), "gen-batch-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rr := post()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "2 rows inserted, 1 rejected")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Retry: answered from the record, no insert
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_SELECT_BATCH)).WithArgs("gen-batch-1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted", "rejected"}).AddRow(2, 1))
+
+	rr = post()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Batch already processed, 2 rows inserted, 1 rejected.",`+
+		`"data":{"batch_id":"gen-batch-1","already_processed":true,"inserted":2,"rejected":1}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Disabled: the header is ignored and no batch queries are made
+	utils.ConfigData.BatchAckTTL = 0
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	rr = post()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAddLogsHandler_BatchClaimedConcurrently checks that a batch whose id a concurrent request recorded
+// between the lookup and the insert is rolled back and answered from that request's record, and that a
+// failed insert leaves the id unrecorded, for the retry to insert the batch.
+func TestAddLogsHandler_BatchClaimedConcurrently(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(ttl int) { utils.ConfigData.BatchAckTTL = ttl }(utils.ConfigData.BatchAckTTL)
+	utils.ConfigData.BatchAckTTL = 3600
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+	})
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body))
+		req.Header.Set(utils.BATCH_ID_HEADER, "gen-batch-2")
+		rr := httptest.NewRecorder()
+		AddLogsHandler(rr, req)
+		return rr
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_SELECT_BATCH)).WithArgs("gen-batch-2", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted", "rejected"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CLAIM_BATCH)).WithArgs("gen-batch-2", 0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_SELECT_BATCH)).WithArgs("gen-batch-2", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted", "rejected"}).AddRow(1, 0))
+
+	rr := post()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"already_processed":true`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// The record rolls back with a failed insert
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_SELECT_BATCH)).WithArgs("gen-batch-2", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"inserted", "rejected"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_CLAIM_BATCH)).WithArgs("gen-batch-2", 0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(fmt.Errorf("disk full"))
+	mock.ExpectRollback()
+
+	rr = post()
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAddLogsHandler_ChunkFailureRollsBack checks that a failing chunk rolls back the chunks
+// written before it
+func TestAddLogsHandler_ChunkFailureRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(size int) { utils.ConfigData.InsertChunkSize = size }(utils.ConfigData.InsertChunkSize)
+	utils.ConfigData.InsertChunkSize = 1
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`127.0.0.2 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+	})
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to insert logs: disk full, nothing inserted")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAddLogsHandler_InsertTimeout checks that an insert outlasting PARSER_INSERT_TIMEOUT is cancelled
+// and rolled back
+func TestAddLogsHandler_InsertTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(timeout int) { utils.ConfigData.InsertTimeout = timeout }(utils.ConfigData.InsertTimeout)
+	utils.ConfigData.InsertTimeout = 1
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+	})
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillDelayFor(time.Minute).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Failed to insert logs: timed out after 1s")
+	assert.Contains(t, rr.Body.String(), "nothing inserted")
+}
+
+// TestQueryTimeout checks that a query outlasting PARSER_QUERY_TIMEOUT is cancelled and answered with 504
+func TestQueryTimeout(t *testing.T) {
+	defer func(timeout int) { utils.ConfigData.QueryTimeout = timeout }(utils.ConfigData.QueryTimeout)
+	utils.ConfigData.QueryTimeout = 1
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		url     string
+		expect  func(mock sqlmock.Sqlmock)
+	}{
+		{"get logs", GetLogsHandler, http.MethodGet, "/logs", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+			mock.ExpectQuery("SELECT id, remote_addr").WillDelayFor(time.Minute).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		}},
+		{"count logs", GetLogsCountHandler, http.MethodGet, "/logs/count?status=500", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs$`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+			mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs WHERE`).WillDelayFor(time.Minute).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		}},
+		{"delete logs", DeleteLogsHandler, http.MethodDelete, "/logs?status=500", func(mock sqlmock.Sqlmock) {
+			mock.ExpectExec("DELETE FROM logs").WillDelayFor(time.Minute).WillReturnResult(sqlmock.NewResult(0, 3))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			connection.DB = db
+			tt.expect(mock)
+
+			started := time.Now()
+			rr := httptest.NewRecorder()
+			tt.handler(rr, httptest.NewRequest(tt.method, tt.url, nil))
+
+			assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+			assert.JSONEq(t, `{"status":false,"message":"Database query timed out after 1s","data":null}`, rr.Body.String())
+			assert.Less(t, time.Since(started), 10*time.Second)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetWatermarkHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	lastLog := time.Now().Add(-90 * time.Second).UTC().Truncate(time.Second)
+	mock.ExpectQuery(`SELECT MAX\(time_local\) FROM logs`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(lastLog))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs WHERE time_local >= \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	mock.ExpectQuery(`SELECT COALESCE\(AVG\(EXTRACT\(EPOCH FROM \(ingested_at - time_local\)\)\), 0\), .* WHERE ingested_at >= \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"avg", "max"}).AddRow(1.5, 4.0))
+
+	rr := httptest.NewRecorder()
+	GetWatermarkHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/watermark?interval=5m", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp struct {
+		Status bool `json:"status"`
+		Data   struct {
+			LastLogTime time.Time `json:"last_log_time"`
+			LagSeconds  float64   `json:"lag_seconds"`
+			Interval    string    `json:"interval"`
+			RecentCount int       `json:"recent_count"`
+			IngestLag   struct {
+				Avg float64 `json:"avg"`
+				Max float64 `json:"max"`
+			} `json:"ingest_lag_seconds"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.True(t, resp.Status)
+	assert.True(t, lastLog.Equal(resp.Data.LastLogTime))
+	assert.InDelta(t, 90, resp.Data.LagSeconds, 5)
+	assert.Equal(t, "5m0s", resp.Data.Interval)
+	assert.Equal(t, 42, resp.Data.RecentCount)
+	assert.Equal(t, 1.5, resp.Data.IngestLag.Avg)
+	assert.Equal(t, 4.0, resp.Data.IngestLag.Max)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetWatermarkHandler_MySQL checks that the watermark queries are written for MySQL, with ?
+// placeholders and TIMESTAMPDIFF in place of EXTRACT(EPOCH FROM ...).
+func TestGetWatermarkHandler_MySQL(t *testing.T) {
+	defer func() { utils.DBDriver = utils.DB_DRIVER }()
+	utils.DBDriver = utils.DB_DRIVER_MYSQL
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(`SELECT MAX\(time_local\) FROM logs`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(time.Now()))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs WHERE time_local >= \?`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	mock.ExpectQuery(regexp.QuoteMeta(utils.DriverQuery(utils.QUERY_INGEST_LAG_SINCE_MYSQL))).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"avg", "max"}).AddRow(1.5, 4.0))
+
+	rr := httptest.NewRecorder()
+	GetWatermarkHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/watermark", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"ingest_lag_seconds":{"avg":1.5,"max":4}`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetWatermarkHandler_EmptyTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(`SELECT MAX\(time_local\) FROM logs`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs WHERE time_local >= \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`WHERE ingested_at >= \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"avg", "max"}).AddRow(0, 0))
+
+	rr := httptest.NewRecorder()
+	GetWatermarkHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/watermark", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Watermark retrieved successfully","data":{"last_log_time":null,"lag_seconds":null,"interval":"10m0s","recent_count":0,"ingest_lag_seconds":{"avg":0,"max":0}}}`, rr.Body.String())
+}
+
+func TestGetWatermarkHandler_InvalidInterval(t *testing.T) {
+	rr := httptest.NewRecorder()
+	GetWatermarkHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/watermark?interval=soon", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestGetAggregateStatsHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(`SELECT status, COUNT\(\*\) FROM logs WHERE 1=1 AND remote_addr = \$1 AND time_local >= \$2 AND time_local <= \$3 GROUP BY status ORDER BY status`).
+		WithArgs("10.0.0.1", "2025-04-10T00:00:00Z", "2025-04-11T00:00:00Z").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).AddRow(200, 120).AddRow(404, 7).AddRow(500, 3))
+
+	rr := httptest.NewRecorder()
+	GetAggregateStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/aggregate?remote_addr=10.0.0.1&start_time=2025-04-10&end_time=2025-04-11", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Status aggregate retrieved successfully","data":{"statuses":{"200":120,"404":7,"500":3},"total":130}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAggregateStatsHandler_EmptyAndInvalid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(`GROUP BY status`).WillReturnRows(sqlmock.NewRows([]string{"status", "count"}))
+	rr := httptest.NewRecorder()
+	GetAggregateStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/aggregate", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Status aggregate retrieved successfully","data":{"statuses":{},"total":0}}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	GetAggregateStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/aggregate?start_time=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	GetAggregateStatsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs/aggregate", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTopIPsHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	tests := []struct {
+		name  string
+		url   string
+		limit int
+	}{
+		{"default limit", "/stats/top-ips", 10},
+		{"custom limit", "/stats/top-ips?limit=3", 3},
+		{"clamped limit", "/stats/top-ips?limit=5000", 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.ExpectQuery(`SELECT remote_addr, COUNT\(\*\) c FROM logs WHERE 1=1 GROUP BY remote_addr ORDER BY c DESC, remote_addr LIMIT \$1`).
+				WithArgs(tt.limit).
+				WillReturnRows(sqlmock.NewRows([]string{"remote_addr", "c"}).AddRow("10.0.0.1", 42).AddRow("10.0.0.2", 7))
+
+			rr := httptest.NewRecorder()
+			GetTopIPsHandler(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.JSONEq(t, `{"status":true,"message":"Top IPs retrieved successfully","data":[{"ip_address":"10.0.0.1","count":42},{"ip_address":"10.0.0.2","count":7}]}`, rr.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetTopIPsHandler_FiltersAndInvalid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(`WHERE 1=1 AND status = \$1 AND time_local >= \$2 GROUP BY remote_addr ORDER BY c DESC, remote_addr LIMIT \$3`).
+		WithArgs(500, "2025-04-10T00:00:00Z", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"remote_addr", "c"}))
+	rr := httptest.NewRecorder()
+	GetTopIPsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/top-ips?status=500&start_time=2025-04-10", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Top IPs retrieved successfully","data":[]}`, rr.Body.String())
+
+	for _, url := range []string{"/stats/top-ips?limit=0", "/stats/top-ips?limit=ten", "/stats/top-ips?end_time=later"} {
+		rr = httptest.NewRecorder()
+		GetTopIPsHandler(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTimeSeriesHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	tests := []struct {
+		name     string
+		url      string
+		interval string
+	}{
+		{"default interval", "/stats/timeseries", "hour"},
+		{"minute", "/stats/timeseries?interval=1m", "minute"},
+		{"hour", "/stats/timeseries?interval=hour", "hour"},
+		{"day", "/stats/timeseries?interval=1d", "day"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.ExpectQuery(`SELECT date_trunc\('` + tt.interval + `', time_local\) bucket, COUNT\(\*\) FROM logs WHERE 1=1 GROUP BY bucket ORDER BY bucket`).
+				WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}).
+					AddRow(time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC), 42).
+					AddRow(time.Date(2025, time.April, 10, 11, 0, 0, 0, time.UTC), 7))
+
+			rr := httptest.NewRecorder()
+			GetTimeSeriesHandler(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.JSONEq(t, `{"status":true,"message":"Time series retrieved successfully","data":[{"bucket":"2025-04-10T10:00:00Z","count":42},{"bucket":"2025-04-10T11:00:00Z","count":7}]}`, rr.Body.String())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetTimeSeriesHandler_FiltersAndInvalid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(`SELECT date_trunc\('minute', time_local\) bucket, COUNT\(\*\) FROM logs WHERE 1=1 AND status = \$1 AND time_local >= \$2 AND time_local <= \$3 GROUP BY bucket ORDER BY bucket`).
+		WithArgs(500, "2025-04-10T10:00:00Z", "2025-04-10T11:00:00Z").
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}))
+	rr := httptest.NewRecorder()
+	GetTimeSeriesHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/timeseries?interval=1m&status=500&start_time=2025-04-10T10:00:00Z&end_time=2025-04-10T11:00:00Z", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Time series retrieved successfully","data":[]}`, rr.Body.String())
+
+	for _, url := range []string{"/stats/timeseries?interval=week", "/stats/timeseries?interval=5m", "/stats/timeseries?start_time=soon"} {
+		rr = httptest.NewRecorder()
+		GetTimeSeriesHandler(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+
+	rr = httptest.NewRecorder()
+	GetTimeSeriesHandler(rr, httptest.NewRequest(http.MethodPost, "/stats/timeseries", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReenrichHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(`SELECT id, request FROM logs WHERE request_method IS NULL AND id > \$1 AND status = \$2 ORDER BY id LIMIT \$3`).
+		WithArgs(0, 200, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "request"}).
+			AddRow(3, "GET /home HTTP/1.1").
+			AddRow(5, "POST /login HTTP/2"))
+	mock.ExpectExec(`UPDATE logs AS l SET request_method = v.request_method`).
+		WithArgs(3, "GET", "/home", "HTTP/1.1", 5, "POST", "/login", "HTTP/2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(`SELECT id, request FROM logs WHERE request_method IS NULL AND id > \$1`).
+		WithArgs(5, 200, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "request"}).AddRow(8, nil))
+	mock.ExpectExec(`UPDATE logs AS l SET request_method = v.request_method`).
+		WithArgs(8, "", "", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	ReenrichHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reenrich?status=200&batch_size=2", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Re-enriched 3 logs","data":{"processed":3,"batches":2,"next_cursor":null,"done":true}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReenrichHandler_ResumesFromCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(`SELECT id, request FROM logs WHERE request_method IS NULL AND id > \$1 ORDER BY id LIMIT \$2`).
+		WithArgs(40, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "request"}).AddRow(41, "GET / HTTP/1.1"))
+	mock.ExpectExec(`UPDATE logs AS l`).
+		WithArgs(41, "GET", "/", "HTTP/1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr := httptest.NewRecorder()
+	ReenrichHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reenrich?cursor=40&batch_size=1&max_batches=1", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Re-enriched 1 logs","data":{"processed":1,"batches":1,"next_cursor":41,"done":false}}`, rr.Body.String())
+	assert.Equal(t, `<http://example.com/admin/reenrich?batch_size=1&cursor=41&max_batches=1>; rel="next"`, rr.Header().Get("Link"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReenrichHandler_InvalidParams(t *testing.T) {
+	rr := httptest.NewRecorder()
+	ReenrichHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reenrich?batch_size=0", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	ReenrichHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/reenrich", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestGetLogsHandler(t *testing.T) {
+    db, mock, err := sqlmock.New()
+    if err != nil {
+        t.Fatalf("Failed to open sqlmock database: %s", err)
+    }
+    defer db.Close()
+
+    connection.DB = db
+	timeLocal := time.Date(2025, time.March, 17, 13, 30, 20, 0, time.FixedZone("IST", 19800))
+	ingestedAt := timeLocal.Add(3 * time.Second)
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT id, remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for, ingested_at").
+    WillReturnRows(
+        sqlmock.NewRows([]string{
+            "id", "remote_addr", "remote_user", "time_local", "request", "status",
+            "body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name",
+        }).AddRow(
+            7, "192.168.1.1", "-",
+            timeLocal,
+            "GET /home HTTP/1.1", 200,
+            1234, "http://example.com", "Mozilla/5.0", "192.168.0.1",
+            ingestedAt, 0.042, nil,
+        ),
+    )
+			
+    req, err := http.NewRequest("GET", "/logs", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    rr := httptest.NewRecorder()
+    handler := http.HandlerFunc(GetLogsHandler)
+    handler.ServeHTTP(rr, req)
+    if status := rr.Code; status != http.StatusOK {
+        t.Errorf("GetLogsHandler returned wrong status code: got %v want %v", status, http.StatusOK)
+    }
+
+	expected := `{"status":true,"message":"Fetched logs successfully","data":{"count":{"fetch":1,"total":1},"logs":[{"remote_addr":"192.168.1.1","remote_user":"-","time_local":"2025-03-17T13:30:20+05:30","request":"GET /home HTTP/1.1","status":200,"body_bytes_sent":1234,"http_referer":"http://example.com","http_user_agent":"Mozilla/5.0","http_x_forwarded_for":"192.168.0.1","ingested_at":"2025-03-17T13:30:23+05:30","response_time":0.042}],"paging":{"limit":10,"next_cursor":null,"prev_cursor":null}}}`
+	assert.JSONEq(t, expected, rr.Body.String())
+
+    if err := mock.ExpectationsWereMet(); err != nil {
+        t.Errorf("there were unmet expectations: %s", err)
+    }
+}
+
+func TestGetLogsHandler_EpochMillis(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	timeLocal := time.Date(2025, time.March, 17, 8, 0, 20, 250*int(time.Millisecond), time.UTC)
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+
+	// First page: one row, rendered in epoch milliseconds
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT id, remote_addr").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(7, "192.168.1.1", "-", timeLocal, "GET /home HTTP/1.1", 200, 1234, "-", "Mozilla/5.0", "-", nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?time_format=epoch_ms&limit=1", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp struct {
+		Data struct {
+			Logs []struct {
+				TimeLocal int64 `json:"time_local"`
+			} `json:"logs"`
+			Paging struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"paging"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Len(t, resp.Data.Logs, 1)
+	assert.Equal(t, int64(1742198420250), resp.Data.Logs[0].TimeLocal)
+	assert.Equal(t, utils.EncodeCursor(timeLocal, 7), resp.Data.Paging.NextCursor)
+
+	// Second page: the cursor is accepted and resolves to the same instant
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`time_local < \$1 OR \(time_local = \$1 AND id < \$2\)`).
+		WithArgs("2025-03-17T08:00:20.25Z", 7, 1).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	rr = httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?time_format=epoch_ms&limit=1&cursor="+resp.Data.Paging.NextCursor, nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetLogsHandler_LinkHeader checks that the Link header carries next and prev URLs that keep the
+// request's other parameters and hold the same cursors as the body.
+func TestGetLogsHandler_LinkHeader(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	timeLocal := time.Date(2025, time.March, 17, 8, 0, 20, 0, time.UTC)
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	cursor := utils.EncodeCursor(timeLocal, 7)
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`time_local < \$1 OR \(time_local = \$1 AND id < \$2\)`).
+		WithArgs("2025-03-17T08:00:20Z", 7, 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(6, "192.168.1.1", "-", timeLocal.Add(-time.Minute), "GET /home HTTP/1.1", 200, 1234, "-", "curl", "-", nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "http://logs.example.com/logs?time_format=epoch_ms&limit=1&cursor="+cursor, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp struct {
+		Data struct {
+			Paging struct {
+				NextCursor string `json:"next_cursor"`
+				PrevCursor string `json:"prev_cursor"`
+			} `json:"paging"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.Data.Paging.NextCursor)
+	assert.NotEmpty(t, resp.Data.Paging.PrevCursor)
+
+	pageURL := func(cursor string, extra url.Values) string {
+		values := url.Values{"cursor": {cursor}, "limit": {"1"}, "time_format": {"epoch_ms"}}
+		for key, value := range extra {
+			values[key] = value
+		}
+		return "http://logs.example.com/logs?" + values.Encode()
+	}
+	assert.Equal(t, "<"+pageURL(resp.Data.Paging.NextCursor, nil)+`>; rel="next", <`+
+		pageURL(resp.Data.Paging.PrevCursor, url.Values{"direction": {"prev"}})+`>; rel="prev"`, rr.Header().Get("Link"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetLogsHandler_PrevPage pages forward from the newest logs, then back again, over five logs with
+// ids 1 to 5 and times in the same order, two per page
+func TestGetLogsHandler_PrevPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	start := time.Date(2025, time.March, 17, 8, 0, 0, 0, time.UTC)
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	rowsOf := func(ids ...int) *sqlmock.Rows {
+		rows := sqlmock.NewRows(columns)
+		for _, id := range ids {
+			rows.AddRow(id, fmt.Sprintf("10.0.0.%d", id), "-", start.Add(time.Duration(id)*time.Minute), "GET / HTTP/1.1", 200, 100, "-", "curl", "-", nil, nil, nil)
+		}
+		return rows
+	}
+	type page struct {
+		Data struct {
+			Logs   []models.Log `json:"logs"`
+			Paging struct {
+				NextCursor *string `json:"next_cursor"`
+				PrevCursor *string `json:"prev_cursor"`
+			} `json:"paging"`
+		} `json:"data"`
+	}
+	expectPage := func(query string) *sqlmock.ExpectedQuery {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+		return mock.ExpectQuery(query)
+	}
+	get := func(target string) page {
+		rr := httptest.NewRecorder()
+		GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var p page
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+		return p
+	}
+	addrs := func(p page) []string {
+		var out []string
+		for _, log := range p.Data.Logs {
+			out = append(out, log.RemoteAddr)
+		}
+		return out
+	}
+
+	// First page: the newest two, with only a next page
+	expectPage(regexp.QuoteMeta("ORDER BY time_local DESC, id DESC LIMIT $1")).WithArgs(2).WillReturnRows(rowsOf(5, 4))
+	first := get("/logs?limit=2")
+	assert.Equal(t, []string{"10.0.0.5", "10.0.0.4"}, addrs(first))
+	assert.Nil(t, first.Data.Paging.PrevCursor)
+	if !assert.NotNil(t, first.Data.Paging.NextCursor) {
+		return
+	}
+
+	// Forward: the two after id 4, with both neighbours
+	expectPage(regexp.QuoteMeta("time_local < $1 OR (time_local = $1 AND id < $2)")).
+		WithArgs(start.Add(4*time.Minute).Format(time.RFC3339Nano), 4, 2).WillReturnRows(rowsOf(3, 2))
+	second := get("/logs?limit=2&cursor=" + url.QueryEscape(*first.Data.Paging.NextCursor))
+	assert.Equal(t, []string{"10.0.0.3", "10.0.0.2"}, addrs(second))
+	if !assert.NotNil(t, second.Data.Paging.PrevCursor) || !assert.NotNil(t, second.Data.Paging.NextCursor) {
+		return
+	}
+
+	// Backward from the second page: read walking up from id 3, returned newest first again
+	expectPage(regexp.QuoteMeta("time_local > $1 OR (time_local = $1 AND id > $2)")+`.*`+regexp.QuoteMeta("ORDER BY time_local ASC, id ASC LIMIT $3")).
+		WithArgs(start.Add(3*time.Minute).Format(time.RFC3339Nano), 3, 2).WillReturnRows(rowsOf(4, 5))
+	back := get("/logs?limit=2&direction=prev&cursor=" + url.QueryEscape(*second.Data.Paging.PrevCursor))
+	assert.Equal(t, addrs(first), addrs(back))
+	// The way forward leads to the second page again, and a full page may have more before it
+	if assert.NotNil(t, back.Data.Paging.NextCursor) {
+		assert.Equal(t, *first.Data.Paging.NextCursor, *back.Data.Paging.NextCursor)
+	}
+	assert.NotNil(t, back.Data.Paging.PrevCursor)
+
+	// A short previous page is the first one
+	expectPage(regexp.QuoteMeta("ORDER BY time_local ASC, id ASC LIMIT $3")).WillReturnRows(rowsOf(5))
+	top := get("/logs?limit=2&direction=prev&cursor=" + url.QueryEscape(*back.Data.Paging.PrevCursor))
+	assert.Equal(t, []string{"10.0.0.5"}, addrs(top))
+	assert.Nil(t, top.Data.Paging.PrevCursor)
+	assert.NotNil(t, top.Data.Paging.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestTenantIsolation checks that requests authenticated as tenant A only read, count, aggregate, delete
+// and ingest tenant A's rows, whatever tenant their query parameters name.
+func TestTenantIsolation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(tenants map[string]string, header string) {
+		utils.ConfigData.Tenants, utils.ConfigData.TenantHeader = tenants, header
+	}(utils.ConfigData.Tenants, utils.ConfigData.TenantHeader)
+	utils.ConfigData.TenantHeader = "X-API-Key"
+	utils.ConfigData.Tenants = map[string]string{"key-a": "tenant-a", "key-b": "tenant-b"}
+
+	asTenantA := func(handler http.HandlerFunc, method string, target string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, body)
+		req.Header.Set("X-API-Key", "key-a")
+		rr := httptest.NewRecorder()
+		middleware.RequireTenant(handler)(rr, req)
+		return rr
+	}
+
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM (SELECT * FROM logs WHERE tenant_id = $1) AS logs")).
+		WithArgs("tenant-a").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE 1=1 AND status = $1 AND tenant_id = $2 ORDER BY")).
+		WithArgs(200, "tenant-a", 10).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "10.0.0.1", "-", time.Now(), "GET /a HTTP/1.1", 200, 10, "-", "curl", "-", nil, nil, nil))
+	rr := asTenantA(GetLogsHandler, http.MethodGet, "/logs?status=200&tenant_id=tenant-b", nil)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM (SELECT * FROM logs WHERE tenant_id = $1) AS logs GROUP BY status")).
+		WithArgs("tenant-a").WillReturnRows(sqlmock.NewRows([]string{"status", "count", "avg_bytes"}).AddRow(200, 1, 10.0))
+	rr = asTenantA(GetStatusStatsHandler, http.MethodGet, "/stats/status?tenant_id=tenant-b", nil)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM logs WHERE 1=1 AND tenant_id = $1")).
+		WithArgs("tenant-a").WillReturnResult(sqlmock.NewResult(0, 1))
+	rr = asTenantA(DeleteLogsHandler, http.MethodDelete, "/logs?tenant_id=tenant-b&confirm=true", nil)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Ingested logs are stored for the tenant of the key, even when a JSON line names another
+	line := `{"remote_addr":"10.0.0.1","time_local":"2025-03-17T13:30:20Z","request":"GET /a HTTP/1.1","status":200,"tenant_id":"tenant-b"}`
+	body, err := json.Marshal([]string{line})
+	assert.NoError(t, err)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("server_name, tenant_id)")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "tenant-a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	rr = asTenantA(AddLogsHandler, http.MethodPost, "/logs", bytes.NewReader(body))
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// A tenant's ML insights come from its own service, reading only its logs
+	saved := mlService
+	defer func() { mlService = saved }()
+	assert.NoError(t, InitializeMLService())
+	req := httptest.NewRequest(http.MethodGet, "/ml/insights", nil)
+	tenantService := mlServiceFor(req.WithContext(utils.WithTenant(req.Context(), "tenant-a")))
+	assert.NotSame(t, mlService, tenantService)
+	assert.Same(t, tenantService, mlServiceFor(req.WithContext(utils.WithTenant(req.Context(), "tenant-a"))))
+	assert.Same(t, mlService, mlServiceFor(req))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM (SELECT * FROM logs WHERE tenant_id = $1) AS logs")).
+		WithArgs("tenant-a", sqlmock.AnyArg(), 10000).WillReturnRows(sqlmock.NewRows([]string{"remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for"}))
+	_, err = tenantService.GenerateInsights()
+	assert.NoError(t, err)
+
+	// Without a valid key nothing is read
+	req = httptest.NewRequest(http.MethodGet, "/logs", nil)
+	req.Header.Set("X-API-Key", "unknown")
+	rr = httptest.NewRecorder()
+	middleware.RequireTenant(GetLogsHandler)(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLogsHandler_TamperedCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	cursor := utils.EncodeCursor(time.Now(), 7)
+	tampered := strings.Replace(cursor, cursor[:4], "AAAA", 1)
+
+	rr := httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?cursor="+tampered, nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid cursor")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLogsHandler_SortRejections(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	cursor := url.QueryEscape(utils.EncodeCursor(time.Now(), 7))
+	for target, message := range map[string]string{
+		"/logs?sort_by=remote_addr":             "invalid sort_by: 'remote_addr'",
+		"/logs?order=up":                        "invalid order: 'up'",
+		"/logs?sort_by=status&cursor=" + cursor: "cursor pagination requires sort_by=time_local",
+		"/logs?cursor_by=id&sort_by=status":     "sort_by and order cannot be combined with cursor_by=id",
+		"/logs?direction=up":                    "invalid direction: 'up'",
+		"/logs?direction=prev":                  "direction=prev requires a cursor",
+	} {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		rr := httptest.NewRecorder()
+		GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+		assert.Contains(t, rr.Body.String(), message, target)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLogsHandler_SortedWithoutCursors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	timeLocal := time.Date(2025, time.March, 17, 13, 30, 20, 0, time.UTC)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY body_bytes_sent DESC, id DESC LIMIT $1")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "remote_addr", "remote_user", "time_local", "request", "status",
+			"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name",
+		}).AddRow(3, "10.0.0.1", "-", timeLocal, "GET /big HTTP/1.1", 200, 90000, "-", "curl/8.0", "-", timeLocal, nil, nil))
+
+	rr := httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?sort_by=body_bytes_sent&limit=1", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	// A full page sorted by size still has no cursor to page on
+	assert.Contains(t, rr.Body.String(), `"next_cursor":null`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLogsHandler_CursorByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	timeLocal := time.Date(2025, time.March, 17, 8, 0, 20, 0, time.UTC)
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	cursor := utils.EncodeCursor(timeLocal, 7)
+
+	// A short page still hands out a cursor to poll for logs that arrive later
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(8))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE 1=1 AND id > $1 ORDER BY id ASC LIMIT $2")).
+		WithArgs(7, 10).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(8, "192.168.1.1", "-", timeLocal.Add(-time.Hour), "GET /home HTTP/1.1", 200, 1234, "-", "curl", "-", nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?cursor_by=id&cursor="+cursor, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"next_cursor":"`+utils.EncodeCursor(timeLocal.Add(-time.Hour), 8)+`"`)
+
+	// An empty page keeps the cursor it was given
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(8))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE 1=1 AND id > $1 ORDER BY id ASC LIMIT $2")).
+		WithArgs(7, 10).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	rr = httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?cursor_by=id&cursor="+cursor, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"next_cursor":"`+cursor+`"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(8))
+	rr = httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?cursor_by=event_time", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invalid cursor_by")
+}
+
+// TestDeleteLogsHandler_TimeRange checks that start_time and end_time bound the deleted logs, in a dry
+// run as in the delete itself
+func TestDeleteLogsHandler_TimeRange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM logs WHERE 1=1 AND time_local <= $1")).
+		WithArgs("2025-04-01T00:00:00Z").
+		WillReturnResult(sqlmock.NewResult(0, 12))
+	rr := httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?end_time=2025-04-01", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"12 logs deleted successfully.","data":null}`, rr.Body.String())
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM logs WHERE 1=1 AND status = $1 AND time_local >= $2 AND time_local <= $3")).
+		WithArgs(500, "2025-04-10T00:00:00Z", "2025-04-11T00:00:00Z").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	rr = httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?status=500&start_time=2025-04-10&end_time=2025-04-11", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs WHERE 1=1 AND time_local >= $1")).
+		WithArgs("2025-04-10T00:00:00Z").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	rr = httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?start_time=2025-04-10&dry_run=true", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?end_time=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteLogsHandler_RequiresConfirm checks that a delete without any filter or time range is refused
+// unless confirmed, including one whose only filter had an invalid value
+func TestDeleteLogsHandler_RequiresConfirm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	for _, url := range []string{"/logs", "/logs?status=abc", "/logs?confirm=yes"} {
+		rr := httptest.NewRecorder()
+		DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, url, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+		assert.Contains(t, rr.Body.String(), "confirm=true", url)
+	}
+	// No ExpectExec was registered, so a DELETE would have failed the handler
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM logs WHERE 1=1")).
+		WithoutArgs().
+		WillReturnResult(sqlmock.NewResult(0, 100))
+	rr := httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?confirm=true", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"100 logs deleted successfully.","data":null}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteLogsHandler_TenantRequiresConfirm checks that the tenant filter of a tenant's request does not
+// count as a filter, so that the tenant's unfiltered delete still needs confirm=true.
+func TestDeleteLogsHandler_TenantRequiresConfirm(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	tenantRequest := func(url string) *http.Request {
+		req := httptest.NewRequest(http.MethodDelete, url, nil)
+		return req.WithContext(utils.WithTenant(req.Context(), "tenant-a"))
+	}
+
+	rr := httptest.NewRecorder()
+	DeleteLogsHandler(rr, tenantRequest("/logs"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "confirm=true")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM logs WHERE 1=1 AND tenant_id = $1")).
+		WithArgs("tenant-a").
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	rr = httptest.NewRecorder()
+	DeleteLogsHandler(rr, tenantRequest("/logs?confirm=true"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM logs WHERE 1=1 AND status = $1 AND tenant_id = $2")).
+		WithArgs(500, "tenant-a").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	rr = httptest.NewRecorder()
+	DeleteLogsHandler(rr, tenantRequest("/logs?status=500"))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteLogsHandler_DryRun checks that a dry run counts and samples the matching logs and
+// never executes the DELETE
+func TestDeleteLogsHandler_DryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	timeLocal := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs WHERE 1=1 AND status = $1")).
+		WithArgs(500).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM logs WHERE 1=1 AND status = $1 ORDER BY time_local ASC, id ASC LIMIT $2")).
+		WithArgs(500, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "10.0.0.1", "-", timeLocal, "GET /a HTTP/1.1", 500, 10, "-", "curl", "-", nil, nil, nil).
+			AddRow(2, "10.0.0.2", "-", timeLocal.Add(time.Minute), "GET /b HTTP/1.1", 500, 20, "-", "curl", "-", nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?status=500&dry_run=true&sample=2", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp struct {
+		Message string `json:"message"`
+		Data    struct {
+			DryRun  bool         `json:"dry_run"`
+			Matched int          `json:"matched"`
+			Sample  []models.Log `json:"sample"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, "Dry run: 42 logs would be deleted.", resp.Message)
+	assert.True(t, resp.Data.DryRun)
+	assert.Equal(t, 42, resp.Data.Matched)
+	if assert.Len(t, resp.Data.Sample, 2) {
+		assert.Equal(t, "10.0.0.1", resp.Data.Sample[0].RemoteAddr)
+		assert.Equal(t, "GET /b HTTP/1.1", resp.Data.Sample[1].Request)
+	}
+	// No ExpectExec was registered, so a DELETE would have failed the handler
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Nothing matches: no sample query, and the sample is an empty list
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs WHERE 1=1 AND status = $1")).
+		WithArgs(404).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	rr = httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?status=404&dry_run=true", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Dry run: 0 logs would be deleted.","data":{"dry_run":true,"matched":0,"sample":[]}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	rr = httptest.NewRecorder()
+	DeleteLogsHandler(rr, httptest.NewRequest(http.MethodDelete, "/logs?dry_run=true&sample=500", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLogsHandler_InvalidTimeFormat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM logs`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	rr := httptest.NewRecorder()
+	GetLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs?time_format=unix", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLogIngestLag(t *testing.T) {
+	timeLocal := time.Date(2025, time.March, 17, 13, 30, 20, 0, time.UTC)
+	ingestedAt := timeLocal.Add(90 * time.Second)
+
+	assert.Equal(t, 90*time.Second, models.Log{TimeLocal: timeLocal, IngestedAt: &ingestedAt}.IngestLag())
+	assert.Equal(t, time.Duration(0), models.Log{TimeLocal: timeLocal}.IngestLag())
+}
+
+func TestInsertOneLog_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	connection.DB = db // Set mock DB
+
+	log := models.Log{
+		RemoteAddr:        "127.0.0.1",
+		RemoteUser:        "-",
+		TimeLocal:         time.Now(),
+		Request:           "GET /home HTTP/1.1",
+		Status:            200,
+		BodyBytesSent:     500,
+		HttpReferer:       "http://example.com",
+		HttpUserAgent:     "Mozilla/5.0",
+		HttpXForwardedFor: "192.168.0.1",
+	}
+
+	mock.ExpectExec("INSERT INTO logs").
+		WithArgs(log.RemoteAddr, log.RemoteUser, log.TimeLocal, log.Request, log.Status, log.BodyBytesSent, log.HttpReferer, log.HttpUserAgent, log.HttpXForwardedFor).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = InsertOneLog(log)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertOneLog_DBDown(t *testing.T) {
+	connection.DB = nil // Simulate DB not alive
+
+	log := models.Log{}
+	err := InsertOneLog(log)
+	assert.Error(t, err)
+	assert.Equal(t, "Database is down!", err.Error())
+}
+
+func TestInsertOneLog_InsertFail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	connection.DB = db
+
+	log := models.Log{}
+
+	mock.ExpectExec("INSERT INTO logs").
+		WithArgs(log.RemoteAddr, log.RemoteUser, log.TimeLocal, log.Request, log.Status, log.BodyBytesSent, log.HttpReferer, log.HttpUserAgent, log.HttpXForwardedFor).
+		WillReturnError(assert.AnError)
+
+	err = InsertOneLog(log)
+	assert.Error(t, err)
+	assert.Equal(t, assert.AnError, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessLogWorker(t *testing.T) {
+	logs := make(chan LogLine, 1)
+	results := make(chan ParsedLog, 1)
+	var wg sync.WaitGroup
+	var skipped atomic.Int64
+
+	// Add one item to WaitGroup as one goroutine will run
+	wg.Add(1)
+	go ProcessLogWorker(context.Background(), logs, results, &skipped, &wg)
+
+	// Send a test log line
+	logs <- LogLine{Index: 0, Raw: `127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`}
+	close(logs) // Important to close channel so goroutine can exit
+
+	// Wait for goroutine to finish
+	wg.Wait()
+	close(results)
+
+	// Assert the result
+	result := <-results
+	assert.True(t, result.Valid)
+	assert.Equal(t, 0, result.Index)
+	parsedLog := result.Log
+	assert.Equal(t, "127.0.0.1", parsedLog.RemoteAddr)
+	assert.Equal(t, "GET /home HTTP/1.1", parsedLog.Request)
+	assert.Equal(t, 200, parsedLog.Status)
+	assert.Zero(t, skipped.Load())
+}
+
+func TestProcessLogWorker_CountsSkipped(t *testing.T) {
+	lines := []string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`,
+		`this line is not an access log`,
+		`127.0.0.1 - - [17/Mar/2025:13:30:21 +0530] "GET /about HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`,
+		`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" not-a-status`,
+		`{"remote_addr": "10.0.0.1", "status": "two hundred"}`,
+	}
+	logs := make(chan LogLine, len(lines))
+	results := make(chan ParsedLog, len(lines))
+	for i, line := range lines {
+		logs <- LogLine{Index: i, Raw: line}
+	}
+	close(logs)
+
+	// Several workers share the counter
+	var wg sync.WaitGroup
+	var skipped atomic.Int64
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go ProcessLogWorker(context.Background(), logs, results, &skipped, &wg)
+	}
+	wg.Wait()
+	close(results)
+
+	assert.Equal(t, int64(3), skipped.Load())
+	for result := range results {
+		if !result.Valid {
+			assert.Equal(t, models.Log{}, result.Log, "line %d", result.Index)
+		}
+	}
+}
+
+func TestAddLogsHandler_MixedValidAndInvalid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	body, _ := json.Marshal([]string{
+		`this line is not an access log`,
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" not-a-status`,
+		`10.0.0.2 - - [17/Mar/2025:13:30:21 +0530] "POST /login HTTP/1.1" 302 0 "-" "curl/8.0" "-"`,
+	})
+
+	// Only the two valid lines are inserted, in order: 14 columns per row
+	args := make([]driver.Value, 28)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[0], args[14] = "127.0.0.1", "10.0.0.2"
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 2 rows inserted, 2 rejected.",
+		"data":{"inserted":2,"skipped":2,"rejected":2,"rejected_lines":[0,2]}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddLogsHandler_AbortedOnShutdown(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	defer resetShutdown()
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	lines := make([]string, 20000)
+	for i := range lines {
+		lines[i] = `127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`
+	}
+	body, _ := json.Marshal(lines)
+
+	// The insert never completes on its own; only cancellation can end it
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillDelayFor(time.Minute).WillReturnResult(sqlmock.NewResult(1, int64(len(lines))))
+
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	AbortInFlight()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddLogsHandler did not return after AbortInFlight")
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "nothing inserted")
+}
+
+func TestAddLogsHandler_CompletesBeforeShutdown(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	defer resetShutdown()
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`,
+	})
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+	AbortInFlight()
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseLog_Valid(t *testing.T) {
+	logLine := `192.168.1.1 - user123 [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" 200 512 "http://example.com" "Go-http-client/1.1" "192.168.1.100"`
+
+	log := ParseLog(logLine)
+
+	assert.Equal(t, "192.168.1.1", log.RemoteAddr)
+	assert.Equal(t, "user123", log.RemoteUser)
+	assert.Equal(t, "GET /api HTTP/1.1", log.Request)
+	assert.Equal(t, 200, log.Status)
+	assert.Equal(t, 512, log.BodyBytesSent)
+	assert.Equal(t, "http://example.com", log.HttpReferer)
+	assert.Equal(t, "Go-http-client/1.1", log.HttpUserAgent)
+	assert.Equal(t, "192.168.1.100", log.HttpXForwardedFor)
+	assert.Equal(t, time.Date(2025, 4, 10, 10, 20, 30, 0, time.UTC), log.TimeLocal)
+}
+
+// TestParseLog_ResponseTime checks that the optional $request_time field is parsed when appended to
+// the combined format and left unset when the line has only the usual nine fields
+func TestParseLog_ResponseTime(t *testing.T) {
+	nineFields := `192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" 200 512 "-" "curl/8.0" "-"`
+	log, ok := parseLogLine(nineFields)
+	assert.True(t, ok)
+	assert.Equal(t, "-", log.HttpXForwardedFor)
+	assert.Nil(t, log.ResponseTime)
+
+	tenFields := `192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" 200 512 "-" "curl/8.0" "-" 0.125`
+	log, ok = parseLogLine(tenFields)
+	assert.True(t, ok)
+	assert.Equal(t, 512, log.BodyBytesSent)
+	assert.Equal(t, "-", log.HttpXForwardedFor)
+	if assert.NotNil(t, log.ResponseTime) {
+		assert.Equal(t, 0.125, *log.ResponseTime)
+	}
+
+	// nginx logs "-" when it has no request time
+	log, ok = parseLogLine(nineFields + " -")
+	assert.True(t, ok)
+	assert.Nil(t, log.ResponseTime)
+
+	log, ok = parseLogLine(`{"remote_addr":"10.0.0.1","time_local":"2025-04-10T10:20:30Z","request":"GET / HTTP/1.1","status":200,"response_time":"1.5"}`)
+	assert.True(t, ok)
+	if assert.NotNil(t, log.ResponseTime) {
+		assert.Equal(t, 1.5, *log.ResponseTime)
+	}
+}
+
+// TestParseLog_CommonAndCombined checks that the Nginx/Apache common and combined formats are parsed,
+// with their $time_local timestamps, alongside the default RFC3339 format
+func TestParseLog_CommonAndCombined(t *testing.T) {
+	expectedTime := time.Date(2025, time.March, 17, 8, 0, 20, 0, time.UTC)
+
+	log, ok := parseLogLine(`192.168.1.1 - - [17/Mar/2025:13:30:20 +0530] "GET /api HTTP/1.1" 200 512 "http://example.com" "curl/8.0"`)
+	assert.True(t, ok)
+	assert.True(t, expectedTime.Equal(log.TimeLocal))
+	assert.Equal(t, "http://example.com", log.HttpReferer)
+	assert.Equal(t, "curl/8.0", log.HttpUserAgent)
+	assert.Equal(t, "", log.HttpXForwardedFor)
+
+	log, ok = parseLogLine(`192.168.1.1 - frank [17/Mar/2025:13:30:20 +0530] "POST /login HTTP/1.0" 302 0`)
+	assert.True(t, ok)
+	assert.True(t, expectedTime.Equal(log.TimeLocal))
+	assert.Equal(t, "frank", log.RemoteUser)
+	assert.Equal(t, "POST /login HTTP/1.0", log.Request)
+	assert.Equal(t, 302, log.Status)
+	assert.Equal(t, "", log.HttpUserAgent)
+
+	// A lone referer is neither format
+	_, ok = parseLogLine(`192.168.1.1 - - [17/Mar/2025:13:30:20 +0530] "GET /api HTTP/1.1" 200 512 "http://example.com"`)
+	assert.False(t, ok)
+}
+
+func TestGetResponseTimeStatsHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(regexp.QuoteMeta(utils.QUERY_RESPONSE_TIME_PERCENTILES)).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "avg", "p50", "p90", "p95", "p99", "max"}).AddRow(4, 0.3, 0.2, 0.6, 0.7, 0.8, 0.81))
+
+	rr := httptest.NewRecorder()
+	GetResponseTimeStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/response_time", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Response time statistics retrieved successfully","data":{"count":4,"avg":0.3,"p50":0.2,"p90":0.6,"p95":0.7,"p99":0.8,"max":0.81}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestParseLog_ServerName checks that a quoted $server_name appended to the combined format, with or
+// without $request_time before it, is parsed, and that lines without it keep a nil server name
+func TestParseLog_ServerName(t *testing.T) {
+	nineFields := `192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" 200 512 "-" "curl/8.0" "-"`
+	log, ok := parseLogLine(nineFields)
+	assert.True(t, ok)
+	assert.Nil(t, log.ServerName)
+
+	log, ok = parseLogLine(nineFields + ` "api.example.com"`)
+	assert.True(t, ok)
+	assert.Equal(t, "-", log.HttpXForwardedFor)
+	assert.Nil(t, log.ResponseTime)
+	if assert.NotNil(t, log.ServerName) {
+		assert.Equal(t, "api.example.com", *log.ServerName)
+	}
+
+	log, ok = parseLogLine(nineFields + ` 0.125 "api.example.com"`)
+	assert.True(t, ok)
+	if assert.NotNil(t, log.ResponseTime) && assert.NotNil(t, log.ServerName) {
+		assert.Equal(t, 0.125, *log.ResponseTime)
+		assert.Equal(t, "api.example.com", *log.ServerName)
+	}
+
+	// nginx logs "-" when the request matched no server name
+	log, ok = parseLogLine(nineFields + ` "-"`)
+	assert.True(t, ok)
+	assert.Nil(t, log.ServerName)
+
+	log, ok = parseLogLine(`{"remote_addr":"10.0.0.1","time_local":"2025-04-10T10:20:30Z","request":"GET / HTTP/1.1","status":200,"server_name":"www.example.com"}`)
+	assert.True(t, ok)
+	if assert.NotNil(t, log.ServerName) {
+		assert.Equal(t, "www.example.com", *log.ServerName)
+	}
+}
+
+func TestGetServerStatsHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE server_name IS NOT NULL")).
+		WillReturnRows(sqlmock.NewRows([]string{"server_name", "request_count", "error_count", "avg_bytes"}).
+			AddRow("api.example.com", 30, 3, 750.5).
+			AddRow("www.example.com", 10, 0, 600))
+
+	rr := httptest.NewRecorder()
+	GetServerStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/server", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Server statistics retrieved successfully","data":[`+
+		`{"server_name":"api.example.com","request_count":30,"error_count":3,"avg_bytes":750.5},`+
+		`{"server_name":"www.example.com","request_count":10,"error_count":0,"avg_bytes":600}]}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddLogsHandler_BumpsWriteVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	body, _ := json.Marshal([]string{`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`})
+	version := utils.WriteVersion()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	rr := httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Greater(t, utils.WriteVersion(), version)
+
+	// A failed insert changes nothing cached reads depend on
+	version = utils.WriteVersion()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnError(errors.New("insert failed"))
+	mock.ExpectRollback()
+	rr = httptest.NewRecorder()
+	AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, version, utils.WriteVersion())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddLogsHandler_UnknownMethod(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(methods []string) { utils.ConfigData.ExtraMethods = methods }(utils.ConfigData.ExtraMethods)
+	utils.ConfigData.ExtraMethods = nil
+
+	body, _ := json.Marshal([]string{
+		`127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "get /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`,
+		`127.0.0.1 - - [17/Mar/2025:13:30:21 +0530] "PROPFIND /dav/ HTTP/1.1" 207 500 "-" "Mozilla/5.0" "-"`,
+	})
+	post := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+		return rr
+	}
+
+	// Both are stored, the lowercase method normalized, the unknown one flagged
+	args := make([]driver.Value, 28)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[9], args[23] = "GET", "PROPFIND"
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	rr := post()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 2 rows inserted.","data":{"inserted":2,"skipped":0,"unknown_method_lines":[1]}}`, rr.Body.String())
+
+	// Configured as an extension method it is no longer flagged
+	utils.ConfigData.ExtraMethods = []string{"PROPFIND"}
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO logs").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	rr = post()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Logs stored successfully, 2 rows inserted.","data":{"inserted":2,"skipped":0}}`, rr.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRawLine_StoredAndReturned(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(store bool) { utils.ConfigData.StoreRawLine = store }(utils.ConfigData.StoreRawLine)
+
+	line := `127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`
+	body, _ := json.Marshal([]string{line})
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status", "body_bytes_sent",
+		"http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	timeLocal := time.Date(2025, 3, 17, 8, 0, 20, 0, time.UTC)
+	getByID := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/logs/7", nil)
+		req.SetPathValue("id", "7")
+		rr := httptest.NewRecorder()
+		GetLogByIDHandler(rr, req)
+		return rr
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		utils.ConfigData.StoreRawLine = true
+
+		args := make([]driver.Value, 0, 15)
+		for i := 0; i < 14; i++ {
+			args = append(args, sqlmock.AnyArg())
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("server_name, raw_line)")).WithArgs(append(args, line)...).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		rr := httptest.NewRecorder()
+		AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		mock.ExpectQuery(regexp.QuoteMeta("server_name, raw_line FROM logs WHERE id = $1")).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(append(columns, "raw_line")).
+				AddRow(7, "127.0.0.1", "-", timeLocal, "GET /home HTTP/1.1", 200, 500, "-", "Mozilla/5.0", "-", nil, nil, nil, line))
+		rr = getByID()
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp struct {
+			Data models.Log `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		if assert.NotNil(t, resp.Data.RawLine) {
+			assert.Equal(t, line, *resp.Data.RawLine)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		utils.ConfigData.StoreRawLine = false
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("server_name) VALUES")).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		rr := httptest.NewRecorder()
+		AddLogsHandler(rr, httptest.NewRequest(http.MethodPost, "/logs", bytes.NewBuffer(body)))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		mock.ExpectQuery(regexp.QuoteMeta("server_name FROM logs WHERE id = $1")).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(7, "127.0.0.1", "-", timeLocal, "GET /home HTTP/1.1", 200, 500, "-", "Mozilla/5.0", "-", nil, nil, nil))
+		rr = getByID()
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "raw_line")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetLogByIDHandler_Errors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/abc", nil)
+	req.SetPathValue("id", "abc")
+	rr := httptest.NewRecorder()
+	GetLogByIDHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE id = $1")).WithArgs(42).WillReturnError(sql.ErrNoRows)
+	req = httptest.NewRequest(http.MethodGet, "/logs/42", nil)
+	req.SetPathValue("id", "42")
+	rr = httptest.NewRecorder()
+	GetLogByIDHandler(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParseLog_InvalidFormat(t *testing.T) {
+	logLine := `This is a malformed log line`
+	log := ParseLog(logLine)
+
+	assert.Equal(t, models.Log{}, log)
+}
+
+func TestParseLog_InvalidTime(t *testing.T) {
+	logLine := `192.168.1.1 - user123 [invalid-time-format] "GET /api HTTP/1.1" 200 512 "http://example.com" "Go-http-client/1.1" "192.168.1.100"`
+	log := ParseLog(logLine)
+
+	assert.Equal(t, time.Time{}, log.TimeLocal) // should be zero time
+	assert.Equal(t, "192.168.1.1", log.RemoteAddr)
 }
 
-func TestInsertOneLog_InsertFail(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	assert.NoError(t, err)
-	defer db.Close()
-
-	connection.DB = db
+// TestParseLog_TimeLayouts checks that each accepted timestamp layout is parsed with its offset kept,
+// and that a malformed timestamp only zeroes the time.
+func TestParseLog_TimeLayouts(t *testing.T) {
+	line := func(stamp string) string {
+		return `192.168.1.1 - - [` + stamp + `] "GET /api HTTP/1.1" 200 512 "-" "curl/8.0" "-"`
+	}
 
-	log := models.Log{}
+	log := ParseLog(line("17/Mar/2025:13:30:20 +0530"))
+	assert.True(t, time.Date(2025, time.March, 17, 8, 0, 20, 0, time.UTC).Equal(log.TimeLocal))
+	_, offset := log.TimeLocal.Zone()
+	assert.Equal(t, 5*3600+30*60, offset, "the logged offset should be kept")
+	assert.Equal(t, "13:30:20", log.TimeLocal.Format("15:04:05"))
 
-	mock.ExpectExec("INSERT INTO logs").
-		WithArgs(log.RemoteAddr, log.RemoteUser, log.TimeLocal, log.Request, log.Status, log.BodyBytesSent, log.HttpReferer, log.HttpUserAgent, log.HttpXForwardedFor).
-		WillReturnError(assert.AnError)
+	log = ParseLog(line("2025-03-17T13:30:20.250-04:00"))
+	assert.True(t, time.Date(2025, time.March, 17, 17, 30, 20, 250e6, time.UTC).Equal(log.TimeLocal))
+	_, offset = log.TimeLocal.Zone()
+	assert.Equal(t, -4*3600, offset)
 
-	err = InsertOneLog(log)
-	assert.Error(t, err)
-	assert.Equal(t, assert.AnError, err)
-	assert.NoError(t, mock.ExpectationsWereMet())
-}
+	log = ParseLog(line("2025-03-17"))
+	assert.True(t, time.Date(2025, time.March, 17, 0, 0, 0, 0, time.UTC).Equal(log.TimeLocal))
 
-func TestProcessLogWorker(t *testing.T) {
-	logs := make(chan string, 1)
-	results := make(chan models.Log, 1)
-	var wg sync.WaitGroup
+	log, ok := parseLogLine(line("17/Mar/2025 13:30:20"))
+	assert.True(t, ok, "a malformed timestamp should not reject the line")
+	assert.True(t, log.TimeLocal.IsZero())
+	assert.Equal(t, "192.168.1.1", log.RemoteAddr)
+	assert.Equal(t, "GET /api HTTP/1.1", log.Request)
+	assert.Equal(t, 200, log.Status)
+	assert.Equal(t, "curl/8.0", log.HttpUserAgent)
 
-	// Add one item to WaitGroup as one goroutine will run
-	wg.Add(1)
-	go ProcessLogWorker(logs, results, &wg)
+	// JSON lines accept the same layouts
+	log, ok = parseJSONLog(`{"remote_addr":"10.0.0.1","time_local":"17/Mar/2025:13:30:20 +0530","request":"GET / HTTP/1.1","status":200}`, nil)
+	assert.True(t, ok)
+	assert.True(t, time.Date(2025, time.March, 17, 8, 0, 20, 0, time.UTC).Equal(log.TimeLocal))
+}
 
-	// Send a test log line
-	logs <- `127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "192.168.0.1"`
-	close(logs) // Important to close channel so goroutine can exit
+// TestParseLog_CustomPattern checks that a configured pattern maps its named groups onto the log,
+// ignoring groups that name no field, and that the built-in pattern is restored without one.
+func TestParseLog_CustomPattern(t *testing.T) {
+	defer func() { assert.NoError(t, utils.SetLogPattern("")) }()
+	assert.NoError(t, utils.SetLogPattern(`^(?P<time_local>\S+) (?P<remote_addr>\S+) (?P<status>\d{3}) "(?P<request>[^"]*)" (?P<request_time>\S+) (?P<server_name>\S+)$`))
+
+	log, ok := parseLogLine(`2025-03-17T13:30:20Z 10.0.0.7 503 "GET /checkout HTTP/2.0" 0.250 shop.example.com`)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.7", log.RemoteAddr)
+	assert.True(t, time.Date(2025, time.March, 17, 13, 30, 20, 0, time.UTC).Equal(log.TimeLocal))
+	assert.Equal(t, 503, log.Status)
+	assert.Equal(t, "GET /checkout HTTP/2.0", log.Request)
+	if assert.NotNil(t, log.ServerName) {
+		assert.Equal(t, "shop.example.com", *log.ServerName)
+	}
+	assert.Nil(t, log.ResponseTime, "request_time names no field and should be ignored")
+	assert.Equal(t, "", log.HttpUserAgent)
+	assert.Equal(t, 0, log.BodyBytesSent)
 
-	// Wait for goroutine to finish
-	wg.Wait()
-	close(results)
+	// Lines in the built-in format no longer match
+	_, ok = parseLogLine(`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" 200 512 "-" "curl/8.0" "-"`)
+	assert.False(t, ok)
 
-	// Assert the result
-	parsedLog := <-results
-	assert.Equal(t, "127.0.0.1", parsedLog.RemoteAddr)
-	assert.Equal(t, "GET /home HTTP/1.1", parsedLog.Request)
-	assert.Equal(t, 200, parsedLog.Status)
+	assert.NoError(t, utils.SetLogPattern(""))
+	_, ok = parseLogLine(`192.168.1.1 - - [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" 200 512 "-" "curl/8.0" "-"`)
+	assert.True(t, ok)
 }
 
-func TestParseLog_Valid(t *testing.T) {
-	logLine := `192.168.1.1 - user123 [2025-04-10T10:20:30Z] "GET /api HTTP/1.1" 200 512 "http://example.com" "Go-http-client/1.1" "192.168.1.100"`
+func TestParseLog_JSONWithFieldMapping(t *testing.T) {
+	utils.ConfigData.JSONFieldMap = map[string]string{
+		"client_ip":   "remote_addr",
+		"status_code": "status",
+		"ts":          "time_local",
+		"req":         "request",
+		"bytes":       "body_bytes_sent",
+	}
+	defer func() { utils.ConfigData.JSONFieldMap = nil }()
 
+	logLine := `{"client_ip":"10.1.2.3","ts":"2025-04-10T10:20:30Z","req":"GET /api HTTP/1.1","status_code":404,"bytes":"512","http_user_agent":"curl/8.0","ignored":true}`
 	log := ParseLog(logLine)
 
-	assert.Equal(t, "192.168.1.1", log.RemoteAddr)
-	assert.Equal(t, "user123", log.RemoteUser)
+	assert.Equal(t, "10.1.2.3", log.RemoteAddr)
 	assert.Equal(t, "GET /api HTTP/1.1", log.Request)
-	assert.Equal(t, 200, log.Status)
+	assert.Equal(t, 404, log.Status)
 	assert.Equal(t, 512, log.BodyBytesSent)
-	assert.Equal(t, "http://example.com", log.HttpReferer)
-	assert.Equal(t, "Go-http-client/1.1", log.HttpUserAgent)
-	assert.Equal(t, "192.168.1.100", log.HttpXForwardedFor)
+	assert.Equal(t, "curl/8.0", log.HttpUserAgent)
 	assert.Equal(t, time.Date(2025, 4, 10, 10, 20, 30, 0, time.UTC), log.TimeLocal)
 }
 
-func TestParseLog_InvalidFormat(t *testing.T) {
-	logLine := `This is a malformed log line`
-	log := ParseLog(logLine)
-
-	assert.Equal(t, models.Log{}, log)
+// TestParseLog_GeneratorJSON checks that the JSON lines of the generator's json log format are
+// detected and decoded into the same Log as their text form
+func TestParseLog_GeneratorJSON(t *testing.T) {
+	jsonLine := `{"remote_addr":"192.168.1.1","remote_user":"-","time_local":"2025-04-10T12:00:00.25Z","request":"GET /home HTTP/1.1","status":200,"body_bytes_sent":520,"http_referer":"https://example.com","http_user_agent":"Mozilla/5.0","http_x_forwarded_for":"127.0.0.1","server_name":"api.example.com"}`
+	textLine := `192.168.1.1 - - [2025-04-10T12:00:00.250Z] "GET /home HTTP/1.1" 200 520 "https://example.com" "Mozilla/5.0" "127.0.0.1" "api.example.com"`
+
+	fromJSON, ok := parseLogLine(jsonLine)
+	assert.True(t, ok)
+	fromText, ok := parseLogLine(textLine)
+	assert.True(t, ok)
+	assert.Equal(t, fromText, fromJSON)
+	assert.Equal(t, time.Date(2025, 4, 10, 12, 0, 0, 250*int(time.Millisecond), time.UTC), fromJSON.TimeLocal)
+	if assert.NotNil(t, fromJSON.ServerName) {
+		assert.Equal(t, "api.example.com", *fromJSON.ServerName)
+	}
 }
 
-func TestParseLog_InvalidTime(t *testing.T) {
-	logLine := `192.168.1.1 - user123 [invalid-time-format] "GET /api HTTP/1.1" 200 512 "http://example.com" "Go-http-client/1.1" "192.168.1.100"`
-	log := ParseLog(logLine)
+func TestParseLog_JSONMissingRequiredField(t *testing.T) {
+	utils.ConfigData.JSONFieldMap = map[string]string{"client_ip": "remote_addr"}
+	defer func() { utils.ConfigData.JSONFieldMap = nil }()
 
-	assert.Equal(t, time.Time{}, log.TimeLocal) // should be zero time
-	assert.Equal(t, "192.168.1.1", log.RemoteAddr)
+	// status is neither present under its own name nor mapped from another key
+	_, ok := parseLogLine(`{"client_ip":"10.1.2.3","time_local":"2025-04-10T10:20:30Z","request":"GET / HTTP/1.1","status_code":200}`)
+	assert.False(t, ok)
 }
 
 func TestAtoi_ValidInput(t *testing.T) {
@@ -466,4 +2863,700 @@ func TestGetLogsHandler_QueryError(t *testing.T) {
 	assert.Equal(t, 500, rr.Code)
 	assert.Contains(t, rr.Body.String(), "Failed to query database")
 }
-	*/
\ No newline at end of file
+	*/
+func TestResetMLHandler(t *testing.T) {
+	saved := mlService
+	defer func() { mlService = saved }()
+
+	mlService = nil
+	rr := httptest.NewRecorder()
+	ResetMLHandler(rr, httptest.NewRequest(http.MethodPost, "/ml/reset", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	mlService = ml.NewMLService()
+	rr = httptest.NewRecorder()
+	ResetMLHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/reset", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = httptest.NewRecorder()
+	ResetMLHandler(rr, httptest.NewRequest(http.MethodPost, "/ml/reset", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "ML state reset")
+}
+
+func TestPurgeIPHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	savedML, savedAlerts := mlService, alertStore
+	defer func() { mlService, alertStore = savedML, savedAlerts }()
+	mlService = ml.NewMLService()
+	assert.NoError(t, mlService.Initialize())
+	alertStore = alerts.NewAlertStore()
+
+	// Seed the security analyzer's behavior map through an insights run
+	mock.ExpectQuery("FROM logs").WillReturnRows(sqlmock.NewRows([]string{
+		"remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for",
+	}).AddRow("10.0.0.1", "-", time.Now(), "GET /home HTTP/1.1", 200, 512, "-", "Mozilla/5.0", "-"))
+	_, err = mlService.GenerateInsights()
+	assert.NoError(t, err)
+
+	purge := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/admin/ip/"+addr, nil)
+		req.SetPathValue("addr", addr)
+		rr := httptest.NewRecorder()
+		PurgeIPHandler(rr, req)
+		return rr
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_DELETE_LOGS_BY_IP)).WithArgs("10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 3))
+	rr := purge("10.0.0.1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":true,"message":"Purged 3 logs, 1 behavior entries and 0 alerts",`+
+		`"data":{"ip":"10.0.0.1","logs_deleted":3,"behavior_removed":1,"alerts_removed":0}}`, rr.Body.String())
+
+	// Nothing is left for a second purge
+	mock.ExpectExec(regexp.QuoteMeta(utils.QUERY_DELETE_LOGS_BY_IP)).WithArgs("10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 0))
+	rr = purge("10.0.0.1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Purged 0 logs, 0 behavior entries and 0 alerts")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, http.StatusBadRequest, purge("not-an-ip").Code)
+}
+
+// emptyResultData decodes the data of a successful response, failing the test when it is null.
+func emptyResultData(t *testing.T, rr *httptest.ResponseRecorder) interface{} {
+	t.Helper()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Status bool        `json:"status"`
+		Data   interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.True(t, response.Status)
+	assert.NotNil(t, response.Data, "data must not be null: %s", rr.Body.String())
+	return response.Data
+}
+
+// TestStatsHandlers_EmptyResults checks that the stats endpoints answer an empty table with
+// empty lists and zeroed counts instead of null
+func TestStatsHandlers_EmptyResults(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery("FROM logs").WillReturnRows(sqlmock.NewRows([]string{"status", "count", "avg_bytes"}))
+	rr := httptest.NewRecorder()
+	GetStatusStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/status", nil))
+	assert.Equal(t, []interface{}{}, emptyResultData(t, rr))
+
+	mock.ExpectQuery("FROM logs").WillReturnRows(sqlmock.NewRows([]string{"remote_addr", "request_count", "avg_bytes", "first_request", "last_request"}))
+	rr = httptest.NewRecorder()
+	GetIPStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/ip", nil))
+	assert.Equal(t, []interface{}{}, emptyResultData(t, rr))
+
+	mock.ExpectQuery("FROM logs").WillReturnRows(sqlmock.NewRows([]string{"time_unit", "request_count", "avg_bytes"}))
+	rr = httptest.NewRecorder()
+	GetTimeStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/time?group_by=day", nil))
+	assert.Equal(t, map[string]interface{}{"group_by": "day", "data": []interface{}{}}, emptyResultData(t, rr))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(DISTINCT remote_addr) FROM logs")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(AVG(body_bytes_sent), 0) FROM logs")).WillReturnRows(sqlmock.NewRows([]string{"avg"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT MAX(time_local) FROM logs")).WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery("GROUP BY status").WillReturnRows(sqlmock.NewRows([]string{"status", "count"}))
+	mock.ExpectQuery("GROUP BY remote_addr").WillReturnRows(sqlmock.NewRows([]string{"remote_addr", "count"}))
+	rr = httptest.NewRecorder()
+	GetDashboardStatsHandler(rr, httptest.NewRequest(http.MethodGet, "/stats/dashboard", nil))
+	assert.Equal(t, map[string]interface{}{
+		"total_logs":        float64(0),
+		"unique_ips":        float64(0),
+		"avg_response_size": float64(0),
+		"last_log_time":     nil,
+		"top_status_codes":  []interface{}{},
+		"top_ips":           []interface{}{},
+	}, emptyResultData(t, rr))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM logs WHERE 1=1")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	rr = httptest.NewRecorder()
+	GetLogsCountHandler(rr, httptest.NewRequest(http.MethodGet, "/count", nil))
+	assert.Equal(t, map[string]interface{}{"total": float64(0), "fetch": float64(0)}, emptyResultData(t, rr))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestMLHandlers_EmptyResults checks that the ML endpoints answer when there are no recent logs
+// with empty lists and zeroed counts instead of null
+func TestMLHandlers_EmptyResults(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	saved := mlService
+	defer func() { mlService = saved }()
+	mlService = ml.NewMLService()
+	assert.NoError(t, mlService.Initialize())
+
+	noLogs := func() {
+		mock.ExpectQuery("FROM logs").WillReturnRows(sqlmock.NewRows([]string{
+			"remote_addr", "remote_user", "time_local", "request", "status",
+			"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for",
+		}))
+	}
+
+	noLogs()
+	rr := httptest.NewRecorder()
+	GetMLInsightsHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/insights", nil))
+	data := emptyResultData(t, rr).(map[string]interface{})
+	for _, key := range []string{"anomalies", "predictions", "clusters", "security_threats"} {
+		assert.Equal(t, []interface{}{}, data[key], key)
+	}
+	assert.Equal(t, "insufficient_data", data["trend_analysis"].(map[string]interface{})["period"])
+
+	cases := []struct {
+		handler http.HandlerFunc
+		list    string
+		count   string
+	}{
+		{GetAnomalyDetectionHandler, "anomalies", "total_count"},
+		{GetPredictionsHandler, "predictions", "total_count"},
+		{GetSecurityThreatsHandler, "threats", "total_count"},
+		{GetUserClustersHandler, "clusters", "total_users"},
+	}
+	for _, c := range cases {
+		noLogs()
+		rr := httptest.NewRecorder()
+		c.handler(rr, httptest.NewRequest(http.MethodGet, "/ml", nil))
+		data := emptyResultData(t, rr).(map[string]interface{})
+		assert.Equal(t, []interface{}{}, data[c.list], c.list)
+		assert.Equal(t, float64(0), data[c.count], c.count)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestMLHandlers_DisabledFeature checks that a disabled feature is flagged in its endpoint and in /ml/config.
+func TestMLHandlers_DisabledFeature(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	saved := mlService
+	defer func() { mlService = saved }()
+	mlService = ml.NewMLService()
+	assert.NoError(t, mlService.Initialize())
+	assert.NoError(t, mlService.Apply(models.MLSettings{
+		DisabledFeatures: []string{ml.FEATURE_USER_CLUSTERING, ml.FEATURE_ANOMALY_DETECTION},
+	}))
+
+	rows := sqlmock.NewRows([]string{
+		"remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for",
+	})
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		rows.AddRow(ip, "-", time.Now(), "GET /home HTTP/1.1", 200, 512, "-", "Mozilla/5.0", "-")
+	}
+	mock.ExpectQuery("FROM logs").WillReturnRows(rows)
+
+	rr := httptest.NewRecorder()
+	GetUserClustersHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/clusters", nil))
+	data := emptyResultData(t, rr).(map[string]interface{})
+	assert.Equal(t, []interface{}{}, data["clusters"])
+	assert.Equal(t, false, data["enabled"])
+
+	rr = httptest.NewRecorder()
+	GetRealTimeAnomalyHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/realtime?value=10", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	rr = httptest.NewRecorder()
+	GetMLConfigHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/config", nil))
+	config := emptyResultData(t, rr).(map[string]interface{})
+	assert.Equal(t, []interface{}{"traffic_prediction", "security_analysis", "trend_analysis"}, config["features"])
+	assert.Equal(t, []interface{}{"anomaly_detection", "user_clustering"}, config["disabled_features"])
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestMLHandlers_InvalidForce checks that the ML endpoints reject a force parameter that is not a boolean.
+func TestMLHandlers_InvalidForce(t *testing.T) {
+	saved := mlService
+	defer func() { mlService = saved }()
+	mlService = ml.NewMLService()
+
+	for _, handler := range []http.HandlerFunc{GetMLInsightsHandler, GetAnomalyDetectionHandler, GetPredictionsHandler, GetSecurityThreatsHandler, GetUserClustersHandler} {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, "/ml/insights?force=maybe", nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Invalid force: 'maybe'")
+	}
+}
+
+func TestGetAlertsHandler_InvalidResolved(t *testing.T) {
+	saved := mlService
+	defer func() { mlService = saved }()
+	mlService = ml.NewMLService()
+
+	rr := httptest.NewRecorder()
+	GetAlertsHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/alerts?resolved=maybe", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid resolved: 'maybe'")
+}
+
+func TestGetMLInsightsHandler_InvalidWindow(t *testing.T) {
+	saved := mlService
+	defer func() { mlService = saved }()
+	mlService = ml.NewMLService()
+
+	for query, message := range map[string]string{
+		"hours=abc":         "Invalid hours: 'abc'",
+		"hours=0":           "Invalid hours: '0'",
+		"hours=72&limit=-5": "Invalid limit: '-5'",
+	} {
+		rr := httptest.NewRecorder()
+		GetMLInsightsHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/insights?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		assert.Contains(t, rr.Body.String(), message, query)
+	}
+}
+
+// TestUpdateMLConfigHandler checks that a POST to /ml/config/update changes what /ml/config returns.
+func TestUpdateMLConfigHandler(t *testing.T) {
+	saved := mlService
+	defer func() { mlService = saved }()
+	mlService = ml.NewMLService()
+
+	getConfig := func() map[string]interface{} {
+		rr := httptest.NewRecorder()
+		GetMLConfigHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/config", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return emptyResultData(t, rr).(map[string]interface{})
+	}
+	update := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		UpdateMLConfigHandler(rr, httptest.NewRequest(http.MethodPost, "/ml/config/update", strings.NewReader(body)))
+		return rr
+	}
+
+	rr := update(`{"anomaly_threshold": 3.5, "cluster_count": 6, "security_sensitivity": "high"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	config := getConfig()
+	assert.Equal(t, 3.5, config["anomaly_threshold"])
+	assert.Equal(t, float64(6), config["cluster_count"])
+	assert.Equal(t, "high", config["security_sensitivity"])
+	// Fields left out keep their values
+	assert.Equal(t, float64(24), config["prediction_horizon"])
+
+	for _, body := range []string{
+		`{"anomaly_threshold": -1}`,
+		`{"prediction_horizon": 0}`,
+		`{"security_sensitivity": "paranoid"}`,
+		`{"cluster_count": "six"}`,
+		`{"anomaly_treshold": 4}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, update(body).Code, body)
+	}
+	assert.Equal(t, 3.5, getConfig()["anomaly_threshold"])
+
+	rr = httptest.NewRecorder()
+	UpdateMLConfigHandler(rr, httptest.NewRequest(http.MethodGet, "/ml/config/update", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+// TestGetCapabilitiesHandler checks that the capabilities follow the current configuration and ML settings.
+func TestGetCapabilitiesHandler(t *testing.T) {
+	savedConfig, savedML := utils.ConfigData, mlService
+	defer func() { utils.ConfigData, mlService = savedConfig, savedML }()
+
+	capabilities := func() map[string]interface{} {
+		rr := httptest.NewRecorder()
+		GetCapabilitiesHandler(rr, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return emptyResultData(t, rr).(map[string]interface{})
+	}
+
+	utils.ConfigData = models.Config{SampleRate: 1}
+	mlService = nil
+	data := capabilities()
+	assert.Equal(t, utils.API_VERSION, data["api_version"])
+	assert.Equal(t, []interface{}{"rfc3339", "combined", "common", "json"}, data["log_formats"])
+	assert.Equal(t, float64(utils.PARSER_MAX_PAGE_LIMIT), data["max_page_limit"])
+	assert.Equal(t, []interface{}{}, data["ml_features"])
+	for feature, enabled := range data["features"].(map[string]interface{}) {
+		assert.Equal(t, false, enabled, "%s should be disabled by default", feature)
+	}
+
+	utils.ConfigData = models.Config{
+		AdminToken:    "secret-token",
+		Tenants:       map[string]string{"key-a": "tenant-a"},
+		StatsCacheTTL: 30,
+		StoreRawLine:  true,
+		SampleRate:    0.5,
+		MaxLines:      500,
+	}
+	mlService = ml.NewMLService()
+	assert.NoError(t, mlService.Apply(models.MLSettings{DisabledFeatures: []string{ml.FEATURE_USER_CLUSTERING}}))
+	data = capabilities()
+	features := data["features"].(map[string]interface{})
+	for _, feature := range []string{"admin", "multitenant", "stats_cache", "raw_lines", "sampling", "ml"} {
+		assert.Equal(t, true, features[feature], feature)
+	}
+	assert.Equal(t, false, features["archive"])
+	assert.Equal(t, []interface{}{"anomaly_detection", "traffic_prediction", "security_analysis", "trend_analysis"}, data["ml_features"])
+	assert.Equal(t, float64(500), data["max_lines"])
+
+	rr := httptest.NewRecorder()
+	GetCapabilitiesHandler(rr, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	assert.NotContains(t, rr.Body.String(), "secret-token")
+	assert.NotContains(t, rr.Body.String(), "key-a")
+
+	rr = httptest.NewRecorder()
+	GetCapabilitiesHandler(rr, httptest.NewRequest(http.MethodPost, "/capabilities", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestGetParserStatusHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	lastLog := time.Date(2025, 4, 10, 10, 20, 30, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*), MAX(time_local) FROM logs")).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(42, lastLog))
+	rr := httptest.NewRecorder()
+	GetParserStatusHandler(rr, httptest.NewRequest(http.MethodGet, "/status", nil))
+	data := emptyResultData(t, rr).(map[string]interface{})
+	assert.Equal(t, true, data["database"])
+	assert.Equal(t, float64(42), data["total_rows"])
+	assert.Equal(t, "2025-04-10T10:20:30Z", data["last_log_time"])
+	assert.GreaterOrEqual(t, data["uptime_seconds"], float64(0))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*), MAX(time_local) FROM logs")).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(0, nil))
+	rr = httptest.NewRecorder()
+	GetParserStatusHandler(rr, httptest.NewRequest(http.MethodGet, "/status", nil))
+	data = emptyResultData(t, rr).(map[string]interface{})
+	assert.Equal(t, float64(0), data["total_rows"])
+	assert.Nil(t, data["last_log_time"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	connection.DB = nil
+	rr = httptest.NewRecorder()
+	GetParserStatusHandler(rr, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, false, response.Data["database"])
+	assert.Contains(t, response.Data, "uptime_seconds")
+}
+
+// TestReloadMLHandler checks that a valid ML section is applied to the running analyzers and that an
+// invalid one is rejected, leaving the previously applied patterns in place.
+func TestReloadMLHandler(t *testing.T) {
+	saved, savedFile := mlService, mlConfigFile
+	defer func() { mlService, mlConfigFile = saved, savedFile }()
+	mlService = ml.NewMLService()
+	mlConfigFile = t.TempDir() + "/config.yaml"
+
+	reload := func(yaml string) *httptest.ResponseRecorder {
+		assert.NoError(t, os.WriteFile(mlConfigFile, []byte(yaml), 0o644))
+		rr := httptest.NewRecorder()
+		ReloadMLHandler(rr, httptest.NewRequest(http.MethodPost, "/admin/reload-ml", nil))
+		return rr
+	}
+	patternNames := func() []string {
+		_, patterns := mlService.Config()
+		var names []string
+		for _, pattern := range patterns {
+			names = append(names, pattern.Name)
+		}
+		return names
+	}
+
+	rr := reload(`
+PORT: ":8083"
+ML:
+  ANOMALY_THRESHOLD: 3
+  ATTACK_PATTERNS:
+    - NAME: "Env Probe"
+      PATTERN: '/\.env'
+`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, []string{"Env Probe"}, patternNames())
+	config, _ := mlService.Config()
+	assert.Equal(t, 3.0, config.AnomalyThreshold)
+
+	rr = reload(`
+ML:
+  ATTACK_PATTERNS:
+    - NAME: "Broken"
+      PATTERN: '(unclosed'
+`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "keeping the current ones")
+	assert.Equal(t, []string{"Env Probe"}, patternNames())
+
+	rr = httptest.NewRecorder()
+	ReloadMLHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/reload-ml", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+// fakeStorage records the objects uploaded to it.
+type fakeStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	err     error
+}
+
+func (s *fakeStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if s.err != nil {
+		return s.err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("read %d bytes, expected %d", len(data), size)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func startArchive(t *testing.T, target string) ArchiveJob {
+	rr := httptest.NewRecorder()
+	ArchiveHandler(rr, httptest.NewRequest(http.MethodPost, target, nil))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	var resp struct {
+		Data ArchiveJob `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	inFlight.Wait() // The job has finished once it no longer counts as in flight
+
+	rr = httptest.NewRecorder()
+	ArchiveHandler(rr, httptest.NewRequest(http.MethodGet, "/admin/archive?job="+resp.Data.ID, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp.Data
+}
+
+func TestArchiveHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	store := &fakeStorage{objects: map[string][]byte{}}
+	defer func(saved func() (storage.Storage, error)) { archiveStorage = saved }(archiveStorage)
+	archiveStorage = func() (storage.Storage, error) { return store, nil }
+	defer func(prefix string) { utils.ConfigData.ArchivePrefix = prefix }(utils.ConfigData.ArchivePrefix)
+	utils.ConfigData.ArchivePrefix = "archive/"
+
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	first := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM logs WHERE 1=1 AND status = $1 AND time_local >= $2 AND time_local <= $3 ORDER BY time_local ASC, id ASC")).
+		WithArgs(500, "2025-04-10T00:00:00Z", "2025-04-11T00:00:00Z").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "10.0.0.1", "-", first, "GET /a HTTP/1.1", 500, 10, "-", "curl", "-", nil, 1.5, nil).
+			AddRow(2, "10.0.0.2", "-", first.Add(time.Minute), "GET /b HTTP/1.1", 500, 20, "-", "curl", "-", nil, nil, nil))
+
+	job := startArchive(t, "/admin/archive?start_time=2025-04-10T00:00:00Z&end_time=2025-04-11T00:00:00Z&status=500")
+
+	assert.Equal(t, ARCHIVE_DONE, job.State)
+	assert.Equal(t, 2, job.Rows)
+	assert.Equal(t, "archive/logs-20250410T000000Z-20250411T000000Z-"+job.ID+".ndjson.gz", job.Key)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	gz, err := gzip.NewReader(bytes.NewReader(store.objects[job.Key]))
+	assert.NoError(t, err)
+	content, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.JSONEq(t, `{"remote_addr":"10.0.0.1","remote_user":"-","time_local":"2025-04-10T10:00:00Z","request":"GET /a HTTP/1.1","status":500,"body_bytes_sent":10,"http_referer":"-","http_user_agent":"curl","http_x_forwarded_for":"-","response_time":1.5}`, lines[0])
+	assert.Contains(t, lines[1], `"remote_addr":"10.0.0.2"`)
+}
+
+func TestExportLogsHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	first := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM logs WHERE 1=1 AND status = $1 AND time_local >= $2 ORDER BY time_local ASC, id ASC")).
+		WithArgs(404, "2025-04-10T00:00:00Z").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "10.0.0.1", "-", first, "GET /a HTTP/1.1", 404, 10, "-", "curl", "-", nil, 1.5, nil).
+			AddRow(2, "10.0.0.2", "-", first.Add(time.Minute), "GET /b HTTP/1.1", 404, 20, "-", "curl", "-", nil, nil, nil).
+			AddRow(3, "10.0.0.3", "-", first.Add(2*time.Minute), "GET /c HTTP/1.1", 404, 30, "-", "curl", "-", nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	ExportLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/export?status=404&start_time=2025-04-10&limit=1&cursor=ignored", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	for i, line := range lines {
+		var log models.Log
+		assert.NoError(t, json.Unmarshal([]byte(line), &log), line)
+		assert.Equal(t, fmt.Sprintf("10.0.0.%d", i+1), log.RemoteAddr)
+	}
+	assert.JSONEq(t, `{"remote_addr":"10.0.0.1","remote_user":"-","time_local":"2025-04-10T10:00:00Z","request":"GET /a HTTP/1.1","status":404,"body_bytes_sent":10,"http_referer":"-","http_user_agent":"curl","http_x_forwarded_for":"-","response_time":1.5}`, lines[0])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportLogsHandler_CSV(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	first := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.FixedZone("IST", 19800))
+	ingested := time.Date(2025, time.April, 10, 4, 30, 5, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM logs WHERE 1=1 ORDER BY time_local ASC, id ASC")).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "10.0.0.1", "-", first, "GET /a HTTP/1.1", 200, 10, "-", "curl/8.0", "-", ingested, 0.25, "api.example.com").
+			AddRow(2, "10.0.0.2", "-", first.Add(time.Minute), `GET /b?q="x" HTTP/1.1`, 404, 20, "-", "Mozilla/5.0 (X11; Linux x86_64) Gecko, like Safari", "-", nil, nil, nil))
+
+	rr := httptest.NewRecorder()
+	ExportLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/export?format=csv", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "remote_addr,remote_user,time_local,request,status,body_bytes_sent,http_referer,http_user_agent,http_x_forwarded_for,ingested_at,response_time,server_name\n"+
+		"10.0.0.1,-,2025-04-10T10:00:00+05:30,GET /a HTTP/1.1,200,10,-,curl/8.0,-,2025-04-10T04:30:05Z,0.25,api.example.com\n"+
+		`10.0.0.2,-,2025-04-10T10:01:00+05:30,"GET /b?q=""x"" HTTP/1.1",404,20,-,"Mozilla/5.0 (X11; Linux x86_64) Gecko, like Safari",-,,,`+"\n", rr.Body.String())
+
+	records, err := csv.NewReader(strings.NewReader(rr.Body.String())).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "Mozilla/5.0 (X11; Linux x86_64) Gecko, like Safari", records[2][7])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestExportLogsHandler_CSVFormulas checks that cells a spreadsheet would run as a formula are escaped
+func TestExportLogsHandler_CSVFormulas(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	columns := []string{"id", "remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+	first := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM logs WHERE 1=1 ORDER BY time_local ASC, id ASC")).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "10.0.0.1", "@admin", first, `=HYPERLINK("http://evil.example")`, 200, 10, "+1", "-2+3", "\tcmd", nil, nil, "\rhost"))
+
+	rr := httptest.NewRecorder()
+	ExportLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/export?format=csv", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	records, err := csv.NewReader(strings.NewReader(rr.Body.String())).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, []string{"10.0.0.1", "'@admin", "2025-04-10T10:00:00Z", `'=HYPERLINK("http://evil.example")`, "200", "10",
+		"'+1", "'-2+3", "'\tcmd", "", "", "'\rhost"}, records[1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportLogsHandler_Errors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	mock.ExpectQuery("SELECT id, remote_addr").WillReturnError(errors.New("relation missing"))
+	rr := httptest.NewRecorder()
+	ExportLogsHandler(rr, httptest.NewRequest(http.MethodGet, "/logs/export", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "relation missing")
+
+	for _, url := range []string{"/logs/export?start_time=soon", "/logs/export?format=xml"} {
+		rr = httptest.NewRecorder()
+		ExportLogsHandler(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestArchiveHandler_UploadFails(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	connection.DB = db
+
+	defer func(saved func() (storage.Storage, error)) { archiveStorage = saved }(archiveStorage)
+	archiveStorage = func() (storage.Storage, error) { return &fakeStorage{err: errors.New("bucket not found")}, nil }
+
+	mock.ExpectQuery("SELECT id, remote_addr").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	job := startArchive(t, "/admin/archive?start_time=2025-04-10&end_time=2025-04-11")
+	assert.Equal(t, ARCHIVE_FAILED, job.State)
+	assert.Equal(t, "bucket not found", job.Error)
+}
+
+// TestPruneArchiveJobs checks that finished jobs are evicted once their TTL has passed, and running ones never
+func TestPruneArchiveJobs(t *testing.T) {
+	archiveJobsMu.Lock()
+	defer archiveJobsMu.Unlock()
+	defer func(saved map[string]*ArchiveJob) { archiveJobs = saved }(archiveJobs)
+
+	now := time.Date(2025, time.April, 15, 12, 0, 0, 0, time.UTC)
+	recent, expired := now.Add(-time.Hour), now.Add(-ARCHIVE_JOB_TTL-time.Second)
+	archiveJobs = map[string]*ArchiveJob{
+		"running": {ID: "running", State: ARCHIVE_RUNNING, StartedAt: now.Add(-48 * time.Hour)},
+		"recent":  {ID: "recent", State: ARCHIVE_DONE, FinishedAt: &recent},
+		"expired": {ID: "expired", State: ARCHIVE_FAILED, FinishedAt: &expired},
+	}
+	pruneArchiveJobs(now)
+	assert.Contains(t, archiveJobs, "running")
+	assert.Contains(t, archiveJobs, "recent")
+	assert.NotContains(t, archiveJobs, "expired")
+}
+
+func TestArchiveHandler_InvalidRequests(t *testing.T) {
+	defer func(bucket string) { utils.ConfigData.ArchiveBucket = bucket }(utils.ConfigData.ArchiveBucket)
+	utils.ConfigData.ArchiveBucket = ""
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		code   int
+	}{
+		{"missing range", http.MethodPost, "/admin/archive?start_time=2025-04-10", http.StatusBadRequest},
+		{"invalid range", http.MethodPost, "/admin/archive?start_time=yesterday&end_time=2025-04-11", http.StatusBadRequest},
+		{"storage not configured", http.MethodPost, "/admin/archive?start_time=2025-04-10&end_time=2025-04-11", http.StatusServiceUnavailable},
+		{"unknown job", http.MethodGet, "/admin/archive?job=nope", http.StatusNotFound},
+		{"wrong method", http.MethodDelete, "/admin/archive", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			ArchiveHandler(rr, httptest.NewRequest(tt.method, tt.target, nil))
+			assert.Equal(t, tt.code, rr.Code)
+		})
+	}
+}
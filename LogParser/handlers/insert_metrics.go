@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"LogParser/logger"
+	"LogParser/metrics"
+	"LogParser/models"
+	"LogParser/utils"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	insertTunerOnce sync.Once
+	insertTuner     *metrics.Tuner
+)
+
+// autoTuner returns the chunk size tuner, created on first use from the configured size and bounds.
+func autoTuner() *metrics.Tuner {
+	insertTunerOnce.Do(func() {
+		insertTuner = metrics.NewTuner(utils.ConfigData.InsertChunkSize, utils.ConfigData.InsertChunkMin, utils.ConfigData.InsertChunkMax)
+	})
+	return insertTuner
+}
+
+// insertChunkSize returns the number of logs to write per INSERT: the tuned size while
+// PARSER_INSERT_AUTO_TUNE is enabled, the configured one otherwise, never more than an INSERT of the
+// current columns can bind.
+func insertChunkSize() int {
+	limit := utils.InsertChunkLimit()
+	if utils.ConfigData.InsertAutoTune {
+		tuner := autoTuner()
+		tuner.Cap(limit)
+		return tuner.Size()
+	}
+	return min(utils.ConfigData.InsertChunkSize, limit)
+}
+
+// recordInsertBatch records a written chunk in the insert metrics and feeds it to the tuner.
+func recordInsertBatch(rows int, latency time.Duration) {
+	metrics.Inserts.Record(rows, latency)
+	if utils.ConfigData.InsertAutoTune {
+		autoTuner().Observe(rows, latency)
+	}
+}
+
+// GetInsertStatsHandler reports the insert batch metrics: batch sizes, per-batch latency and
+// rows per second, along with the chunk size the next batch will use.
+func GetInsertStatsHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"batches":    metrics.Inserts.Snapshot(),
+		"chunk_size": insertChunkSize(),
+		"auto_tune":  utils.ConfigData.InsertAutoTune,
+	}
+	models.SendResponse(w, http.StatusOK, true, "Insert statistics retrieved successfully", data)
+}
+
+// GetMetricsHandler exposes the request and log add metrics in the Prometheus text format, for scraping.
+func GetMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Only GET method is allowed", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.HTTP.WritePrometheus(w); err != nil {
+		logger.LogWarn(fmt.Sprintf("Error writing metrics: %v", err))
+	}
+}
@@ -6,22 +6,119 @@ import (
 	"LogParser/logger"
 	"LogParser/ml"
 	"LogParser/models"
+	"LogParser/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 )
 
 var mlService *ml.MLService
 
+// tenantMLServices holds the ML service of each tenant, derived from mlService on the tenant's first
+// ML request, so the state the analyzers accumulate is never shared between tenants.
+var (
+	tenantMLMu       sync.Mutex
+	tenantMLServices = make(map[string]*ml.MLService)
+)
+
 // InitializeMLService initializes the ML service
 func InitializeMLService() error {
+	tenantMLMu.Lock()
+	tenantMLServices = make(map[string]*ml.MLService)
+	tenantMLMu.Unlock()
+
 	mlService = ml.NewMLService()
+	if err := mlService.Apply(utils.ConfigData.ML); err != nil {
+		logger.LogWarn(fmt.Sprintf("Invalid ML settings in config, using the defaults: %v", err))
+	}
+	if url := utils.ConfigData.MLAlertWebhook; url != "" {
+		notifier, err := ml.NewAlertNotifier(url, utils.ConfigData.MLAlertWebhookSeverity)
+		if err != nil {
+			logger.LogWarn(fmt.Sprintf("ML alert webhook disabled: %v", err))
+		} else {
+			mlService.SetAlertNotifier(notifier)
+		}
+	}
 	return mlService.Initialize()
 }
 
-// GetMLInsightsHandler provides comprehensive ML insights
+// mlServiceFor returns the ML service analyzing the logs r may see: its tenant's, or mlService for
+// a request not scoped to a tenant.
+func mlServiceFor(r *http.Request) *ml.MLService {
+	tenant := utils.TenantFromContext(r.Context())
+	if tenant == "" {
+		return mlService
+	}
+
+	tenantMLMu.Lock()
+	defer tenantMLMu.Unlock()
+	service, ok := tenantMLServices[tenant]
+	if !ok {
+		service = mlService.ForTenant(tenant)
+		tenantMLServices[tenant] = service
+	}
+	return service
+}
+
+// allMLServices returns mlService followed by the service of every tenant that has made an ML request.
+func allMLServices() []*ml.MLService {
+	tenantMLMu.Lock()
+	defer tenantMLMu.Unlock()
+
+	services := []*ml.MLService{mlService}
+	for _, service := range tenantMLServices {
+		services = append(services, service)
+	}
+	return services
+}
+
+// forceParam parses the force query parameter, which makes the ML endpoints compute fresh insights
+// instead of reusing cached ones. An invalid value is answered with 400 and ok false.
+func forceParam(w http.ResponseWriter, r *http.Request) (force bool, ok bool) {
+	param := r.URL.Query().Get("force")
+	if param == "" {
+		return false, true
+	}
+	force, err := strconv.ParseBool(param)
+	if err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid force: '%s'. Expected true or false", param), nil)
+		return false, false
+	}
+	return force, true
+}
+
+// windowParams parses the hours and limit query parameters of r into the analysis window, zero for those
+// left out. Values above the bounds of the ML service are clamped by it. It answers 400 and returns false
+// when either is not a positive integer.
+func windowParams(w http.ResponseWriter, r *http.Request) (window ml.AnalysisWindow, ok bool) {
+	if window.Hours, ok = positiveIntParam(w, r, "hours"); !ok {
+		return window, false
+	}
+	window.Limit, ok = positiveIntParam(w, r, "limit")
+	return window, ok
+}
+
+// positiveIntParam parses the named query parameter of r, 0 when it is left out. It answers 400 and
+// returns false when the parameter is not a positive integer.
+func positiveIntParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return 0, true
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil || value <= 0 {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid %s: '%s'. Expected a positive integer", name, param), nil)
+		return 0, false
+	}
+	return value, true
+}
+
+// GetMLInsightsHandler provides comprehensive ML insights on the logs of the last hours hours, at most
+// the limit most recent, by default those of the ML configuration
 func GetMLInsightsHandler(w http.ResponseWriter, r *http.Request) {
 	logger.LogInfo("ML Insights API called")
 	
@@ -30,7 +127,15 @@ func GetMLInsightsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	insights, err := mlService.GenerateInsights()
+	force, ok := forceParam(w, r)
+	if !ok {
+		return
+	}
+	window, ok := windowParams(w, r)
+	if !ok {
+		return
+	}
+	insights, err := mlServiceFor(r).InsightsFor(window, force)
 	if err != nil {
 		logger.LogError(fmt.Sprintf("Error generating ML insights: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to generate insights", nil)
@@ -58,7 +163,11 @@ func GetAnomalyDetectionHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	
-	insights, err := mlService.GenerateInsights()
+	force, ok := forceParam(w, r)
+	if !ok {
+		return
+	}
+	insights, err := mlServiceFor(r).Insights(force)
 	if err != nil {
 		logger.LogError(fmt.Sprintf("Error generating anomaly insights: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to detect anomalies", nil)
@@ -67,7 +176,7 @@ func GetAnomalyDetectionHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// Filter anomalies by time range
 	cutoffTime := time.Now().Add(-time.Duration(hours) * time.Hour)
-	var filteredAnomalies []ml.AnomalyResult
+	filteredAnomalies := []ml.AnomalyResult{}
 	
 	for _, anomaly := range insights.Anomalies {
 		if anomaly.Timestamp.After(cutoffTime) {
@@ -77,6 +186,7 @@ func GetAnomalyDetectionHandler(w http.ResponseWriter, r *http.Request) {
 	
 	response := map[string]interface{}{
 		"anomalies":     filteredAnomalies,
+		"enabled":       mlService.FeatureEnabled(ml.FEATURE_ANOMALY_DETECTION),
 		"total_count":   len(filteredAnomalies),
 		"time_range":    fmt.Sprintf("%d hours", hours),
 		"generated_at":  time.Now(),
@@ -103,7 +213,11 @@ func GetPredictionsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	
-	insights, err := mlService.GenerateInsights()
+	force, ok := forceParam(w, r)
+	if !ok {
+		return
+	}
+	insights, err := mlServiceFor(r).Insights(force)
 	if err != nil {
 		logger.LogError(fmt.Sprintf("Error generating predictions: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to generate predictions", nil)
@@ -111,7 +225,7 @@ func GetPredictionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Filter predictions by requested time range
-	var filteredPredictions []ml.PredictionResult
+	filteredPredictions := []ml.PredictionResult{}
 	cutoffTime := time.Now().Add(time.Duration(hoursAhead) * time.Hour)
 	
 	for _, prediction := range insights.Predictions {
@@ -122,6 +236,7 @@ func GetPredictionsHandler(w http.ResponseWriter, r *http.Request) {
 	
 	response := map[string]interface{}{
 		"predictions":   filteredPredictions,
+		"enabled":       mlService.FeatureEnabled(ml.FEATURE_TRAFFIC_PREDICTION),
 		"total_count":   len(filteredPredictions),
 		"hours_ahead":   hoursAhead,
 		"trend_analysis": insights.TrendAnalysis,
@@ -150,7 +265,11 @@ func GetSecurityThreatsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	
-	insights, err := mlService.GenerateInsights()
+	force, ok := forceParam(w, r)
+	if !ok {
+		return
+	}
+	insights, err := mlServiceFor(r).Insights(force)
 	if err != nil {
 		logger.LogError(fmt.Sprintf("Error analyzing security threats: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to analyze security threats", nil)
@@ -159,7 +278,7 @@ func GetSecurityThreatsHandler(w http.ResponseWriter, r *http.Request) {
 	
 	// Filter threats by time range and severity
 	cutoffTime := time.Now().Add(-time.Duration(hours) * time.Hour)
-	var filteredThreats []ml.SecurityThreat
+	filteredThreats := []ml.SecurityThreat{}
 	
 	for _, threat := range insights.SecurityThreats {
 		if threat.LastSeen.After(cutoffTime) {
@@ -180,6 +299,7 @@ func GetSecurityThreatsHandler(w http.ResponseWriter, r *http.Request) {
 	
 	response := map[string]interface{}{
 		"threats":       filteredThreats,
+		"enabled":       mlService.FeatureEnabled(ml.FEATURE_SECURITY_ANALYSIS),
 		"total_count":   len(filteredThreats),
 		"threat_stats":  threatStats,
 		"time_range":    fmt.Sprintf("%d hours", hours),
@@ -198,7 +318,11 @@ func GetUserClustersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	insights, err := mlService.GenerateInsights()
+	force, ok := forceParam(w, r)
+	if !ok {
+		return
+	}
+	insights, err := mlServiceFor(r).Insights(force)
 	if err != nil {
 		logger.LogError(fmt.Sprintf("Error generating user clusters: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to generate user clusters", nil)
@@ -217,25 +341,29 @@ func GetUserClustersHandler(w http.ResponseWriter, r *http.Request) {
 		totalRequests := 0.0
 		totalBytes := 0.0
 		totalErrors := 0.0
+		totalSessionTime := 0.0
 		
 		for _, user := range users {
 			totalRequests += user.RequestRate
 			totalBytes += user.AvgBytes
 			totalErrors += user.ErrorRate
+			totalSessionTime += user.SessionTime
 		}
 		
 		userCount := len(users)
 		clusterStats[clusterID] = map[string]interface{}{
-			"user_count":     userCount,
-			"avg_requests":   totalRequests / float64(userCount),
-			"avg_bytes":      totalBytes / float64(userCount),
-			"avg_error_rate": totalErrors / float64(userCount),
-			"cluster_name":   users[0].ClusterName,
+			"user_count":       userCount,
+			"avg_requests":     totalRequests / float64(userCount),
+			"avg_bytes":        totalBytes / float64(userCount),
+			"avg_error_rate":   totalErrors / float64(userCount),
+			"avg_session_time": totalSessionTime / float64(userCount),
+			"cluster_name":     users[0].ClusterName,
 		}
 	}
 	
 	response := map[string]interface{}{
 		"clusters":       insights.Clusters,
+		"enabled":        mlService.FeatureEnabled(ml.FEATURE_USER_CLUSTERING),
 		"cluster_groups": clusterGroups,
 		"cluster_stats":  clusterStats,
 		"total_users":    len(insights.Clusters),
@@ -245,6 +373,54 @@ func GetUserClustersHandler(w http.ResponseWriter, r *http.Request) {
 	models.SendResponse(w, http.StatusOK, true, "User clustering completed", response)
 }
 
+// GetAlertsHandler provides the alerts raised from the ML insights, optionally filtered by severity and resolved
+func GetAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	logger.LogInfo("ML Alerts API called")
+	
+	if mlService == nil {
+		models.SendResponse(w, http.StatusInternalServerError, false, "ML service not initialized", nil)
+		return
+	}
+	
+	severityParam := r.URL.Query().Get("severity")
+	resolvedParam := r.URL.Query().Get("resolved")
+	var resolved bool
+	if resolvedParam != "" {
+		var err error
+		resolved, err = strconv.ParseBool(resolvedParam)
+		if err != nil {
+			models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid resolved: '%s'. Expected true or false", resolvedParam), nil)
+			return
+		}
+	}
+	
+	alerts, err := mlServiceFor(r).GenerateAlerts()
+	if err != nil {
+		logger.LogError(fmt.Sprintf("Error generating alerts: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to generate alerts", nil)
+		return
+	}
+	
+	filteredAlerts := []ml.Alert{}
+	for _, alert := range alerts {
+		if severityParam != "" && alert.Severity != severityParam {
+			continue
+		}
+		if resolvedParam != "" && alert.Resolved != resolved {
+			continue
+		}
+		filteredAlerts = append(filteredAlerts, alert)
+	}
+	
+	response := map[string]interface{}{
+		"alerts":       filteredAlerts,
+		"total_count":  len(filteredAlerts),
+		"generated_at": time.Now(),
+	}
+	
+	models.SendResponse(w, http.StatusOK, true, "Alerts generated", response)
+}
+
 // GetRealTimeAnomalyHandler provides real-time anomaly detection
 func GetRealTimeAnomalyHandler(w http.ResponseWriter, r *http.Request) {
 	logger.LogInfo("Real-time Anomaly Detection API called")
@@ -267,7 +443,11 @@ func GetRealTimeAnomalyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	anomalyScore, err := mlService.GetRealTimeAnomalyScore(value)
+	anomalyScore, err := mlServiceFor(r).GetRealTimeAnomalyScore(value)
+	if errors.Is(err, ml.ErrFeatureDisabled) {
+		models.SendResponse(w, http.StatusServiceUnavailable, false, "Anomaly detection is disabled", nil)
+		return
+	}
 	if err != nil {
 		logger.LogError(fmt.Sprintf("Error calculating real-time anomaly score: %v", err))
 		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to calculate anomaly score", nil)
@@ -305,25 +485,33 @@ func GetMLConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Return default configuration (in a real implementation, this would be configurable)
+	current, patterns := mlService.Config()
+	patternNames := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		patternNames = append(patternNames, pattern.Name)
+	}
+	
 	config := map[string]interface{}{
-		"anomaly_threshold":    2.5,
-		"prediction_horizon":   24,
-		"cluster_count":        3,
-		"security_sensitivity": "medium",
-		"features": []string{
-			"anomaly_detection",
-			"traffic_prediction",
-			"security_analysis",
-			"user_clustering",
-			"real_time_monitoring",
-		},
+		"anomaly_threshold":    current.AnomalyThreshold,
+		"prediction_horizon":   current.PredictionHorizon,
+		"cluster_count":        current.ClusterCount,
+		"security_sensitivity": current.SecuritySensitivity,
+		"anomaly_method":       current.AnomalyMethod,
+		"analysis_hours":       current.AnalysisHours,
+		"analysis_limit":       current.AnalysisLimit,
+		"security_allowlist":   current.SecurityAllowlist,
+		"security_denylist":    current.SecurityDenylist,
+		"attack_patterns":      patternNames,
+		"features":             current.EnabledFeatures(),
+		"disabled_features":    current.DisabledFeatures(),
 	}
 	
 	models.SendResponse(w, http.StatusOK, true, "ML configuration retrieved", config)
 }
 
-// UpdateMLConfigHandler updates ML configuration (POST)
+// UpdateMLConfigHandler updates ML configuration (POST). Only the fields present in the body change,
+// the others keep their current values. The update applies to the running analyzers of every tenant
+// until the next POST /admin/reload-ml or restart; it is not written to config.yaml.
 func UpdateMLConfigHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
@@ -332,20 +520,60 @@ func UpdateMLConfigHandler(w http.ResponseWriter, r *http.Request) {
 	
 	logger.LogInfo("ML Config Update API called")
 	
-	var configUpdate map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&configUpdate)
-	if err != nil {
-		models.SendResponse(w, http.StatusBadRequest, false, "Invalid JSON payload", nil)
+	if mlService == nil {
+		models.SendResponse(w, http.StatusInternalServerError, false, "ML service not initialized", nil)
+		return
+	}
+	
+	configUpdate, _ := mlService.Config()
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&configUpdate); err != nil {
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid JSON payload: %v", err), nil)
+		return
+	}
+	
+	if err := mlService.UpdateConfig(configUpdate); err != nil {
+		logger.LogWarn(fmt.Sprintf("ML config update rejected: %v", err))
+		models.SendResponse(w, http.StatusBadRequest, false, fmt.Sprintf("Invalid ML configuration, keeping the current one: %v", err), nil)
 		return
 	}
+	// Tenants' services run with the same configuration
+	for _, service := range allMLServices()[1:] {
+		if err := service.UpdateConfig(configUpdate); err != nil {
+			logger.LogWarn(fmt.Sprintf("ML config update of a tenant failed: %v", err))
+		}
+	}
 	
-	// In a real implementation, you would update the actual configuration
-	// For now, just return success
 	response := map[string]interface{}{
 		"updated_config": configUpdate,
 		"updated_at":     time.Now(),
-		"status":         "Configuration updated successfully",
 	}
 	
 	models.SendResponse(w, http.StatusOK, true, "ML configuration updated", response)
 }
+
+// ResetMLHandler clears the accumulated ML state (POST)
+func ResetMLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
+		return
+	}
+	
+	logger.LogInfo("ML Reset API called")
+	
+	if mlService == nil {
+		models.SendResponse(w, http.StatusInternalServerError, false, "ML service not initialized", nil)
+		return
+	}
+	
+	for _, service := range allMLServices() {
+		service.Reset()
+	}
+	
+	response := map[string]interface{}{
+		"reset_at": time.Now(),
+	}
+	
+	models.SendResponse(w, http.StatusOK, true, "ML state reset", response)
+}
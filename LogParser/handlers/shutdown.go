@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+)
+
+// In-flight AddLogs requests run under a shared context that is cancelled once the server's drain
+// timeout expires. Parsing then stops and a pending insert is cancelled (and rolled back by the
+// database) instead of being cut off by process exit, so a batch is either fully stored or not at all.
+var (
+	shutdownMu     sync.Mutex
+	shutdownCtx    context.Context
+	shutdownCancel context.CancelFunc
+	inFlight       sync.WaitGroup
+)
+
+func init() {
+	resetShutdown()
+}
+
+// resetShutdown installs a fresh, uncancelled shutdown context.
+func resetShutdown() {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	shutdownCtx, shutdownCancel = context.WithCancel(context.Background())
+}
+
+// shutdownContext returns the context in-flight work should observe.
+func shutdownContext() context.Context {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	return shutdownCtx
+}
+
+// AbortInFlight cancels the work of in-flight AddLogs requests and blocks until they have returned.
+// It is called when the graceful shutdown drain timeout expires.
+func AbortInFlight() {
+	shutdownMu.Lock()
+	shutdownCancel()
+	shutdownMu.Unlock()
+	inFlight.Wait()
+}
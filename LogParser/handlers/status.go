@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"LogParser/connection"
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// startedAt is when the parser started, reported as its uptime by GetParserStatusHandler.
+var startedAt = time.Now()
+
+// GetParserStatusHandler reports the health of the parser in one place: whether the database answers,
+// how long the parser has been up, how many logs are stored and the timestamp of the most recent one.
+// An unreachable database is answered with 503 and the uptime alone.
+func GetParserStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		models.SendResponse(w, http.StatusMethodNotAllowed, false, "Only GET method is allowed", nil)
+		return
+	}
+	logger.LogDebug("Get parser status hit!")
+
+	uptime := time.Since(startedAt)
+	data := map[string]interface{}{
+		"database":       false,
+		"uptime_seconds": int64(uptime.Seconds()),
+		"started_at":     startedAt.UTC(),
+	}
+
+	isAlive, db := connection.PingDB()
+	if !isAlive {
+		models.SendResponse(w, http.StatusServiceUnavailable, false, "Failed to connect to Database!", data)
+		return
+	}
+	data["database"] = true
+
+	ctx, cancel := queryContext(r)
+	defer cancel()
+
+	var totalRows int64
+	var lastLogTime sql.NullTime
+	query, args := tenantQuery(r, utils.QUERY_ROWS_AND_LAST_LOG)
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&totalRows, &lastLogTime); err != nil {
+		if queryTimedOut(w, ctx, err) {
+			return
+		}
+		logger.LogWarn(fmt.Sprintf("Failed to query database: %v", err))
+		models.SendResponse(w, http.StatusInternalServerError, false, fmt.Sprintf("Failed to query database: %v", err), nil)
+		return
+	}
+
+	data["total_rows"] = totalRows
+	data["last_log_time"] = nil
+	if lastLogTime.Valid {
+		data["last_log_time"] = lastLogTime.Time
+	}
+	models.SendResponse(w, http.StatusOK, true, "Parser status retrieved successfully", data)
+}
@@ -1,8 +1,17 @@
 package helpers
 
 import (
+	"LogParser/connection"
+	"LogParser/metrics"
+	"LogParser/utils"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"os/signal"
 	"syscall"
 	"testing"
 	"time"
@@ -85,7 +94,9 @@ func TestNewApplication(t *testing.T) {
 
 func TestRefreshConfigura(t *testing.T) {
 	//ticker := time.NewTicker(1 * time.Minute)
-	go RefreshConfigura(&Configs{}, time.Minute)
+	stop := make(chan struct{})
+	defer close(stop)
+	go RefreshConfigura(&Configs{}, time.Minute, stop)
 	
 }
 
@@ -104,6 +115,80 @@ func TestStopServer(t *testing.T) {
 	assert.NoError(t, nil)
 }
 
+// TestStopServer_Signal starts the server on a free port, sends the process SIGTERM and checks that
+// the server shuts down, with both lifecycle methods returning, instead of the process exiting.
+func TestStopServer_Signal(t *testing.T) {
+	defer func(port string, timeout int) {
+		utils.ConfigData.PORT, utils.ConfigData.ShutdownTimeout = port, timeout
+	}(utils.ConfigData.PORT, utils.ConfigData.ShutdownTimeout)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	utils.ConfigData.PORT = addr
+	utils.ConfigData.ShutdownTimeout = 5
+
+	notifyShutdown()
+	defer signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+	s := &Servers{}
+	started := make(chan error, 1)
+	go func() { started <- s.startServer() }()
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.stopServer() }()
+
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	for name, ch := range map[string]chan error{"stopServer": stopped, "startServer": started} {
+		select {
+		case err := <-ch:
+			assert.NoError(t, err, name)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s did not return after SIGTERM", name)
+		}
+	}
+
+	_, err = http.Get("http://" + addr + "/")
+	assert.Error(t, err, "the server should no longer accept connections")
+}
+
+// TestNewRouter drives requests through the server's handler and checks that POST /logs reaches the
+// one AddLogsHandler, and that the request is counted on /metrics.
+func TestNewRouter(t *testing.T) {
+	connection.DB = nil
+	metrics.HTTP.Reset()
+	defer metrics.HTTP.Reset()
+	defer func(key string) { utils.ConfigData.APIKey = key }(utils.ConfigData.APIKey)
+	utils.ConfigData.APIKey = "s3cret"
+	ts := httptest.NewServer(newRouter())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+utils.PARSER_MAIN_URL, strings.NewReader(`not json`))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(utils.API_KEY_HEADER, "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, string(body), "Failed to decode log data")
+
+	resp, err = http.Get(ts.URL + utils.PARSER_METRICS_URL)
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `http_requests_total{method="POST",status="400"} 1`)
+}
+
 func TestStartServer(t *testing.T) {
 	serv := &Servers{}
 
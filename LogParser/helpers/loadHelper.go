@@ -5,17 +5,21 @@
 package helpers
 
 import (
+	"LogParser/alerts"
 	"LogParser/connection"
 	"LogParser/handlers"
 	_"LogParser/interfaces"
 	"LogParser/logger"
+	"LogParser/middleware"
 	_ "LogParser/server"
 	"LogParser/utils"
+	"context"
 	"fmt"
 	_ "log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -38,46 +42,108 @@ type ConfigurationLoader interface{
 
 // Servers struct implements the ServerLoader interface. It contains methods for starting 
 // and stopping the HTTP server. It is responsible for managing the server lifecycle.
-type Servers struct{}
+type Servers struct{
+	mu      sync.Mutex
+	srv     *http.Server  // Built by startServer, shut down by stopServer.
+	stopped chan struct{} // Closed by stopServer once in-flight requests have drained or been aborted.
+}
+
+// stoppedChan returns the channel closed once the server has stopped.
+func (s *Servers) stoppedChan() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped == nil {
+		s.stopped = make(chan struct{})
+	}
+	return s.stopped
+}
 
 // EndPointHandler struct is used to map handler names (from the config) to corresponding HTTP 
 // handler functions. It allows dynamic routing of requests based on handler names.
 type EndPointHandler struct{}
 
+// newRouter returns the server's handler: every route of the parser, behind the middleware shared
+// by all of them.
+func newRouter() http.Handler {
+	// The read endpoints backing browser dashboards answer their cross-origin requests
+	cors := func(next http.HandlerFunc) http.HandlerFunc { return middleware.CORS(next, utils.ConfigData.CORSOrigins) }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(utils.PARSER_ALIVE_URL, handlers.IsAlive)            // Handler for /alive
+	mux.HandleFunc(utils.PARSER_CAPABILITIES_URL, cors(handlers.GetCapabilitiesHandler)) // Handler for /capabilities
+	mux.HandleFunc(utils.PARSER_STATUS_URL, cors(middleware.RequireTenant(handlers.GetParserStatusHandler))) // Handler for /status
+	mux.HandleFunc(utils.PARSER_MAIN_URL, middleware.RequireAPIKey(middleware.RequireTenant(middleware.Coalesce(handlers.HandleType)))) // Handler for /parse
+	mux.HandleFunc(utils.PARSER_GET_COUNT_URL, middleware.RequireTenant(middleware.Coalesce(handlers.GetLogsCountHandler))) // Handler for /logs/count
+	mux.HandleFunc("/logs/watermark", middleware.RequireTenant(middleware.Coalesce(handlers.GetWatermarkHandler)))     // Handler for /logs/watermark
+	mux.HandleFunc("/logs/aggregate", middleware.RequireTenant(middleware.Coalesce(handlers.GetAggregateStatsHandler)))   // Handler for /logs/aggregate
+	mux.HandleFunc("/logs/export", middleware.RequireTenant(handlers.ExportLogsHandler))                               // Handler for /logs/export
+	mux.HandleFunc("/logs/{id}", middleware.RequireTenant(middleware.Coalesce(handlers.GetLogByIDHandler)))            // Handler for /logs/{id}
+	mux.HandleFunc("/admin/reenrich", middleware.RequireAdmin(handlers.ReenrichHandler)) // Handler for /admin/reenrich
+	mux.HandleFunc("/admin/archive", middleware.RequireAdmin(handlers.ArchiveHandler)) // Handler for /admin/archive
+	mux.HandleFunc("/admin/ip/{addr}", middleware.RequireAdmin(handlers.PurgeIPHandler)) // Handler for /admin/ip/{addr}
+	mux.HandleFunc("/admin/reload-ml", middleware.RequireAdmin(handlers.ReloadMLHandler)) // Handler for /admin/reload-ml
+
+	// Statistics endpoints
+	mux.HandleFunc("/stats/status", cors(middleware.RequireTenant(middleware.Cache(middleware.Coalesce(handlers.GetStatusStatsHandler)))))     // Handler for /stats/status
+	mux.HandleFunc("/stats/ip", cors(middleware.RequireTenant(middleware.Cache(middleware.Coalesce(handlers.GetIPStatsHandler)))))             // Handler for /stats/ip
+	mux.HandleFunc("/stats/top-ips", cors(middleware.RequireTenant(middleware.Cache(middleware.Coalesce(handlers.GetTopIPsHandler)))))         // Handler for /stats/top-ips
+	mux.HandleFunc("/stats/server", cors(middleware.RequireTenant(middleware.Cache(middleware.Coalesce(handlers.GetServerStatsHandler)))))     // Handler for /stats/server
+	mux.HandleFunc("/stats/time", cors(middleware.RequireTenant(middleware.Cache(middleware.Coalesce(handlers.GetTimeStatsHandler)))))         // Handler for /stats/time
+	mux.HandleFunc("/stats/timeseries", cors(middleware.RequireTenant(middleware.Cache(middleware.Coalesce(handlers.GetTimeSeriesHandler))))) // Handler for /stats/timeseries
+	mux.HandleFunc("/stats/dashboard", cors(middleware.RequireTenant(middleware.Cache(middleware.Coalesce(handlers.GetDashboardStatsHandler))))) // Handler for /stats/dashboard
+	mux.HandleFunc("/stats/response_time", cors(middleware.RequireTenant(middleware.Cache(middleware.Coalesce(handlers.GetResponseTimeStatsHandler))))) // Handler for /stats/response_time
+	mux.HandleFunc("/stats/insert", cors(handlers.GetInsertStatsHandler))                          // Handler for /stats/insert
+	mux.HandleFunc(utils.PARSER_METRICS_URL, handlers.GetMetricsHandler)                     // Handler for /metrics
+
+	// ML/AI endpoints
+	mux.HandleFunc("/ml/insights", cors(middleware.RequireTenant(handlers.GetMLInsightsHandler)))       // Handler for comprehensive ML insights
+	mux.HandleFunc("/ml/anomalies", cors(middleware.RequireTenant(handlers.GetAnomalyDetectionHandler))) // Handler for anomaly detection
+	mux.HandleFunc("/ml/predictions", cors(middleware.RequireTenant(handlers.GetPredictionsHandler)))   // Handler for traffic predictions
+	mux.HandleFunc("/ml/security", cors(middleware.RequireTenant(handlers.GetSecurityThreatsHandler)))  // Handler for security threat analysis
+	mux.HandleFunc("/ml/clusters", cors(middleware.RequireTenant(handlers.GetUserClustersHandler)))     // Handler for user behavior clustering
+	mux.HandleFunc("/ml/alerts", cors(middleware.RequireTenant(handlers.GetAlertsHandler)))            // Handler for alerts raised from the ML insights
+	mux.HandleFunc("/ml/realtime-anomaly", cors(middleware.RequireTenant(handlers.GetRealTimeAnomalyHandler))) // Handler for real-time anomaly detection
+	mux.HandleFunc("/ml/config", cors(handlers.GetMLConfigHandler))           // Handler for ML configuration
+	mux.HandleFunc("/ml/config/update", middleware.RequireAPIKey(handlers.UpdateMLConfigHandler)) // Handler for updating ML configuration
+	mux.HandleFunc("/ml/reset", middleware.RequireAdmin(handlers.ResetMLHandler)) // Handler for clearing accumulated ML state
+
+	return middleware.Metrics(middleware.RequestID(middleware.RateLimit(middleware.Pretty(mux))))
+}
+
 // startServer starts the HTTP server, which listens for incoming requests on the port 
 // defined in the configuration. The server handles requests for specific paths and endpoints.
 func (s *Servers) startServer() error{
 	fmt.Println("Starting log generator server on port", utils.ConfigData.PORT)
-		
-	http.HandleFunc(utils.PARSER_ALIVE_URL, handlers.IsAlive)            // Handler for /alive
-	http.HandleFunc(utils.PARSER_MAIN_URL, handlers.HandleType)          // Handler for /parse
-	http.HandleFunc(utils.PARSER_GET_COUNT_URL, handlers.GetLogsCountHandler) // Handler for /logs/count
-
-	// Statistics endpoints
-	http.HandleFunc("/stats/status", handlers.GetStatusStatsHandler)     // Handler for /stats/status
-	http.HandleFunc("/stats/ip", handlers.GetIPStatsHandler)             // Handler for /stats/ip
-	http.HandleFunc("/stats/time", handlers.GetTimeStatsHandler)         // Handler for /stats/time
-	http.HandleFunc("/stats/dashboard", handlers.GetDashboardStatsHandler) // Handler for /stats/dashboard
 
-	// ML/AI endpoints
-	http.HandleFunc("/ml/insights", handlers.GetMLInsightsHandler)       // Handler for comprehensive ML insights
-	http.HandleFunc("/ml/anomalies", handlers.GetAnomalyDetectionHandler) // Handler for anomaly detection
-	http.HandleFunc("/ml/predictions", handlers.GetPredictionsHandler)   // Handler for traffic predictions
-	http.HandleFunc("/ml/security", handlers.GetSecurityThreatsHandler)  // Handler for security threat analysis
-	http.HandleFunc("/ml/clusters", handlers.GetUserClustersHandler)     // Handler for user behavior clustering
-	http.HandleFunc("/ml/realtime-anomaly", handlers.GetRealTimeAnomalyHandler) // Handler for real-time anomaly detection
-	http.HandleFunc("/ml/config", handlers.GetMLConfigHandler)           // Handler for ML configuration
-	http.HandleFunc("/ml/config/update", handlers.UpdateMLConfigHandler) // Handler for updating ML configuration
-
-	fmt.Println("Current Configuration Data:", utils.ConfigData)
+	// Config's String redacts its secrets
+	logger.LogDebug(fmt.Sprintf("Current Configuration Data: %v", utils.ConfigData))
+	if utils.ConfigData.APIKey == "" && utils.ConfigData.AllowAnonymousWrites {
+		logger.LogWarn(fmt.Sprintf("%s is empty and %s is set: anyone reaching the server can ingest and delete logs", utils.KEY_API_KEY, utils.KEY_ALLOW_ANONYMOUS_WRITES))
+	} else if utils.ConfigData.APIKey == "" && !utils.Multitenant() {
+		logger.LogWarn(fmt.Sprintf("%s is empty: requests that modify logs are rejected until it is set", utils.KEY_API_KEY))
+	}
 	
 	// Start the HTTP server and listen on the configured port.
-	serverPort := utils.ConfigData.PORT
-	if err := http.ListenAndServe(fmt.Sprintf("%s", serverPort), nil); err != nil {
+	srv := &http.Server{
+		Addr:    utils.ConfigData.PORT,
+		Handler: newRouter(),
+	}
+	s.mu.Lock()
+	s.srv = srv
+	s.mu.Unlock()
+	select {
+	case <-s.stoppedChan():
+		// Stopped before the server was built, there is nothing to serve
+		return nil
+	default:
+	}
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.LogError(fmt.Sprintf("Error starting server: %v", err))
 		os.Exit(1)
 	}
 
+	// ListenAndServe returns as soon as shutdown begins; wait for in-flight requests to drain.
+	<-s.stoppedChan()
 	return nil
 }
 /*
@@ -109,11 +175,32 @@ func (url *EndPointHandler) MapHandler(handlerName string) http.HandlerFunc{
 }
 */
 // stopServer gracefully shuts down the server when a termination signal is received.
+// New connections are refused and in-flight requests get the configured drain timeout to finish;
+// whatever is still running after that is aborted, and the database connection closed, before
+// the server reports it has stopped.
 func (s *Servers) stopServer() error{
 	// Wait for a signal (e.g., SIGINT or SIGTERM) to stop the server.
 	<-Done
+	stopped := s.stoppedChan()
+	defer close(stopped)
+
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(utils.ConfigData.ShutdownTimeout)*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.LogWarn(fmt.Sprintf("Drain timeout expired, aborting in-flight requests: %v", err))
+		}
+	}
+	handlers.AbortInFlight()
+
+	if err := connection.CloseDB(); err != nil {
+		logger.LogWarn(fmt.Sprintf("Error closing the database connection: %v", err))
+	}
+
 	fmt.Println("Server Stopped......")
-	os.Exit(1)
 	return nil
 }
 
@@ -137,23 +224,28 @@ func (c *Configs) refreshServer() error {
 		return fmt.Errorf("error loading Database configuration: %v", err)
 	}
 
-	fmt.Println(utils.ConfigData)
-	logger.LogDebug("Configuration Updated!")
+	logger.LogDebug(fmt.Sprintf("Configuration Updated! %v", utils.ConfigData))
 	return nil
 }
 
-// RefreshConfigura refreshes the server's configuration at regular intervals using a ticker.
-func RefreshConfigura(configs ConfigurationLoader, t time.Duration){
+// RefreshConfigura refreshes the server's configuration at regular intervals using a ticker,
+// until stop is closed.
+func RefreshConfigura(configs ConfigurationLoader, t time.Duration, stop <-chan struct{}){
 	// Create a ticker to trigger configuration refresh at regular intervals.
 	ticker := time.NewTicker(1 * t)
 	defer ticker.Stop()
 
-	// Continuously refresh the configuration as long as the ticker is active.
-	for range ticker.C {
-		//log.SetFlags(log.LstdFlags | log.Lshortfile)
-		if err := configs.refreshServer(); err != nil{
-			// Log any errors encountered while refreshing the configuration.
-			logger.LogError(err)
+	// Continuously refresh the configuration until the server stops.
+	for {
+		select {
+		case <-ticker.C:
+			//log.SetFlags(log.LstdFlags | log.Lshortfile)
+			if err := configs.refreshServer(); err != nil{
+				// Log any errors encountered while refreshing the configuration.
+				logger.LogError(err)
+			}
+		case <-stop:
+			return
 		}
 	}
 }
@@ -175,18 +267,25 @@ func NewApplication(servers ServerLoader, configs ConfigurationLoader) *Applicat
 // done channel is used to signal the termination of the server when a shutdown signal is received.
 var Done chan bool
 
-// SetUp initializes and sets up the application. It starts the server, begins periodic config refresh 
-func (app *Application) SetUp() error{
+// notifyShutdown installs a fresh Done channel that receives a value once the process gets
+// SIGINT or SIGTERM.
+func notifyShutdown() {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	Done = make(chan bool, 1)
+	done := make(chan bool, 1)
+	Done = done
 
 	go func() {
 		sig := <-sigs
 		fmt.Println()
 		fmt.Println(sig)
-		Done <- true
+		done <- true
 	}()
+}
+
+// SetUp initializes and sets up the application. It starts the server, begins periodic config refresh 
+func (app *Application) SetUp() error{
+	notifyShutdown()
 
 	if err := app.configuration.refreshServer(); err != nil {
 		//log.SetFlags(log.LstdFlags | log.Lshortfile)
@@ -202,7 +301,19 @@ func (app *Application) SetUp() error{
 		logger.LogInfo("ML service initialized successfully")
 	}
 
-	go RefreshConfigura(app.configuration, time.Minute)
+	// Background work runs until the server has stopped
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go RefreshConfigura(app.configuration, time.Minute, stopped)
+	if utils.ConfigData.Partitioning || utils.ConfigData.RetentionDays > 0 || utils.ConfigData.BatchAckTTL > 0 {
+		go connection.MaintainLogsTable(time.Duration(utils.ConfigData.MaintenanceInterval)*time.Second, stopped)
+	}
+	if utils.ConfigData.AlertInterval > 0 {
+		engine := alerts.NewEngine(alerts.LogNotifier{})
+		handlers.SetAlertStore(engine.Store)
+		go engine.Run(time.Duration(utils.ConfigData.AlertInterval)*time.Second, stopped)
+	}
 	go app.server.stopServer()
 	app.server.startServer()
 
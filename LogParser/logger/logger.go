@@ -1,10 +1,18 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"os"
 )
 
+// Output formats of the logger, selected with SetFormat.
+const (
+	FORMAT_TEXT string = "text" // Human-readable lines with colored levels, the default.
+	FORMAT_JSON string = "json" // One JSON object per line, with the time, level, message and fields as keys.
+)
+
 // Global logger variable
 var Log *logrus.Logger
 
@@ -32,11 +40,8 @@ func InitLogger(logLevel string) *logrus.Logger{
 		Log.SetLevel(logrus.InfoLevel) // Default to Info level if invalid
 	}
 
-	// Set log format - you can use JSONFormatter or TextFormatter
-	Log.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true, // Show timestamps in logs
-		ForceColors:   true, // Force color output for terminal
-	})
+	// Logs are text until SetFormat selects another format
+	Log.SetFormatter(formatter(FORMAT_TEXT))
 
 	// Optional: If you want to log to a file, uncomment the below code
 	// Log.SetOutput(&lumberjack.Logger{
@@ -48,6 +53,83 @@ func InitLogger(logLevel string) *logrus.Logger{
 	return Log
 }
 
+// SetFormat switches the output of Log to format, FORMAT_TEXT or FORMAT_JSON; an empty format is text.
+// An unknown format is rejected and leaves the output as it was.
+func SetFormat(format string) error {
+	if format == "" {
+		format = FORMAT_TEXT
+	}
+	f := formatter(format)
+	if f == nil {
+		return fmt.Errorf("unknown log format '%s', expected '%s' or '%s'", format, FORMAT_TEXT, FORMAT_JSON)
+	}
+	if Log != nil {
+		Log.SetFormatter(f)
+	}
+	return nil
+}
+
+// formatter returns the logrus formatter of format, nil when it is unknown.
+func formatter(format string) logrus.Formatter {
+	switch format {
+	case FORMAT_TEXT:
+		return &logrus.TextFormatter{
+			FullTimestamp: true, // Show timestamps in logs
+			ForceColors:   true, // Force color output for terminal
+		}
+	case FORMAT_JSON:
+		return &logrus.JSONFormatter{}
+	}
+	return nil
+}
+
+// LogWithFields logs msg at level, "debug", "info", "warn" or "error", with fields as context, such as
+// the id, method and path of the request being handled. In the JSON format each field is a key of the
+// log line; in the text format they follow the message as key=value. An unknown level logs at info,
+// and "fatal" and "panic" log at error: logging must not panic or exit the service.
+func LogWithFields(level string, msg string, fields map[string]interface{}) {
+	if Log == nil {
+		return
+	}
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		lvl = logrus.InfoLevel
+	} else if lvl < logrus.ErrorLevel {
+		lvl = logrus.ErrorLevel
+	}
+	Log.WithFields(logrus.Fields(fields)).Log(lvl, msg)
+}
+
+// fieldsKey is the context key ContextWithFields stores the fields of a context's logs under.
+type fieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx whose logs, written with LogContext, carry fields in addition
+// to those ctx already carries; a field set in both takes the value from fields.
+func ContextWithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	merged := make(map[string]interface{}, len(fields))
+	for key, value := range ContextFields(ctx) {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// ContextFields returns the fields ContextWithFields attached to ctx, nil when there are none. The map
+// is shared by every log of ctx and must not be modified.
+func ContextFields(ctx context.Context) map[string]interface{} {
+	fields, _ := ctx.Value(fieldsKey{}).(map[string]interface{})
+	return fields
+}
+
+// LogContext logs msg at level, as LogWithFields does, with the fields attached to ctx. Work done for a
+// request, such as the parsing workers and the insert of a POST /logs batch, logs with the request's
+// context so that its lines can be told apart by request id.
+func LogContext(ctx context.Context, level string, msg string) {
+	LogWithFields(level, msg, ContextFields(ctx))
+}
+
 // LogInfo logs an informational message
 func LogInfo(message interface{}) {
 	if Log != nil {
@@ -1,6 +1,10 @@
 package logger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -40,3 +44,105 @@ func TestLogDebug(t *testing.T) {
 	LogDebug("This is a debug message")
 }
 
+// TestLogWithFields_JSON checks that the JSON format writes each log as one JSON object carrying the
+// level, the message and the fields as keys, and that levels below the logger's are dropped.
+func TestLogWithFields_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	Log = InitLogger("info")
+	Log.SetOutput(&buf)
+	assert.NoError(t, SetFormat(FORMAT_JSON))
+
+	LogWithFields("warn", "Ignoring unknown query parameters", map[string]interface{}{
+		"request_id": "client-42",
+		"method":     "GET",
+		"path":       "/logs",
+	})
+	LogWithFields("debug", "Not logged", map[string]interface{}{"request_id": "client-43"})
+	LogInfo("Service started")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "warning", entry["level"])
+	assert.Equal(t, "Ignoring unknown query parameters", entry["msg"])
+	assert.Equal(t, "client-42", entry["request_id"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/logs", entry["path"])
+	assert.Contains(t, entry, "time")
+
+	entry = nil
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "Service started", entry["msg"])
+}
+
+// TestLogWithFields_SevereLevels checks that panic and fatal log at error instead of panicking or exiting
+func TestLogWithFields_SevereLevels(t *testing.T) {
+	var buf bytes.Buffer
+	Log = InitLogger("info")
+	Log.SetOutput(&buf)
+	assert.NoError(t, SetFormat(FORMAT_JSON))
+
+	assert.NotPanics(t, func() {
+		LogWithFields("panic", "Panic requested", nil)
+		LogWithFields("fatal", "Fatal requested", nil)
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "error", entry["level"])
+	}
+}
+
+// TestSetFormat checks that the text format is the default and that an unknown format is rejected
+// without changing the output.
+func TestSetFormat(t *testing.T) {
+	var buf bytes.Buffer
+	Log = InitLogger("info")
+	Log.SetOutput(&buf)
+
+	assert.Error(t, SetFormat("xml"))
+	LogWithFields("info", "Text line", map[string]interface{}{"path": "/logs"})
+	assert.Contains(t, buf.String(), "Text line")
+	assert.Contains(t, buf.String(), "=/logs")
+	assert.False(t, json.Valid(bytes.TrimSpace(buf.Bytes())))
+
+	assert.NoError(t, SetFormat(""))
+	assert.NoError(t, SetFormat(FORMAT_JSON))
+	buf.Reset()
+	LogWithFields("unknown", "JSON line", nil)
+	assert.True(t, json.Valid(bytes.TrimSpace(buf.Bytes())))
+	assert.Contains(t, buf.String(), `"level":"info"`)
+}
+
+// TestLogContext checks that the logs of a context carry the fields attached to it and to its parents,
+// the innermost value winning, and that a context without fields logs none.
+func TestLogContext(t *testing.T) {
+	var buf bytes.Buffer
+	Log = InitLogger("info")
+	Log.SetOutput(&buf)
+	assert.NoError(t, SetFormat(FORMAT_JSON))
+
+	parent := ContextWithFields(context.Background(), map[string]interface{}{"request_id": "client-42", "path": "/logs"})
+	ctx := ContextWithFields(parent, map[string]interface{}{"path": "/logs/count", "method": "GET"})
+	assert.Equal(t, map[string]interface{}{"request_id": "client-42", "path": "/logs"}, ContextFields(parent))
+
+	LogContext(ctx, "warn", "Query timed out")
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "warning", entry["level"])
+	assert.Equal(t, "client-42", entry["request_id"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/logs/count", entry["path"])
+
+	buf.Reset()
+	LogContext(context.Background(), "info", "No request")
+	entry = nil
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.NotContains(t, entry, "request_id")
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DurationBuckets are the upper bounds, in seconds, of the request duration histogram.
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey identifies a series of http_requests_total.
+type requestKey struct {
+	method string
+	status int
+}
+
+// HTTPMetrics counts the requests the parser answers, by method and status, with a histogram of
+// their durations, and the logs it stores. It is safe for concurrent use and renders itself in the
+// Prometheus text exposition format.
+type HTTPMetrics struct {
+	mu            sync.Mutex
+	requests      map[requestKey]int64
+	bucketCounts  []int64 // Requests per bucket of DurationBuckets, not cumulative.
+	durationSum   float64
+	durationCount int64
+	logAdds       int64
+}
+
+// HTTP holds the metrics of every request answered by the parser.
+var HTTP = NewHTTPMetrics()
+
+// NewHTTPMetrics returns empty request metrics.
+func NewHTTPMetrics() *HTTPMetrics {
+	return &HTTPMetrics{
+		requests:     map[requestKey]int64{},
+		bucketCounts: make([]int64, len(DurationBuckets)),
+	}
+}
+
+// ObserveRequest records a request of the given method answered with status after duration.
+func (m *HTTPMetrics) ObserveRequest(method string, status int, duration time.Duration) {
+	seconds := duration.Seconds()
+	bucket := sort.SearchFloat64s(DurationBuckets, seconds)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{method: method, status: status}]++
+	if bucket < len(m.bucketCounts) {
+		m.bucketCounts[bucket]++
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+// AddLogs records n logs stored by POST /logs.
+func (m *HTTPMetrics) AddLogs(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.logAdds += n
+}
+
+// Reset clears the recorded metrics.
+func (m *HTTPMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests = map[requestKey]int64{}
+	m.bucketCounts = make([]int64, len(DurationBuckets))
+	m.durationSum, m.durationCount, m.logAdds = 0, 0, 0
+}
+
+// WritePrometheus writes the metrics to w in the Prometheus text exposition format, version 0.0.4.
+// Request series are sorted by method and status, so the output is stable.
+func (m *HTTPMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	requests := make(map[requestKey]int64, len(m.requests))
+	for key, count := range m.requests {
+		requests[key] = count
+	}
+	bucketCounts := append([]int64(nil), m.bucketCounts...)
+	durationSum, durationCount, logAdds := m.durationSum, m.durationCount, m.logAdds
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("# HELP http_requests_total Requests answered by the parser, by method and status.\n")
+	printf("# TYPE http_requests_total counter\n")
+	for _, key := range keys {
+		printf("http_requests_total{method=%q,status=\"%d\"} %d\n", key.method, key.status, requests[key])
+	}
+
+	printf("# HELP http_request_duration_seconds Time taken to answer requests.\n")
+	printf("# TYPE http_request_duration_seconds histogram\n")
+	var cumulative int64
+	for i, bound := range DurationBuckets {
+		cumulative += bucketCounts[i]
+		printf("http_request_duration_seconds_bucket{le=\"%s\"} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	printf("http_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", durationCount)
+	printf("http_request_duration_seconds_sum %s\n", strconv.FormatFloat(durationSum, 'g', -1, 64))
+	printf("http_request_duration_seconds_count %d\n", durationCount)
+
+	printf("# HELP log_adds_total Logs stored by POST /logs.\n")
+	printf("# TYPE log_adds_total counter\n")
+	printf("log_adds_total %d\n", logAdds)
+	return err
+}
@@ -0,0 +1,77 @@
+// Package metrics records the requests the parser answers, for Prometheus, and how its log inserts
+// perform, batch by batch, tuning the insert chunk size from those observations when auto-tuning is enabled.
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// InsertMetrics accumulates the size and latency of insert batches. It is safe for concurrent use.
+type InsertMetrics struct {
+	mu           sync.Mutex
+	batches      int64
+	rows         int64
+	totalLatency time.Duration
+	lastSize     int
+	lastLatency  time.Duration
+}
+
+// InsertSnapshot is a point-in-time copy of the insert metrics.
+type InsertSnapshot struct {
+	Batches            int64   `json:"batches"`
+	Rows               int64   `json:"rows"`
+	AvgBatchSize       float64 `json:"avg_batch_size"`
+	AvgBatchLatencyMs  float64 `json:"avg_batch_latency_ms"`
+	LastBatchSize      int     `json:"last_batch_size"`
+	LastBatchLatencyMs float64 `json:"last_batch_latency_ms"`
+	RowsPerSecond      float64 `json:"rows_per_second"` // Rows inserted per second spent inserting.
+}
+
+// Inserts holds the metrics of every insert batch written by the parser.
+var Inserts = &InsertMetrics{}
+
+// Record adds one insert batch of the given number of rows that took latency to write.
+func (m *InsertMetrics) Record(rows int, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.batches++
+	m.rows += int64(rows)
+	m.totalLatency += latency
+	m.lastSize = rows
+	m.lastLatency = latency
+}
+
+// Snapshot returns the current metrics. Averages and throughput are zero until a batch is recorded.
+func (m *InsertMetrics) Snapshot() InsertSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := InsertSnapshot{
+		Batches:            m.batches,
+		Rows:               m.rows,
+		LastBatchSize:      m.lastSize,
+		LastBatchLatencyMs: milliseconds(m.lastLatency),
+	}
+	if m.batches > 0 {
+		snapshot.AvgBatchSize = float64(m.rows) / float64(m.batches)
+		snapshot.AvgBatchLatencyMs = milliseconds(m.totalLatency) / float64(m.batches)
+	}
+	if m.totalLatency > 0 {
+		snapshot.RowsPerSecond = float64(m.rows) / m.totalLatency.Seconds()
+	}
+	return snapshot
+}
+
+// Reset clears the recorded metrics.
+func (m *InsertMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.batches, m.rows, m.totalLatency, m.lastSize, m.lastLatency = 0, 0, 0, 0, 0
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertMetricsRecord(t *testing.T) {
+	m := &InsertMetrics{}
+	assert.Equal(t, InsertSnapshot{}, m.Snapshot())
+
+	m.Record(1000, 200*time.Millisecond)
+	m.Record(500, 50*time.Millisecond)
+
+	snapshot := m.Snapshot()
+	assert.Equal(t, int64(2), snapshot.Batches)
+	assert.Equal(t, int64(1500), snapshot.Rows)
+	assert.Equal(t, 750.0, snapshot.AvgBatchSize)
+	assert.Equal(t, 125.0, snapshot.AvgBatchLatencyMs)
+	assert.Equal(t, 500, snapshot.LastBatchSize)
+	assert.Equal(t, 50.0, snapshot.LastBatchLatencyMs)
+	assert.Equal(t, 6000.0, snapshot.RowsPerSecond)
+
+	m.Reset()
+	assert.Equal(t, InsertSnapshot{}, m.Snapshot())
+}
+
+func TestTunerObserve(t *testing.T) {
+	tuner := NewTuner(1000, 100, 2000)
+	assert.Equal(t, 1000, tuner.Size())
+
+	// The first full batch has nothing to compare with, so the tuner tries larger chunks
+	assert.Equal(t, 1250, tuner.Observe(1000, 100*time.Millisecond))
+	// Throughput improved (12500 > 10000 rows/s): keep growing
+	assert.Equal(t, 1563, tuner.Observe(1250, 100*time.Millisecond))
+	// Throughput dropped: reverse and shrink
+	assert.Equal(t, 1250, tuner.Observe(1563, 200*time.Millisecond))
+
+	// Partial batches and unmeasurable ones leave the size alone
+	assert.Equal(t, 1250, tuner.Observe(10, time.Millisecond))
+	assert.Equal(t, 1250, tuner.Observe(1250, 0))
+
+	// The size never leaves the bounds, and hitting one turns the tuner around
+	bounded := NewTuner(5000, 100, 2000)
+	assert.Equal(t, 2000, bounded.Size())
+	assert.Equal(t, 2000, bounded.Observe(2000, 100*time.Millisecond))
+	assert.Equal(t, 1600, bounded.Observe(2000, 100*time.Millisecond))
+}
+
+// TestTunerConverges feeds the tuner synthetic latencies with a fixed per-statement overhead and a
+// cost growing with the square of the batch size, whose throughput peaks at about 707 rows.
+func TestTunerConverges(t *testing.T) {
+	latency := func(rows int) time.Duration {
+		n := float64(rows)
+		return time.Duration((50 + 0.1*n + 0.0001*n*n) * float64(time.Millisecond))
+	}
+
+	for _, start := range []int{100, 4000} {
+		tuner := NewTuner(start, 50, 4000)
+		for i := 0; i < 50; i++ {
+			size := tuner.Size()
+			tuner.Observe(size, latency(size))
+		}
+		for i := 0; i < 10; i++ {
+			size := tuner.Size()
+			assert.True(t, size >= 400 && size <= 1200, "starting at %d the tuner settled on %d", start, size)
+			tuner.Observe(size, latency(size))
+		}
+	}
+}
+
+// TestTunerCap checks that a cap shrinks the chunk size and stops it growing past the cap, and that
+// removing it lets the tuner grow back up to its max.
+func TestTunerCap(t *testing.T) {
+	tuner := NewTuner(4000, 100, 4000)
+	tuner.Cap(3276)
+	assert.Equal(t, 3276, tuner.Size())
+	for i := 0; i < 5; i++ {
+		tuner.Observe(tuner.Size(), 100*time.Millisecond)
+		assert.LessOrEqual(t, tuner.Size(), 3276)
+	}
+
+	// Chunks of any size taking the same time, larger chunks always have the better throughput
+	tuner.Cap(0)
+	for i := 0; i < 20 && tuner.Size() < 4000; i++ {
+		tuner.Observe(tuner.Size(), 100*time.Millisecond)
+	}
+	assert.Equal(t, 4000, tuner.Size())
+}
+
+func TestHTTPMetricsWritePrometheus(t *testing.T) {
+	m := NewHTTPMetrics()
+	m.ObserveRequest("POST", 200, 30*time.Millisecond)
+	m.ObserveRequest("GET", 404, 2*time.Millisecond)
+	m.ObserveRequest("GET", 200, 20*time.Second)
+	m.ObserveRequest("POST", 200, 70*time.Millisecond)
+	m.AddLogs(25)
+
+	var out strings.Builder
+	assert.NoError(t, m.WritePrometheus(&out))
+	assert.Equal(t, `# HELP http_requests_total Requests answered by the parser, by method and status.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",status="200"} 1
+http_requests_total{method="GET",status="404"} 1
+http_requests_total{method="POST",status="200"} 2
+# HELP http_request_duration_seconds Time taken to answer requests.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.005"} 1
+http_request_duration_seconds_bucket{le="0.01"} 1
+http_request_duration_seconds_bucket{le="0.025"} 1
+http_request_duration_seconds_bucket{le="0.05"} 2
+http_request_duration_seconds_bucket{le="0.1"} 3
+http_request_duration_seconds_bucket{le="0.25"} 3
+http_request_duration_seconds_bucket{le="0.5"} 3
+http_request_duration_seconds_bucket{le="1"} 3
+http_request_duration_seconds_bucket{le="2.5"} 3
+http_request_duration_seconds_bucket{le="5"} 3
+http_request_duration_seconds_bucket{le="10"} 3
+http_request_duration_seconds_bucket{le="+Inf"} 4
+http_request_duration_seconds_sum 20.102
+http_request_duration_seconds_count 4
+# HELP log_adds_total Logs stored by POST /logs.
+# TYPE log_adds_total counter
+log_adds_total 25
+`, out.String())
+
+	m.Reset()
+	out.Reset()
+	assert.NoError(t, m.WritePrometheus(&out))
+	assert.Contains(t, out.String(), "http_request_duration_seconds_count 0\n")
+	assert.NotContains(t, out.String(), "http_requests_total{")
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// TUNER_STEP is the factor the tuner grows or shrinks the chunk size by after each full batch.
+const TUNER_STEP float64 = 1.25
+
+// Tuner adjusts the insert chunk size within [Min, Max] to maximize throughput. It hill-climbs:
+// after each full batch it compares the batch's rows per second with the previous batch's and keeps
+// moving the size in the same direction while throughput improves, reversing when it drops or a
+// bound is reached. It is safe for concurrent use.
+type Tuner struct {
+	mu             sync.Mutex
+	min, max       int
+	limit          int // Cap set by Cap, 0 for none.
+	size           int
+	growing        bool
+	lastThroughput float64
+}
+
+// NewTuner creates a tuner starting at initial, clamped to [min, max], that first tries larger chunks.
+func NewTuner(initial, min, max int) *Tuner {
+	t := &Tuner{min: min, max: max, growing: true}
+	t.size = t.clamp(initial)
+	return t
+}
+
+// Size returns the chunk size to use for the next batch.
+func (t *Tuner) Size() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.size
+}
+
+// Observe feeds the tuner the outcome of a batch and returns the chunk size for the next one.
+// Batches smaller than the current size, such as the tail of a request, say little about the
+// current size and are ignored, as are batches with no measurable latency.
+func (t *Tuner) Observe(rows int, latency time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if rows < t.size || latency <= 0 {
+		return t.size
+	}
+
+	throughput := float64(rows) / latency.Seconds()
+	if t.lastThroughput > 0 && throughput < t.lastThroughput {
+		t.growing = !t.growing
+	}
+	t.lastThroughput = throughput
+
+	next := t.size
+	if t.growing {
+		next = int(float64(t.size)*TUNER_STEP + 0.5)
+	} else {
+		next = int(float64(t.size)/TUNER_STEP + 0.5)
+	}
+	next = t.clamp(next)
+	// At a bound there is nothing further to explore in this direction
+	if next == t.size {
+		t.growing = !t.growing
+	}
+	t.size = next
+	return t.size
+}
+
+func (t *Tuner) clamp(size int) int {
+	if size < t.min {
+		size = t.min
+	}
+	if size > t.max {
+		size = t.max
+	}
+	// The cap is a hard limit, it wins over min
+	if t.limit > 0 && size > t.limit {
+		size = t.limit
+	}
+	return size
+}
+
+// Cap limits the chunk size to limit, below Max, shrinking the current size if needed. A later call
+// replaces the cap, so a cap raised again lets the tuner grow back up to Max; 0 removes it.
+func (t *Tuner) Cap(limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.limit = limit
+	t.size = t.clamp(t.size)
+}
@@ -0,0 +1,85 @@
+// Package middleware provides HTTP handler wrappers shared by the parser's routes,
+// such as the token check guarding the /admin endpoints, the tenant scoping of log and stats requests
+// and the coalescing of identical reads.
+package middleware
+
+import (
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RequireAdmin wraps an admin handler so it only runs for requests carrying the configured
+// admin token as "Authorization: Bearer <token>". While no token is configured the
+// endpoint is disabled and every request is rejected with 403.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := utils.ConfigData.AdminToken
+		if token == "" {
+			models.SendResponse(w, http.StatusForbidden, false, "Admin endpoints are disabled, set "+utils.KEY_ADMIN_TOKEN+" to enable them", nil)
+			return
+		}
+
+		// A bare token is not accepted, only the Bearer scheme carries it
+		provided, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !bearer || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			logger.LogWarn(fmt.Sprintf("Rejected unauthorized admin request to %s from %s", r.URL.Path, r.RemoteAddr))
+			models.SendResponse(w, http.StatusUnauthorized, false, "Unauthorized", nil)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// RequireAPIKey wraps a handler that modifies logs so that its POST, PUT, PATCH and DELETE requests
+// only run when they carry the configured API key in the X-API-Key header; others are rejected with
+// 401. Reads go straight to the handler. While no key is configured the writes are rejected too,
+// unless PARSER_ALLOW_ANONYMOUS_WRITES opens them. A known tenant key is accepted in place of the
+// API key, RequireTenant scoping the request to that tenant.
+func RequireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := utils.ConfigData.APIKey
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+			(key == "" && utils.ConfigData.AllowAnonymousWrites) {
+			next(w, r)
+			return
+		}
+
+		provided := r.Header.Get(utils.API_KEY_HEADER)
+		validKey := key != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1
+		_, tenantKey := utils.TenantForKey(r.Header.Get(utils.ConfigData.TenantHeader))
+		if !validKey && !tenantKey {
+			logger.LogWarn(fmt.Sprintf("Rejected %s request to %s without a valid API key from %s", r.Method, r.URL.Path, r.RemoteAddr))
+			models.SendResponse(w, http.StatusUnauthorized, false, "Unauthorized, a valid API key is required in "+utils.API_KEY_HEADER, nil)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// RequireTenant scopes a log or stats request to the tenant of the API key it carries in the
+// configured tenant header, for the queries behind it to filter on. Requests without a known key are
+// rejected with 401. While no tenants are configured every request goes straight to the handler.
+func RequireTenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !utils.Multitenant() {
+			next(w, r)
+			return
+		}
+
+		tenant, ok := utils.TenantForKey(r.Header.Get(utils.ConfigData.TenantHeader))
+		if !ok {
+			logger.LogWarn(fmt.Sprintf("Rejected request to %s without a valid tenant API key from %s", r.URL.Path, r.RemoteAddr))
+			models.SendResponse(w, http.StatusUnauthorized, false, "Unauthorized, a valid API key is required in "+utils.ConfigData.TenantHeader, nil)
+			return
+		}
+
+		next(w, r.WithContext(utils.WithTenant(r.Context(), tenant)))
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"LogParser/utils"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached response along with the write version it was computed at.
+type cacheEntry struct {
+	version uint64
+	expires time.Time
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]*cacheEntry)
+)
+
+// Cache wraps a read-only aggregation handler so its successful GET responses are cached, keyed by
+// tenant, path and query parameters, for up to PARSER_STATS_CACHE_TTL seconds. An entry is only served while
+// the write version it was computed at is current: any insert or delete of logs bumps the version,
+// so a cached aggregate is never served after a write. Every request goes straight to the handler
+// while the TTL is 0.
+func Cache(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ttl := time.Duration(utils.ConfigData.StatsCacheTTL) * time.Second
+		if r.Method != http.MethodGet || ttl <= 0 {
+			next(w, r)
+			return
+		}
+
+		key := requestKey(r)
+		now := time.Now()
+		// Read before computing, so a write that lands while the handler runs makes the entry stale
+		version := utils.WriteVersion()
+
+		cacheMu.Lock()
+		entry, ok := cache[key]
+		cacheMu.Unlock()
+		if ok && entry.version == version && now.Before(entry.expires) {
+			entry.replay(w)
+			return
+		}
+
+		rec := &recorder{status: http.StatusOK, header: http.Header{}}
+		next(rec, r)
+		entry = &cacheEntry{version: version, expires: now.Add(ttl), status: rec.status, header: rec.header, body: rec.body.Bytes()}
+		if entry.status == http.StatusOK {
+			cacheMu.Lock()
+			if len(cache) >= utils.STATS_CACHE_MAX_ENTRIES {
+				cache = make(map[string]*cacheEntry)
+			}
+			cache[key] = entry
+			cacheMu.Unlock()
+		}
+		entry.replay(w)
+	}
+}
+
+// ResetCache drops every cached response.
+func ResetCache() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	cache = make(map[string]*cacheEntry)
+}
+
+// replay writes the cached response to w.
+func (e *cacheEntry) replay(w http.ResponseWriter) {
+	for name, values := range e.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"LogParser/utils"
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+// flight is one in-progress execution of a coalesced request. Its response is recorded
+// so every request that joined the flight can be answered with a copy.
+type flight struct {
+	done    chan struct{}
+	waiters int // Requests waiting on done besides the one executing the handler
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+var (
+	flightsMu sync.Mutex
+	flights   = make(map[string]*flight)
+)
+
+// recorder buffers a handler's response so it can be replayed to several clients.
+type recorder struct {
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header         { return rec.header }
+func (rec *recorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+func (rec *recorder) WriteHeader(status int)      { rec.status = status }
+
+// requestKey identifies the response of a read-only GET request: its path and query parameters, and the
+// tenant it is scoped to, so tenants never share a response.
+func requestKey(r *http.Request) string {
+	key := r.URL.Path + "?" + r.URL.Query().Encode()
+	if tenant := utils.TenantFromContext(r.Context()); tenant != "" {
+		key = tenant + " " + key
+	}
+	return key
+}
+
+// Coalesce wraps a read-only handler so that concurrent identical GET requests (same tenant, path and
+// query parameters) share a single execution: the first request runs the handler and the others
+// wait for it and receive a copy of its response. Other methods, and every request while
+// PARSER_COALESCE_REQUESTS is disabled, go straight to the handler.
+func Coalesce(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !utils.ConfigData.CoalesceRequests {
+			next(w, r)
+			return
+		}
+
+		// Encode sorts the parameters, so their order in the URL doesn't split flights
+		key := requestKey(r)
+
+		flightsMu.Lock()
+		if f, ok := flights[key]; ok {
+			f.waiters++
+			flightsMu.Unlock()
+			select {
+			case <-f.done:
+				f.replay(w)
+			case <-r.Context().Done():
+			}
+			return
+		}
+		// Until the handler returns the flight answers 500, which is what joined requests
+		// get should the handler panic
+		f := &flight{done: make(chan struct{}), status: http.StatusInternalServerError, header: http.Header{}}
+		flights[key] = f
+		flightsMu.Unlock()
+
+		defer func() {
+			flightsMu.Lock()
+			delete(flights, key)
+			flightsMu.Unlock()
+			close(f.done)
+		}()
+
+		rec := &recorder{status: http.StatusOK, header: http.Header{}}
+		next(rec, r)
+		f.status, f.header, f.body = rec.status, rec.header, rec.body.Bytes()
+		f.replay(w)
+	}
+}
+
+// replay writes the recorded response of the flight to w.
+func (f *flight) replay(w http.ResponseWriter) {
+	for name, values := range f.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(f.status)
+	w.Write(f.body)
+}
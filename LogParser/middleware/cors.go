@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORS_MAX_AGE is how long, in seconds, browsers may cache the answer to a preflight request.
+const CORS_MAX_AGE string = "600"
+
+// CORS wraps a read endpoint so that browser dashboards served from allowedOrigins can call it: requests
+// from an allowed origin get Access-Control-Allow-Origin, and their OPTIONS preflight is answered with
+// 204 and the methods and headers they may use, before any other check. Requests from another origin are
+// rejected with 403. Requests without an Origin header, which do not come from a browser, and every
+// request while no origins are allowed, go straight to the handler. An origin of "*" allows any origin.
+func CORS(next http.HandlerFunc, allowedOrigins []string) http.HandlerFunc {
+	anyOrigin := slices.Contains(allowedOrigins, "*")
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(allowedOrigins) == 0 || origin == "" {
+			next(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !anyOrigin && !slices.Contains(allowedOrigins, origin) {
+			logger.LogWarn(fmt.Sprintf("Rejected %s request to %s from disallowed origin %s", r.Method, r.URL.Path, origin))
+			models.SendResponse(w, http.StatusForbidden, false, fmt.Sprintf("Origin '%s' is not allowed", origin), nil)
+			return
+		}
+
+		if anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		// Scripts can read the request id and the pagination links of the response
+		exposed := []string{"Link"}
+		if header := utils.ConfigData.RequestIDHeader; header != "" {
+			exposed = append(exposed, header)
+		}
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			headers := []string{"Content-Type"}
+			if utils.ConfigData.TenantHeader != "" {
+				headers = append(headers, utils.ConfigData.TenantHeader)
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			w.Header().Set("Access-Control-Max-Age", CORS_MAX_AGE)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"LogParser/metrics"
+	"net/http"
+	"time"
+)
+
+// Metrics wraps the server's handler so that every request is counted in metrics.HTTP by method and
+// the status it was answered with, and its duration observed.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		metrics.HTTP.ObserveRequest(r.Method, sw.status, time.Since(started))
+	})
+}
@@ -0,0 +1,620 @@
+package middleware
+
+import (
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	logger.InitLogger("error")
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRequireAdmin(t *testing.T) {
+	defer func(token string) { utils.ConfigData.AdminToken = token }(utils.ConfigData.AdminToken)
+	utils.ConfigData.AdminToken = "s3cret"
+	handler := RequireAdmin(okHandler)
+
+	tests := []struct {
+		name   string
+		header string
+		code   int
+	}{
+		{"valid token", "Bearer s3cret", http.StatusOK},
+		{"wrong token", "Bearer nope", http.StatusUnauthorized},
+		{"missing header", "", http.StatusUnauthorized},
+		{"token without scheme", "s3cret", http.StatusUnauthorized},
+		{"other scheme", "Basic s3cret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/reenrich", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			assert.Equal(t, tt.code, rr.Code)
+		})
+	}
+}
+
+func TestRequireAdmin_DisabledWithoutToken(t *testing.T) {
+	defer func(token string) { utils.ConfigData.AdminToken = token }(utils.ConfigData.AdminToken)
+	utils.ConfigData.AdminToken = ""
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/reenrich", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rr := httptest.NewRecorder()
+	RequireAdmin(okHandler)(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	defer func(key string, tenants map[string]string, header string) {
+		utils.ConfigData.APIKey, utils.ConfigData.Tenants, utils.ConfigData.TenantHeader = key, tenants, header
+	}(utils.ConfigData.APIKey, utils.ConfigData.Tenants, utils.ConfigData.TenantHeader)
+	utils.ConfigData.APIKey = "s3cret"
+	utils.ConfigData.TenantHeader = "X-API-Key"
+	utils.ConfigData.Tenants = nil
+	handler := RequireAPIKey(okHandler)
+
+	tests := []struct {
+		name   string
+		method string
+		key    string
+		code   int
+	}{
+		{"correct key", http.MethodDelete, "s3cret", http.StatusOK},
+		{"wrong key", http.MethodDelete, "nope", http.StatusUnauthorized},
+		{"missing key", http.MethodPost, "", http.StatusUnauthorized},
+		{"read without key", http.MethodGet, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/logs", nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+			assert.Equal(t, tt.code, rr.Code)
+		})
+	}
+
+	// A tenant key stands in for the API key
+	utils.ConfigData.Tenants = map[string]string{"key-a": "tenant-a"}
+	req := httptest.NewRequest(http.MethodPost, "/logs", nil)
+	req.Header.Set("X-API-Key", "key-a")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Without a configured key writes are denied, unless explicitly opened; reads and tenant keys pass
+	defer func(allow bool) { utils.ConfigData.AllowAnonymousWrites = allow }(utils.ConfigData.AllowAnonymousWrites)
+	utils.ConfigData.APIKey = ""
+	utils.ConfigData.AllowAnonymousWrites = false
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodDelete, "/logs", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/logs", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	req = httptest.NewRequest(http.MethodPost, "/logs", nil)
+	req.Header.Set("X-API-Key", "key-a")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	utils.ConfigData.AllowAnonymousWrites = true
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodDelete, "/logs", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+// TestRequireTenant checks that requests are scoped to the tenant of their API key, that unknown keys are
+// rejected while tenants are configured, and that without tenants requests pass unscoped.
+func TestRequireTenant(t *testing.T) {
+	defer func(tenants map[string]string, header string) {
+		utils.ConfigData.Tenants, utils.ConfigData.TenantHeader = tenants, header
+	}(utils.ConfigData.Tenants, utils.ConfigData.TenantHeader)
+	utils.ConfigData.TenantHeader = "X-API-Key"
+	utils.ConfigData.Tenants = map[string]string{"key-a": "tenant-a"}
+
+	var scoped string
+	handler := RequireTenant(func(w http.ResponseWriter, r *http.Request) {
+		scoped = utils.TenantFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(key string) int {
+		scoped = ""
+		req := httptest.NewRequest(http.MethodGet, "/logs?tenant_id=tenant-b", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call("key-a"))
+	assert.Equal(t, "tenant-a", scoped)
+	assert.Equal(t, http.StatusUnauthorized, call("key-b"))
+	assert.Equal(t, http.StatusUnauthorized, call(""))
+	assert.Empty(t, scoped)
+
+	utils.ConfigData.Tenants = nil
+	assert.Equal(t, http.StatusOK, call(""))
+	assert.Empty(t, scoped)
+}
+
+// TestCoalesce checks that N concurrent identical requests run the handler once and all get its response.
+func TestCoalesce(t *testing.T) {
+	defer func(enabled bool) { utils.ConfigData.CoalesceRequests = enabled }(utils.ConfigData.CoalesceRequests)
+	utils.ConfigData.CoalesceRequests = true
+
+	const n = 10
+	var executions int32
+	release := make(chan struct{})
+	handler := Coalesce(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&executions, 1)
+		<-release // The expensive query
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":true}`))
+	})
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, n)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		// Same parameters in a different order still coalesce
+		target := "/stats/dashboard?a=1&b=2"
+		if i%2 == 1 {
+			target = "/stats/dashboard?b=2&a=1"
+		}
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder, target string) {
+			defer wg.Done()
+			handler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		}(recorders[i], target)
+	}
+
+	// Hold the first execution until every other request has joined it
+	assert.Eventually(t, func() bool {
+		flightsMu.Lock()
+		defer flightsMu.Unlock()
+		f, ok := flights["/stats/dashboard?a=1&b=2"]
+		return ok && f.waiters == n-1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&executions))
+	for _, rr := range recorders {
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.Equal(t, `{"status":true}`, rr.Body.String())
+	}
+
+	// Once the flight has landed, the next request executes again
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stats/dashboard?a=1&b=2", nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&executions))
+}
+
+func TestCoalesce_PassThrough(t *testing.T) {
+	defer func(enabled bool) { utils.ConfigData.CoalesceRequests = enabled }(utils.ConfigData.CoalesceRequests)
+
+	var executions int32
+	handler := Coalesce(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&executions, 1)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	// Writes are never coalesced
+	utils.ConfigData.CoalesceRequests = true
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/logs", nil))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	// Nor is anything while coalescing is disabled
+	utils.ConfigData.CoalesceRequests = false
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/logs", nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&executions))
+	assert.Empty(t, flights)
+}
+
+func TestPretty(t *testing.T) {
+	handler := Pretty(Coalesce(func(w http.ResponseWriter, r *http.Request) {
+		models.SendResponse(w, http.StatusCreated, true, "ok", map[string]int{"count": 2})
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/logs/count?pretty=true", nil))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "{\n  \"status\": true,\n  \"message\": \"ok\",\n  \"data\": {\n    \"count\": 2\n  }\n}\n", rr.Body.String())
+
+	// Compact by default, and for anything but a true value
+	for _, url := range []string{"/logs/count", "/logs/count?pretty=false", "/logs/count?pretty=yes"} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, "{\"status\":true,\"message\":\"ok\",\"data\":{\"count\":2}}\n", rr.Body.String(), url)
+	}
+
+	// Responses that aren't JSON are left alone
+	plain := Pretty(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("a,b\n1,2\n"))
+	}))
+	rr = httptest.NewRecorder()
+	plain.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/logs?format=csv&pretty=true", nil))
+	assert.Equal(t, "a,b\n1,2\n", rr.Body.String())
+
+	// Streamed responses reach the client as they are flushed, not once complete
+	flushed := make(chan string, 1)
+	stream := Pretty(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"id\":1}\n"))
+		http.NewResponseController(w).Flush()
+		flushed <- rr.Body.String()
+		w.Write([]byte("{\"id\":2}\n"))
+	}))
+	rr = httptest.NewRecorder()
+	stream.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/logs/export?pretty=true", nil))
+	assert.Equal(t, "{\"id\":1}\n", <-flushed)
+	assert.True(t, rr.Flushed)
+	assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n", rr.Body.String())
+}
+
+func TestCache(t *testing.T) {
+	defer func(ttl int) { utils.ConfigData.StatsCacheTTL = ttl }(utils.ConfigData.StatsCacheTTL)
+	utils.ConfigData.StatsCacheTTL = 60
+	ResetCache()
+	defer ResetCache()
+
+	var calls int32
+	status := http.StatusOK
+	handler := Cache(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		models.SendResponse(w, status, true, "computed", n)
+	})
+	get := func(url string) string {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		return rr.Body.String()
+	}
+
+	// The aggregate is computed once and served from the cache until a write
+	first := get("/stats/status")
+	assert.Equal(t, first, get("/stats/status"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Other parameters are cached separately
+	get("/stats/status?limit=5")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// A write bumps the version and the next read recomputes
+	utils.BumpWriteVersion()
+	assert.NotEqual(t, first, get("/stats/status"))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	get("/stats/status")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// Failed responses are not cached
+	status = http.StatusInternalServerError
+	get("/stats/ip")
+	get("/stats/ip")
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+
+	// Tenants never share an entry
+	status = http.StatusOK
+	req := httptest.NewRequest(http.MethodGet, "/stats/status", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req.WithContext(utils.WithTenant(req.Context(), "tenant-a")))
+	assert.NotEqual(t, first, rr.Body.String())
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+
+	// Disabled, every request reaches the handler
+	status = http.StatusOK
+	utils.ConfigData.StatsCacheTTL = 0
+	get("/stats/status")
+	assert.Equal(t, int32(7), atomic.LoadInt32(&calls))
+}
+
+// TestRequestID checks that success and error responses both carry the request id, that a client's
+// id is echoed back and that a missing or malformed one is replaced by a generated id.
+func TestRequestID(t *testing.T) {
+	defer func(header string) { utils.ConfigData.RequestIDHeader = header }(utils.ConfigData.RequestIDHeader)
+	utils.ConfigData.RequestIDHeader = utils.PARSER_REQUEST_ID_HEADER
+
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+		if r.URL.Path == "/fail" {
+			models.SendResponse(w, http.StatusInternalServerError, false, "Failed to query database", nil)
+			return
+		}
+		models.SendResponse(w, http.StatusOK, true, "Fetched logs successfully", nil)
+	}))
+
+	serve := func(path string, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("/logs", "client-42")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "client-42", rr.Header().Get("X-Request-ID"))
+	assert.Equal(t, "client-42", seen)
+
+	rr = serve("/fail", "client-43")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, "client-43", rr.Header().Get("X-Request-ID"))
+
+	rr = serve("/fail", "")
+	generated := rr.Header().Get("X-Request-ID")
+	assert.Regexp(t, `^[0-9a-f]{32}$`, generated)
+	assert.Equal(t, generated, seen)
+	assert.NotEqual(t, generated, serve("/logs", "").Header().Get("X-Request-ID"))
+
+	rr = serve("/logs", "has spaces\tand tabs")
+	assert.Regexp(t, `^[0-9a-f]{32}$`, rr.Header().Get("X-Request-ID"))
+
+	utils.ConfigData.RequestIDHeader = ""
+	rr = serve("/logs", "client-44")
+	assert.Empty(t, rr.Header().Get("X-Request-ID"))
+	assert.Empty(t, seen)
+}
+
+// TestRequestID_LogFields checks that a 5xx response is logged, in the JSON format, with the id,
+// method, path and status of its request as fields.
+func TestRequestID_LogFields(t *testing.T) {
+	defer func(header string) { utils.ConfigData.RequestIDHeader = header }(utils.ConfigData.RequestIDHeader)
+	utils.ConfigData.RequestIDHeader = utils.PARSER_REQUEST_ID_HEADER
+
+	var logs bytes.Buffer
+	logger.InitLogger("error")
+	logger.Log.SetOutput(&logs)
+	logger.SetFormat(logger.FORMAT_JSON)
+	defer logger.InitLogger("error")
+
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, map[string]interface{}{"method": "DELETE", "path": "/logs", "request_id": "client-42"}, RequestFields(r))
+		models.SendResponse(w, http.StatusInternalServerError, false, "Failed to delete logs", nil)
+	}))
+	req := httptest.NewRequest(http.MethodDelete, "/logs?status=500", nil)
+	req.Header.Set("X-Request-ID", "client-42")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "client-42", entry["request_id"])
+	assert.Equal(t, "DELETE", entry["method"])
+	assert.Equal(t, "/logs", entry["path"])
+	assert.Equal(t, float64(http.StatusInternalServerError), entry["status"])
+}
+
+func TestRequestID_Flush(t *testing.T) {
+	defer func(header string) { utils.ConfigData.RequestIDHeader = header }(utils.ConfigData.RequestIDHeader)
+	utils.ConfigData.RequestIDHeader = utils.PARSER_REQUEST_ID_HEADER
+
+	var flushErr error
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}\n"))
+		flushErr = http.NewResponseController(w).Flush()
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/logs/export", nil))
+	assert.NoError(t, flushErr)
+	assert.True(t, rr.Flushed)
+}
+
+// TestRateLimit checks that a client bursting beyond the limit gets 429 with Retry-After, without
+// affecting other clients, and is served again once its bucket has refilled.
+func TestRateLimit(t *testing.T) {
+	defer func(rate float64, burst int, trust bool) {
+		utils.ConfigData.RateLimit, utils.ConfigData.RateLimitBurst, utils.ConfigData.RateLimitTrustProxy = rate, burst, trust
+	}(utils.ConfigData.RateLimit, utils.ConfigData.RateLimitBurst, utils.ConfigData.RateLimitTrustProxy)
+	utils.ConfigData.RateLimit = 10
+	utils.ConfigData.RateLimitBurst = 3
+	utils.ConfigData.RateLimitTrustProxy = false
+	rateMu.Lock()
+	rateBuckets = make(map[string]*rateBucket)
+	rateMu.Unlock()
+	handler := RateLimit(http.HandlerFunc(okHandler))
+
+	call := func(addr, forwarded string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/logs", nil)
+		req.RemoteAddr = addr
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, call("192.0.2.1:1000", "").Code, "request %d is within the burst", i)
+	}
+	rr := call("192.0.2.1:1001", "")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, call("192.0.2.2:1000", "").Code, "other clients keep their own bucket")
+
+	// One token is back after 1/rate seconds
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, call("192.0.2.1:1000", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, call("192.0.2.1:1000", "").Code)
+
+	// Behind a trusted proxy the address it appended to X-Forwarded-For is limited, not the proxy's nor
+	// those sent by the client, which it could rotate to escape the limit
+	utils.ConfigData.RateLimitTrustProxy = true
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, call("192.0.2.1:1000", fmt.Sprintf("10.0.0.%d, 198.51.100.7", i)).Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, call("192.0.2.1:1000", "10.0.0.9, 198.51.100.7").Code)
+	assert.Equal(t, http.StatusTooManyRequests, call("192.0.2.1:1000", "198.51.100.7").Code)
+
+	utils.ConfigData.RateLimit = 0
+	assert.Equal(t, http.StatusOK, call("192.0.2.1:1000", "198.51.100.7").Code)
+}
+
+// TestRateLimit_SpoofedForwardedFor checks that behind a trusted proxy the addresses a client puts in
+// front of X-Forwarded-For, in the same header or one of its own, get no bucket of their own.
+func TestRateLimit_SpoofedForwardedFor(t *testing.T) {
+	defer func(rate float64, burst int, trust bool) {
+		utils.ConfigData.RateLimit, utils.ConfigData.RateLimitBurst, utils.ConfigData.RateLimitTrustProxy = rate, burst, trust
+	}(utils.ConfigData.RateLimit, utils.ConfigData.RateLimitBurst, utils.ConfigData.RateLimitTrustProxy)
+	utils.ConfigData.RateLimit = 0.001
+	utils.ConfigData.RateLimitBurst = 1
+	utils.ConfigData.RateLimitTrustProxy = true
+	rateMu.Lock()
+	rateBuckets = make(map[string]*rateBucket)
+	rateMu.Unlock()
+	handler := RateLimit(http.HandlerFunc(okHandler))
+
+	call := func(forwarded ...string) int {
+		req := httptest.NewRequest(http.MethodGet, "/logs", nil)
+		req.RemoteAddr = "192.0.2.1:1000"
+		for _, value := range forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call("10.0.0.1, 198.51.100.7"))
+	assert.Equal(t, http.StatusTooManyRequests, call("10.0.0.2, 198.51.100.7"))
+	assert.Equal(t, http.StatusTooManyRequests, call("10.0.0.3", "198.51.100.7"))
+
+	rateMu.Lock()
+	defer rateMu.Unlock()
+	assert.Len(t, rateBuckets, 1)
+	assert.Contains(t, rateBuckets, "198.51.100.7")
+}
+
+// TestRateLimit_Eviction checks that a full table of limited clients evicts the least recently seen
+// ones, keeping the buckets of the clients limited most recently.
+func TestRateLimit_Eviction(t *testing.T) {
+	rateMu.Lock()
+	rateBuckets = make(map[string]*rateBucket)
+	rateMu.Unlock()
+	defer func() {
+		rateMu.Lock()
+		rateBuckets = make(map[string]*rateBucket)
+		rateMu.Unlock()
+	}()
+
+	start := time.Now()
+	// A burst of 1 at a slow rate: every client is limited after its first request
+	for i := 0; i < utils.RATE_LIMIT_MAX_CLIENTS; i++ {
+		takeToken(fmt.Sprintf("client-%d", i), 0.001, 1, start.Add(time.Duration(i)*time.Millisecond))
+	}
+	now := start.Add(time.Duration(utils.RATE_LIMIT_MAX_CLIENTS) * time.Millisecond)
+	assert.Zero(t, takeToken("newcomer", 0.001, 1, now))
+
+	rateMu.Lock()
+	assert.Len(t, rateBuckets, utils.RATE_LIMIT_EVICT_TO+1)
+	_, oldest := rateBuckets["client-0"]
+	rateMu.Unlock()
+	assert.False(t, oldest)
+	assert.Greater(t, takeToken(fmt.Sprintf("client-%d", utils.RATE_LIMIT_MAX_CLIENTS-1), 0.001, 1, now), time.Duration(0),
+		"the most recent clients are still limited")
+}
+
+func TestCORS(t *testing.T) {
+	defer func(header, tenantHeader string) {
+		utils.ConfigData.RequestIDHeader, utils.ConfigData.TenantHeader = header, tenantHeader
+	}(utils.ConfigData.RequestIDHeader, utils.ConfigData.TenantHeader)
+	utils.ConfigData.RequestIDHeader = "X-Request-ID"
+	utils.ConfigData.TenantHeader = "X-API-Key"
+	called := 0
+	handler := CORS(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		okHandler(w, r)
+	}, []string{"https://dashboard.example.com"})
+
+	call := func(method, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/stats/status", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	// The preflight is answered without reaching the handler
+	rr := call(http.MethodOptions, "https://dashboard.example.com", true)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://dashboard.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-API-Key", rr.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, CORS_MAX_AGE, rr.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+	assert.Equal(t, 0, called)
+
+	rr = call(http.MethodGet, "https://dashboard.example.com", false)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "https://dashboard.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Link, X-Request-ID", rr.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, 1, called)
+
+	// A disallowed origin is rejected, preflight or not
+	for _, method := range []string{http.MethodOptions, http.MethodGet} {
+		rr = call(method, "https://evil.example.com", method == http.MethodOptions)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+	assert.Equal(t, 1, called)
+
+	// Requests without an Origin header do not come from a browser
+	rr = call(http.MethodGet, "", false)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, 2, called)
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ml/insights", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	rr := httptest.NewRecorder()
+	CORS(okHandler, []string{"*"})(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	// No origins configured, no CORS headers
+	rr = httptest.NewRecorder()
+	CORS(okHandler, nil)(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+}
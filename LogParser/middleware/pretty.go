@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PRETTY_INDENT is the indentation of JSON responses requested with pretty=true.
+const PRETTY_INDENT string = "  "
+
+// Pretty wraps the server's handler so that requests with pretty=true get their JSON responses
+// indented, for reading them with curl. A JSON response is buffered and re-indented as a whole, so
+// it also covers handlers behind Coalesce; responses that are not JSON, such as the streamed exports,
+// and every request without the parameter, are passed through unchanged as they are written.
+func Pretty(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); !pretty {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pw := &prettyWriter{ResponseWriter: w}
+		next.ServeHTTP(pw, r)
+		if !pw.buffered {
+			return
+		}
+
+		body := pw.body.Bytes()
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", PRETTY_INDENT); err == nil {
+			body = indented.Bytes()
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(pw.status)
+		w.Write(body)
+	})
+}
+
+// prettyWriter buffers the response written through it when its Content-Type is JSON, decided when
+// the header is written, and passes any other response through.
+type prettyWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffered    bool
+	body        bytes.Buffer
+}
+
+func (pw *prettyWriter) WriteHeader(status int) {
+	if pw.wroteHeader {
+		return
+	}
+	pw.wroteHeader = true
+	pw.status = status
+	pw.buffered = strings.HasPrefix(pw.Header().Get("Content-Type"), "application/json")
+	if !pw.buffered {
+		pw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (pw *prettyWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if pw.buffered {
+		return pw.body.Write(b)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+// Flush sends what a passed through response wrote so far; a buffered one is sent whole once complete.
+func (pw *prettyWriter) Flush() {
+	if !pw.buffered {
+		http.NewResponseController(pw.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController.
+func (pw *prettyWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
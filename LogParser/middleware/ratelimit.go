@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"LogParser/logger"
+	"LogParser/models"
+	"LogParser/utils"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateBucket is the token bucket of one client: the tokens it had left when last seen.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var (
+	rateMu      sync.Mutex
+	rateBuckets = make(map[string]*rateBucket)
+)
+
+// RateLimit wraps the server's handler so that each client, identified by its address, gets a token
+// bucket refilled at PARSER_RATE_LIMIT requests per second and holding up to PARSER_RATE_LIMIT_BURST.
+// A request finding the bucket empty is rejected with 429 and a Retry-After header giving the seconds
+// until the next token. With PARSER_RATE_LIMIT_TRUST_PROXY the client is the last address of
+// X-Forwarded-For instead, the one the proxy in front of the parser appended. Every request goes
+// straight to the handler while the rate is 0.
+func RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate := utils.ConfigData.RateLimit
+		if rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		burst := float64(utils.ConfigData.RateLimitBurst)
+		if burst < 1 {
+			burst = math.Max(1, math.Ceil(rate))
+		}
+
+		client := clientAddr(r)
+		if wait := takeToken(client, rate, burst, time.Now()); wait > 0 {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			logger.LogWarn(fmt.Sprintf("Rate limited %s request to %s from %s", r.Method, r.URL.Path, client))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			models.SendResponse(w, http.StatusTooManyRequests, false, fmt.Sprintf("Too many requests, retry after %ds", retryAfter), nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// takeToken takes a token from the bucket of client at now and returns 0, or, when the bucket is
+// empty, how long until it holds a token again.
+func takeToken(client string, rate, burst float64, now time.Time) time.Duration {
+	rateMu.Lock()
+	defer rateMu.Unlock()
+
+	bucket, ok := rateBuckets[client]
+	if !ok {
+		if len(rateBuckets) >= utils.RATE_LIMIT_MAX_CLIENTS {
+			pruneBuckets(rate, burst, now)
+		}
+		bucket = &rateBucket{tokens: burst, last: now}
+		rateBuckets[client] = bucket
+	}
+
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return 0
+}
+
+// pruneBuckets drops the buckets refilled to the full burst by now, which are the same as no bucket.
+// When too many clients are still limited, the buckets of the clients seen least recently are dropped
+// until RATE_LIMIT_EVICT_TO remain, so the table stays bounded without freeing the clients limited now.
+func pruneBuckets(rate, burst float64, now time.Time) {
+	for client, bucket := range rateBuckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rate >= burst {
+			delete(rateBuckets, client)
+		}
+	}
+	if len(rateBuckets) < utils.RATE_LIMIT_MAX_CLIENTS {
+		return
+	}
+
+	clients := make([]string, 0, len(rateBuckets))
+	for client := range rateBuckets {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return rateBuckets[clients[i]].last.Before(rateBuckets[clients[j]].last)
+	})
+	for _, client := range clients[:len(clients)-utils.RATE_LIMIT_EVICT_TO] {
+		delete(rateBuckets, client)
+	}
+}
+
+// clientAddr returns the address r is rate limited by: its remote address without the port, or the
+// last address of X-Forwarded-For when the proxy in front of the parser is trusted. The addresses before
+// it are sent by the client, which could pick a new one for every request to escape its limit.
+func clientAddr(r *http.Request) string {
+	if utils.ConfigData.RateLimitTrustProxy {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			addrs := strings.Split(forwarded[len(forwarded)-1], ",")
+			if last := strings.TrimSpace(addrs[len(addrs)-1]); last != "" {
+				return last
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"LogParser/logger"
+	"LogParser/utils"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// requestIDKey is the context key RequestID stores the request's id under.
+type requestIDKey struct{}
+
+// validRequestID matches the request ids accepted from clients; others are replaced by a generated one.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID wraps the server's handler so that every response, success or error, carries the request's
+// id in the header named by PARSER_REQUEST_ID_HEADER. An id sent by the client in that header is reused,
+// so it can be followed across services; otherwise one is generated. Responses with a 5xx status are
+// logged with their id, which lets a reported id be matched to the server logs. The id is also available
+// to handlers through RequestIDFromContext, and every log written with logger.LogContext under the
+// request's context carries it with the method and path. An empty header name disables the middleware.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := utils.ConfigData.RequestIDHeader
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id := r.Header.Get(header)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(header, id)
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+		ctx := logger.ContextWithFields(r.Context(), RequestFields(r))
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		if sw.status >= http.StatusInternalServerError {
+			logger.LogWithFields("error", fmt.Sprintf("Request %s: %s %s answered %d", id, r.Method, r.URL.Path, sw.status),
+				map[string]interface{}{"request_id": id, "method": r.Method, "path": r.URL.Path, "status": sw.status})
+		}
+	})
+}
+
+// RequestIDFromContext returns the id RequestID assigned to the request ctx belongs to, or "" outside of it.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestFields returns the fields logger.LogWithFields logs a message about r with: its method, path
+// and, under RequestID, its id.
+func RequestFields(r *http.Request) map[string]interface{} {
+	fields := map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		fields["request_id"] = id
+	}
+	return fields
+}
+
+// newRequestID returns a random 128-bit id in hex.
+func newRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// statusWriter records the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController, so streaming handlers can still flush.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
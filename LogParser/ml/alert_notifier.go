@@ -0,0 +1,141 @@
+// Package ml - Alert Notifier
+// Posts newly raised ML alerts to a webhook
+package ml
+
+import (
+	"LogParser/logger"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// alertNotifierQueueSize is how many alerts wait for delivery before new ones are dropped
+	alertNotifierQueueSize = 64
+	// alertNotifierAttempts is how many times delivering an alert is tried
+	alertNotifierAttempts = 3
+)
+
+// alertNotifierBackoff is the wait before the first retry of a delivery, doubled for every further one
+var alertNotifierBackoff = 500 * time.Millisecond
+
+// AlertNotifier posts the JSON of every alert of at least its severity to a webhook, once per alert ID.
+// Notify never blocks: alerts are queued and delivered by a background goroutine, which retries failed
+// deliveries with backoff.
+type AlertNotifier struct {
+	url         string
+	minSeverity string
+	client      *http.Client
+	queue       chan Alert
+	done        chan struct{}
+
+	mu   sync.Mutex
+	sent map[string]time.Time // When each alert ID was queued, so it is posted only once
+}
+
+// NewAlertNotifier starts a notifier posting the alerts of at least minSeverity to url.
+func NewAlertNotifier(url, minSeverity string) (*AlertNotifier, error) {
+	if _, ok := alertSeverityRank[minSeverity]; !ok {
+		return nil, fmt.Errorf("invalid alert severity %q, expected low, medium, high or critical", minSeverity)
+	}
+
+	notifier := &AlertNotifier{
+		url:         url,
+		minSeverity: minSeverity,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan Alert, alertNotifierQueueSize),
+		done:        make(chan struct{}),
+		sent:        make(map[string]time.Time),
+	}
+	go notifier.run()
+	return notifier, nil
+}
+
+// Notify queues alert for delivery unless it is resolved, below the notifier's severity or was queued before.
+// When the queue is full the alert is dropped, and posted if it is still raised at a later Notify.
+func (n *AlertNotifier) Notify(alert Alert) {
+	if alert.Resolved || alertSeverityRank[alert.Severity] < alertSeverityRank[n.minSeverity] {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	for id, queued := range n.sent {
+		// Alert IDs change once the dedup window has passed, older ones never come back
+		if now.Sub(queued) > 2*alertDedupWindow {
+			delete(n.sent, id)
+		}
+	}
+	if _, ok := n.sent[alert.ID]; ok {
+		return
+	}
+
+	select {
+	case n.queue <- alert:
+		n.sent[alert.ID] = now
+	default:
+		logger.LogWarn(fmt.Sprintf("Alert webhook queue is full, dropping alert %s", alert.ID))
+	}
+}
+
+// Close stops the notifier once the queued alerts are delivered. Notify must not be called afterwards.
+func (n *AlertNotifier) Close() {
+	close(n.queue)
+	<-n.done
+}
+
+// run delivers the queued alerts until the queue is closed
+func (n *AlertNotifier) run() {
+	defer close(n.done)
+	for alert := range n.queue {
+		if err := n.deliver(alert); err != nil {
+			logger.LogError(fmt.Sprintf("Failed to post alert %s to the webhook: %v", alert.ID, err))
+		}
+	}
+}
+
+// deliver posts alert, retrying network errors and 5xx responses up to alertNotifierAttempts times
+func (n *AlertNotifier) deliver(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	backoff := alertNotifierBackoff
+	for attempt := 1; ; attempt++ {
+		err = n.post(body)
+		if err == nil {
+			return nil
+		}
+		if _, permanent := err.(permanentError); permanent || attempt == alertNotifierAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// permanentError is a delivery failure retrying cannot fix
+type permanentError struct{ error }
+
+// post sends body to the webhook once
+func (n *AlertNotifier) post(body []byte) error {
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return permanentError{fmt.Errorf("webhook responded %s", resp.Status)}
+	}
+	return nil
+}
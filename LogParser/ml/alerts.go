@@ -0,0 +1,202 @@
+// Package ml - Alerts
+// Turns the findings of the ML analyses into alerts and keeps track of them between analyses
+package ml
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	ALERT_TYPE_ANOMALY    = "anomaly"
+	ALERT_TYPE_SECURITY   = "security"
+	ALERT_TYPE_PREDICTION = "prediction"
+
+	// alertThreatConfidence is the confidence from which a security threat raises an alert
+	alertThreatConfidence = 0.8
+	// alertPredictedIncrease is the ratio of the predicted peak to the next hour's prediction
+	// from which a predicted increase raises an alert
+	alertPredictedIncrease = 1.5
+)
+
+// alertDedupWindow is how long an alert absorbs new findings of its type and IP instead of a new
+// alert being raised for them. Resolved alerts are dropped once they are older than it.
+var alertDedupWindow = time.Hour
+
+// alertSeverityRank orders severities, so the most severe finding of a type and IP is kept
+var alertSeverityRank = map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+
+// alertKey identifies the alerts that are deduplicated against each other
+func alertKey(alertType, ip string) string {
+	return alertType + "|" + ip
+}
+
+// alertID derives the ID of an alert from its type, IP and when it was first raised, so an alert keeps
+// its ID across analyses and the same finding always gets the same one
+func alertID(alertType, ip string, raised time.Time) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d", alertType, ip, raised.UnixNano())))
+	return hex.EncodeToString(sum[:8])
+}
+
+// alertsFromInsights converts high and critical anomalies, security threats with a confidence of at
+// least alertThreatConfidence and predicted increases of at least alertPredictedIncrease into alerts,
+// one per type and IP. IDs and timestamps are left for recordAlerts to fill in.
+func alertsFromInsights(insights *MLInsights) []Alert {
+	candidates := map[string]Alert{}
+	keep := func(ip string, alert Alert) {
+		key := alertKey(alert.Type, ip)
+		if current, ok := candidates[key]; ok && alertSeverityRank[current.Severity] >= alertSeverityRank[alert.Severity] {
+			return
+		}
+		candidates[key] = alert
+	}
+
+	for _, anomaly := range insights.Anomalies {
+		if !anomaly.IsAnomaly || alertSeverityRank[anomaly.Severity] < alertSeverityRank["high"] {
+			continue
+		}
+		keep("", Alert{
+			Type:        ALERT_TYPE_ANOMALY,
+			Severity:    anomaly.Severity,
+			Title:       "Traffic anomaly detected",
+			Description: fmt.Sprintf("%.0f requests at %s, anomaly score %.2f", anomaly.Value, anomaly.Timestamp.Format(time.RFC3339), anomaly.AnomalyScore),
+			Data:        anomaly,
+		})
+	}
+
+	for _, threat := range insights.SecurityThreats {
+		if threat.Confidence < alertThreatConfidence {
+			continue
+		}
+		keep(threat.IPAddress, Alert{
+			Type:        ALERT_TYPE_SECURITY,
+			Severity:    threat.Severity,
+			Title:       fmt.Sprintf("Security threat: %s", threat.ThreatType),
+			Description: threat.Description,
+			IPAddress:   threat.IPAddress,
+			Data:        threat,
+		})
+	}
+
+	if len(insights.Predictions) > 1 && insights.Predictions[0].PredictedValue > 0 {
+		base := insights.Predictions[0]
+		peak := base
+		for _, prediction := range insights.Predictions[1:] {
+			if prediction.PredictedValue > peak.PredictedValue {
+				peak = prediction
+			}
+		}
+		if increase := peak.PredictedValue / base.PredictedValue; increase >= alertPredictedIncrease {
+			severity := "medium"
+			if increase >= 2*alertPredictedIncrease {
+				severity = "high"
+			}
+			keep("", Alert{
+				Type:        ALERT_TYPE_PREDICTION,
+				Severity:    severity,
+				Title:       "Sharp traffic increase predicted",
+				Description: fmt.Sprintf("Traffic predicted to grow %.1fx to %.0f requests by %s", increase, peak.PredictedValue, peak.Timestamp.Format(time.RFC3339)),
+				Data:        peak,
+			})
+		}
+	}
+
+	alerts := make([]Alert, 0, len(candidates))
+	for _, alert := range candidates {
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// GenerateAlerts raises alerts for the findings of the current insights and returns every alert still
+// tracked, newest first. A finding with the type and IP of an alert raised within alertDedupWindow updates
+// that alert rather than raising another one, and alerts whose finding is gone are marked resolved.
+// The raised alerts are passed to the alert notifier, if one is set.
+func (mls *MLService) GenerateAlerts() ([]Alert, error) {
+	insights, err := mls.Insights(false)
+	if err != nil {
+		return nil, err
+	}
+	return mls.recordAlerts(alertsFromInsights(insights), time.Now()), nil
+}
+
+// recordAlerts merges candidates, as made by alertsFromInsights, into the tracked alerts at now and
+// returns every tracked alert, newest first
+func (mls *MLService) recordAlerts(candidates []Alert, now time.Time) []Alert {
+	mls.alertsMu.Lock()
+	defer mls.alertsMu.Unlock()
+
+	if mls.alerts == nil {
+		mls.alerts = make(map[string]*Alert)
+	}
+
+	seen := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		key := alertKey(candidate.Type, candidate.IPAddress)
+		seen[key] = true
+
+		current, ok := mls.alerts[key]
+		if ok && now.Sub(current.Timestamp) < alertDedupWindow {
+			candidate.ID, candidate.Timestamp = current.ID, current.Timestamp
+		} else {
+			candidate.ID, candidate.Timestamp = alertID(candidate.Type, candidate.IPAddress, now), now
+		}
+		candidate.Resolved = false
+		mls.alerts[key] = &candidate
+	}
+
+	alerts := make([]Alert, 0, len(mls.alerts))
+	for key, alert := range mls.alerts {
+		if !seen[key] {
+			if alert.Resolved && now.Sub(alert.Timestamp) >= alertDedupWindow {
+				delete(mls.alerts, key)
+				continue
+			}
+			alert.Resolved = true
+		}
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if !alerts[i].Timestamp.Equal(alerts[j].Timestamp) {
+			return alerts[i].Timestamp.After(alerts[j].Timestamp)
+		}
+		return alerts[i].ID < alerts[j].ID
+	})
+
+	if mls.notifier != nil {
+		for _, alert := range alerts {
+			mls.notifier.Notify(alert)
+		}
+	}
+	return alerts
+}
+
+// SetAlertNotifier sets the notifier told about the alerts GenerateAlerts raises, nil for none.
+// Services created by ForTenant afterwards share it.
+func (mls *MLService) SetAlertNotifier(notifier *AlertNotifier) {
+	mls.alertsMu.Lock()
+	defer mls.alertsMu.Unlock()
+	mls.notifier = notifier
+}
+
+// alertNotifier returns the notifier set by SetAlertNotifier
+func (mls *MLService) alertNotifier() *AlertNotifier {
+	mls.alertsMu.Lock()
+	defer mls.alertsMu.Unlock()
+	return mls.notifier
+}
+
+// clearAlerts drops the tracked alerts of ip, or all of them when ip is empty
+func (mls *MLService) clearAlerts(ip string) {
+	mls.alertsMu.Lock()
+	defer mls.alertsMu.Unlock()
+
+	for key, alert := range mls.alerts {
+		if ip == "" || alert.IPAddress == ip {
+			delete(mls.alerts, key)
+		}
+	}
+}
@@ -1,5 +1,5 @@
 // Package ml - Anomaly Detection Module
-// Implements statistical anomaly detection using Z-score and IQR methods
+// Implements statistical anomaly detection using Z-score and IQR, MAD and EWMA methods
 package ml
 
 import (
@@ -7,6 +7,16 @@ import (
 	"sort"
 )
 
+// Anomaly detection methods, selected by MLConfig.AnomalyMethod
+const (
+	ANOMALY_METHOD_COMBINED = "combined" // Z-score or IQR outlier, the default
+	ANOMALY_METHOD_MAD      = "mad"      // Modified Z-score from the median absolute deviation
+	ANOMALY_METHOD_EWMA     = "ewma"     // Residual from the exponentially weighted moving average
+)
+
+// ANOMALY_METHODS lists every anomaly detection method
+var ANOMALY_METHODS = []string{ANOMALY_METHOD_COMBINED, ANOMALY_METHOD_MAD, ANOMALY_METHOD_EWMA}
+
 // AnomalyDetector implements statistical anomaly detection
 type AnomalyDetector struct {
 	config MLConfig
@@ -19,7 +29,8 @@ func NewAnomalyDetector(config MLConfig) *AnomalyDetector {
 	}
 }
 
-// DetectAnomalies analyzes time series data for anomalies using multiple methods
+// DetectAnomalies analyzes time series data for anomalies with the configured AnomalyMethod, the
+// combined Z-score and IQR method by default
 func (ad *AnomalyDetector) DetectAnomalies(data []TimeSeriesPoint) []AnomalyResult {
 	if len(data) < 10 {
 		return []AnomalyResult{} // Need minimum data points
@@ -33,45 +44,34 @@ func (ad *AnomalyDetector) DetectAnomalies(data []TimeSeriesPoint) []AnomalyResu
 		values[i] = point.Value
 	}
 
-	// Calculate statistical measures
-	mean := calculateMean(values)
-	stdDev := calculateStdDev(values, mean)
-	q1, q3 := calculateQuartiles(values)
-	iqr := q3 - q1
-
-	// Z-score threshold (configurable, default 2.5)
+	// Threshold on the deviation score of every method (configurable, default 2.5)
 	zThreshold := ad.config.AnomalyThreshold
 	if zThreshold == 0 {
 		zThreshold = 2.5
 	}
 
-	// IQR threshold
-	iqrLower := q1 - 1.5*iqr
-	iqrUpper := q3 + 1.5*iqr
+	var scores []float64
+	var flagged []bool
+	switch ad.config.AnomalyMethod {
+	case ANOMALY_METHOD_MAD:
+		scores, flagged = madScores(values, zThreshold)
+	case ANOMALY_METHOD_EWMA:
+		scores, flagged = ewmaScores(values, zThreshold)
+	default:
+		scores, flagged = combinedScores(values, zThreshold)
+	}
 
-	for _, point := range data {
-		value := point.Value
-		
-		// Z-score anomaly detection
-		zScore := math.Abs((value - mean) / stdDev)
-		isZAnomaly := zScore > zThreshold
-		
-		// IQR anomaly detection
-		isIQRAnomaly := value < iqrLower || value > iqrUpper
-		
-		// Combined anomaly detection
-		isAnomaly := isZAnomaly || isIQRAnomaly
-		
+	for i, point := range data {
 		// Calculate anomaly score (0-1)
-		anomalyScore := math.Min(zScore/5.0, 1.0) // Normalize to 0-1
+		anomalyScore := math.Min(scores[i]/5.0, 1.0) // Normalize to 0-1
 		
 		// Determine severity
 		severity := ad.calculateSeverity(anomalyScore)
 		
 		result := AnomalyResult{
 			Timestamp:    point.Timestamp,
-			Value:        value,
-			IsAnomaly:    isAnomaly,
+			Value:        point.Value,
+			IsAnomaly:    flagged[i],
 			AnomalyScore: anomalyScore,
 			Threshold:    zThreshold,
 			Severity:     severity,
@@ -83,6 +83,91 @@ func (ad *AnomalyDetector) DetectAnomalies(data []TimeSeriesPoint) []AnomalyResu
 	return results
 }
 
+// combinedScores scores values by their Z-score and flags those whose Z-score exceeds threshold or
+// that lie outside 1.5 IQR of the quartiles
+func combinedScores(values []float64, threshold float64) ([]float64, []bool) {
+	mean := calculateMean(values)
+	stdDev := calculateStdDev(values, mean)
+	q1, q3 := calculateQuartiles(values)
+	iqr := q3 - q1
+
+	// IQR threshold
+	iqrLower := q1 - 1.5*iqr
+	iqrUpper := q3 + 1.5*iqr
+
+	scores := make([]float64, len(values))
+	flagged := make([]bool, len(values))
+	for i, value := range values {
+		// Z-score anomaly detection
+		scores[i] = math.Abs((value - mean) / stdDev)
+		isZAnomaly := scores[i] > threshold
+		
+		// IQR anomaly detection
+		isIQRAnomaly := value < iqrLower || value > iqrUpper
+		
+		// Combined anomaly detection
+		flagged[i] = isZAnomaly || isIQRAnomaly
+	}
+	return scores, flagged
+}
+
+// madScores scores values by their modified Z-score, the distance from the median in median absolute
+// deviations (MAD), and flags those above threshold. Unlike the mean and standard deviation, the median
+// and MAD hardly move when a cluster of outliers is added, so the outliers cannot mask each other.
+func madScores(values []float64, threshold float64) ([]float64, []bool) {
+	median := calculateMedian(values)
+	deviations := make([]float64, len(values))
+	for i, value := range values {
+		deviations[i] = math.Abs(value - median)
+	}
+
+	// 0.6745 scales the MAD to the standard deviation of normally distributed data. When more than
+	// half the values equal the median the MAD is 0 and the mean absolute deviation is used instead,
+	// scaled likewise.
+	scale := calculateMedian(deviations) / 0.6745
+	if scale == 0 {
+		scale = calculateMean(deviations) * 1.2533
+	}
+
+	scores := make([]float64, len(values))
+	flagged := make([]bool, len(values))
+	for i, deviation := range deviations {
+		if scale > 0 {
+			scores[i] = deviation / scale
+		}
+		flagged[i] = scores[i] > threshold
+	}
+	return scores, flagged
+}
+
+// ewmaAlpha is the weight of the newest value in the exponentially weighted moving average
+const ewmaAlpha = 0.3
+
+// ewmaScores scores each value by its residual from the exponentially weighted moving average of the
+// values before it, in exponentially weighted standard deviations of the residuals, and flags those
+// above threshold. Unlike the other methods it follows trends and level shifts, so only sudden
+// changes are flagged.
+func ewmaScores(values []float64, threshold float64) ([]float64, []bool) {
+	// The variance starts at the one of the whole series, so the first values are not measured
+	// against a variance of 0
+	average := values[0]
+	variance := math.Pow(calculateStdDev(values, calculateMean(values)), 2)
+
+	scores := make([]float64, len(values))
+	flagged := make([]bool, len(values))
+	for i, value := range values {
+		residual := value - average
+		if variance > 0 {
+			scores[i] = math.Abs(residual) / math.Sqrt(variance)
+		}
+		flagged[i] = scores[i] > threshold
+
+		average += ewmaAlpha * residual
+		variance = (1 - ewmaAlpha) * (variance + ewmaAlpha*residual*residual)
+	}
+	return scores, flagged
+}
+
 // DetectRealTimeAnomaly checks if a single new data point is anomalous
 func (ad *AnomalyDetector) DetectRealTimeAnomaly(historicalData []TimeSeriesPoint, newPoint TimeSeriesPoint) AnomalyResult {
 	if len(historicalData) < 10 {
@@ -163,6 +248,18 @@ func calculateStdDev(values []float64, mean float64) float64 {
 	return math.Sqrt(variance)
 }
 
+func calculateMedian(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
 func calculateQuartiles(values []float64) (float64, float64) {
 	sorted := make([]float64, len(values))
 	copy(sorted, values)
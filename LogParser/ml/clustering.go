@@ -62,47 +62,65 @@ func (uc *UserClusterer) ClusterUsers(logs []models.Log) []ClusterResult {
 	return uc.formatClusterResults(clusters, profiles)
 }
 
-// extractUserProfiles aggregates log data into user behavior profiles
+// userActivity accumulates the logs of one IP address until its profile is computed
+type userActivity struct {
+	profile   *UserProfile
+	requests  int
+	bytes     float64
+	errors    int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// extractUserProfiles aggregates log data into user behavior profiles. Request rates are taken over the
+// time span the IP was observed in, counted as at least an hour so a short burst is not extrapolated.
 func (uc *UserClusterer) extractUserProfiles(logs []models.Log) []UserProfile {
-	userStats := make(map[string]*UserProfile)
+	userStats := make(map[string]*userActivity)
 	
 	// Aggregate data by IP address
 	for _, log := range logs {
 		ip := log.RemoteAddr
 		
 		if userStats[ip] == nil {
-			userStats[ip] = &UserProfile{
-				IPAddress: ip,
+			userStats[ip] = &userActivity{
+				profile:   &UserProfile{IPAddress: ip},
+				firstSeen: log.TimeLocal,
+				lastSeen:  log.TimeLocal,
 			}
 		}
 		
-		profile := userStats[ip]
-		
-		// Count requests
-		profile.RequestRate++
+		activity := userStats[ip]
 		
-		// Track response sizes
-		profile.AvgBytes = (profile.AvgBytes + float64(log.BodyBytesSent)) / 2
+		// Count requests and response sizes
+		activity.requests++
+		activity.bytes += float64(log.BodyBytesSent)
+		if log.TimeLocal.Before(activity.firstSeen) {
+			activity.firstSeen = log.TimeLocal
+		}
+		if log.TimeLocal.After(activity.lastSeen) {
+			activity.lastSeen = log.TimeLocal
+		}
 		
 		// Count errors
 		if log.Status >= 400 {
-			profile.ErrorRate++
+			activity.errors++
 		}
 		
 		// Track unique pages (simplified)
-		profile.UniquePages++
+		activity.profile.UniquePages++
 	}
 	
-	// Calculate rates and normalize data
+	// Calculate rates and averages
 	var profiles []UserProfile
-	for _, profile := range userStats {
-		// Calculate error rate as percentage
-		if profile.RequestRate > 0 {
-			profile.ErrorRate = (profile.ErrorRate / profile.RequestRate) * 100
-		}
+	for _, activity := range userStats {
+		profile := activity.profile
+		requests := float64(activity.requests)
+		span := activity.lastSeen.Sub(activity.firstSeen).Hours()
 		
-		// Estimate session time (simplified)
-		profile.SessionTime = profile.RequestRate / 10 // rough estimate
+		profile.AvgBytes = activity.bytes / requests
+		profile.ErrorRate = float64(activity.errors) / requests * 100
+		profile.RequestRate = requests / math.Max(span, 1)
+		profile.SessionTime = span
 		
 		profiles = append(profiles, *profile)
 	}
@@ -360,6 +378,7 @@ func (uc *UserClusterer) formatClusterResults(clusters [][]int, profiles []UserP
 					RequestRate: profile.RequestRate,
 					AvgBytes:    profile.AvgBytes,
 					ErrorRate:   profile.ErrorRate,
+					SessionTime: profile.SessionTime,
 				}
 				
 				results = append(results, result)
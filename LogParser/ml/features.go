@@ -0,0 +1,86 @@
+// Package ml - Feature Toggles
+// Lets deployments switch off the ML components they do not use
+package ml
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Names of the ML features that can be disabled, as used in config.yaml and the API
+const (
+	FEATURE_ANOMALY_DETECTION  = "anomaly_detection"
+	FEATURE_TRAFFIC_PREDICTION = "traffic_prediction"
+	FEATURE_SECURITY_ANALYSIS  = "security_analysis"
+	FEATURE_USER_CLUSTERING    = "user_clustering"
+	FEATURE_TREND_ANALYSIS     = "trend_analysis"
+)
+
+// ErrFeatureDisabled is returned when a disabled feature is asked for directly
+var ErrFeatureDisabled = errors.New("ML feature is disabled")
+
+// FEATURES lists every ML feature, in the order they are reported
+var FEATURES = []string{
+	FEATURE_ANOMALY_DETECTION,
+	FEATURE_TRAFFIC_PREDICTION,
+	FEATURE_SECURITY_ANALYSIS,
+	FEATURE_USER_CLUSTERING,
+	FEATURE_TREND_ANALYSIS,
+}
+
+// featureFlag returns the switch of the named feature in config, or nil for an unknown name
+func (config *MLConfig) featureFlag(feature string) *bool {
+	switch feature {
+	case FEATURE_ANOMALY_DETECTION:
+		return &config.AnomalyDetection
+	case FEATURE_TRAFFIC_PREDICTION:
+		return &config.TrafficPrediction
+	case FEATURE_SECURITY_ANALYSIS:
+		return &config.SecurityAnalysis
+	case FEATURE_USER_CLUSTERING:
+		return &config.UserClustering
+	case FEATURE_TREND_ANALYSIS:
+		return &config.TrendAnalysis
+	}
+	return nil
+}
+
+// Enabled reports whether the named feature is enabled
+func (config MLConfig) Enabled(feature string) bool {
+	flag := config.featureFlag(feature)
+	return flag != nil && *flag
+}
+
+// EnabledFeatures returns the names of the enabled features
+func (config MLConfig) EnabledFeatures() []string {
+	enabled := []string{}
+	for _, feature := range FEATURES {
+		if config.Enabled(feature) {
+			enabled = append(enabled, feature)
+		}
+	}
+	return enabled
+}
+
+// DisabledFeatures returns the names of the disabled features
+func (config MLConfig) DisabledFeatures() []string {
+	disabled := []string{}
+	for _, feature := range FEATURES {
+		if !config.Enabled(feature) {
+			disabled = append(disabled, feature)
+		}
+	}
+	return disabled
+}
+
+// disable switches off the named features, failing on the first unknown name
+func (config *MLConfig) disable(features []string) error {
+	for _, feature := range features {
+		flag := config.featureFlag(feature)
+		if flag == nil {
+			return fmt.Errorf("unknown ML feature %q, expected one of %v", feature, FEATURES)
+		}
+		*flag = false
+	}
+	return nil
+}
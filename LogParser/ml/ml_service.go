@@ -6,29 +6,44 @@ import (
 	"LogParser/connection"
 	"LogParser/logger"
 	"LogParser/models"
+	"LogParser/utils"
 	"database/sql"
 	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // MLService orchestrates all ML/AI capabilities
 type MLService struct {
+	mu                sync.RWMutex // Held for reading by analyses, so Apply never swaps settings mid-analysis
 	anomalyDetector   *AnomalyDetector
 	predictor         *Predictor
 	securityAnalyzer  *SecurityAnalyzer
 	userClusterer     *UserClusterer
 	config            MLConfig
 	db                *sql.DB
+	tenant            string // Tenant whose logs are analyzed, every tenant's when empty
+
+	// The insights last computed by Insights, reused until they are older than PARSER_ML_INSIGHTS_TTL
+	// or generation moves past the one they were computed in
+	insightsMu         sync.Mutex
+	insights           *MLInsights
+	insightsAt         time.Time
+	insightsGeneration int64
+	insightsWindow     AnalysisWindow
+	generation         atomic.Int64 // Bumped by every change of settings or state, invalidating the cached insights
+
+	// The alerts raised by GenerateAlerts, by type and IP, and the notifier told about them
+	alertsMu sync.Mutex
+	alerts   map[string]*Alert
+	notifier *AlertNotifier
 }
 
 // NewMLService creates a new ML service with all components
 func NewMLService() *MLService {
-	config := MLConfig{
-		AnomalyThreshold:    2.5,
-		PredictionHorizon:   24,
-		ClusterCount:        3,
-		SecuritySensitivity: "medium",
-	}
+	config := DefaultMLConfig()
 	
 	return &MLService{
 		anomalyDetector:  NewAnomalyDetector(config),
@@ -51,69 +66,233 @@ func (mls *MLService) Initialize() error {
 	return nil
 }
 
-// GenerateInsights performs comprehensive ML analysis on recent log data
+// GenerateInsights performs comprehensive ML analysis on the logs of the configured analysis window
 func (mls *MLService) GenerateInsights() (*MLInsights, error) {
+	return mls.GenerateInsightsFor(AnalysisWindow{})
+}
+
+// GenerateInsightsFor performs comprehensive ML analysis on the logs of window, see AnalysisWindow
+func (mls *MLService) GenerateInsightsFor(window AnalysisWindow) (*MLInsights, error) {
 	if mls.db == nil {
 		return nil, fmt.Errorf("ML service not initialized")
 	}
 	
-	// Fetch recent log data (last 24 hours)
-	logs, err := mls.fetchRecentLogs(24)
+	mls.mu.RLock()
+	defer mls.mu.RUnlock()
+	
+	config := mls.config
+	window = config.resolve(window)
+	insights := &MLInsights{
+		DisabledFeatures: config.DisabledFeatures(),
+		Window:           window,
+		GeneratedAt:      time.Now(),
+	}
+	if !config.TrendAnalysis {
+		insights.TrendAnalysis = TrendAnalysis{Period: "disabled"}
+	}
+	if len(insights.DisabledFeatures) == len(FEATURES) {
+		return insights.withEmptySlices(), nil
+	}
+	
+	// Fetch recent log data
+	logs, err := mls.fetchRecentLogs(window.Hours, window.Limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch logs: %v", err)
 	}
 	
 	if len(logs) == 0 {
-		return &MLInsights{
-			GeneratedAt: time.Now(),
-		}, nil
+		if config.TrendAnalysis {
+			insights.TrendAnalysis = mls.generateTrendAnalysis(nil)
+		}
+		return insights.withEmptySlices(), nil
 	}
 	
-	// Generate time series metrics
-	metrics := mls.generateMetrics(logs)
+	// Generate time series metrics, only needed by the time series features
+	var metrics LogMetrics
+	if config.AnomalyDetection || config.TrafficPrediction || config.TrendAnalysis {
+		metrics = mls.generateMetrics(logs)
+	}
 	
 	// Perform anomaly detection
-	anomalies := mls.anomalyDetector.DetectAnomalies(metrics.RequestsPerMinute)
+	if config.AnomalyDetection {
+		insights.Anomalies = mls.anomalyDetector.DetectAnomalies(metrics.RequestsPerMinute)
+	}
 	
 	// Generate predictions
-	predictions := mls.predictor.PredictTraffic(metrics.RequestsPerMinute, 24)
+	if config.TrafficPrediction {
+		insights.Predictions = mls.predictor.PredictTraffic(metrics.RequestsPerMinute, 24)
+	}
 	
 	// Analyze security threats
-	securityThreats := mls.securityAnalyzer.AnalyzeLogs(logs)
+	if config.SecurityAnalysis {
+		insights.SecurityThreats = mls.securityAnalyzer.AnalyzeLogs(logs)
+	}
 	
 	// Perform user clustering
-	clusters := mls.userClusterer.ClusterUsers(logs)
+	if config.UserClustering {
+		insights.Clusters = mls.userClusterer.ClusterUsers(logs)
+	}
 	
 	// Generate trend analysis
-	trendAnalysis := mls.generateTrendAnalysis(metrics.RequestsPerMinute)
-	
-	insights := &MLInsights{
-		Anomalies:       anomalies,
-		Predictions:     predictions,
-		TrendAnalysis:   trendAnalysis,
-		Clusters:        clusters,
-		SecurityThreats: securityThreats,
-		GeneratedAt:     time.Now(),
+	if config.TrendAnalysis {
+		insights.TrendAnalysis = mls.generateTrendAnalysis(metrics.RequestsPerMinute)
 	}
 	
 	logger.LogInfo(fmt.Sprintf("Generated ML insights: %d anomalies, %d predictions, %d security threats, %d clusters",
-		len(anomalies), len(predictions), len(securityThreats), len(clusters)))
+		len(insights.Anomalies), len(insights.Predictions), len(insights.SecurityThreats), len(insights.Clusters)))
 	
+	return insights.withEmptySlices(), nil
+}
+
+// Insights returns the insights of the configured analysis window, see InsightsFor.
+func (mls *MLService) Insights(force bool) (*MLInsights, error) {
+	return mls.InsightsFor(AnalysisWindow{}, force)
+}
+
+// InsightsFor returns the insights of window computed within the last PARSER_ML_INSIGHTS_TTL seconds, or
+// generates them with GenerateInsightsFor when there are none, when the settings or state changed since,
+// or when force is set. Only the insights of the last window asked for are kept. Concurrent callers wait
+// for one computation instead of each running their own.
+func (mls *MLService) InsightsFor(window AnalysisWindow, force bool) (*MLInsights, error) {
+	mls.insightsMu.Lock()
+	defer mls.insightsMu.Unlock()
+
+	config, _ := mls.Config()
+	window = config.resolve(window)
+	ttl := time.Duration(utils.ConfigData.MLInsightsTTL) * time.Second
+	generation := mls.generation.Load()
+	if !force && mls.insights != nil && mls.insightsGeneration == generation && mls.insightsWindow == window &&
+		time.Since(mls.insightsAt) < ttl {
+		return mls.insights, nil
+	}
+
+	insights, err := mls.GenerateInsightsFor(window)
+	if err != nil {
+		return nil, err
+	}
+	mls.insights, mls.insightsAt, mls.insightsGeneration, mls.insightsWindow = insights, time.Now(), generation, window
 	return insights, nil
 }
 
-// fetchRecentLogs retrieves logs from the last N hours
-func (mls *MLService) fetchRecentLogs(hours int) ([]models.Log, error) {
-	query := `
+// withEmptySlices replaces nil result lists with empty ones, so insights without results
+// encode as [] rather than null.
+func (insights *MLInsights) withEmptySlices() *MLInsights {
+	if insights.Anomalies == nil {
+		insights.Anomalies = []AnomalyResult{}
+	}
+	if insights.Predictions == nil {
+		insights.Predictions = []PredictionResult{}
+	}
+	if insights.Clusters == nil {
+		insights.Clusters = []ClusterResult{}
+	}
+	if insights.SecurityThreats == nil {
+		insights.SecurityThreats = []SecurityThreat{}
+	}
+	if insights.DisabledFeatures == nil {
+		insights.DisabledFeatures = []string{}
+	}
+	return insights
+}
+
+// Reset clears the state the ML components accumulate between analyses, so the next
+// insights are computed from scratch. Only the security analyzer keeps such state today.
+func (mls *MLService) Reset() {
+	mls.securityAnalyzer.Reset()
+	mls.clearAlerts("")
+	mls.generation.Add(1)
+	logger.LogInfo("ML Service state reset")
+}
+
+// ForgetIP drops all state the ML components hold about ip and returns how many entries were removed.
+func (mls *MLService) ForgetIP(ip string) int {
+	removed := mls.securityAnalyzer.ForgetIP(ip)
+	mls.clearAlerts(ip)
+	mls.generation.Add(1)
+	logger.LogInfo(fmt.Sprintf("ML Service forgot %d entries for an IP", removed))
+	return removed
+}
+
+// Apply validates settings and swaps the resulting configuration and attack patterns into all
+// components at once. Analyses in progress finish with the old settings. When settings are
+// invalid, the error is returned and the running settings are kept.
+func (mls *MLService) Apply(settings models.MLSettings) error {
+	config, patterns, err := CompileSettings(settings)
+	if err != nil {
+		return err
+	}
+
+	mls.mu.Lock()
+	defer mls.mu.Unlock()
+
+	mls.configure(config, patterns)
+	mls.generation.Add(1)
+
+	logger.LogInfo(fmt.Sprintf("ML Service settings applied with %d attack patterns", len(patterns)))
+	return nil
+}
+
+// UpdateConfig validates config and swaps it into every component, keeping the current attack patterns.
+// An invalid config is rejected as a whole and the components keep running with the current one.
+func (mls *MLService) UpdateConfig(config MLConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	mls.mu.Lock()
+	defer mls.mu.Unlock()
+
+	mls.configure(config, mls.securityAnalyzer.AttackPatterns())
+	mls.generation.Add(1)
+
+	logger.LogInfo(fmt.Sprintf("ML Service configuration updated: %+v", config))
+	return nil
+}
+
+// configure sets the configuration and attack patterns of every component, with mu held for writing
+func (mls *MLService) configure(config MLConfig, patterns []AttackPattern) {
+	mls.config = config
+	mls.anomalyDetector.config = config
+	mls.predictor.config = config
+	mls.userClusterer.config = config
+	mls.securityAnalyzer.Configure(config, patterns)
+}
+
+// ForTenant returns a service analyzing only the logs of tenant, with the settings of mls but none of
+// its accumulated state, so nothing learned from one tenant's traffic shows in another's insights
+func (mls *MLService) ForTenant(tenant string) *MLService {
+	config, patterns := mls.Config()
+	
+	tenantService := NewMLService()
+	tenantService.db = mls.db
+	tenantService.tenant = tenant
+	tenantService.notifier = mls.alertNotifier()
+	tenantService.configure(config, patterns)
+	return tenantService
+}
+
+// Config returns the configuration and attack patterns the components currently run with
+func (mls *MLService) Config() (MLConfig, []AttackPattern) {
+	mls.mu.RLock()
+	defer mls.mu.RUnlock()
+
+	return mls.config, mls.securityAnalyzer.AttackPatterns()
+}
+
+// fetchRecentLogs retrieves the limit most recent logs of the last hours hours
+func (mls *MLService) fetchRecentLogs(hours, limit int) ([]models.Log, error) {
+	source, args := utils.ScopeToTenant(utils.LogsReadSource(), mls.tenant, nil)
+	query := fmt.Sprintf(`
 		SELECT remote_addr, remote_user, time_local, request, status, 
 		       body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for
-		FROM logs 
-		WHERE time_local >= NOW() - INTERVAL '%d hours'
+		FROM %s 
+		WHERE time_local >= %s
 		ORDER BY time_local DESC
-		LIMIT 10000
-	`
+		LIMIT %s
+	`, source, utils.Placeholder(len(args)+1), utils.Placeholder(len(args)+2))
+	args = append(args, time.Now().Add(-time.Duration(hours)*time.Hour), limit)
 	
-	rows, err := mls.db.Query(fmt.Sprintf(query, hours))
+	rows, err := mls.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -271,7 +450,7 @@ func (mls *MLService) calculateSlope(data []TimeSeriesPoint) float64 {
 	return slope
 }
 
-// calculateCorrelation calculates correlation coefficient
+// calculateCorrelation calculates the Pearson correlation coefficient of the values with time, in [-1, 1]
 func (mls *MLService) calculateCorrelation(data []TimeSeriesPoint) float64 {
 	if len(data) < 2 {
 		return 0
@@ -298,7 +477,8 @@ func (mls *MLService) calculateCorrelation(data []TimeSeriesPoint) float64 {
 		return 0
 	}
 	
-	return numerator / (denominator * 0.5) // Simplified correlation
+	// Pearson's r; rounding can push it marginally past ±1
+	return math.Max(-1, math.Min(1, numerator/math.Sqrt(denominator)))
 }
 
 // detectSeasonality performs simple seasonality detection
@@ -340,10 +520,22 @@ func (mls *MLService) detectSeasonality(data []TimeSeriesPoint) bool {
 	return variance > mean*0.1
 }
 
+// FeatureEnabled reports whether the named feature is enabled in the live config
+func (mls *MLService) FeatureEnabled(feature string) bool {
+	mls.mu.RLock()
+	defer mls.mu.RUnlock()
+	return mls.config.Enabled(feature)
+}
+
 // GetRealTimeAnomalyScore provides real-time anomaly detection for new data
 func (mls *MLService) GetRealTimeAnomalyScore(newValue float64) (float64, error) {
+	if !mls.FeatureEnabled(FEATURE_ANOMALY_DETECTION) {
+		return 0, ErrFeatureDisabled
+	}
+	
 	// Fetch recent data for baseline
-	logs, err := mls.fetchRecentLogs(1)
+	config, _ := mls.Config()
+	logs, err := mls.fetchRecentLogs(1, config.AnalysisLimit)
 	if err != nil {
 		return 0, err
 	}
@@ -358,6 +550,9 @@ func (mls *MLService) GetRealTimeAnomalyScore(newValue float64) (float64, error)
 		Value:     newValue,
 	}
 	
+	mls.mu.RLock()
+	defer mls.mu.RUnlock()
+	
 	result := mls.anomalyDetector.DetectRealTimeAnomaly(metrics.RequestsPerMinute, newPoint)
 	return result.AnomalyScore, nil
 }
@@ -0,0 +1,720 @@
+package ml
+
+import (
+	"LogParser/models"
+	"LogParser/utils"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLog(ip string, status int) models.Log {
+	return models.Log{
+		RemoteAddr:    ip,
+		TimeLocal:     time.Now(),
+		Request:       "GET /home HTTP/1.1",
+		Status:        status,
+		HttpUserAgent: "Mozilla/5.0",
+	}
+}
+
+func TestSecurityAnalyzerReset(t *testing.T) {
+	sa := NewSecurityAnalyzer(MLConfig{})
+	sa.AnalyzeLogs([]models.Log{testLog("10.0.0.1", 200), testLog("10.0.0.2", 404)})
+	assert.Len(t, sa.suspiciousIPs, 2)
+
+	sa.Reset()
+	assert.Empty(t, sa.suspiciousIPs)
+	assert.Empty(t, sa.rateLimitTracker)
+}
+
+func TestSecurityAnalyzerForgetIP(t *testing.T) {
+	sa := NewSecurityAnalyzer(MLConfig{})
+	sa.AnalyzeLogs([]models.Log{testLog("10.0.0.1", 200), testLog("10.0.0.2", 404)})
+	sa.rateLimitTracker["10.0.0.1"] = &RateLimit{Requests: []time.Time{time.Now()}}
+
+	assert.Equal(t, 2, sa.ForgetIP("10.0.0.1"))
+	assert.NotContains(t, sa.suspiciousIPs, "10.0.0.1")
+	assert.NotContains(t, sa.rateLimitTracker, "10.0.0.1")
+	assert.Contains(t, sa.suspiciousIPs, "10.0.0.2")
+	assert.Equal(t, 0, sa.ForgetIP("10.0.0.1"))
+}
+
+// TestMLServiceReset checks that insights generated after a reset only reflect the logs of that run.
+func TestMLServiceReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{"remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for"}
+	addRows := func(ip string, count int) {
+		rows := sqlmock.NewRows(columns)
+		for i := 0; i < count; i++ {
+			rows.AddRow(ip, "-", time.Now(), "GET /home HTTP/1.1", 200, 512, "-", "Mozilla/5.0", "-")
+		}
+		mock.ExpectQuery("SELECT remote_addr").WillReturnRows(rows)
+	}
+
+	mls := NewMLService()
+	mls.db = db
+
+	addRows("10.0.0.1", 3)
+	_, err = mls.GenerateInsights()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, mls.securityAnalyzer.suspiciousIPs["10.0.0.1"].RequestCount)
+
+	mls.Reset()
+	assert.Empty(t, mls.securityAnalyzer.suspiciousIPs)
+
+	addRows("10.0.0.2", 2)
+	_, err = mls.GenerateInsights()
+	assert.NoError(t, err)
+	assert.Len(t, mls.securityAnalyzer.suspiciousIPs, 1)
+	assert.Equal(t, 2, mls.securityAnalyzer.suspiciousIPs["10.0.0.2"].RequestCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func threatTypes(threats []SecurityThreat) []string {
+	var types []string
+	for _, threat := range threats {
+		types = append(types, threat.ThreatType)
+	}
+	return types
+}
+
+// TestMLServiceApply checks that valid settings are swapped into every component, and that invalid
+// ones are rejected as a whole while detection keeps running with the previous patterns.
+func TestMLServiceApply(t *testing.T) {
+	mls := NewMLService()
+	traversal := testLog("10.0.0.1", 404)
+	traversal.Request = "GET /../../etc/passwd HTTP/1.1"
+	probe := testLog("10.0.0.2", 404)
+	probe.Request = "GET /.env HTTP/1.1"
+
+	err := mls.Apply(models.MLSettings{
+		AnomalyThreshold: 4,
+		AttackPatterns: []models.AttackPatternRule{
+			{Name: "Env Probe", Pattern: `/\.env`},
+			{Name: "Broken", Pattern: `(unclosed`},
+		},
+	})
+	assert.ErrorContains(t, err, `"Broken"`)
+	config, patterns := mls.Config()
+	assert.Equal(t, DefaultMLConfig(), config)
+	assert.Len(t, patterns, len(DefaultAttackPatterns()))
+	assert.Contains(t, threatTypes(mls.securityAnalyzer.AnalyzeLogs([]models.Log{traversal})), "Directory Traversal")
+
+	assert.Error(t, mls.Apply(models.MLSettings{SecuritySensitivity: "paranoid"}))
+	assert.Equal(t, 2.5, mls.anomalyDetector.config.AnomalyThreshold)
+
+	err = mls.Apply(models.MLSettings{
+		AnomalyThreshold: 4,
+		ClusterCount:     5,
+		AttackPatterns:   []models.AttackPatternRule{{Name: "Env Probe", Pattern: `/\.env`, Severity: "high"}},
+	})
+	assert.NoError(t, err)
+	config, patterns = mls.Config()
+	assert.Equal(t, 4.0, config.AnomalyThreshold)
+	assert.Equal(t, 24, config.PredictionHorizon)
+	assert.Equal(t, 4.0, mls.anomalyDetector.config.AnomalyThreshold)
+	assert.Equal(t, 5, mls.userClusterer.config.ClusterCount)
+	assert.Len(t, patterns, 1)
+	assert.Equal(t, "high", patterns[0].Severity)
+	types := threatTypes(mls.securityAnalyzer.AnalyzeLogs([]models.Log{traversal, probe}))
+	assert.Contains(t, types, "Env Probe")
+	assert.NotContains(t, types, "Directory Traversal")
+}
+
+func TestMLServiceUpdateConfig(t *testing.T) {
+	mls := NewMLService()
+	assert.NoError(t, mls.Apply(models.MLSettings{
+		AttackPatterns: []models.AttackPatternRule{{Name: "Env Probe", Pattern: `/\.env`}},
+	}))
+
+	for _, invalid := range []func(*MLConfig){
+		func(c *MLConfig) { c.AnomalyThreshold = 0 },
+		func(c *MLConfig) { c.PredictionHorizon = -1 },
+		func(c *MLConfig) { c.ClusterCount = 0 },
+		func(c *MLConfig) { c.SecuritySensitivity = "paranoid" },
+	} {
+		config := DefaultMLConfig()
+		invalid(&config)
+		assert.Error(t, mls.UpdateConfig(config))
+	}
+	config, _ := mls.Config()
+	assert.Equal(t, DefaultMLConfig(), config)
+
+	update := DefaultMLConfig()
+	update.AnomalyThreshold = 3.5
+	update.PredictionHorizon = 12
+	update.ClusterCount = 4
+	update.SecuritySensitivity = "high"
+	assert.NoError(t, mls.UpdateConfig(update))
+
+	config, patterns := mls.Config()
+	assert.Equal(t, update, config)
+	assert.Equal(t, 3.5, mls.anomalyDetector.config.AnomalyThreshold)
+	assert.Equal(t, 12, mls.predictor.config.PredictionHorizon)
+	assert.Equal(t, 4, mls.userClusterer.config.ClusterCount)
+	assert.Equal(t, "high", mls.securityAnalyzer.config.SecuritySensitivity)
+	// The attack patterns are kept
+	assert.Len(t, patterns, 1)
+	assert.Equal(t, "Env Probe", patterns[0].Name)
+}
+
+// TestMLServiceInsightsCache checks that insights are computed once within the TTL, and again when forced,
+// expired or invalidated by a settings change.
+func TestMLServiceInsightsCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	defer func(ttl int) { utils.ConfigData.MLInsightsTTL = ttl }(utils.ConfigData.MLInsightsTTL)
+	utils.ConfigData.MLInsightsTTL = 60
+
+	expectQuery := func() {
+		rows := sqlmock.NewRows([]string{"remote_addr", "remote_user", "time_local", "request", "status",
+			"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for"}).
+			AddRow("10.0.0.1", "-", time.Now(), "GET /home HTTP/1.1", 200, 512, "-", "Mozilla/5.0", "-")
+		mock.ExpectQuery("SELECT remote_addr").WillReturnRows(rows)
+	}
+
+	mls := NewMLService()
+	mls.db = db
+
+	// Two calls within the TTL query the logs once
+	expectQuery()
+	first, err := mls.Insights(false)
+	assert.NoError(t, err)
+	second, err := mls.Insights(false)
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	expectQuery()
+	forced, err := mls.Insights(true)
+	assert.NoError(t, err)
+	assert.NotSame(t, first, forced)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	expectQuery()
+	assert.NoError(t, mls.UpdateConfig(DefaultMLConfig()))
+	_, err = mls.Insights(false)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Expired insights are computed again
+	mls.insightsAt = time.Now().Add(-time.Minute)
+	expectQuery()
+	_, err = mls.Insights(false)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Without a TTL nothing is cached
+	utils.ConfigData.MLInsightsTTL = 0
+	expectQuery()
+	_, err = mls.Insights(false)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestMLServiceGenerateAlerts feeds synthetic insights to GenerateAlerts and checks which alerts are
+// raised, that repeated findings are deduplicated and that alerts whose finding is gone are resolved.
+func TestMLServiceGenerateAlerts(t *testing.T) {
+	defer func(ttl int) { utils.ConfigData.MLInsightsTTL = ttl }(utils.ConfigData.MLInsightsTTL)
+	utils.ConfigData.MLInsightsTTL = 60
+
+	now := time.Now()
+	mls := NewMLService()
+	setInsights := func(insights *MLInsights) {
+		mls.insights, mls.insightsAt, mls.insightsGeneration = insights, time.Now(), mls.generation.Load()
+		mls.insightsWindow = mls.config.resolve(AnalysisWindow{})
+	}
+	byType := func(alerts []Alert) map[string]Alert {
+		found := map[string]Alert{}
+		for _, alert := range alerts {
+			found[alert.Type+"|"+alert.IPAddress] = alert
+		}
+		return found
+	}
+
+	setInsights(&MLInsights{
+		Anomalies: []AnomalyResult{
+			{Timestamp: now, Value: 900, IsAnomaly: true, AnomalyScore: 0.95, Severity: "critical"},
+			{Timestamp: now, Value: 300, IsAnomaly: true, AnomalyScore: 0.6, Severity: "medium"},
+		},
+		SecurityThreats: []SecurityThreat{
+			{ThreatType: "sql_injection", IPAddress: "10.0.0.1", Severity: "high", Confidence: 0.8},
+			{ThreatType: "brute_force", IPAddress: "10.0.0.1", Severity: "critical", Confidence: 0.9},
+			{ThreatType: "suspicious_behavior", IPAddress: "10.0.0.2", Severity: "medium", Confidence: 0.7},
+		},
+		Predictions: []PredictionResult{
+			{Timestamp: now.Add(time.Hour), PredictedValue: 100},
+			{Timestamp: now.Add(2 * time.Hour), PredictedValue: 350},
+		},
+	})
+	alerts, err := mls.GenerateAlerts()
+	assert.NoError(t, err)
+	found := byType(alerts)
+	assert.Len(t, found, 3)
+	assert.Equal(t, "critical", found["anomaly|"].Severity)
+	// One alert per IP, for its most severe threat; the low confidence threat raises none
+	assert.Equal(t, "critical", found["security|10.0.0.1"].Severity)
+	assert.NotContains(t, found, "security|10.0.0.2")
+	assert.Equal(t, "high", found["prediction|"].Severity)
+	for _, alert := range alerts {
+		assert.NotEmpty(t, alert.ID)
+		assert.False(t, alert.Resolved)
+	}
+
+	// The same findings again keep their alerts and IDs, the ones gone are resolved
+	setInsights(&MLInsights{
+		SecurityThreats: []SecurityThreat{
+			{ThreatType: "brute_force", IPAddress: "10.0.0.1", Severity: "critical", Confidence: 0.9},
+		},
+	})
+	again, err := mls.GenerateAlerts()
+	assert.NoError(t, err)
+	assert.Len(t, again, 3)
+	assert.Equal(t, found["security|10.0.0.1"].ID, byType(again)["security|10.0.0.1"].ID)
+	assert.False(t, byType(again)["security|10.0.0.1"].Resolved)
+	assert.True(t, byType(again)["anomaly|"].Resolved)
+	assert.True(t, byType(again)["prediction|"].Resolved)
+
+	// Past the dedup window a finding raises a new alert and resolved alerts are dropped
+	later := mls.recordAlerts(alertsFromInsights(mls.insights), now.Add(alertDedupWindow+time.Minute))
+	assert.Len(t, later, 1)
+	assert.NotEqual(t, found["security|10.0.0.1"].ID, later[0].ID)
+
+	mls.ForgetIP("10.0.0.1")
+	setInsights(&MLInsights{})
+	cleared, err := mls.GenerateAlerts()
+	assert.NoError(t, err)
+	assert.Empty(t, cleared)
+}
+
+// TestAlertNotifier checks that an alert raised on every analysis is posted to the webhook once, that
+// alerts below the severity are not posted and that a failed delivery is retried.
+func TestAlertNotifier(t *testing.T) {
+	defer func(backoff time.Duration) { alertNotifierBackoff = backoff }(alertNotifierBackoff)
+	alertNotifierBackoff = time.Millisecond
+
+	var posts atomic.Int64
+	var received Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first delivery fails and is retried
+		if posts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	_, err := NewAlertNotifier(server.URL, "severe")
+	assert.Error(t, err)
+
+	notifier, err := NewAlertNotifier(server.URL, "high")
+	assert.NoError(t, err)
+	mls := NewMLService()
+	mls.SetAlertNotifier(notifier)
+
+	insights := &MLInsights{
+		SecurityThreats: []SecurityThreat{
+			{ThreatType: "brute_force", IPAddress: "10.0.0.1", Severity: "critical", Confidence: 0.9},
+		},
+		Predictions: []PredictionResult{
+			{Timestamp: time.Now(), PredictedValue: 100},
+			{Timestamp: time.Now().Add(time.Hour), PredictedValue: 160},
+		},
+	}
+	for i := 0; i < 3; i++ {
+		mls.recordAlerts(alertsFromInsights(insights), time.Now())
+	}
+	notifier.Close()
+
+	assert.Equal(t, int64(2), posts.Load())
+	assert.Equal(t, ALERT_TYPE_SECURITY, received.Type)
+	assert.Equal(t, "10.0.0.1", received.IPAddress)
+}
+
+func TestCalculateCorrelation(t *testing.T) {
+	series := func(values ...float64) []TimeSeriesPoint {
+		data := make([]TimeSeriesPoint, len(values))
+		for i, value := range values {
+			data[i] = TimeSeriesPoint{Timestamp: time.Now().Add(time.Duration(i) * time.Hour), Value: value}
+		}
+		return data
+	}
+
+	mls := NewMLService()
+	assert.InDelta(t, 1, mls.calculateCorrelation(series(10, 20, 30, 40, 50)), 1e-9)
+	assert.InDelta(t, -1, mls.calculateCorrelation(series(50, 40, 30, 20, 10)), 1e-9)
+	assert.Equal(t, 0.0, mls.calculateCorrelation(series(7, 7, 7, 7, 7)))
+	assert.Equal(t, 0.0, mls.calculateCorrelation(series(7)))
+
+	r := mls.calculateCorrelation(series(3, 9, 1, 12, 5, 20, 8))
+	assert.True(t, r > 0 && r < 1, "correlation %v of noisy data should be within (0, 1)", r)
+}
+
+func TestExtractUserProfiles(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	logAt := func(ip string, offset time.Duration, status, bytes int) models.Log {
+		log := testLog(ip, status)
+		log.TimeLocal = start.Add(offset)
+		log.BodyBytesSent = bytes
+		return log
+	}
+
+	uc := NewUserClusterer(MLConfig{})
+	profiles := uc.extractUserProfiles([]models.Log{
+		logAt("10.0.0.1", 0, 200, 100),
+		logAt("10.0.0.1", time.Hour, 404, 200),
+		logAt("10.0.0.1", 30*time.Minute, 200, 300),
+		logAt("10.0.0.1", 4*time.Hour, 500, 1000),
+		logAt("10.0.0.2", 0, 200, 50),
+	})
+
+	byIP := map[string]UserProfile{}
+	for _, profile := range profiles {
+		byIP[profile.IPAddress] = profile
+	}
+	assert.Len(t, byIP, 2)
+
+	// Four requests over four hours
+	assert.InDelta(t, 400, byIP["10.0.0.1"].AvgBytes, 1e-9)
+	assert.InDelta(t, 1, byIP["10.0.0.1"].RequestRate, 1e-9)
+	assert.InDelta(t, 50, byIP["10.0.0.1"].ErrorRate, 1e-9)
+	assert.InDelta(t, 4, byIP["10.0.0.1"].SessionTime, 1e-9)
+
+	// A single request counts over an hour
+	assert.InDelta(t, 50, byIP["10.0.0.2"].AvgBytes, 1e-9)
+	assert.InDelta(t, 1, byIP["10.0.0.2"].RequestRate, 1e-9)
+	assert.Equal(t, 0.0, byIP["10.0.0.2"].ErrorRate)
+}
+
+// anomalySeries returns values as hourly points
+func anomalySeries(values ...float64) []TimeSeriesPoint {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := make([]TimeSeriesPoint, len(values))
+	for i, value := range values {
+		data[i] = TimeSeriesPoint{Timestamp: start.Add(time.Duration(i) * time.Hour), Value: value}
+	}
+	return data
+}
+
+// TestDetectAnomalies_MAD checks that a cluster of outliers, which skews the mean and standard deviation
+// enough to hide from the combined method, is flagged by MAD.
+func TestDetectAnomalies_MAD(t *testing.T) {
+	var values []float64
+	for i := 0; i < 18; i++ {
+		values = append(values, float64(8+i%5))
+	}
+	for i := 0; i < 7; i++ {
+		values = append(values, 100)
+	}
+	data := anomalySeries(values...)
+
+	flaggedBy := func(method string) []bool {
+		config := DefaultMLConfig()
+		config.AnomalyMethod = method
+		var flagged []bool
+		for _, result := range NewAnomalyDetector(config).DetectAnomalies(data) {
+			flagged = append(flagged, result.IsAnomaly)
+		}
+		return flagged
+	}
+
+	combined := flaggedBy(ANOMALY_METHOD_COMBINED)
+	mad := flaggedBy(ANOMALY_METHOD_MAD)
+	for i, value := range values {
+		if value == 100 {
+			assert.False(t, combined[i], "combined method flagged outlier %d", i)
+			assert.True(t, mad[i], "MAD missed outlier %d", i)
+		} else {
+			assert.False(t, mad[i], "MAD flagged regular value %d", i)
+		}
+	}
+}
+
+// TestDetectAnomalies_EWMA checks that the EWMA method flags a sudden spike but not a steady trend.
+func TestDetectAnomalies_EWMA(t *testing.T) {
+	var values []float64
+	for i := 0; i < 30; i++ {
+		values = append(values, 100+float64(i)*5+float64(i%3))
+	}
+	values[20] = 400
+
+	config := DefaultMLConfig()
+	config.AnomalyMethod = ANOMALY_METHOD_EWMA
+	results := NewAnomalyDetector(config).DetectAnomalies(anomalySeries(values...))
+	assert.Len(t, results, len(values))
+	for i, result := range results {
+		assert.Equal(t, i == 20, result.IsAnomaly, "value %d", i)
+	}
+}
+
+func TestCompileSettings_AnomalyMethod(t *testing.T) {
+	config, _, err := CompileSettings(models.MLSettings{})
+	assert.NoError(t, err)
+	assert.Equal(t, ANOMALY_METHOD_COMBINED, config.AnomalyMethod)
+
+	config, _, err = CompileSettings(models.MLSettings{AnomalyMethod: "mad"})
+	assert.NoError(t, err)
+	assert.Equal(t, ANOMALY_METHOD_MAD, config.AnomalyMethod)
+
+	_, _, err = CompileSettings(models.MLSettings{AnomalyMethod: "prophet"})
+	assert.Error(t, err)
+
+	config = DefaultMLConfig()
+	config.AnomalyMethod = "prophet"
+	assert.Error(t, NewMLService().UpdateConfig(config))
+}
+
+func TestSecurityAnalyzerAddPattern(t *testing.T) {
+	probe := testLog("10.0.0.1", 404)
+	probe.Request = "GET /.git/config HTTP/1.1"
+	gitProbe := AttackPattern{Name: "Git Probe", Pattern: regexp.MustCompile(`/\.git/`), Severity: "high", Description: "Attempt to read the git repository"}
+
+	sa := NewSecurityAnalyzer(MLConfig{})
+	assert.NotContains(t, threatTypes(sa.AnalyzeLogs([]models.Log{probe})), "Git Probe")
+
+	assert.NoError(t, sa.AddPattern(gitProbe))
+	assert.Len(t, sa.AttackPatterns(), len(DefaultAttackPatterns())+1)
+	var found *SecurityThreat
+	for _, threat := range sa.AnalyzeLogs([]models.Log{probe}) {
+		if threat.ThreatType == "Git Probe" {
+			found = &threat
+		}
+	}
+	if assert.NotNil(t, found) {
+		assert.Equal(t, "10.0.0.1", found.IPAddress)
+		assert.Equal(t, "high", found.Severity)
+		assert.Equal(t, "Attempt to read the git repository", found.Description)
+	}
+
+	// A pattern of the same name replaces the existing one
+	assert.NoError(t, sa.AddPattern(AttackPattern{Name: "Bot Activity", Pattern: regexp.MustCompile(`(?i)scanner`), Severity: "medium"}))
+	assert.Len(t, sa.AttackPatterns(), len(DefaultAttackPatterns())+1)
+
+	assert.Error(t, sa.AddPattern(AttackPattern{Name: "No Regex", Severity: "high"}))
+	assert.Error(t, sa.AddPattern(AttackPattern{Pattern: regexp.MustCompile(`x`), Severity: "high"}))
+	assert.Error(t, sa.AddPattern(AttackPattern{Name: "Odd", Pattern: regexp.MustCompile(`x`), Severity: "urgent"}))
+	assert.Len(t, sa.AttackPatterns(), len(DefaultAttackPatterns())+1)
+
+	// Extras are added when the analyzer is created, invalid ones are skipped
+	sa = NewSecurityAnalyzer(MLConfig{}, gitProbe, AttackPattern{Name: "Broken"})
+	assert.Contains(t, threatTypes(sa.AnalyzeLogs([]models.Log{probe})), "Git Probe")
+	assert.Len(t, sa.AttackPatterns(), len(DefaultAttackPatterns())+1)
+}
+
+func TestCompileSettings_ExtraAttackPatterns(t *testing.T) {
+	_, patterns, err := CompileSettings(models.MLSettings{
+		ExtraAttackPatterns: []models.AttackPatternRule{
+			{Name: "Git Probe", Pattern: `/\.git/`},
+			{Name: "SQL Injection", Pattern: `(?i)union\s+select`, Severity: "critical"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, patterns, len(DefaultAttackPatterns())+1)
+	assert.Equal(t, "SQL Injection", patterns[0].Name)
+	assert.Equal(t, "critical", patterns[0].Severity)
+	assert.Equal(t, "Git Probe", patterns[len(patterns)-1].Name)
+	assert.Equal(t, "medium", patterns[len(patterns)-1].Severity)
+
+	_, patterns, err = CompileSettings(models.MLSettings{
+		AttackPatterns:      []models.AttackPatternRule{{Name: "Env Probe", Pattern: `/\.env`}},
+		ExtraAttackPatterns: []models.AttackPatternRule{{Name: "Git Probe", Pattern: `/\.git/`}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, patterns, 2)
+
+	_, _, err = CompileSettings(models.MLSettings{
+		ExtraAttackPatterns: []models.AttackPatternRule{{Name: "Broken", Pattern: `(unclosed`}},
+	})
+	assert.ErrorContains(t, err, `"Broken"`)
+
+	_, _, err = CompileSettings(models.MLSettings{
+		ExtraAttackPatterns: []models.AttackPatternRule{{Name: "Odd", Pattern: `x`, Severity: "urgent"}},
+	})
+	assert.ErrorContains(t, err, `"urgent"`)
+}
+
+func TestSecurityAnalyzerIPLists(t *testing.T) {
+	scanner := testLog("10.1.2.3", 404)
+	scanner.HttpUserAgent = "sqlmap/1.7"
+	denied := testLog("203.0.113.7", 200)
+	other := testLog("192.0.2.1", 404)
+	other.HttpUserAgent = "sqlmap/1.7"
+
+	config := DefaultMLConfig()
+	config.SecurityAllowlist = []string{"10.0.0.0/8"}
+	config.SecurityDenylist = []string{"203.0.113.7"}
+	sa := NewSecurityAnalyzer(config)
+
+	threats := sa.AnalyzeLogs([]models.Log{scanner, scanner, denied, denied, other})
+	byIP := map[string][]SecurityThreat{}
+	for _, threat := range threats {
+		byIP[threat.IPAddress] = append(byIP[threat.IPAddress], threat)
+	}
+	assert.NotContains(t, byIP, "10.1.2.3")
+	if assert.Len(t, byIP["203.0.113.7"], 1) {
+		assert.Equal(t, "Denylisted IP", byIP["203.0.113.7"][0].ThreatType)
+		assert.Equal(t, "high", byIP["203.0.113.7"][0].Severity)
+		assert.Equal(t, 2, byIP["203.0.113.7"][0].RequestCount)
+	}
+	assert.NotEmpty(t, byIP["192.0.2.1"])
+
+	// Entries that are neither an IP nor a CIDR range are rejected
+	config.SecurityDenylist = []string{"not-an-ip"}
+	assert.ErrorContains(t, NewMLService().UpdateConfig(config), "not-an-ip")
+	_, _, err := CompileSettings(models.MLSettings{SecurityAllowlist: []string{"10.0.0.0/33"}})
+	assert.ErrorContains(t, err, "allowlist")
+}
+
+// TestDetectRateLimitViolations checks that the rate limit is judged on the logs' own timestamps, so a
+// burst in historical logs is reported while the same number of requests spread out is not.
+func TestDetectRateLimitViolations(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	var logs []models.Log
+	for i := 0; i < 150; i++ {
+		burst := testLog("10.0.0.1", 200)
+		burst.TimeLocal = start.Add(time.Duration(i) * 300 * time.Millisecond)
+		steady := testLog("10.0.0.2", 200)
+		steady.TimeLocal = start.Add(time.Duration(i) * time.Minute)
+		logs = append(logs, burst, steady)
+	}
+
+	threats := NewSecurityAnalyzer(MLConfig{}).detectRateLimitViolations(logs)
+	if assert.Len(t, threats, 1) {
+		assert.Equal(t, "Rate Limit Violation", threats[0].ThreatType)
+		assert.Equal(t, "10.0.0.1", threats[0].IPAddress)
+		assert.Equal(t, 150, threats[0].RequestCount)
+		assert.Equal(t, start, threats[0].FirstSeen)
+	}
+}
+
+// cutoffArg matches a time about hours before now
+type cutoffArg struct{ hours int }
+
+func (arg cutoffArg) Match(value driver.Value) bool {
+	cutoff, ok := value.(time.Time)
+	expected := time.Now().Add(-time.Duration(arg.hours) * time.Hour)
+	return ok && cutoff.Sub(expected).Abs() < time.Minute
+}
+
+// TestMLServiceInsightsWindow checks that the analysis window reaches the query as parameters, and that
+// it is clamped to its bounds.
+func TestMLServiceInsightsWindow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	expectQuery := func(hours, limit int) {
+		rows := sqlmock.NewRows([]string{"remote_addr", "remote_user", "time_local", "request", "status",
+			"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for"})
+		mock.ExpectQuery(`WHERE time_local >= \$1\s+ORDER BY time_local DESC\s+LIMIT \$2`).
+			WithArgs(cutoffArg{hours}, limit).WillReturnRows(rows)
+	}
+
+	mls := NewMLService()
+	mls.db = db
+
+	expectQuery(24, 10000)
+	insights, err := mls.InsightsFor(AnalysisWindow{}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, AnalysisWindow{Hours: 24, Limit: 10000}, insights.Window)
+
+	expectQuery(72, 50000)
+	insights, err = mls.InsightsFor(AnalysisWindow{Hours: 72, Limit: 50000}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, AnalysisWindow{Hours: 72, Limit: 50000}, insights.Window)
+
+	expectQuery(MAX_ANALYSIS_HOURS, MAX_ANALYSIS_LIMIT)
+	insights, err = mls.InsightsFor(AnalysisWindow{Hours: 100000, Limit: 10000000}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, AnalysisWindow{Hours: MAX_ANALYSIS_HOURS, Limit: MAX_ANALYSIS_LIMIT}, insights.Window)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	_, _, err = CompileSettings(models.MLSettings{AnalysisLimit: MAX_ANALYSIS_LIMIT + 1})
+	assert.Error(t, err)
+	config, _, err := CompileSettings(models.MLSettings{AnalysisHours: 48})
+	assert.NoError(t, err)
+	assert.Equal(t, AnalysisWindow{Hours: 48, Limit: 10000}, config.resolve(AnalysisWindow{}))
+}
+
+// TestClusterUsers_SessionTime checks that the session time reported for a user is the span between
+// their first and last request.
+func TestClusterUsers_SessionTime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	var logs []models.Log
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		first := testLog(ip, 200)
+		first.TimeLocal = start
+		last := testLog(ip, 200)
+		last.TimeLocal = start.Add(time.Duration(i+1) * time.Hour)
+		logs = append(logs, first, last)
+	}
+
+	sessionTimes := map[string]float64{}
+	for _, result := range NewUserClusterer(DefaultMLConfig()).ClusterUsers(logs) {
+		sessionTimes[result.IPAddress] = result.SessionTime
+	}
+	assert.InDelta(t, 1, sessionTimes["10.0.0.1"], 1e-9)
+	assert.InDelta(t, 4, sessionTimes["10.0.0.4"], 1e-9)
+}
+
+// TestMLServiceDisabledFeature checks that a disabled feature is never run and is reported as disabled.
+func TestMLServiceDisabledFeature(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	columns := []string{"remote_addr", "remote_user", "time_local", "request", "status",
+		"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for"}
+	addRows := func() {
+		rows := sqlmock.NewRows(columns)
+		for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+			rows.AddRow(ip, "-", time.Now(), "GET /home HTTP/1.1", 200, 512, "-", "Mozilla/5.0", "-")
+		}
+		mock.ExpectQuery("SELECT remote_addr").WillReturnRows(rows)
+	}
+
+	mls := NewMLService()
+	mls.db = db
+
+	addRows()
+	insights, err := mls.GenerateInsights()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, insights.Clusters)
+	assert.Empty(t, insights.DisabledFeatures)
+
+	assert.ErrorContains(t, mls.Apply(models.MLSettings{DisabledFeatures: []string{"clustering"}}), `"clustering"`)
+	assert.True(t, mls.FeatureEnabled(FEATURE_USER_CLUSTERING))
+
+	assert.NoError(t, mls.Apply(models.MLSettings{DisabledFeatures: []string{FEATURE_USER_CLUSTERING}}))
+	assert.False(t, mls.FeatureEnabled(FEATURE_USER_CLUSTERING))
+	// A nil clusterer would panic if the disabled feature still ran
+	mls.userClusterer = nil
+
+	addRows()
+	insights, err = mls.GenerateInsights()
+	assert.NoError(t, err)
+	assert.NotNil(t, insights.Clusters)
+	assert.Empty(t, insights.Clusters)
+	assert.Equal(t, []string{FEATURE_USER_CLUSTERING}, insights.DisabledFeatures)
+	assert.Len(t, mls.securityAnalyzer.suspiciousIPs, 4)
+
+	config, _ := mls.Config()
+	assert.NotContains(t, config.EnabledFeatures(), FEATURE_USER_CLUSTERING)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
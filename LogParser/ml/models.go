@@ -42,6 +42,7 @@ type ClusterResult struct {
 	RequestRate float64 `json:"request_rate"`
 	AvgBytes    float64 `json:"avg_bytes"`
 	ErrorRate   float64 `json:"error_rate"`
+	SessionTime float64 `json:"session_time"` // Hours between the first and last request
 }
 
 // SecurityThreat represents detected security threats
@@ -63,6 +64,8 @@ type MLInsights struct {
 	TrendAnalysis   TrendAnalysis     `json:"trend_analysis"`
 	Clusters        []ClusterResult   `json:"clusters"`
 	SecurityThreats []SecurityThreat  `json:"security_threats"`
+	DisabledFeatures []string         `json:"disabled_features"` // Features skipped, whose sections are left empty
+	Window          AnalysisWindow    `json:"window"`            // Logs analyzed, after defaults and bounds
 	GeneratedAt     time.Time         `json:"generated_at"`
 }
 
@@ -86,6 +89,27 @@ type MLConfig struct {
 	PredictionHorizon   int     `json:"prediction_horizon"` // hours
 	ClusterCount        int     `json:"cluster_count"`
 	SecuritySensitivity string  `json:"security_sensitivity"` // "low", "medium", "high"
+	AnomalyMethod       string  `json:"anomaly_method"`       // "combined", "mad", "ewma"
+	AnalysisHours       int     `json:"analysis_hours"`       // Hours of logs analyzed, at most MAX_ANALYSIS_HOURS
+	AnalysisLimit       int     `json:"analysis_limit"`       // Most recent logs analyzed, at most MAX_ANALYSIS_LIMIT
+
+	// IPs and CIDR ranges the security analyzer never reports, and always reports
+	SecurityAllowlist []string `json:"security_allowlist"`
+	SecurityDenylist  []string `json:"security_denylist"`
+
+	// Feature switches; GenerateInsights skips the components of disabled features
+	AnomalyDetection  bool `json:"anomaly_detection"`
+	TrafficPrediction bool `json:"traffic_prediction"`
+	SecurityAnalysis  bool `json:"security_analysis"`
+	UserClustering    bool `json:"user_clustering"`
+	TrendAnalysis     bool `json:"trend_analysis"`
+}
+
+// AnalysisWindow selects the logs an analysis runs on: those of the last Hours hours, at most the
+// Limit most recent of them. Zero fields take the value of the configuration.
+type AnalysisWindow struct {
+	Hours int `json:"hours"`
+	Limit int `json:"limit"`
 }
 
 // Alert represents an ML-generated alert
@@ -95,7 +119,8 @@ type Alert struct {
 	Severity    string    `json:"severity"`
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
-	Timestamp   time.Time `json:"timestamp"`
+	IPAddress   string    `json:"ip_address,omitempty"` // Set for alerts about a single client
+	Timestamp   time.Time `json:"timestamp"`            // When the alert was first raised
 	Data        interface{} `json:"data"`
 	Resolved    bool      `json:"resolved"`
 }
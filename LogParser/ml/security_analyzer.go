@@ -3,18 +3,70 @@
 package ml
 
 import (
+	"LogParser/logger"
 	"LogParser/models"
+	"fmt"
+	"net"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 // SecurityAnalyzer implements ML-based security threat detection
 type SecurityAnalyzer struct {
+	mu               sync.Mutex // Guards config, attackPatterns, allowlist, denylist, suspiciousIPs and rateLimitTracker
 	config           MLConfig
 	suspiciousIPs    map[string]*IPBehavior
 	attackPatterns   []AttackPattern
 	rateLimitTracker map[string]*RateLimit
+	allowlist        ipList // Addresses never reported, from config.SecurityAllowlist
+	denylist         ipList // Addresses always reported, from config.SecurityDenylist
+}
+
+// ipList matches addresses against a list of IPs and CIDR ranges
+type ipList []*net.IPNet
+
+// parseIPList parses entries, each an IP or a CIDR range. The error names the first invalid entry;
+// the others are still returned.
+func parseIPList(entries []string) (ipList, error) {
+	var list ipList
+	var firstErr error
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		} else if _, network, err := net.ParseCIDR(entry); err == nil {
+			list = append(list, network)
+			continue
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%q is not an IP address or CIDR range", entry)
+		}
+	}
+	return list, firstErr
+}
+
+// contains reports whether address is in the list
+func (list ipList) contains(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range list {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
 
 // IPBehavior tracks behavior patterns for IP addresses
@@ -43,57 +95,49 @@ type RateLimit struct {
 	WindowMin int // minutes
 }
 
-// NewSecurityAnalyzer creates a new security analyzer
-func NewSecurityAnalyzer(config MLConfig) *SecurityAnalyzer {
+// NewSecurityAnalyzer creates a new security analyzer matching the built-in attack patterns and extra,
+// see AddPattern. Invalid extra patterns are logged and skipped.
+func NewSecurityAnalyzer(config MLConfig, extra ...AttackPattern) *SecurityAnalyzer {
 	sa := &SecurityAnalyzer{
 		config:           config,
 		suspiciousIPs:    make(map[string]*IPBehavior),
 		rateLimitTracker: make(map[string]*RateLimit),
+		attackPatterns:   DefaultAttackPatterns(),
 	}
+	sa.setIPLists(config)
 	
-	sa.initializeAttackPatterns()
+	for _, pattern := range extra {
+		if err := sa.AddPattern(pattern); err != nil {
+			logger.LogWarn(fmt.Sprintf("Skipping attack pattern: %v", err))
+		}
+	}
 	return sa
 }
 
-// initializeAttackPatterns sets up known attack patterns
-func (sa *SecurityAnalyzer) initializeAttackPatterns() {
-	sa.attackPatterns = []AttackPattern{
-		{
-			Name:        "SQL Injection",
-			Pattern:     regexp.MustCompile(`(?i)(union|select|insert|delete|drop|exec|script|javascript|<script)`),
-			Severity:    "high",
-			Description: "Potential SQL injection or XSS attempt",
-		},
-		{
-			Name:        "Directory Traversal",
-			Pattern:     regexp.MustCompile(`\.\./|\.\.\\|%2e%2e%2f|%2e%2e\\`),
-			Severity:    "medium",
-			Description: "Directory traversal attempt",
-		},
-		{
-			Name:        "Command Injection",
-			Pattern:     regexp.MustCompile(`(?i)(;|&&|\|\||cmd|powershell|bash|sh|exec)`),
-			Severity:    "high",
-			Description: "Command injection attempt",
-		},
-		{
-			Name:        "Brute Force",
-			Pattern:     regexp.MustCompile(`(?i)(admin|login|wp-admin|administrator)`),
-			Severity:    "medium",
-			Description: "Potential brute force attack",
-		},
-		{
-			Name:        "Bot Activity",
-			Pattern:     regexp.MustCompile(`(?i)(bot|crawler|spider|scraper|scanner)`),
-			Severity:    "low",
-			Description: "Automated bot activity",
-		},
+// AddPattern matches pattern against logs from the next analysis on, replacing the attack pattern of
+// the same name if there is one. A pattern without a name or regular expression, or with a severity
+// other than low, medium, high or critical, is rejected.
+func (sa *SecurityAnalyzer) AddPattern(pattern AttackPattern) error {
+	if err := pattern.validate(); err != nil {
+		return err
 	}
+
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	sa.attackPatterns = withAttackPattern(sa.attackPatterns, pattern)
+	return nil
 }
 
 // AnalyzeLogs performs comprehensive security analysis on log entries
 func (sa *SecurityAnalyzer) AnalyzeLogs(logs []models.Log) []SecurityThreat {
-	var threats []SecurityThreat
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	// Allowlisted addresses are left out entirely and denylisted ones are reported as such, without
+	// further analysis
+	threats := sa.detectDenylistedIPs(logs)
+	logs = sa.unlistedLogs(logs)
 	
 	// Update IP behavior tracking
 	for _, log := range logs {
@@ -109,6 +153,97 @@ func (sa *SecurityAnalyzer) AnalyzeLogs(logs []models.Log) []SecurityThreat {
 	return threats
 }
 
+// Configure swaps in a new configuration and set of attack patterns, taking effect from the next analysis
+func (sa *SecurityAnalyzer) Configure(config MLConfig, patterns []AttackPattern) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	sa.config = config
+	sa.attackPatterns = patterns
+	sa.setIPLists(config)
+}
+
+// setIPLists parses the allowlist and denylist of config, with mu held or before sa is shared.
+// Configurations are validated before they get here, so no entry is expected to be invalid.
+func (sa *SecurityAnalyzer) setIPLists(config MLConfig) {
+	sa.allowlist, _ = parseIPList(config.SecurityAllowlist)
+	sa.denylist, _ = parseIPList(config.SecurityDenylist)
+}
+
+// unlistedLogs returns the logs of addresses on neither the allowlist nor the denylist
+func (sa *SecurityAnalyzer) unlistedLogs(logs []models.Log) []models.Log {
+	if len(sa.allowlist) == 0 && len(sa.denylist) == 0 {
+		return logs
+	}
+	unlisted := make([]models.Log, 0, len(logs))
+	for _, log := range logs {
+		if !sa.allowlist.contains(log.RemoteAddr) && !sa.denylist.contains(log.RemoteAddr) {
+			unlisted = append(unlisted, log)
+		}
+	}
+	return unlisted
+}
+
+// detectDenylistedIPs reports every denylisted address in logs as a high severity threat. An address on
+// both lists is allowlisted.
+func (sa *SecurityAnalyzer) detectDenylistedIPs(logs []models.Log) []SecurityThreat {
+	if len(sa.denylist) == 0 {
+		return nil
+	}
+
+	var threats []SecurityThreat
+	for _, log := range logs {
+		if sa.allowlist.contains(log.RemoteAddr) || !sa.denylist.contains(log.RemoteAddr) {
+			continue
+		}
+		threats = append(threats, SecurityThreat{
+			ThreatType:   "Denylisted IP",
+			IPAddress:    log.RemoteAddr,
+			Severity:     "high",
+			Confidence:   1.0,
+			Description:  "Request from a denylisted IP address",
+			FirstSeen:    log.TimeLocal,
+			LastSeen:     log.TimeLocal,
+			RequestCount: 1,
+		})
+	}
+	return sa.consolidateThreats(threats)
+}
+
+// AttackPatterns returns the attack patterns currently matched against logs
+func (sa *SecurityAnalyzer) AttackPatterns() []AttackPattern {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	return sa.attackPatterns
+}
+
+// Reset discards the IP behavior and rate limit state accumulated over previous analyses
+func (sa *SecurityAnalyzer) Reset() {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	sa.suspiciousIPs = make(map[string]*IPBehavior)
+	sa.rateLimitTracker = make(map[string]*RateLimit)
+}
+
+// ForgetIP drops the behavior and rate limit state tracked for ip and returns how many entries were removed.
+func (sa *SecurityAnalyzer) ForgetIP(ip string) int {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	removed := 0
+	if _, ok := sa.suspiciousIPs[ip]; ok {
+		delete(sa.suspiciousIPs, ip)
+		removed++
+	}
+	if _, ok := sa.rateLimitTracker[ip]; ok {
+		delete(sa.rateLimitTracker, ip)
+		removed++
+	}
+	return removed
+}
+
 // updateIPBehavior updates behavior tracking for IP addresses
 func (sa *SecurityAnalyzer) updateIPBehavior(log models.Log) {
 	ip := log.RemoteAddr
@@ -171,6 +306,13 @@ func (sa *SecurityAnalyzer) detectAttackPatterns(logs []models.Log) []SecurityTh
 	return sa.consolidateThreats(threats)
 }
 
+// rateLimitWindow and rateLimitMaxRequests are the rate above which an IP violates the rate limit:
+// more than 100 requests within a minute
+const (
+	rateLimitWindow      = time.Minute
+	rateLimitMaxRequests = 100
+)
+
 // detectRateLimitViolations detects potential DDoS or brute force attacks
 func (sa *SecurityAnalyzer) detectRateLimitViolations(logs []models.Log) []SecurityThreat {
 	var threats []SecurityThreat
@@ -185,28 +327,30 @@ func (sa *SecurityAnalyzer) detectRateLimitViolations(logs []models.Log) []Secur
 	
 	// Check for rate limit violations
 	for ip, requests := range ipRequestCounts {
-		if len(requests) < 10 {
+		if len(requests) <= rateLimitMaxRequests {
 			continue
 		}
 		
-		// Check requests in last minute
-		now := time.Now()
-		recentRequests := 0
-		
-		for _, reqTime := range requests {
-			if now.Sub(reqTime) <= time.Minute {
-				recentRequests++
+		// Slide a window of rateLimitWindow over the requests' own timestamps, so historical logs are
+		// judged by when they were made rather than by how long ago that was
+		sort.Slice(requests, func(i, j int) bool { return requests[i].Before(requests[j]) })
+		peakRequests := 0
+		for start, end := 0, 0; end < len(requests); end++ {
+			for requests[end].Sub(requests[start]) >= rateLimitWindow {
+				start++
+			}
+			if end-start+1 > peakRequests {
+				peakRequests = end - start + 1
 			}
 		}
 		
-		// Threshold: more than 100 requests per minute
-		if recentRequests > 100 {
+		if peakRequests > rateLimitMaxRequests {
 			threat := SecurityThreat{
 				ThreatType:   "Rate Limit Violation",
 				IPAddress:    ip,
 				Severity:     "high",
 				Confidence:   0.9,
-				Description:  "Excessive request rate detected",
+				Description:  fmt.Sprintf("Excessive request rate detected: %d requests within a minute", peakRequests),
 				FirstSeen:    requests[0],
 				LastSeen:     requests[len(requests)-1],
 				RequestCount: len(requests),
@@ -224,6 +368,10 @@ func (sa *SecurityAnalyzer) detectSuspiciousIPs() []SecurityThreat {
 	var threats []SecurityThreat
 	
 	for _, behavior := range sa.suspiciousIPs {
+		// Tracked before the address was listed
+		if sa.allowlist.contains(behavior.IP) || sa.denylist.contains(behavior.IP) {
+			continue
+		}
 		if behavior.SuspiciousScore > 0.7 {
 			severity := "medium"
 			if behavior.SuspiciousScore > 0.9 {
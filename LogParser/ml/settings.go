@@ -0,0 +1,278 @@
+// Package ml - ML Settings
+// Builds the analyzers' configuration from the ML section of config.yaml
+package ml
+
+import (
+	"LogParser/models"
+	"fmt"
+	"regexp"
+)
+
+// Upper bounds of the analysis window, so a request cannot load more logs into memory than the
+// service can handle
+const (
+	MAX_ANALYSIS_HOURS = 720    // 30 days
+	MAX_ANALYSIS_LIMIT = 100000 // logs
+)
+
+// DefaultMLConfig returns the configuration the ML components use when config.yaml does not tune them
+func DefaultMLConfig() MLConfig {
+	return MLConfig{
+		AnomalyThreshold:    2.5,
+		PredictionHorizon:   24,
+		ClusterCount:        3,
+		SecuritySensitivity: "medium",
+		AnomalyMethod:       ANOMALY_METHOD_COMBINED,
+		AnalysisHours:       24,
+		AnalysisLimit:       10000,
+		AnomalyDetection:    true,
+		TrafficPrediction:   true,
+		SecurityAnalysis:    true,
+		UserClustering:      true,
+		TrendAnalysis:       true,
+	}
+}
+
+// DefaultAttackPatterns returns the built-in attack patterns of the security analyzer
+func DefaultAttackPatterns() []AttackPattern {
+	return []AttackPattern{
+		{
+			Name:        "SQL Injection",
+			Pattern:     regexp.MustCompile(`(?i)(union|select|insert|delete|drop|exec|script|javascript|<script)`),
+			Severity:    "high",
+			Description: "Potential SQL injection or XSS attempt",
+		},
+		{
+			Name:        "Directory Traversal",
+			Pattern:     regexp.MustCompile(`\.\./|\.\.\\|%2e%2e%2f|%2e%2e\\`),
+			Severity:    "medium",
+			Description: "Directory traversal attempt",
+		},
+		{
+			Name:        "Command Injection",
+			Pattern:     regexp.MustCompile(`(?i)(;|&&|\|\||cmd|powershell|bash|sh|exec)`),
+			Severity:    "high",
+			Description: "Command injection attempt",
+		},
+		{
+			Name:        "Brute Force",
+			Pattern:     regexp.MustCompile(`(?i)(admin|login|wp-admin|administrator)`),
+			Severity:    "medium",
+			Description: "Potential brute force attack",
+		},
+		{
+			Name:        "Bot Activity",
+			Pattern:     regexp.MustCompile(`(?i)(bot|crawler|spider|scraper|scanner)`),
+			Severity:    "low",
+			Description: "Automated bot activity",
+		},
+	}
+}
+
+// validate checks a complete configuration, as set by UpdateConfig: unlike in CompileSettings, zero
+// values are not replaced by the defaults and so are invalid.
+func (config MLConfig) validate() error {
+	if config.AnomalyThreshold <= 0 {
+		return fmt.Errorf("anomaly threshold %v is not positive", config.AnomalyThreshold)
+	}
+	if config.PredictionHorizon <= 0 {
+		return fmt.Errorf("prediction horizon %d is not positive", config.PredictionHorizon)
+	}
+	if config.ClusterCount <= 0 {
+		return fmt.Errorf("cluster count %d is not positive", config.ClusterCount)
+	}
+	switch config.SecuritySensitivity {
+	case "low", "medium", "high":
+	default:
+		return fmt.Errorf("security sensitivity %q is not low, medium or high", config.SecuritySensitivity)
+	}
+	if !validAnomalyMethod(config.AnomalyMethod) {
+		return fmt.Errorf("anomaly method %q is not combined, mad or ewma", config.AnomalyMethod)
+	}
+	if config.AnalysisHours <= 0 || config.AnalysisHours > MAX_ANALYSIS_HOURS {
+		return fmt.Errorf("analysis hours %d is not between 1 and %d", config.AnalysisHours, MAX_ANALYSIS_HOURS)
+	}
+	if config.AnalysisLimit <= 0 || config.AnalysisLimit > MAX_ANALYSIS_LIMIT {
+		return fmt.Errorf("analysis limit %d is not between 1 and %d", config.AnalysisLimit, MAX_ANALYSIS_LIMIT)
+	}
+	if _, err := parseIPList(config.SecurityAllowlist); err != nil {
+		return fmt.Errorf("security allowlist: %v", err)
+	}
+	if _, err := parseIPList(config.SecurityDenylist); err != nil {
+		return fmt.Errorf("security denylist: %v", err)
+	}
+	return nil
+}
+
+// resolve fills the zero fields of window with the analysis window of config and clamps both to
+// MAX_ANALYSIS_HOURS and MAX_ANALYSIS_LIMIT
+func (config MLConfig) resolve(window AnalysisWindow) AnalysisWindow {
+	if window.Hours <= 0 {
+		window.Hours = config.AnalysisHours
+	}
+	if window.Limit <= 0 {
+		window.Limit = config.AnalysisLimit
+	}
+	window.Hours = max(1, min(window.Hours, MAX_ANALYSIS_HOURS))
+	window.Limit = max(1, min(window.Limit, MAX_ANALYSIS_LIMIT))
+	return window
+}
+
+// validAnomalyMethod reports whether method is one of ANOMALY_METHODS
+func validAnomalyMethod(method string) bool {
+	for _, known := range ANOMALY_METHODS {
+		if method == known {
+			return true
+		}
+	}
+	return false
+}
+
+// CompileSettings validates the ML section of config.yaml and turns it into the configuration and
+// attack patterns of the analyzers. Zero values keep the defaults. Nothing is returned but the error
+// when any setting is invalid or any pattern fails to compile, so a bad section is never half applied.
+func CompileSettings(settings models.MLSettings) (MLConfig, []AttackPattern, error) {
+	config := DefaultMLConfig()
+
+	if settings.AnomalyThreshold < 0 {
+		return MLConfig{}, nil, fmt.Errorf("anomaly threshold %v is negative", settings.AnomalyThreshold)
+	}
+	if settings.AnomalyThreshold > 0 {
+		config.AnomalyThreshold = settings.AnomalyThreshold
+	}
+
+	if settings.PredictionHorizon < 0 {
+		return MLConfig{}, nil, fmt.Errorf("prediction horizon %d is negative", settings.PredictionHorizon)
+	}
+	if settings.PredictionHorizon > 0 {
+		config.PredictionHorizon = settings.PredictionHorizon
+	}
+
+	if settings.ClusterCount < 0 {
+		return MLConfig{}, nil, fmt.Errorf("cluster count %d is negative", settings.ClusterCount)
+	}
+	if settings.ClusterCount > 0 {
+		config.ClusterCount = settings.ClusterCount
+	}
+
+	switch settings.SecuritySensitivity {
+	case "":
+	case "low", "medium", "high":
+		config.SecuritySensitivity = settings.SecuritySensitivity
+	default:
+		return MLConfig{}, nil, fmt.Errorf("security sensitivity %q is not low, medium or high", settings.SecuritySensitivity)
+	}
+
+	if settings.AnalysisHours < 0 || settings.AnalysisHours > MAX_ANALYSIS_HOURS {
+		return MLConfig{}, nil, fmt.Errorf("analysis hours %d is not between 1 and %d", settings.AnalysisHours, MAX_ANALYSIS_HOURS)
+	}
+	if settings.AnalysisHours > 0 {
+		config.AnalysisHours = settings.AnalysisHours
+	}
+
+	if settings.AnalysisLimit < 0 || settings.AnalysisLimit > MAX_ANALYSIS_LIMIT {
+		return MLConfig{}, nil, fmt.Errorf("analysis limit %d is not between 1 and %d", settings.AnalysisLimit, MAX_ANALYSIS_LIMIT)
+	}
+	if settings.AnalysisLimit > 0 {
+		config.AnalysisLimit = settings.AnalysisLimit
+	}
+
+	switch {
+	case settings.AnomalyMethod == "":
+	case validAnomalyMethod(settings.AnomalyMethod):
+		config.AnomalyMethod = settings.AnomalyMethod
+	default:
+		return MLConfig{}, nil, fmt.Errorf("anomaly method %q is not combined, mad or ewma", settings.AnomalyMethod)
+	}
+
+	if _, err := parseIPList(settings.SecurityAllowlist); err != nil {
+		return MLConfig{}, nil, fmt.Errorf("security allowlist: %v", err)
+	}
+	if _, err := parseIPList(settings.SecurityDenylist); err != nil {
+		return MLConfig{}, nil, fmt.Errorf("security denylist: %v", err)
+	}
+	config.SecurityAllowlist = settings.SecurityAllowlist
+	config.SecurityDenylist = settings.SecurityDenylist
+
+	if err := config.disable(settings.DisabledFeatures); err != nil {
+		return MLConfig{}, nil, err
+	}
+
+	patterns := DefaultAttackPatterns()
+	if len(settings.AttackPatterns) > 0 {
+		compiled, err := compileAttackPatterns(settings.AttackPatterns)
+		if err != nil {
+			return MLConfig{}, nil, err
+		}
+		patterns = compiled
+	}
+
+	extras, err := compileAttackPatterns(settings.ExtraAttackPatterns)
+	if err != nil {
+		return MLConfig{}, nil, err
+	}
+	for _, extra := range extras {
+		patterns = withAttackPattern(patterns, extra)
+	}
+	return config, patterns, nil
+}
+
+// compileAttackPatterns compiles and validates the attack pattern rules of config.yaml, in order
+func compileAttackPatterns(rules []models.AttackPatternRule) ([]AttackPattern, error) {
+	patterns := make([]AttackPattern, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("attack pattern %d has no name", i+1)
+		}
+		compiled, err := regexp.Compile(rule.Pattern)
+		if err != nil || rule.Pattern == "" {
+			return nil, fmt.Errorf("attack pattern %q does not compile: %v", rule.Name, err)
+		}
+		severity := rule.Severity
+		if severity == "" {
+			severity = "medium"
+		}
+		pattern := AttackPattern{
+			Name:        rule.Name,
+			Pattern:     compiled,
+			Severity:    severity,
+			Description: rule.Description,
+		}
+		if err := pattern.validate(); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// validate checks that pattern has a name, a regular expression and a known severity
+func (pattern AttackPattern) validate() error {
+	if pattern.Name == "" {
+		return fmt.Errorf("attack pattern has no name")
+	}
+	if pattern.Pattern == nil {
+		return fmt.Errorf("attack pattern %q has no regular expression", pattern.Name)
+	}
+	if _, ok := alertSeverityRank[pattern.Severity]; !ok {
+		return fmt.Errorf("attack pattern %q has severity %q, expected low, medium, high or critical", pattern.Name, pattern.Severity)
+	}
+	return nil
+}
+
+// withAttackPattern returns a copy of patterns with pattern replacing the one of the same name, or
+// added after the others when there is none. patterns itself is left untouched, as it may be shared.
+func withAttackPattern(patterns []AttackPattern, pattern AttackPattern) []AttackPattern {
+	updated := make([]AttackPattern, 0, len(patterns)+1)
+	replaced := false
+	for _, current := range patterns {
+		if current.Name == pattern.Name {
+			current, replaced = pattern, true
+		}
+		updated = append(updated, current)
+	}
+	if !replaced {
+		updated = append(updated, pattern)
+	}
+	return updated
+}
@@ -8,7 +8,7 @@ package models
 type DB_Config struct {
 
 	// Database struct holds the connection details for the database, including
-	// the port, host, username, password, database name, and SSL mode.
+	// the port, host, username, password, database name, SSL mode, driver and connection pool limits.
 	Database struct {
 		// DBPort is the port number on which the database server is running.
 		// This value is used to establish the connection to the database.
@@ -34,6 +34,17 @@ type DB_Config struct {
 		// This can be values like "disable", "require", "verify-full", etc., depending on 
 		// the security requirements of the database server.
 		DBSslMode string `yaml:"DB_SSLMODE"`
+
+		// DBDriver is the database the logs are stored in, "postgres" or "mysql".
+		// It selects the driver, the connection string and the query placeholder style.
+		DBDriver string `yaml:"DB_DRIVER"`
+
+		// DBMaxOpenConns caps the open connections of the pool, DBMaxIdleConns the idle ones kept
+		// around, and DBConnMaxLifetime is the seconds a connection is reused before it is replaced.
+		// Values of 0 or less fall back to the defaults.
+		DBMaxOpenConns    int `yaml:"DB_MAX_OPEN_CONNS"`
+		DBMaxIdleConns    int `yaml:"DB_MAX_IDLE_CONNS"`
+		DBConnMaxLifetime int `yaml:"DB_CONN_MAX_LIFETIME"`
 	} `yaml:"database"`
 
 	// Logs struct defines the log table settings, including the table name and 
@@ -49,4 +49,113 @@ type Log struct {
 	// and any proxy servers through which the request passed.
 	// This is useful when the application is behind a reverse proxy or load balancer.
 	HttpXForwardedFor string `json:"http_x_forwarded_for"`
+
+	// IngestedAt is the time the log was written to the database. It is set by the
+	// column default on insert, so it is only populated for logs read back from storage.
+	IngestedAt *time.Time `json:"ingested_at,omitempty"`
+
+	// ResponseTime is nginx's $request_time: the seconds spent serving the request, with millisecond
+	// resolution. It is only logged by formats that append it to the combined format, so it may be nil.
+	ResponseTime *float64 `json:"response_time,omitempty"`
+
+	// ServerName is nginx's $server_name: the virtual host that served the request. It is only logged by
+	// formats that append it as a quoted field, or by JSON logs that carry it, so it may be nil.
+	ServerName *string `json:"server_name,omitempty"`
+
+	// RawLine is the line the log was parsed from. It is only stored when PARSER_STORE_RAW_LINE is
+	// enabled and only returned by GET /logs/{id}, so it is usually nil.
+	RawLine *string `json:"raw_line,omitempty"`
+
+	// TenantID is the tenant the log was ingested for, taken from the API key of the request that sent it.
+	// It is never read from the log itself nor returned, so a tenant cannot write or see another's.
+	TenantID string `json:"-"`
+
+	// DedupKey identifies the line the log was parsed from, and its tenant, while PARSER_IDEMPOTENT_INSERTS
+	// is enabled: a log whose key is already stored is skipped. It is never returned.
+	DedupKey string `json:"-"`
+}
+
+// IngestLag returns how long after the request the log was ingested (ingested_at - time_local).
+// It returns 0 when IngestedAt is not set.
+func (l Log) IngestLag() time.Duration {
+	if l.IngestedAt == nil {
+		return 0
+	}
+	return l.IngestedAt.Sub(l.TimeLocal)
+}
+
+// LogEpochMillis renders a Log with its timestamps as integer milliseconds since the Unix epoch,
+// for clients that request time_format=epoch_ms.
+type LogEpochMillis struct {
+	Log
+	TimeLocal  int64  `json:"time_local"`
+	IngestedAt *int64 `json:"ingested_at,omitempty"`
+}
+
+// EpochMillis returns the epoch-milliseconds rendering of the log.
+func (l Log) EpochMillis() LogEpochMillis {
+	out := LogEpochMillis{Log: l, TimeLocal: l.TimeLocal.UnixMilli()}
+	if l.IngestedAt != nil {
+		ingestedAt := l.IngestedAt.UnixMilli()
+		out.IngestedAt = &ingestedAt
+	}
+	return out
+}
+
+// RequestLine holds the parts of a request line ("GET /index.html HTTP/1.1") that are stored
+// alongside the raw request so logs can be filtered by method and path.
+type RequestLine struct {
+	Method   string `json:"request_method"`
+	Path     string `json:"request_path"`
+	Protocol string `json:"request_protocol"`
+
+	// UnknownMethod is set when Method is neither a standard HTTP method nor a configured extension method.
+	UnknownMethod bool `json:"-"`
+}
+
+// LogJSONFields lists the json field names of Log that ingestion can populate.
+var LogJSONFields = []string{
+	"remote_addr", "remote_user", "time_local", "request", "status",
+	"body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for", "response_time",
+	"server_name",
+}
+
+// RequiredLogJSONFields lists the fields a JSON log line must provide (directly or via mapping) to be accepted.
+var RequiredLogJSONFields = []string{"remote_addr", "time_local", "request", "status"}
+
+// MissingFields returns the fields among required (json field names) that the log lacks:
+// empty strings, a zero time_local, or a status outside 100-599. body_bytes_sent is always present.
+func (l Log) MissingFields(required []string) []string {
+	var missing []string
+	for _, field := range required {
+		var present bool
+		switch field {
+		case "remote_addr":
+			present = l.RemoteAddr != ""
+		case "remote_user":
+			present = l.RemoteUser != ""
+		case "time_local":
+			present = !l.TimeLocal.IsZero()
+		case "request":
+			present = l.Request != ""
+		case "status":
+			present = l.Status >= 100 && l.Status <= 599
+		case "body_bytes_sent":
+			present = l.BodyBytesSent >= 0
+		case "http_referer":
+			present = l.HttpReferer != ""
+		case "http_user_agent":
+			present = l.HttpUserAgent != ""
+		case "http_x_forwarded_for":
+			present = l.HttpXForwardedFor != ""
+		case "response_time":
+			present = l.ResponseTime != nil
+		case "server_name":
+			present = l.ServerName != nil
+		}
+		if !present {
+			missing = append(missing, field)
+		}
+	}
+	return missing
 }
@@ -3,9 +3,11 @@ package models
 import (
 	_"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"github.com/stretchr/testify/assert"
 )
@@ -70,3 +72,27 @@ func TestSendResponse_MarshalError(t *testing.T) {
 	bodyBytes, _ := io.ReadAll(result.Body)
 	assert.Equal(t, "Internal Server Error\n", string(bodyBytes))
 }
+
+// TestConfigString checks that printing the configuration, as the server does on startup and reload,
+// keeps its settings but none of its secrets.
+func TestConfigString(t *testing.T) {
+	config := Config{
+		PORT:             ":8083",
+		AdminToken:       "admin-secret",
+		APIKey:           "api-secret",
+		CursorSecret:     "cursor-secret",
+		ArchiveAccessKey: "access-secret",
+		ArchiveSecretKey: "archive-secret",
+		MLAlertWebhook:   "https://hooks.example.com/webhook-secret",
+		Tenants:          map[string]string{"tenant-key-secret": "acme"},
+	}
+
+	for _, printed := range []string{config.String(), fmt.Sprint(config), fmt.Sprintf("%v", &config)} {
+		assert.Contains(t, printed, ":8083")
+		assert.Contains(t, printed, "acme")
+		assert.Contains(t, printed, REDACTED)
+		assert.False(t, strings.Contains(printed, "secret"), "secret printed in %s", printed)
+	}
+	assert.Equal(t, "admin-secret", config.AdminToken, "the configuration itself is left untouched")
+	assert.NotContains(t, Config{}.String(), REDACTED)
+}
@@ -17,4 +17,12 @@ type Pagination struct {
 	Limit int `json:"limit"`
 	Cursor *time.Time `json:"cursor"`
 	CursorID   *int 
+	// CursorBy selects the ordering the cursor pages through: "time" or "id".
+	CursorBy string `json:"cursor_by"`
+	// SortBy and Order select the column GET /logs is sorted on and its direction, "asc" or "desc".
+	// Empty means time_local, newest first.
+	SortBy string `json:"sort_by"`
+	Order  string `json:"order"`
+	// Direction is "prev" to read the page before the cursor instead of the one after it.
+	Direction string `json:"direction"`
 }
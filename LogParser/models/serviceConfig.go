@@ -1,6 +1,11 @@
 // Package models defines the data structure used for storing configuration settings.
 package models
 
+import (
+	"fmt"
+	"sort"
+)
+
 // Config struct represents the configuration settings of the application.
 // It holds the necessary configuration data, such as the server port.
 type Config struct {
@@ -8,4 +13,319 @@ type Config struct {
 	// It is fetched from a YAML configuration file and passed as a string.
 	// Example: "8080"
 	PORT string `yaml:"PORT"`
+
+	// StrictParse makes AddLogsHandler reject the whole batch when any line fails to parse.
+	// When false (the default), unparseable lines are tolerated and the rest of the batch is stored.
+	StrictParse bool `yaml:"STRICT_PARSE"`
+
+	// JSONFieldMap renames keys of JSON log lines onto the Log model's json field names
+	// before decoding, e.g. {"client_ip": "remote_addr", "status_code": "status"}.
+	JSONFieldMap map[string]string `yaml:"JSON_FIELD_MAP"`
+
+	// LogRegex is the regular expression log lines are parsed with instead of the built-in one. Its named
+	// groups map onto the Log model's json field names, e.g. (?P<remote_addr>\S+); remote_addr, time_local,
+	// request and status are required and groups with other names are ignored.
+	LogRegex string `yaml:"LOG_REGEX"`
+
+	// RequiredFields lists the Log json fields a parsed line must carry to be stored, see Log.MissingFields.
+	// Lines lacking any of them are dropped and counted as rejected.
+	RequiredFields []string `yaml:"REQUIRED_FIELDS"`
+
+	// ExtraMethods lists request methods accepted besides the standard HTTP ones, such as WebDAV's PROPFIND.
+	// Logs with any other method are still stored, but flagged in the POST /logs response.
+	ExtraMethods []string `yaml:"EXTRA_METHODS"`
+
+	// ShutdownTimeout is the number of seconds in-flight requests get to finish on shutdown.
+	// When it expires, remaining AddLogs requests are aborted and their batches are not inserted.
+	ShutdownTimeout int `yaml:"SHUTDOWN_TIMEOUT"`
+
+	// InsertMaxRetries is how many times an insert failing with a Postgres serialization
+	// failure (40001) or deadlock (40P01) is retried, with exponential backoff. 0 disables retries.
+	InsertMaxRetries int `yaml:"INSERT_MAX_RETRIES"`
+
+	// InsertTimeout is the number of seconds a POST /logs batch insert may take before it is
+	// cancelled and rolled back. 0 disables the timeout.
+	InsertTimeout int `yaml:"INSERT_TIMEOUT"`
+
+	// QueryTimeout is the number of seconds a database query of GET /logs, GET /logs/count or
+	// DELETE /logs may take before it is cancelled and answered with 504. 0 disables the timeout.
+	QueryTimeout int `yaml:"QUERY_TIMEOUT"`
+
+	// InsertChunkSize is the number of logs written per INSERT statement; larger POST /logs batches
+	// are split into chunks of this size.
+	InsertChunkSize int `yaml:"INSERT_CHUNK_SIZE"`
+
+	// InsertAutoTune lets the parser adjust the chunk size within [InsertChunkMin, InsertChunkMax],
+	// starting from InsertChunkSize, towards the size with the best observed throughput.
+	InsertAutoTune bool `yaml:"INSERT_AUTO_TUNE"`
+	InsertChunkMin int  `yaml:"INSERT_CHUNK_MIN"`
+	InsertChunkMax int  `yaml:"INSERT_CHUNK_MAX"`
+
+	// InsertCopy writes each chunk with a COPY instead of a multi-row INSERT, which is faster for
+	// large batches.
+	InsertCopy bool `yaml:"INSERT_COPY"`
+
+	// IdempotentInserts stores each log with a dedup_key hashing its line and tenant, unique in the logs
+	// table, and skips logs whose key is already stored, so re-posting a batch stores nothing twice. Chunks
+	// are then always written with INSERT, as a COPY cannot skip them.
+	IdempotentInserts bool `yaml:"IDEMPOTENT_INSERTS"`
+
+	// MaxLines caps the number of lines in one POST /logs batch. The body is decoded as a stream
+	// and rejected with 413 as soon as the cap is exceeded. 0 disables the cap.
+	MaxLines int `yaml:"MAX_LINES"`
+
+	// Workers is the number of goroutines parsing the lines of a POST /logs batch. 0 uses one per CPU.
+	Workers int `yaml:"WORKERS"`
+
+	// MaxBodyBytes caps the size of a POST /logs body in bytes. 0 disables the cap.
+	MaxBodyBytes int `yaml:"MAX_BODY_BYTES"`
+
+	// CoalesceRequests makes concurrent identical GET requests to the read endpoints share one
+	// execution and its response instead of each querying the database.
+	CoalesceRequests bool `yaml:"COALESCE_REQUESTS"`
+
+	// StatsCacheTTL is how many seconds the responses of the /stats endpoints are cached. Cached responses
+	// are dropped as soon as logs are inserted or deleted through this parser. 0 disables the cache.
+	StatsCacheTTL int `yaml:"STATS_CACHE_TTL"`
+
+	// IndexedColumns lists the logs columns that get an index, created on startup if missing. Indexes on
+	// columns left out are not created; ones that already exist are left in place.
+	IndexedColumns []string `yaml:"INDEXED_COLUMNS"`
+
+	// RequestIDHeader names the header echoing the request id on every response. A client-sent id in
+	// that header is reused, otherwise one is generated. Empty disables request ids.
+	RequestIDHeader string `yaml:"REQUEST_ID_HEADER"`
+
+	// TenantHeader names the header carrying the API key that scopes a request to its tenant.
+	TenantHeader string `yaml:"TENANT_HEADER"`
+
+	// Tenants maps API keys to the tenant they belong to. While set, every log and stats request must carry
+	// a known key and only sees, deletes and ingests its tenant's logs. It is only read from config.yaml.
+	Tenants map[string]string `yaml:"TENANTS"`
+
+	// AdminToken is the bearer token required by the /admin endpoints.
+	// Admin endpoints are disabled while it is empty.
+	AdminToken string `yaml:"ADMIN_TOKEN"`
+
+	// APIKey is the key the endpoints that modify logs require in the X-API-Key header.
+	// Their writes are rejected while it is empty, unless AllowAnonymousWrites is set.
+	APIKey string `yaml:"API_KEY"`
+
+	// AllowAnonymousWrites opens the endpoints that modify logs to every request while APIKey is empty.
+	AllowAnonymousWrites bool `yaml:"ALLOW_ANONYMOUS_WRITES"`
+
+	// CursorSecret is the HMAC key signing the GET /logs pagination cursors. When empty, a random
+	// key is generated per process and cursors stop validating after a restart.
+	CursorSecret string `yaml:"CURSOR_SECRET"`
+
+	// ArchiveBucket is the S3 bucket /admin/archive uploads to. Archiving is disabled while it is empty.
+	ArchiveBucket string `yaml:"ARCHIVE_BUCKET"`
+
+	// ArchiveRegion is the region of ArchiveBucket.
+	ArchiveRegion string `yaml:"ARCHIVE_REGION"`
+
+	// ArchiveEndpoint overrides the S3 endpoint, e.g. for MinIO or another S3-compatible service.
+	ArchiveEndpoint string `yaml:"ARCHIVE_ENDPOINT"`
+
+	// ArchivePrefix is prepended to the keys of archive objects, e.g. "logs/".
+	ArchivePrefix string `yaml:"ARCHIVE_PREFIX"`
+
+	// ArchiveAccessKey and ArchiveSecretKey are the credentials used to sign the uploads.
+	ArchiveAccessKey string `yaml:"ARCHIVE_ACCESS_KEY"`
+	ArchiveSecretKey string `yaml:"ARCHIVE_SECRET_KEY"`
+
+	// Partitioning creates the logs table partitioned by month of time_local (Postgres 11+), so retention
+	// can drop whole months. It only applies when the table is created; existing tables are left as they are.
+	Partitioning bool `yaml:"PARTITIONING"`
+
+	// PartitionsAhead is how many upcoming monthly partitions are kept created in advance.
+	PartitionsAhead int `yaml:"PARTITIONS_AHEAD"`
+
+	// RetentionDays is how long logs are kept, by time_local. Older logs are purged periodically,
+	// by dropping whole monthly partitions on a partitioned table. 0 keeps logs forever.
+	RetentionDays int `yaml:"RETENTION_DAYS"`
+
+	// MaintenanceInterval is the number of seconds between retention purges, which also create upcoming
+	// partitions and purge expired batch ids. It is read on startup.
+	MaintenanceInterval int `yaml:"MAINTENANCE_INTERVAL"`
+
+	// DedupStrings stores each distinct user agent and referer once, in lookup tables referenced by id,
+	// instead of repeating the strings on every log row. Reads join the values back transparently.
+	DedupStrings bool `yaml:"DEDUP_STRINGS"`
+
+	// BatchAckTTL is how many seconds the ids of processed POST /logs batches (X-Batch-ID header) are
+	// remembered, so a retried batch is answered with its original result instead of being inserted again.
+	// 0 disables batch acknowledgement.
+	BatchAckTTL int `yaml:"BATCH_ACK_TTL"`
+
+	// StoreRawLine stores each ingested line verbatim in the raw_line column, so logs can be audited or
+	// re-parsed later. It is off by default because it roughly doubles the size of every row.
+	StoreRawLine bool `yaml:"STORE_RAW_LINE"`
+
+	// SampleRate is the fraction of valid logs kept at ingestion, greater than 0 and at most 1. Each stored
+	// log records the rate it was sampled at, so counts can be scaled back up to estimated totals.
+	SampleRate float64 `yaml:"SAMPLE_RATE"`
+
+	// RateLimit is the number of requests per second each client may make, on average. 0 disables
+	// rate limiting.
+	RateLimit float64 `yaml:"RATE_LIMIT"`
+
+	// RateLimitBurst is the number of requests a client may make at once, before RateLimit applies.
+	// When 0 it is the rate, at least 1.
+	RateLimitBurst int `yaml:"RATE_LIMIT_BURST"`
+
+	// RateLimitTrustProxy identifies clients by the last address of X-Forwarded-For, the one appended by
+	// the proxy, instead of the address they connect from. Only enable it behind a proxy that sets the header.
+	RateLimitTrustProxy bool `yaml:"RATE_LIMIT_TRUST_PROXY"`
+
+	// CORSOrigins lists the browser origins, or "*" for any, allowed to call the stats, ML and other read
+	// endpoints from a dashboard. No CORS headers are sent while it is empty.
+	CORSOrigins []string `yaml:"CORS_ORIGINS"`
+
+	// StrictFilters rejects log queries and deletes carrying a query parameter they do not know, such as
+	// a mistyped filter, with 400. Otherwise the parameter is ignored with a warning.
+	StrictFilters bool `yaml:"STRICT_FILTERS"`
+
+	// LogFormat is the format of the service's own logs: "text" for people or "json", one object per
+	// line with the request id, method and path of request logs as keys, for log collectors.
+	LogFormat string `yaml:"LOG_FORMAT"`
+
+	// AlertInterval is the number of seconds between evaluations of the alert rules. 0 disables alerting.
+	AlertInterval int `yaml:"ALERT_INTERVAL"`
+
+	// AlertRules are the threshold alert rules evaluated by the alert loop. They are only read from config.yaml.
+	AlertRules []AlertRule `yaml:"ALERT_RULES"`
+
+	// ML tunes the ML analyzers. It is only read from config.yaml, on startup and by POST /admin/reload-ml.
+	ML MLSettings `yaml:"ML"`
+
+	// MLInsightsTTL is the number of seconds the ML endpoints reuse computed insights instead of
+	// analyzing the logs again. 0 computes them on every request.
+	MLInsightsTTL int `yaml:"ML_INSIGHTS_TTL"`
+
+	// MLAlertWebhook is the URL the JSON of every new ML alert of at least MLAlertWebhookSeverity is
+	// posted to. No webhook is called while it is empty.
+	MLAlertWebhook string `yaml:"ML_ALERT_WEBHOOK"`
+
+	// MLAlertWebhookSeverity is the lowest severity of the alerts posted to MLAlertWebhook: low, medium,
+	// high or critical.
+	MLAlertWebhookSeverity string `yaml:"ML_ALERT_WEBHOOK_SEVERITY"`
+}
+
+// MLSettings is the ML section of config.yaml. Fields left at their zero value keep the built-in defaults.
+type MLSettings struct {
+	// AnomalyThreshold is the z-score above which a point is reported as an anomaly. Defaults to 2.5.
+	AnomalyThreshold float64 `yaml:"ANOMALY_THRESHOLD"`
+
+	// PredictionHorizon is the number of hours predicted when a request does not ask for more. Defaults to 24.
+	PredictionHorizon int `yaml:"PREDICTION_HORIZON"`
+
+	// ClusterCount is the number of user clusters. Defaults to 3.
+	ClusterCount int `yaml:"CLUSTER_COUNT"`
+
+	// SecuritySensitivity is one of "low", "medium" or "high". Defaults to "medium".
+	SecuritySensitivity string `yaml:"SECURITY_SENSITIVITY"`
+
+	// AnomalyMethod is the anomaly detection method: "combined" (Z-score or IQR), "mad" (median absolute
+	// deviation) or "ewma" (residual from the exponentially weighted moving average). Defaults to "combined".
+	AnomalyMethod string `yaml:"ANOMALY_METHOD"`
+
+	// AnalysisHours is the number of hours of logs analyzed, at most 720. Defaults to 24.
+	AnalysisHours int `yaml:"ANALYSIS_HOURS"`
+
+	// AnalysisLimit is the number of most recent logs analyzed at most, up to 100000. Defaults to 10000.
+	AnalysisLimit int `yaml:"ANALYSIS_LIMIT"`
+
+	// SecurityAllowlist lists the IPs and CIDR ranges, e.g. "10.0.0.0/8", the security analyzer never
+	// reports as threats.
+	SecurityAllowlist []string `yaml:"SECURITY_ALLOWLIST"`
+
+	// SecurityDenylist lists the IPs and CIDR ranges the security analyzer always reports as high
+	// severity threats, without further analysis.
+	SecurityDenylist []string `yaml:"SECURITY_DENYLIST"`
+
+	// DisabledFeatures lists the ML features skipped to save compute: "anomaly_detection",
+	// "traffic_prediction", "security_analysis", "user_clustering" or "trend_analysis".
+	DisabledFeatures []string `yaml:"DISABLED_FEATURES"`
+
+	// AttackPatterns replace the built-in attack patterns of the security analyzer when set.
+	AttackPatterns []AttackPatternRule `yaml:"ATTACK_PATTERNS"`
+
+	// ExtraAttackPatterns are added to the built-in attack patterns, or to AttackPatterns when set. An extra
+	// pattern replaces the pattern of the same name.
+	ExtraAttackPatterns []AttackPatternRule `yaml:"EXTRA_ATTACK_PATTERNS"`
+}
+
+// AttackPatternRule describes an attack pattern matched against the request, user agent and referer of logs.
+type AttackPatternRule struct {
+	// Name is reported as the threat type of matching logs.
+	Name string `yaml:"NAME"`
+
+	// Pattern is a Go regular expression.
+	Pattern string `yaml:"PATTERN"`
+
+	// Severity is reported on the threats found: "low", "medium", "high" or "critical". Defaults to "medium".
+	Severity string `yaml:"SEVERITY"`
+
+	// Description is reported on the threats found.
+	Description string `yaml:"DESCRIPTION"`
+}
+
+// AlertRule describes a threshold alert, e.g. "5xx_rate > 5 over the last 300 seconds".
+type AlertRule struct {
+	// Name identifies the rule; at most one alert per rule is active at a time.
+	Name string `yaml:"NAME"`
+
+	// Metric is one of "request_count", "error_rate", "4xx_rate" or "5xx_rate".
+	// Rates are percentages of the requests in the window.
+	Metric string `yaml:"METRIC"`
+
+	// Window is the number of seconds of logs, counted back from now, the metric is computed over.
+	Window int `yaml:"WINDOW"`
+
+	// Comparator is one of ">", ">=", "<" or "<=" and is applied as: metric <comparator> threshold.
+	Comparator string `yaml:"COMPARATOR"`
+
+	// Threshold is the value the metric is compared against.
+	Threshold float64 `yaml:"THRESHOLD"`
+
+	// Severity is reported on the alerts raised by the rule. Defaults to "warning".
+	Severity string `yaml:"SEVERITY"`
+}
+
+// REDACTED replaces the secrets of the configuration when it is printed.
+const REDACTED string = "[REDACTED]"
+
+// String formats the configuration for logs with its secrets redacted: the admin token, API key, cursor
+// secret, archive credentials, alert webhook URL and the API keys of the tenants, which are listed as
+// numbered placeholders instead.
+func (c Config) String() string {
+	type config Config // Has no String method, so printing it does not recurse
+	redacted := config(c)
+	redacted.AdminToken = redact(c.AdminToken)
+	redacted.APIKey = redact(c.APIKey)
+	redacted.CursorSecret = redact(c.CursorSecret)
+	redacted.ArchiveAccessKey = redact(c.ArchiveAccessKey)
+	redacted.ArchiveSecretKey = redact(c.ArchiveSecretKey)
+	redacted.MLAlertWebhook = redact(c.MLAlertWebhook)
+	if len(c.Tenants) > 0 {
+		tenants := make([]string, 0, len(c.Tenants))
+		for _, tenant := range c.Tenants {
+			tenants = append(tenants, tenant)
+		}
+		sort.Strings(tenants)
+		redacted.Tenants = make(map[string]string, len(tenants))
+		for i, tenant := range tenants {
+			redacted.Tenants[fmt.Sprintf("%s#%d", REDACTED, i+1)] = tenant
+		}
+	}
+	return fmt.Sprintf("%+v", redacted)
+}
+
+// redact returns REDACTED in place of a set secret, and an unset one as it is.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return REDACTED
 }
@@ -0,0 +1,14 @@
+// Package storage provides the object-storage backends log archives are written to.
+// Backends implement Storage; S3Storage talks to Amazon S3 or any S3-compatible service.
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Storage stores objects under a key.
+type Storage interface {
+	// Put uploads size bytes read from body as the object key, replacing any existing object.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+}
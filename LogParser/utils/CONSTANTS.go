@@ -9,6 +9,57 @@ const KEY_PORT string = "PARSER_PORT"               // The key for the port on w
 const KEY_ALIVE_URL string = "PARSER_ALIVE_URL"     // The key for the URL that checks the parser service's health.
 const KEY_GET_COUNT_URL string = "PARSER_GET_COUNT_URL"  // The key for the URL to get the log count.
 const KEY_MAIN_URL string = "PARSER_MAIN_URL"       // The key for the main URL endpoint for logs.
+const KEY_STRICT_PARSE string = "PARSER_STRICT_PARSE" // The key for enabling strict (all-or-nothing) batch parsing.
+const KEY_JSON_FIELD_MAP string = "PARSER_JSON_FIELD_MAP" // The key for the JSON log field mapping, e.g. "client_ip=remote_addr,status_code=status".
+const KEY_LOG_REGEX string = "PARSER_LOG_REGEX" // The key for the regular expression log lines are parsed with, with named groups per Log field.
+const KEY_REQUIRED_FIELDS string = "PARSER_REQUIRED_FIELDS" // The key for the fields a parsed log must carry to be stored, e.g. "remote_addr,status,time_local".
+const KEY_EXTRA_METHODS string = "PARSER_EXTRA_METHODS" // The key for the request methods known besides the standard ones, e.g. "PROPFIND,MKCOL".
+const KEY_SHUTDOWN_TIMEOUT string = "PARSER_SHUTDOWN_TIMEOUT" // The key for the graceful shutdown drain timeout, in seconds.
+const KEY_INSERT_MAX_RETRIES string = "PARSER_INSERT_MAX_RETRIES" // The key for the number of retries on serialization/deadlock errors.
+const KEY_INSERT_TIMEOUT string = "PARSER_INSERT_TIMEOUT" // The key for the batch insert timeout, in seconds.
+const KEY_QUERY_TIMEOUT string = "PARSER_QUERY_TIMEOUT"   // The key for the read and delete query timeout, in seconds.
+const KEY_INSERT_CHUNK_SIZE string = "PARSER_INSERT_CHUNK_SIZE" // The key for the number of logs written per INSERT statement.
+const KEY_INSERT_AUTO_TUNE string = "PARSER_INSERT_AUTO_TUNE" // The key for enabling the insert chunk size auto-tuner.
+const KEY_INSERT_CHUNK_MIN string = "PARSER_INSERT_CHUNK_MIN" // The key for the smallest chunk size the auto-tuner may pick.
+const KEY_INSERT_CHUNK_MAX string = "PARSER_INSERT_CHUNK_MAX" // The key for the largest chunk size the auto-tuner may pick.
+const KEY_INSERT_COPY string = "PARSER_INSERT_COPY" // The key for writing chunks with COPY instead of INSERT.
+const KEY_IDEMPOTENT_INSERTS string = "PARSER_IDEMPOTENT_INSERTS" // The key for skipping logs already stored instead of storing them again.
+const KEY_MAX_LINES string = "PARSER_MAX_LINES"   // The key for the maximum number of lines accepted in one POST /logs batch.
+const KEY_WORKERS string = "PARSER_WORKERS"       // The key for the number of workers parsing a POST /logs batch.
+const KEY_MAX_BODY_BYTES string = "PARSER_MAX_BODY_BYTES" // The key for the maximum POST /logs body size in bytes.
+const KEY_COALESCE_REQUESTS string = "PARSER_COALESCE_REQUESTS" // The key for sharing one execution among identical concurrent reads.
+const KEY_STATS_CACHE_TTL string = "PARSER_STATS_CACHE_TTL" // The key for the seconds stats responses are cached.
+const KEY_INDEXED_COLUMNS string = "PARSER_INDEXED_COLUMNS" // The key for the logs columns that get an index, e.g. "time_local,status".
+const KEY_REQUEST_ID_HEADER string = "PARSER_REQUEST_ID_HEADER" // The key for the header carrying the request id of every response.
+const KEY_TENANT_HEADER string = "PARSER_TENANT_HEADER" // The key for the header carrying the API key of a tenant.
+const KEY_ADMIN_TOKEN string = "PARSER_ADMIN_TOKEN" // The key for the token guarding the /admin endpoints.
+const KEY_API_KEY string = "PARSER_API_KEY"         // The key for the API key required by the endpoints that modify logs.
+const KEY_ALLOW_ANONYMOUS_WRITES string = "PARSER_ALLOW_ANONYMOUS_WRITES" // The key for accepting writes without an API key while none is configured.
+const KEY_CURSOR_SECRET string = "PARSER_CURSOR_SECRET" // The key for the HMAC secret signing pagination cursors.
+const KEY_ARCHIVE_BUCKET string = "PARSER_ARCHIVE_BUCKET" // The key for the S3 bucket log archives are uploaded to.
+const KEY_ARCHIVE_REGION string = "PARSER_ARCHIVE_REGION" // The key for the region of the archive bucket.
+const KEY_ARCHIVE_ENDPOINT string = "PARSER_ARCHIVE_ENDPOINT" // The key for an S3-compatible endpoint overriding the AWS one.
+const KEY_ARCHIVE_PREFIX string = "PARSER_ARCHIVE_PREFIX" // The key for the prefix of archive object keys.
+const KEY_ARCHIVE_ACCESS_KEY string = "AWS_ACCESS_KEY_ID"   // The key for the access key signing archive uploads.
+const KEY_ARCHIVE_SECRET_KEY string = "AWS_SECRET_ACCESS_KEY" // The key for the secret key signing archive uploads.
+const KEY_PARTITIONING string = "PARSER_PARTITIONING" // The key for creating the logs table partitioned by month.
+const KEY_PARTITIONS_AHEAD string = "PARSER_PARTITIONS_AHEAD" // The key for the number of upcoming monthly partitions created in advance.
+const KEY_RETENTION_DAYS string = "PARSER_RETENTION_DAYS" // The key for the number of days logs are kept.
+const KEY_MAINTENANCE_INTERVAL string = "PARSER_MAINTENANCE_INTERVAL" // The key for the seconds between retention purges and partition upkeep.
+const KEY_DEDUP_STRINGS string = "PARSER_DEDUP_STRINGS" // The key for storing user agents and referers in lookup tables.
+const KEY_ALERT_INTERVAL string = "PARSER_ALERT_INTERVAL" // The key for the seconds between alert rule evaluations.
+const KEY_ML_INSIGHTS_TTL string = "PARSER_ML_INSIGHTS_TTL" // The key for the seconds computed ML insights are reused.
+const KEY_ML_ALERT_WEBHOOK string = "PARSER_ML_ALERT_WEBHOOK" // The key for the URL new ML alerts are posted to.
+const KEY_ML_ALERT_WEBHOOK_SEVERITY string = "PARSER_ML_ALERT_WEBHOOK_SEVERITY" // The key for the lowest severity of the ML alerts posted to the webhook.
+const KEY_BATCH_ACK_TTL string = "PARSER_BATCH_ACK_TTL" // The key for the seconds processed batch ids are remembered.
+const KEY_STORE_RAW_LINE string = "PARSER_STORE_RAW_LINE" // The key for storing the raw line of each ingested log.
+const KEY_SAMPLE_RATE string = "PARSER_SAMPLE_RATE" // The key for the fraction of logs kept at ingestion.
+const KEY_RATE_LIMIT string = "PARSER_RATE_LIMIT" // The key for the requests per second allowed to each client.
+const KEY_RATE_LIMIT_BURST string = "PARSER_RATE_LIMIT_BURST" // The key for the requests a client may make at once.
+const KEY_RATE_LIMIT_TRUST_PROXY string = "PARSER_RATE_LIMIT_TRUST_PROXY" // The key for rate limiting clients by X-Forwarded-For.
+const KEY_CORS_ORIGINS string = "PARSER_CORS_ORIGINS" // The key for the browser origins allowed to call the read endpoints.
+const KEY_STRICT_FILTERS string = "PARSER_STRICT_FILTERS" // The key for rejecting requests with unknown query parameters.
+const KEY_LOG_FORMAT string = "PARSER_LOG_FORMAT" // The key for the format of the service's own logs, text or json.
 
 
 // Constants for database configuration keys.
@@ -18,6 +69,10 @@ const KEY_DB_USERNAME string = "DB_USERNAME"        // The key for the database
 const KEY_DB_PASSWORD string = "DB_PASSWORD"        // The key for the database password.
 const KEY_DB_NAME string = "DB_NAME"                // The key for the database name.
 const KEY_DB_SSLMODE string = "DB_SSLMODE"          // The key for the database SSL mode.
+const KEY_DB_DRIVER string = "DB_DRIVER"            // The key for the database driver, postgres or mysql.
+const KEY_DB_MAX_OPEN_CONNS string = "DB_MAX_OPEN_CONNS" // The key for the maximum number of open database connections.
+const KEY_DB_MAX_IDLE_CONNS string = "DB_MAX_IDLE_CONNS" // The key for the maximum number of idle database connections.
+const KEY_DB_CONN_MAX_LIFETIME string = "DB_CONN_MAX_LIFETIME" // The key for the seconds a database connection is reused.
 
 // Constants for database table and query keys.
 const KEY_DB_TABLE_NAME string = "TABLE_NAME"       // The key for the database table name.
@@ -30,6 +85,52 @@ const PARSER_PORT string = ":8083"                  // Default port for the pars
 const PARSER_ALIVE_URL string = "/"                 // Default URL for checking the parser service's health.
 const PARSER_MAIN_URL string = "/logs"              // Default main URL for the logs endpoint.
 const PARSER_GET_COUNT_URL string = "/logs/count"   // Default URL for retrieving the log count.
+const PARSER_CAPABILITIES_URL string = "/capabilities" // Default URL reporting the features of this instance.
+const PARSER_STATUS_URL string = "/status"           // Default URL reporting the health of this instance.
+const PARSER_METRICS_URL string = "/metrics"         // Default URL exposing the Prometheus metrics.
+const PARSER_MAX_PAGE_LIMIT int = 100               // Largest number of logs GET /logs returns per page.
+const API_VERSION string = "1"                      // Version of the HTTP API, reported by the capabilities endpoint.
+const PARSER_STRICT_PARSE bool = false              // Default parse mode is lenient.
+const PARSER_REQUIRED_FIELDS string = "remote_addr,status,time_local" // Default fields a parsed log must carry to be stored.
+const PARSER_SHUTDOWN_TIMEOUT int = 30              // Default seconds to let in-flight requests finish on shutdown.
+const PARSER_INSERT_MAX_RETRIES int = 3             // Default retries for inserts failing with 40001/40P01.
+const PARSER_INSERT_TIMEOUT int = 60               // Default seconds a batch insert may take.
+const PARSER_QUERY_TIMEOUT int = 5                 // Default seconds a read or delete query may take.
+const PARSER_INSERT_CHUNK_SIZE int = 1000           // Default logs per INSERT statement; 5000 would exceed MAX_QUERY_PARAMETERS at 14 values per log.
+const PARSER_INSERT_AUTO_TUNE bool = false          // The chunk size is fixed by default.
+const PARSER_INSERT_CHUNK_MIN int = 100             // Default smallest auto-tuned chunk size.
+const PARSER_INSERT_CHUNK_MAX int = 4000            // Default largest auto-tuned chunk size.
+const PARSER_INSERT_COPY bool = false               // Chunks are written with INSERT by default.
+const PARSER_IDEMPOTENT_INSERTS bool = false        // Re-posted logs are stored again by default.
+const INSERT_MAX_CHUNK_SIZE int = 4000              // Upper bound for any configured chunk size; InsertChunkLimit caps the rows of an INSERT further.
+const MAX_QUERY_PARAMETERS int = 65535             // Most values Postgres binds in one statement.
+const PARSER_MAX_LINES int = 100000                 // Default maximum lines per POST /logs batch.
+const PARSER_WORKERS int = 0                        // Batches are parsed by one worker per CPU by default.
+const PARSER_MAX_BODY_BYTES int = 32 << 20          // Default maximum POST /logs body size (32 MiB).
+const PARSER_COALESCE_REQUESTS bool = true          // Identical concurrent reads are coalesced by default.
+const PARSER_STATS_CACHE_TTL int = 0                // Stats responses are not cached by default.
+const STATS_CACHE_MAX_ENTRIES int = 256             // Cached stats responses kept before the cache is cleared.
+const PARSER_INDEXED_COLUMNS string = "time_local,ingested_at" // Default indexed columns, used by paging and the ingest lag stats.
+const PARSER_REQUEST_ID_HEADER string = "X-Request-ID" // Default header carrying the request id.
+const PARSER_TENANT_HEADER string = "X-API-Key" // Default header carrying the API key of a tenant.
+const API_KEY_HEADER string = "X-API-Key"       // Header carrying the API key checked by RequireAPIKey.
+const PARSER_ALLOW_ANONYMOUS_WRITES bool = false  // Writes are rejected while no API key is configured by default.
+const PARSER_ARCHIVE_REGION string = "us-east-1"    // Default region of the archive bucket.
+const PARSER_PARTITIONING bool = false              // The logs table is not partitioned by default.
+const PARSER_PARTITIONS_AHEAD int = 2               // Default number of upcoming monthly partitions created in advance.
+const PARSER_RETENTION_DAYS int = 0                 // Logs are kept forever by default.
+const PARSER_MAINTENANCE_INTERVAL int = 3600       // Default seconds between retention purges and partition upkeep.
+const PARSER_DEDUP_STRINGS bool = false             // User agents and referers are stored inline by default.
+const PARSER_ALERT_INTERVAL int = 60                // Default seconds between alert rule evaluations.
+const PARSER_ML_INSIGHTS_TTL int = 60               // Default seconds computed ML insights are reused.
+const PARSER_ML_ALERT_WEBHOOK_SEVERITY string = "high" // Default lowest severity of the ML alerts posted to the webhook.
+const PARSER_BATCH_ACK_TTL int = 0                  // Batch ids are not remembered by default.
+const PARSER_STORE_RAW_LINE bool = false            // Raw lines are not stored by default.
+const PARSER_SAMPLE_RATE float64 = 1                // Every log is kept by default.
+const PARSER_RATE_LIMIT float64 = 0                 // Requests are not rate limited by default.
+const RATE_LIMIT_MAX_CLIENTS int = 10000            // Clients tracked by the rate limiter before idle ones are dropped.
+const RATE_LIMIT_EVICT_TO int = 9000                // Clients kept when the least recently seen are evicted from a full rate limiter.
+const PARSER_LOG_FORMAT string = "text"             // The service logs human-readable text by default.
 
 
 // Default values for the database connection configuration.
@@ -39,11 +140,22 @@ const DB_USERNAME string = "postgres"               // Default username for the
 const DB_PASSWORD string = "123456"                 // Default password for the PostgreSQL database.
 const DB_NAME string = "logsdb"                     // Default name for the PostgreSQL database.
 const DB_SSLMODE string = "disable"                 // Default SSL mode for the PostgreSQL database connection.
+const DB_DRIVER string = "postgres"                 // Default database driver.
+const DB_DRIVER_MYSQL string = "mysql"              // The MySQL database driver.
+const DB_MAX_OPEN_CONNS int = 10                    // Default maximum number of open database connections.
+const DB_MAX_IDLE_CONNS int = 5                     // Default maximum number of idle database connections.
+const DB_CONN_MAX_LIFETIME int = 300                // Default seconds a database connection is reused before it is closed.
 
 // Default values for the database table name and table creation query.
 const DB_TABLE_NAME string = "logs"                 // Default table name for storing logs in the database.
-const DB_CREATE_TABLE_QUERY string = "CREATE TABLE IF NOT EXISTS logs (id SERIAL PRIMARY KEY, remote_addr VARCHAR(255), remote_user VARCHAR(255), time_local TIMESTAMPTZ, request VARCHAR(255), status INT, body_bytes_sent INT, http_referer VARCHAR(255), http_user_agent VARCHAR(255), http_x_forwarded_for VARCHAR(255));"  // SQL query for creating the logs table if it doesn't exist.
+const DB_CREATE_TABLE_QUERY string = "CREATE TABLE IF NOT EXISTS logs (id SERIAL PRIMARY KEY, remote_addr VARCHAR(255), remote_user VARCHAR(255), time_local TIMESTAMPTZ, request VARCHAR(255), status INT, body_bytes_sent INT, http_referer VARCHAR(255), http_user_agent VARCHAR(255), http_x_forwarded_for VARCHAR(255), ingested_at TIMESTAMPTZ DEFAULT NOW(), request_method VARCHAR(16), request_path VARCHAR(255), request_protocol VARCHAR(16), http_user_agent_id INT, http_referer_id INT, response_time DOUBLE PRECISION, server_name VARCHAR(255), raw_line TEXT, sample_rate DOUBLE PRECISION, tenant_id VARCHAR(64), dedup_key VARCHAR(64));"  // SQL query for creating the logs table if it doesn't exist.
+// DB_CREATE_TABLE_QUERY_MYSQL creates the logs table with MySQL column types, used instead of DB_CREATE_TABLE_QUERY
+// when DB_DRIVER is mysql and no CREATE_TABLE_QUERY is configured.
+const DB_CREATE_TABLE_QUERY_MYSQL string = "CREATE TABLE IF NOT EXISTS logs (id INT AUTO_INCREMENT PRIMARY KEY, remote_addr VARCHAR(255), remote_user VARCHAR(255), time_local DATETIME(6), request VARCHAR(255), status INT, body_bytes_sent INT, http_referer VARCHAR(255), http_user_agent VARCHAR(255), http_x_forwarded_for VARCHAR(255), ingested_at DATETIME(6) DEFAULT CURRENT_TIMESTAMP(6), request_method VARCHAR(16), request_path VARCHAR(255), request_protocol VARCHAR(16), http_user_agent_id INT, http_referer_id INT, response_time DOUBLE, server_name VARCHAR(255), raw_line TEXT, sample_rate DOUBLE, tenant_id VARCHAR(64), dedup_key VARCHAR(64), INDEX idx_time_local (time_local), INDEX idx_status (status), UNIQUE INDEX idx_logs_dedup_key (dedup_key));"
 
+// DB_CREATE_INGESTED_BATCHES_QUERY_MYSQL creates the table of the batch ids on MySQL, where the Postgres
+// migrations creating it are not applied.
+const DB_CREATE_INGESTED_BATCHES_QUERY_MYSQL string = "CREATE TABLE IF NOT EXISTS " + DB_INGESTED_BATCHES_TABLE + " (batch_id VARCHAR(255) PRIMARY KEY, inserted BIGINT NOT NULL, rejected INT NOT NULL, processed_at DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6));"
 
 // Constants for the HTTP request methods.
 const REQUEST_GET_METHOD string = "GET"             // HTTP GET method.
@@ -64,4 +176,153 @@ const CONFIG_FILE_NAME string = "config.yaml"        // The name of the main con
 const CONFIG_DB_FILE_NAME string = "connection/dbConfig.yaml" // The name of the database connection configuration file.
 
 const QUERY_COUNT_ALL string = "SELECT COUNT(*) FROM " + DB_TABLE_NAME
-const CREATE_INDEX_TABLE string = "CREATE INDEX idx_time_local ON logs (time_local);"
\ No newline at end of file
+const QUERY_MAX_TIME_LOCAL string = "SELECT MAX(time_local) FROM " + DB_TABLE_NAME
+const QUERY_ROWS_AND_LAST_LOG string = "SELECT COUNT(*), MAX(time_local) FROM " + DB_TABLE_NAME
+const QUERY_COUNT_SINCE string = "SELECT COUNT(*) FROM " + DB_TABLE_NAME + " WHERE time_local >= $1"
+const QUERY_STATUS_COUNTS_SINCE string = "SELECT COUNT(*), COUNT(*) FILTER (WHERE status >= 400 AND status < 500), COUNT(*) FILTER (WHERE status >= 500) FROM " + DB_TABLE_NAME + " WHERE time_local >= $1"
+// QUERY_STATUS_COUNTS_SINCE_MYSQL is QUERY_STATUS_COUNTS_SINCE for MySQL, which has no FILTER clause.
+// SUM is NULL over no rows, where COUNT is 0.
+const QUERY_STATUS_COUNTS_SINCE_MYSQL string = "SELECT COUNT(*), COALESCE(SUM(CASE WHEN status >= 400 AND status < 500 THEN 1 ELSE 0 END), 0), COALESCE(SUM(CASE WHEN status >= 500 THEN 1 ELSE 0 END), 0) FROM " + DB_TABLE_NAME + " WHERE time_local >= $1"
+const QUERY_RESPONSE_TIME_PERCENTILES string = "SELECT COUNT(response_time), COALESCE(AVG(response_time), 0), " +
+	"COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY response_time), 0), COALESCE(PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY response_time), 0), " +
+	"COALESCE(PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY response_time), 0), COALESCE(PERCENTILE_CONT(0.99) WITHIN GROUP (ORDER BY response_time), 0), " +
+	"COALESCE(MAX(response_time), 0) FROM " + DB_TABLE_NAME + " WHERE response_time IS NOT NULL"
+const QUERY_DELETE_LOGS_BY_IP string = "DELETE FROM " + DB_TABLE_NAME + " WHERE remote_addr = $1"
+const QUERY_INGEST_LAG_SINCE string = "SELECT COALESCE(AVG(EXTRACT(EPOCH FROM (ingested_at - time_local))), 0), COALESCE(MAX(EXTRACT(EPOCH FROM (ingested_at - time_local))), 0) FROM " + DB_TABLE_NAME + " WHERE ingested_at >= $1"
+// QUERY_INGEST_LAG_SINCE_MYSQL is QUERY_INGEST_LAG_SINCE for MySQL, which has no EXTRACT(EPOCH FROM ...).
+const QUERY_INGEST_LAG_SINCE_MYSQL string = "SELECT COALESCE(AVG(TIMESTAMPDIFF(MICROSECOND, time_local, ingested_at) / 1e6), 0), COALESCE(MAX(TIMESTAMPDIFF(MICROSECOND, time_local, ingested_at) / 1e6), 0) FROM " + DB_TABLE_NAME + " WHERE ingested_at >= $1"
+
+// Values accepted by the time_format query parameter.
+const TIME_FORMAT_RFC3339 string = "rfc3339"   // Timestamps as RFC3339 strings (default).
+const TIME_FORMAT_EPOCH_MS string = "epoch_ms" // Timestamps as integer milliseconds since the Unix epoch.
+
+// Layout of $time_local in Nginx and Apache access logs, the first layout tried by the line parser.
+const CLF_TIME_LAYOUT string = "02/Jan/2006:15:04:05 -0700"
+
+// Number of matching logs a DELETE dry run returns by default, and the most a "sample" parameter may ask for.
+const DELETE_DRY_RUN_SAMPLE int = 10
+const DELETE_DRY_RUN_MAX_SAMPLE int = 100
+
+// Number of addresses GET /stats/top-ips returns by default, and the most a "limit" parameter may ask for.
+const TOP_IPS_LIMIT int = 10
+const TOP_IPS_MAX_LIMIT int = 100
+
+// Most lines and parsed logs queued between POST /logs and its parsing workers, whatever the batch size.
+const PARSE_QUEUE_SIZE int = 1024
+
+// Buckets GET /stats/timeseries may group logs into, as accepted by its "interval" parameter. Each one is
+// also accepted in its short form, e.g. "1m".
+const TIME_SERIES_MINUTE string = "minute"
+const TIME_SERIES_HOUR string = "hour"
+const TIME_SERIES_DAY string = "day"
+
+// Formats accepted by the format parameter of GET /logs/export, their content types, and the number of
+// logs written between flushes of the stream.
+const EXPORT_FORMAT_NDJSON string = "ndjson" // One JSON object per line (default).
+const EXPORT_FORMAT_CSV string = "csv"       // A header row, then one record per log.
+const NDJSON_CONTENT_TYPE string = "application/x-ndjson"
+const CSV_CONTENT_TYPE string = "text/csv; charset=utf-8"
+const EXPORT_FLUSH_ROWS int = 500
+
+// Header row of CSV exports, the JSON field names of the exported log columns in the order they are written.
+var EXPORT_CSV_HEADER = []string{"remote_addr", "remote_user", "time_local", "request", "status", "body_bytes_sent",
+	"http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at", "response_time", "server_name"}
+
+// Values accepted by the cursor_by query parameter.
+const CURSOR_BY_TIME string = "time" // Newest event time first, paging back through time_local (default).
+const CURSOR_BY_ID string = "id"     // Insertion order, oldest id first, paging forward through the SERIAL id.
+
+// Columns accepted by the sort_by query parameter, and the directions accepted by order.
+// Cursors only page through time_local.
+var LOG_SORT_COLUMNS = []string{"time_local", "status", "body_bytes_sent"}
+const SORT_BY_TIME string = "time_local" // Default sort column.
+const ORDER_ASC string = "asc"
+const ORDER_DESC string = "desc"         // Default order, newest or largest first.
+
+// Values accepted by the direction query parameter.
+const DIRECTION_NEXT string = "next" // The page after the cursor (default).
+const DIRECTION_PREV string = "prev" // The page before the cursor.
+
+// Bounds for the re-enrichment endpoint.
+const REENRICH_BATCH_SIZE int = 500      // Default number of rows updated per batch.
+const REENRICH_MAX_BATCH_SIZE int = 5000 // Upper bound accepted for the batch_size parameter.
+const REENRICH_MAX_BATCHES int = 20      // Default number of batches processed per call before returning a cursor.
+
+const CREATE_INDEX_TABLE string = "CREATE INDEX idx_time_local ON logs (time_local);"
+
+// DB_CREATE_PARTITIONED_TABLE_QUERY creates the logs table partitioned by month of time_local, used instead of
+// the configured CREATE_TABLE_QUERY when partitioning is enabled. The partition key must be part of the primary key.
+const DB_CREATE_PARTITIONED_TABLE_QUERY string = "CREATE TABLE IF NOT EXISTS logs (id SERIAL, remote_addr VARCHAR(255), remote_user VARCHAR(255), time_local TIMESTAMPTZ NOT NULL, request VARCHAR(255), status INT, body_bytes_sent INT, http_referer VARCHAR(255), http_user_agent VARCHAR(255), http_x_forwarded_for VARCHAR(255), ingested_at TIMESTAMPTZ DEFAULT NOW(), request_method VARCHAR(16), request_path VARCHAR(255), request_protocol VARCHAR(16), http_user_agent_id INT, http_referer_id INT, response_time DOUBLE PRECISION, server_name VARCHAR(255), raw_line TEXT, sample_rate DOUBLE PRECISION, tenant_id VARCHAR(64), dedup_key VARCHAR(64), PRIMARY KEY (id, time_local)) PARTITION BY RANGE (time_local);"
+
+// Queries used to maintain the logs table: partitions and retention.
+const QUERY_CREATE_DEFAULT_PARTITION string = "CREATE TABLE IF NOT EXISTS " + DB_DEFAULT_PARTITION + " PARTITION OF " + DB_TABLE_NAME + " DEFAULT;" // Catches logs outside the created months.
+const QUERY_IS_PARTITIONED string = "SELECT relkind = 'p' FROM pg_class WHERE relname = $1"
+const QUERY_LIST_PARTITIONS string = "SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid JOIN pg_class p ON p.oid = i.inhparent WHERE p.relname = $1"
+const QUERY_DELETE_BEFORE string = "DELETE FROM " + DB_TABLE_NAME + " WHERE time_local < $1"
+const QUERY_DELETE_DEFAULT_PARTITION_BEFORE string = "DELETE FROM " + DB_DEFAULT_PARTITION + " WHERE time_local < $1" // Expired logs outside the monthly partitions.
+const QUERY_PARTITION_EXISTS string = "SELECT to_regclass($1) IS NOT NULL"
+const QUERY_RESTORE_MOVED_LOGS string = "INSERT INTO " + DB_TABLE_NAME + " SELECT * FROM " + DB_MOVED_LOGS_TABLE + ";" // Routes the logs moved out of the default partition to their new partition.
+
+// Default partition of a partitioned logs table, and the temporary table its logs are moved through
+// when a partition is created for their month.
+const DB_DEFAULT_PARTITION string = DB_TABLE_NAME + "_default"
+const DB_MOVED_LOGS_TABLE string = DB_TABLE_NAME + "_moved"
+
+// Table and queries used when PARSER_BATCH_ACK_TTL is set: the result of each POST /logs batch carrying an
+// X-Batch-ID header is recorded, so a retry of the batch within the TTL returns it without inserting again.
+const BATCH_ID_HEADER string = "X-Batch-ID"
+const BATCH_ID_MAX_LENGTH int = 64
+const TENANT_ID_MAX_LENGTH int = 64 // Longest tenant id, the size of the tenant_id column.
+const DB_INGESTED_BATCHES_TABLE string = "ingested_batches"
+const QUERY_SELECT_BATCH string = "SELECT inserted, rejected FROM " + DB_INGESTED_BATCHES_TABLE + " WHERE batch_id = $1 AND processed_at >= $2"
+// QUERY_CLAIM_BATCH records a batch in the transaction inserting its logs, replacing an expired record of
+// the same id; it affects no row while the id is recorded and unexpired. A concurrent claim of the id
+// waits for the transaction holding it, so at most one of them inserts.
+const QUERY_CLAIM_BATCH string = "INSERT INTO " + DB_INGESTED_BATCHES_TABLE + " (batch_id, inserted, rejected, processed_at) VALUES ($1, 0, $2, NOW()) " +
+	"ON CONFLICT (batch_id) DO UPDATE SET inserted = EXCLUDED.inserted, rejected = EXCLUDED.rejected, processed_at = EXCLUDED.processed_at " +
+	"WHERE " + DB_INGESTED_BATCHES_TABLE + ".processed_at < $3"
+// QUERY_CLAIM_BATCH_MYSQL is QUERY_CLAIM_BATCH for MySQL, bound with the id, rejected, processed_at and
+// three times the expiry. The assignments run in order, so processed_at is compared before it changes.
+// A duplicate left unchanged affects no row.
+const QUERY_CLAIM_BATCH_MYSQL string = "INSERT INTO " + DB_INGESTED_BATCHES_TABLE + " (batch_id, inserted, rejected, processed_at) VALUES (?, 0, ?, ?) " +
+	"ON DUPLICATE KEY UPDATE inserted = IF(processed_at < ?, VALUES(inserted), inserted), rejected = IF(processed_at < ?, VALUES(rejected), rejected), " +
+	"processed_at = IF(processed_at < ?, VALUES(processed_at), processed_at)"
+const QUERY_SET_BATCH_INSERTED string = "UPDATE " + DB_INGESTED_BATCHES_TABLE + " SET inserted = $1 WHERE batch_id = $2"
+const QUERY_DELETE_BATCHES_BEFORE string = "DELETE FROM " + DB_INGESTED_BATCHES_TABLE + " WHERE processed_at < $1"
+
+// Lookup tables and view used when PARSER_DEDUP_STRINGS is enabled: logs rows reference their user agent
+// and referer by id, and reads go through the view, which joins the strings back.
+const DB_USER_AGENTS_TABLE string = "user_agents"
+const DB_REFERERS_TABLE string = "referers"
+const DB_LOGS_RESOLVED_VIEW string = "logs_resolved"
+
+// Queries used to store strings in a lookup table, formatted with the table name. Both take the values as a text array.
+const QUERY_INSERT_LOOKUP_VALUES string = "INSERT INTO %s (value) SELECT DISTINCT unnest($1::text[]) ON CONFLICT (value) DO NOTHING"
+const QUERY_SELECT_LOOKUP_IDS string = "SELECT id, value FROM %s WHERE value = ANY($1::text[])"
+
+// LOGS_TABLE_MIGRATIONS are idempotent statements applied once, on the first connection after startup,
+// so that logs tables created by older releases pick up columns added since.
+var LOGS_TABLE_MIGRATIONS = []string{
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS ingested_at TIMESTAMPTZ DEFAULT NOW();",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS request_method VARCHAR(16);",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS request_path VARCHAR(255);",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS request_protocol VARCHAR(16);",
+	"CREATE TABLE IF NOT EXISTS " + DB_USER_AGENTS_TABLE + " (id SERIAL PRIMARY KEY, value VARCHAR(255) NOT NULL UNIQUE);",
+	"CREATE TABLE IF NOT EXISTS " + DB_REFERERS_TABLE + " (id SERIAL PRIMARY KEY, value VARCHAR(255) NOT NULL UNIQUE);",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS http_user_agent_id INT;",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS http_referer_id INT;",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS response_time DOUBLE PRECISION;",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS server_name VARCHAR(255);",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS raw_line TEXT;",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS sample_rate DOUBLE PRECISION;",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64);",
+	"ALTER TABLE logs ADD COLUMN IF NOT EXISTS dedup_key VARCHAR(64);",
+	"CREATE TABLE IF NOT EXISTS " + DB_INGESTED_BATCHES_TABLE + " (batch_id VARCHAR(255) PRIMARY KEY, inserted BIGINT NOT NULL, rejected INT NOT NULL, processed_at TIMESTAMPTZ NOT NULL DEFAULT NOW());",
+	// Batch ids are prefixed with their tenant, which no longer fits the original 64 characters
+	"ALTER TABLE " + DB_INGESTED_BATCHES_TABLE + " ALTER COLUMN batch_id TYPE VARCHAR(255);",
+	// Rows stored inline, before de-duplication was enabled, have no ids and keep their own strings
+	"CREATE OR REPLACE VIEW " + DB_LOGS_RESOLVED_VIEW + " AS SELECT l.id, l.remote_addr, l.remote_user, l.time_local, l.request, l.status, l.body_bytes_sent, " +
+		"COALESCE(r.value, l.http_referer) AS http_referer, COALESCE(ua.value, l.http_user_agent) AS http_user_agent, l.http_x_forwarded_for, " +
+		"l.ingested_at, l.request_method, l.request_path, l.request_protocol, l.response_time, l.server_name, l.raw_line, l.sample_rate, l.tenant_id FROM logs l " +
+		"LEFT JOIN " + DB_REFERERS_TABLE + " r ON r.id = l.http_referer_id LEFT JOIN " + DB_USER_AGENTS_TABLE + " ua ON ua.id = l.http_user_agent_id;",
+}
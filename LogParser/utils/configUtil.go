@@ -11,6 +11,7 @@ import (
 	_ "log"
 	"os"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -27,6 +28,57 @@ func FirstLoad() (error) {
 	// Set the global ConfigData object with the retrieved port value
 	ConfigData = models.Config{
 		PORT: port, 
+		StrictParse: getEnvBool(KEY_STRICT_PARSE, PARSER_STRICT_PARSE),
+		JSONFieldMap: ParseJSONFieldMap(getEnvString(KEY_JSON_FIELD_MAP, "")),
+		CoalesceRequests: getEnvBool(KEY_COALESCE_REQUESTS, PARSER_COALESCE_REQUESTS),
+		StatsCacheTTL: getEnvInt(KEY_STATS_CACHE_TTL, PARSER_STATS_CACHE_TTL),
+		IndexedColumns: ParseIndexedColumns(getEnvString(KEY_INDEXED_COLUMNS, PARSER_INDEXED_COLUMNS)),
+		RequestIDHeader: getEnvString(KEY_REQUEST_ID_HEADER, PARSER_REQUEST_ID_HEADER),
+		TenantHeader: getEnvString(KEY_TENANT_HEADER, PARSER_TENANT_HEADER),
+		AdminToken: getEnvString(KEY_ADMIN_TOKEN, ""),
+		APIKey: getEnvString(KEY_API_KEY, ""),
+		AllowAnonymousWrites: getEnvBool(KEY_ALLOW_ANONYMOUS_WRITES, PARSER_ALLOW_ANONYMOUS_WRITES),
+		LogRegex: getEnvString(KEY_LOG_REGEX, ""),
+		RequiredFields: ParseRequiredFields(getEnvString(KEY_REQUIRED_FIELDS, PARSER_REQUIRED_FIELDS)),
+		ExtraMethods: ParseMethods(getEnvString(KEY_EXTRA_METHODS, "")),
+		CursorSecret: getEnvString(KEY_CURSOR_SECRET, ""),
+		ShutdownTimeout: getEnvInt(KEY_SHUTDOWN_TIMEOUT, PARSER_SHUTDOWN_TIMEOUT),
+		InsertMaxRetries: getEnvInt(KEY_INSERT_MAX_RETRIES, PARSER_INSERT_MAX_RETRIES),
+		InsertTimeout: getEnvInt(KEY_INSERT_TIMEOUT, PARSER_INSERT_TIMEOUT),
+		QueryTimeout: getEnvInt(KEY_QUERY_TIMEOUT, PARSER_QUERY_TIMEOUT),
+		InsertChunkSize: getEnvInt(KEY_INSERT_CHUNK_SIZE, PARSER_INSERT_CHUNK_SIZE),
+		InsertAutoTune: getEnvBool(KEY_INSERT_AUTO_TUNE, PARSER_INSERT_AUTO_TUNE),
+		InsertChunkMin: getEnvInt(KEY_INSERT_CHUNK_MIN, PARSER_INSERT_CHUNK_MIN),
+		InsertChunkMax: getEnvInt(KEY_INSERT_CHUNK_MAX, PARSER_INSERT_CHUNK_MAX),
+		InsertCopy: getEnvBool(KEY_INSERT_COPY, PARSER_INSERT_COPY),
+		IdempotentInserts: getEnvBool(KEY_IDEMPOTENT_INSERTS, PARSER_IDEMPOTENT_INSERTS),
+		MaxLines: getEnvInt(KEY_MAX_LINES, PARSER_MAX_LINES),
+		Workers: getEnvInt(KEY_WORKERS, PARSER_WORKERS),
+		MaxBodyBytes: getEnvInt(KEY_MAX_BODY_BYTES, PARSER_MAX_BODY_BYTES),
+		ArchiveBucket: getEnvString(KEY_ARCHIVE_BUCKET, ""),
+		ArchiveRegion: getEnvString(KEY_ARCHIVE_REGION, PARSER_ARCHIVE_REGION),
+		ArchiveEndpoint: getEnvString(KEY_ARCHIVE_ENDPOINT, ""),
+		ArchivePrefix: getEnvString(KEY_ARCHIVE_PREFIX, ""),
+		ArchiveAccessKey: getEnvString(KEY_ARCHIVE_ACCESS_KEY, ""),
+		ArchiveSecretKey: getEnvString(KEY_ARCHIVE_SECRET_KEY, ""),
+		Partitioning: getEnvBool(KEY_PARTITIONING, PARSER_PARTITIONING),
+		PartitionsAhead: getEnvInt(KEY_PARTITIONS_AHEAD, PARSER_PARTITIONS_AHEAD),
+		RetentionDays: getEnvInt(KEY_RETENTION_DAYS, PARSER_RETENTION_DAYS),
+		MaintenanceInterval: getEnvInt(KEY_MAINTENANCE_INTERVAL, PARSER_MAINTENANCE_INTERVAL),
+		DedupStrings: getEnvBool(KEY_DEDUP_STRINGS, PARSER_DEDUP_STRINGS),
+		AlertInterval: getEnvInt(KEY_ALERT_INTERVAL, PARSER_ALERT_INTERVAL),
+		MLInsightsTTL: getEnvInt(KEY_ML_INSIGHTS_TTL, PARSER_ML_INSIGHTS_TTL),
+		MLAlertWebhook: getEnvString(KEY_ML_ALERT_WEBHOOK, ""),
+		MLAlertWebhookSeverity: getEnvString(KEY_ML_ALERT_WEBHOOK_SEVERITY, PARSER_ML_ALERT_WEBHOOK_SEVERITY),
+		BatchAckTTL: getEnvInt(KEY_BATCH_ACK_TTL, PARSER_BATCH_ACK_TTL),
+		StoreRawLine: getEnvBool(KEY_STORE_RAW_LINE, PARSER_STORE_RAW_LINE),
+		SampleRate: getEnvFloat(KEY_SAMPLE_RATE, PARSER_SAMPLE_RATE),
+		RateLimit: getEnvFloat(KEY_RATE_LIMIT, PARSER_RATE_LIMIT),
+		RateLimitBurst: getEnvInt(KEY_RATE_LIMIT_BURST, 0),
+		RateLimitTrustProxy: getEnvBool(KEY_RATE_LIMIT_TRUST_PROXY, false),
+		CORSOrigins: ParseCORSOrigins(getEnvString(KEY_CORS_ORIGINS, "")),
+		StrictFilters: getEnvBool(KEY_STRICT_FILTERS, false),
+		LogFormat: getEnvString(KEY_LOG_FORMAT, PARSER_LOG_FORMAT),
 	}
 
 	// If the port is still set to the default value (meaning the environment variable was not set),
@@ -40,6 +92,73 @@ func FirstLoad() (error) {
 		}
 	}
 
+	// The format is applied first, so the logs of the settings rejected below are already in it
+	if err := logger.SetFormat(ConfigData.LogFormat); err != nil {
+		ConfigData.LogFormat = PARSER_LOG_FORMAT
+		logger.SetFormat(PARSER_LOG_FORMAT)
+		return fmt.Errorf("invalid log format: %v", err)
+	}
+
+	if err := ValidateJSONFieldMap(ConfigData.JSONFieldMap); err != nil {
+		ConfigData.JSONFieldMap = nil
+		return fmt.Errorf("invalid JSON field mapping: %v", err)
+	}
+
+	// The pattern is compiled once here, and again only when it changes
+	if err := SetLogPattern(ConfigData.LogRegex); err != nil {
+		ConfigData.LogRegex = LogPattern().String()
+		return fmt.Errorf("invalid log regex, keeping the current one: %v", err)
+	}
+
+	if err := ValidateRequiredFields(ConfigData.RequiredFields); err != nil {
+		ConfigData.RequiredFields = ParseRequiredFields(PARSER_REQUIRED_FIELDS)
+		return fmt.Errorf("invalid required fields: %v", err)
+	}
+
+	// Methods from config.yaml are normalized like those from the environment
+	ConfigData.ExtraMethods = ParseMethods(strings.Join(ConfigData.ExtraMethods, ","))
+	if err := ValidateMethods(ConfigData.ExtraMethods); err != nil {
+		ConfigData.ExtraMethods = nil
+		return fmt.Errorf("invalid extra methods: %v", err)
+	}
+
+	ConfigData.IndexedColumns = ParseIndexedColumns(strings.Join(ConfigData.IndexedColumns, ","))
+	if err := ValidateIndexedColumns(ConfigData.IndexedColumns); err != nil {
+		ConfigData.IndexedColumns = ParseIndexedColumns(PARSER_INDEXED_COLUMNS)
+		return fmt.Errorf("invalid indexed columns: %v", err)
+	}
+
+	if err := ValidateInsertChunking(ConfigData); err != nil {
+		ConfigData.InsertChunkSize, ConfigData.InsertChunkMin, ConfigData.InsertChunkMax = PARSER_INSERT_CHUNK_SIZE, PARSER_INSERT_CHUNK_MIN, PARSER_INSERT_CHUNK_MAX
+		return fmt.Errorf("invalid insert chunking: %v", err)
+	}
+
+	// Invalid tenants are kept rather than dropped: dropping them would open every tenant's logs to all
+	if err := ValidateTenants(ConfigData.Tenants); err != nil {
+		return fmt.Errorf("invalid tenants: %v", err)
+	}
+
+	if err := ValidateSampleRate(ConfigData.SampleRate); err != nil {
+		ConfigData.SampleRate = PARSER_SAMPLE_RATE
+		return fmt.Errorf("invalid sample rate: %v", err)
+	}
+
+	if ConfigData.Workers < 0 {
+		ConfigData.Workers = PARSER_WORKERS
+		return fmt.Errorf("invalid workers, expected 0 for one per CPU or a positive number")
+	}
+
+	if ConfigData.MaintenanceInterval <= 0 {
+		ConfigData.MaintenanceInterval = PARSER_MAINTENANCE_INTERVAL
+		return fmt.Errorf("invalid maintenance interval, expected a positive number of seconds")
+	}
+
+	ConfigData.CORSOrigins = ParseCORSOrigins(strings.Join(ConfigData.CORSOrigins, ","))
+	if err := ValidateCORSOrigins(ConfigData.CORSOrigins); err != nil {
+		ConfigData.CORSOrigins = nil
+		return fmt.Errorf("invalid CORS origins: %v", err)
+	}
+
 	return nil
 }
 
@@ -64,6 +183,23 @@ func LoadConfigFromYaml() error {
 	return nil
 }
 
+// LoadMLSettingsFromYaml reads only the ML section of the YAML file at path, leaving ConfigData untouched.
+// A file without the section yields zero settings, which keep the ML defaults.
+func LoadMLSettingsFromYaml(path string) (models.MLSettings, error) {
+	yamlFile, err := os.ReadFile(path)
+	if err != nil {
+		return models.MLSettings{}, fmt.Errorf("error reading YAML file: %v", err)
+	}
+
+	var section struct {
+		ML models.MLSettings `yaml:"ML"`
+	}
+	if err := yaml.Unmarshal(yamlFile, &section); err != nil {
+		return models.MLSettings{}, fmt.Errorf("error unmarshalling YAML file: %v", err)
+	}
+	return section.ML, nil
+}
+
 /*
 This commented-out function is an older approach to load configuration from environment variables directly,
 but it is not used in the current implementation.
@@ -152,3 +288,35 @@ func getEnvInt(key string, defaultValue int) int {
 	// Return the parsed integer value
 	return parsedValue
 }
+
+// getEnvBool retrieves a boolean value from an environment variable or returns a default value if the environment variable is not set.
+// Values accepted by strconv.ParseBool ("true", "1", "false", "0", ...) are recognised; anything else falls back to the default.
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsedValue, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.LogInfo(fmt.Sprintf("Error parsing bool value for key %s, defaulting to %t", key, defaultValue))
+		return defaultValue
+	}
+	return parsedValue
+}
+
+// getEnvFloat retrieves a float value from an environment variable or returns a default value if the environment variable is not set
+// or cannot be parsed.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsedValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		logger.LogInfo(fmt.Sprintf("Error parsing float value for key %s, defaulting to %v", key, defaultValue))
+		return defaultValue
+	}
+	return parsedValue
+}
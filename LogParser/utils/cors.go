@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseCORSOrigins parses a comma-separated origin list as used in the PARSER_CORS_ORIGINS environment
+// variable, e.g. "https://dashboard.example.com,http://localhost:3000". Empty entries are skipped and a
+// trailing slash is dropped, as browsers send origins without one.
+func ParseCORSOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// ValidateCORSOrigins checks that every origin is "*" or an http or https scheme and host, without a path.
+func ValidateCORSOrigins(origins []string) error {
+	for _, origin := range origins {
+		if origin == "*" {
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.Path != "" || parsed.RawQuery != "" {
+			return fmt.Errorf("invalid origin '%s', expected * or a scheme and host such as https://dashboard.example.com", origin)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or fail signature verification.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// processCursorSecret signs cursors while no PARSER_CURSOR_SECRET is configured.
+// Cursors signed with it stop validating when the process restarts.
+var processCursorSecret = func() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate cursor secret: %v", err))
+	}
+	return secret
+}()
+
+func cursorSecret() []byte {
+	if ConfigData.CursorSecret != "" {
+		return []byte(ConfigData.CursorSecret)
+	}
+	return processCursorSecret
+}
+
+func signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cursorSecret())
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// EncodeCursor returns the signed cursor for the row with the given time_local and id.
+// The time keeps full precision so rows sharing a second are not skipped.
+// A cursor is base64url("<time>|<id>") + "." + base64url(HMAC-SHA256), so clients can pass it
+// back but not craft or alter one.
+func EncodeCursor(t time.Time, id int) string {
+	payload := []byte(fmt.Sprintf("%s|%d", t.UTC().Format(time.RFC3339Nano), id))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload))
+}
+
+// DecodeCursor verifies a cursor produced by EncodeCursor and returns its time and id.
+// Returns ErrInvalidCursor when the cursor is malformed or its signature does not match.
+func DecodeCursor(cursor string) (time.Time, int, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(cursor, ".")
+	if !found {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, signCursor(payload)) {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+
+	timePart, idPart, found := strings.Cut(string(payload), "|")
+	if !found {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	cursorTime, err := time.Parse(time.RFC3339Nano, timePart)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(idPart)
+	if err != nil || id <= 0 {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return cursorTime, id, nil
+}
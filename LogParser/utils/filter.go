@@ -8,12 +8,16 @@ import (
 	"LogParser/models"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // GenerateFiltersMap processes query parameters from the HTTP request to generate a map of filters.
 // It supports filters for various fields like remote address, status, body bytes sent, time range, etc.
+// A request scoped to a tenant always gets a tenant_id filter for it.
 // The filters are returned as a map with the key as the field name and value as the corresponding filter value.
 // Parameters:
 //   - r: The HTTP request containing the query parameters.
@@ -25,10 +29,19 @@ func GenerateFiltersMap(r *http.Request) map[string]interface{} {
 	if remoteAddr := r.URL.Query().Get("remote_addr"); remoteAddr != "" {
 		filters["remote_addr"] = remoteAddr
 	}
+	// A comma separated list of statuses matches any of them; entries that are not numbers are ignored
 	if status := r.URL.Query().Get("status"); status != "" {
-		statusInt, err := strconv.Atoi(status)
-		if err == nil {
-			filters["status"] = statusInt
+		var statuses []int
+		for _, entry := range strings.Split(status, ",") {
+			statusInt, err := strconv.Atoi(strings.TrimSpace(entry))
+			if err == nil {
+				statuses = append(statuses, statusInt)
+			}
+		}
+		if len(statuses) == 1 {
+			filters["status"] = statuses[0]
+		} else if len(statuses) > 1 {
+			filters["status"] = statuses
 		}
 	}
 	if bodyBytesSent := r.URL.Query().Get("body_bytes_sent"); bodyBytesSent != "" {
@@ -46,22 +59,55 @@ func GenerateFiltersMap(r *http.Request) map[string]interface{} {
 	if httpXForwardedFor := r.URL.Query().Get("http_x_forwarded_for"); httpXForwardedFor != "" {
 		filters["http_x_forwarded_for"] = httpXForwardedFor
 	}
+	if method := r.URL.Query().Get("request_method"); method != "" {
+		filters["request_method"], _ = NormalizeMethod(method)
+	}
+	for _, key := range []string{"request_like", "user_agent_like"} {
+		if value := r.URL.Query().Get(key); value != "" {
+			filters[key] = value
+		}
+	}
+	if serverName := r.URL.Query().Get("server_name"); serverName != "" {
+		filters["server_name"] = serverName
+	}
+	for _, key := range []string{"status_min", "status_max", "bytes_min", "bytes_max"} {
+		if value := r.URL.Query().Get(key); value != "" {
+			bound, err := strconv.Atoi(value)
+			if err == nil {
+				filters[key] = bound
+			}
+		}
+	}
+	for _, key := range []string{"response_time_min", "response_time_max"} {
+		if value := r.URL.Query().Get(key); value != "" {
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err == nil {
+				filters[key] = seconds
+			}
+		}
+	}
+	// The tenant comes from the request's API key, never from its query, so it cannot be widened or swapped
+	if tenant := TenantFromContext(r.Context()); tenant != "" {
+		filters["tenant_id"] = tenant
+	}
 
 	return filters
 }
 
 // GetPaginationParams processes the pagination parameters from the HTTP request.
-// It returns a Pagination model containing the page number and the limit for the query.
-// If no pagination parameters are specified, it defaults to page 1 and limit 10.
+// It returns a Pagination model containing the limit and, when a cursor is given, the
+// time and id decoded from it. If no pagination parameters are specified, it defaults to limit 10.
 // Parameters:
 //   - r: The HTTP request containing the query parameters for pagination.
 // Returns:
-//   - Pagination model containing the page and limit.
-func GetPaginationParams(r *http.Request) models.Pagination {
+//   - Pagination model containing the limit and cursor.
+//   - ErrInvalidCursor if the cursor is malformed or has been tampered with.
+func GetPaginationParams(r *http.Request) (models.Pagination, error) {
 	pagination := models.Pagination{
 		Limit: 10,
 		Cursor: nil,
 		CursorID: nil,
+		CursorBy: CURSOR_BY_TIME,
 	}
 
 	// Parse the "page" parameter if it exists and is a valid positive integer.
@@ -76,33 +122,59 @@ func GetPaginationParams(r *http.Request) models.Pagination {
 
 	if l := r.URL.Query().Get("limit"); l != "" {
 		limitInt, err := strconv.Atoi(l)
-		if err == nil && limitInt > 0 && limitInt <= 100 {
+		if err == nil && limitInt > 0 && limitInt <= PARSER_MAX_PAGE_LIMIT {
 			pagination.Limit = limitInt
 		} else {
 			logger.LogInfo(fmt.Sprintf("Invalid or out-of-range 'limit' parameter: %v. Defaulting to limit 10.", l))
 		}
 	}
 
-	if l := r.URL.Query().Get("id"); l != "" {
-		id, err := strconv.Atoi(l)
-		if err == nil && id > 0  {
-			pagination.CursorID = &id
-		} else {
-			logger.LogInfo(fmt.Sprintf("Invalid or out-of-range 'id' parameter: %v.", l))
+	// Parse the signed "cursor" query parameter if it exists; it carries both the time and the id.
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		cursorTime, cursorID, err := DecodeCursor(cursor)
+		if err != nil {
+			logger.LogWarn(fmt.Sprintf("Invalid 'cursor' parameter: %v.", cursor))
+			return pagination, err
 		}
+		pagination.Cursor = &cursorTime
+		pagination.CursorID = &cursorID
 	}
 
-	// Parse "cursor" query parameter if it exists.
-	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
-		cursorTime, err := parseDateOrDateTime(cursor)
-		if err == nil {
-			pagination.Cursor = &cursorTime
-		} else {
-			logger.LogWarn(fmt.Sprintf("Invalid 'cursor' parameter: %v.", cursor))
+	return pagination, nil
+}
+
+// PaginationLinks builds the value of an RFC 5988 Link header pointing at the next and previous pages
+// of r: the request's own URL, with all its other parameters kept, the cursor parameter set to the
+// given cursor and, for the previous page, direction=prev. Nil cursors get no link, so an empty string
+// means there is no other page.
+func PaginationLinks(r *http.Request, next *string, prev *string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	link := func(cursor string, rel string) string {
+		query := r.URL.Query()
+		query.Set("cursor", cursor)
+		query.Del("direction")
+		if rel == "prev" {
+			query.Set("direction", DIRECTION_PREV)
 		}
+		target := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}
+		return fmt.Sprintf("<%s>; rel=\"%s\"", target.String(), rel)
 	}
 
-	return pagination
+	var links []string
+	if next != nil {
+		links = append(links, link(*next, "next"))
+	}
+	if prev != nil {
+		links = append(links, link(*prev, "prev"))
+	}
+	return strings.Join(links, ", ")
 }
 
 // GetDateFilters processes the "start_time" and "end_time" query parameters to return a TimeFilter model.
@@ -155,7 +227,73 @@ func GetDateFilters(r *http.Request) (timeFilter models.TimeFilter, err error) {
 	return timeFilters, nil
 }
 
+// GetTimeFormat reads the "time_format" query parameter, which selects how timestamps are rendered
+// in responses. It defaults to RFC3339 strings; "epoch_ms" renders integer milliseconds since the epoch.
+func GetTimeFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("time_format"); format {
+	case "", TIME_FORMAT_RFC3339:
+		return TIME_FORMAT_RFC3339, nil
+	case TIME_FORMAT_EPOCH_MS:
+		return TIME_FORMAT_EPOCH_MS, nil
+	default:
+		return "", fmt.Errorf("invalid time_format: '%s'. Expected %s or %s", format, TIME_FORMAT_RFC3339, TIME_FORMAT_EPOCH_MS)
+	}
+}
+
+// GetCursorBy reads the "cursor_by" query parameter, which selects the ordering GET /logs pages through.
+// It defaults to "time" (newest time_local first); "id" pages through the SERIAL id in ingestion order,
+// which is stable when logs arrive out of event-time order.
+func GetCursorBy(r *http.Request) (string, error) {
+	switch cursorBy := r.URL.Query().Get("cursor_by"); cursorBy {
+	case "", CURSOR_BY_TIME:
+		return CURSOR_BY_TIME, nil
+	case CURSOR_BY_ID:
+		return CURSOR_BY_ID, nil
+	default:
+		return "", fmt.Errorf("invalid cursor_by: '%s'. Expected %s or %s", cursorBy, CURSOR_BY_TIME, CURSOR_BY_ID)
+	}
+}
+
+// GetDirection reads the "direction" query parameter, which selects whether GET /logs reads the page
+// after the cursor ("next", the default) or the one before it ("prev").
+func GetDirection(r *http.Request) (string, error) {
+	switch direction := r.URL.Query().Get("direction"); direction {
+	case "", DIRECTION_NEXT:
+		return DIRECTION_NEXT, nil
+	case DIRECTION_PREV:
+		return DIRECTION_PREV, nil
+	default:
+		return "", fmt.Errorf("invalid direction: '%s'. Expected %s or %s", direction, DIRECTION_NEXT, DIRECTION_PREV)
+	}
+}
+
+// GetSort reads the "sort_by" and "order" query parameters, which select the column GET /logs is sorted
+// on and its direction. They default to time_local and desc; any other column than those in
+// LOG_SORT_COLUMNS, or direction than asc and desc, is rejected.
+func GetSort(r *http.Request) (string, string, error) {
+	sortBy := r.URL.Query().Get("sort_by")
+	if sortBy == "" {
+		sortBy = SORT_BY_TIME
+	} else if !slices.Contains(LOG_SORT_COLUMNS, sortBy) {
+		return "", "", fmt.Errorf("invalid sort_by: '%s'. Expected one of %s", sortBy, strings.Join(LOG_SORT_COLUMNS, ", "))
+	}
+
+	switch order := strings.ToLower(r.URL.Query().Get("order")); order {
+	case "", ORDER_DESC:
+		return sortBy, ORDER_DESC, nil
+	case ORDER_ASC:
+		return sortBy, ORDER_ASC, nil
+	default:
+		return "", "", fmt.Errorf("invalid order: '%s'. Expected %s or %s", order, ORDER_ASC, ORDER_DESC)
+	}
+}
+
 func parseDateOrDateTime(input string) (time.Time, error) {
+	// Try to parse as milliseconds since the epoch (e.g., "1744095425000"), as rendered by time_format=epoch_ms
+	if millis, err := strconv.ParseInt(input, 10, 64); err == nil {
+		return time.UnixMilli(millis).UTC(), nil
+	}
+
 	// Try to parse as a full timestamp (e.g., "2025-04-08T06:57:05Z")
 	parsedTime, err := time.Parse(time.RFC3339, input)
 	if err == nil {
@@ -170,5 +308,41 @@ func parseDateOrDateTime(input string) (time.Time, error) {
 	}
 
 	// If both parsing attempts fail, return an error
-	return time.Time{}, fmt.Errorf("invalid date format: '%s'. Expected formats: RFC3339 (e.g., 2025-04-08T06:57:05Z) or date (e.g., 2025-04-08)", input)
-}
\ No newline at end of file
+	return time.Time{}, fmt.Errorf("invalid date format: '%s'. Expected formats: RFC3339 (e.g., 2025-04-08T06:57:05Z), date (e.g., 2025-04-08) or epoch milliseconds (e.g., 1744095425000)", input)
+}
+
+// GetTimeSeriesInterval reads the "interval" query parameter, the size of the buckets GET /stats/timeseries
+// counts logs in: minute, hour or day, or 1m, 1h and 1d. It defaults to hour.
+func GetTimeSeriesInterval(r *http.Request) (string, error) {
+	switch interval := r.URL.Query().Get("interval"); interval {
+	case TIME_SERIES_MINUTE, "1m":
+		return TIME_SERIES_MINUTE, nil
+	case "", TIME_SERIES_HOUR, "1h":
+		return TIME_SERIES_HOUR, nil
+	case TIME_SERIES_DAY, "1d":
+		return TIME_SERIES_DAY, nil
+	default:
+		return "", fmt.Errorf("invalid interval: '%s'. Expected %s, %s or %s", interval, TIME_SERIES_MINUTE, TIME_SERIES_HOUR, TIME_SERIES_DAY)
+	}
+}
+
+// FILTER_KEYS lists the query parameters GenerateFiltersMap reads.
+var FILTER_KEYS = []string{
+	"remote_addr", "status", "body_bytes_sent", "http_referer", "http_user_agent", "http_x_forwarded_for",
+	"request_method", "request_like", "user_agent_like", "server_name", "status_min", "status_max",
+	"bytes_min", "bytes_max", "response_time_min", "response_time_max",
+}
+
+// UnknownFilterKeys returns, sorted, the query parameters of r that are neither a filter read by
+// GenerateFiltersMap, pretty, which every endpoint accepts, nor one of accepted, the other parameters
+// of the endpoint. A mistyped filter is otherwise silently ignored and the request matches every log.
+func UnknownFilterKeys(r *http.Request, accepted ...string) []string {
+	var unknown []string
+	for key := range r.URL.Query() {
+		if key != "pretty" && !slices.Contains(FILTER_KEYS, key) && !slices.Contains(accepted, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
@@ -7,10 +7,67 @@ package utils
 import (
 	"LogParser/models"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 )
 //select * from ( SELECT * FROM patients order by patient_id DESC LImit 10) as last10 order by patient_id ASC;
 
+// rangeFilters maps the range filters produced by GenerateFiltersMap to the comparison they apply.
+// Every other filter key is a column compared for equality.
+var rangeFilters = map[string]string{
+	"response_time_min": "response_time >=",
+	"response_time_max": "response_time <=",
+	"status_min":        "status >=",
+	"status_max":        "status <=",
+	"bytes_min":         "body_bytes_sent >=",
+	"bytes_max":         "body_bytes_sent <=",
+}
+
+// likeFilters maps the substring filters produced by GenerateFiltersMap to the column they match,
+// case-insensitively.
+var likeFilters = map[string]string{
+	"request_like":    "request",
+	"user_agent_like": "http_user_agent",
+}
+
+// likeEscaper escapes the LIKE wildcards, and the escape character itself, in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// appendFilter appends the " AND ..." condition for one filter to query, and its values to args,
+// numbering its placeholders after the args already bound. A list of status codes matches any of them,
+// substring filters match their value, escaped, between % wildcards.
+func appendFilter(query string, args []interface{}, key string, value interface{}) (string, []interface{}) {
+	if comparison, ok := rangeFilters[key]; ok {
+		args = append(args, value)
+		return query + fmt.Sprintf(" AND %s %s", comparison, Placeholder(len(args))), args
+	}
+	if column, ok := likeFilters[key]; ok {
+		args = append(args, "%"+likeEscaper.Replace(fmt.Sprint(value))+"%")
+		return query + fmt.Sprintf(" AND %s %s %s", column, likeOperator(), Placeholder(len(args))), args
+	}
+	if values, ok := value.([]int); ok {
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = Placeholder(len(args))
+		}
+		return query + fmt.Sprintf(" AND %s IN (%s)", key, strings.Join(placeholders, ",")), args
+	}
+	args = append(args, value)
+	return query + fmt.Sprintf(" AND %s = %s", key, Placeholder(len(args))), args
+}
+
+// LogsReadSource returns the relation log reads select from: the logs table, or while PARSER_DEDUP_STRINGS
+// is enabled the view that joins the de-duplicated user agents and referers back in.
+func LogsReadSource() string {
+	if ConfigData.DedupStrings {
+		return DB_LOGS_RESOLVED_VIEW
+	}
+	return DB_TABLE_NAME
+}
+
 
 // GenerateFilteredGetQuery generates a SQL query to fetch filtered logs from the database
 // based on provided filters, pagination, and date range.
@@ -23,20 +80,25 @@ import (
 //   - A slice of interface{} containing the values to be bound to the prepared statement.
 func GenerateFilteredGetQuery(filters map[string]interface{}, paginationFilter models.Pagination, dateFilter models.TimeFilter) (string, []interface{}) {
 	// Base query string to fetch logs
-	baseQuery := "SELECT id, remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for FROM logs WHERE 1=1"
+	baseQuery := "SELECT id, remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for, ingested_at, response_time, server_name FROM " + LogsReadSource() + " WHERE 1=1"
 	var args []interface{}
-	argIndex := 1
 
-	for key, value := range filters {
-		baseQuery += fmt.Sprintf(" AND %s = $%d", key, argIndex)
-		args = append(args, value)
-		argIndex++
+	// Sort the filter keys so the generated query is stable across calls
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		baseQuery, args = appendFilter(baseQuery, args, key, filters[key])
+	}
+	argIndex := len(args) + 1
 
 	if dateFilter.Start_time != nil {
 		startTime := dateFilter.Start_time.UTC().Format(time.RFC3339)
 		fmt.Println("Start:",startTime)
-		baseQuery += fmt.Sprintf(" AND time_local >= $%d", argIndex)
+		baseQuery += " AND time_local >= " + Placeholder(argIndex)
 		args = append(args, startTime)
 		argIndex++
 	}
@@ -44,22 +106,68 @@ func GenerateFilteredGetQuery(filters map[string]interface{}, paginationFilter m
 	if dateFilter.End_time != nil {
 		endTime := dateFilter.End_time.UTC().Format(time.RFC3339)
 		fmt.Println("End:",endTime)
-		baseQuery += fmt.Sprintf(" AND time_local <= $%d", argIndex)
+		baseQuery += " AND time_local <= " + Placeholder(argIndex)
 		args = append(args, endTime)
 		argIndex++
 	}
 
-	if paginationFilter.Cursor != nil && paginationFilter.CursorID != nil {
+	// The previous page is read walking back from the cursor, in reverse order; the caller reverses it
+	backward := paginationFilter.Direction == DIRECTION_PREV
+
+	// Insertion order: rows that arrive late in event time still get an id ahead of the cursor. Ids are
+	// taken when a row is inserted but seen once its transaction commits, so a row of an insert still
+	// running behind the cursor's can be skipped; the SERIAL id gives no commit order.
+	if paginationFilter.CursorBy == CURSOR_BY_ID {
+		comparison, order := ">", "ASC"
+		if backward {
+			comparison, order = "<", "DESC"
+		}
+		if paginationFilter.CursorID != nil {
+			baseQuery += fmt.Sprintf(" AND id %s %s", comparison, Placeholder(argIndex))
+			args = append(args, *paginationFilter.CursorID)
+			argIndex++
+		}
+		baseQuery += " ORDER BY id " + order
+		baseQuery += " LIMIT " + Placeholder(argIndex)
+		args = append(args, paginationFilter.Limit)
+		return baseQuery, args
+	}
+
+	// Only a whitelisted column and direction ever reach the query; anything else sorts by time, newest first
+	sortBy, order := SORT_BY_TIME, "DESC"
+	if slices.Contains(LOG_SORT_COLUMNS, paginationFilter.SortBy) {
+		sortBy = paginationFilter.SortBy
+	}
+	if (paginationFilter.Order == ORDER_ASC) != backward {
+		order = "ASC"
+	}
+
+	// Cursors page through time_local, in either order
+	if paginationFilter.Cursor != nil && paginationFilter.CursorID != nil && sortBy == SORT_BY_TIME {
+		comparison := "<"
+		if order == "ASC" {
+			comparison = ">"
+		}
+		cursor := paginationFilter.Cursor.UTC().Format(time.RFC3339Nano)
+		cursorAt, sameCursorAt := Placeholder(argIndex), Placeholder(argIndex)
+		args = append(args, cursor)
+		if DBDriver == DB_DRIVER_MYSQL {
+			// ? placeholders can't be reused, the cursor is bound again for its second use
+			args = append(args, cursor)
+			argIndex++
+			sameCursorAt = Placeholder(argIndex)
+		}
 		baseQuery += fmt.Sprintf(` AND (
-			time_local < $%d OR (time_local = $%d AND id < $%d)
-		)`, argIndex, argIndex, argIndex+1)
+			time_local %s %s OR (time_local = %s AND id %s %s)
+		)`, comparison, cursorAt, sameCursorAt, comparison, Placeholder(argIndex+1))
 		
-		args = append(args, paginationFilter.Cursor.UTC().Format(time.RFC3339), paginationFilter.CursorID)
+		args = append(args, paginationFilter.CursorID)
 		argIndex += 2
 	}
 
-	baseQuery += " ORDER BY time_local DESC, id DESC"
-	baseQuery += fmt.Sprintf(" LIMIT $%d", argIndex)
+	// The id breaks ties, so rows sharing a value keep a stable order
+	baseQuery += fmt.Sprintf(" ORDER BY %s %s, id %s", sortBy, order, order)
+	baseQuery += " LIMIT " + Placeholder(argIndex)
 	args = append(args, paginationFilter.Limit)
 
 	return baseQuery, args
@@ -95,20 +203,42 @@ func GenerateFilteredGetQuery(filters map[string]interface{}, paginationFilter m
 //   - A slice of interface{} containing the values to be bound to the prepared statement.
 func GenerateFilteredCountQuery(filters map[string]interface{}) (string, []interface{}) {//, paginationFilter models.Pagination, dateFilter models.TimeFilter
 	// Base query string to count logs
-	baseQuery := "SELECT COUNT(*) FROM logs WHERE 1=1"
+	baseQuery := "SELECT COUNT(*) FROM " + LogsReadSource() + " WHERE 1=1"
 	var args []interface{}
-	argIndex := 1
 
 	// Add filters to the query
 	for colmun, value := range filters {
-		baseQuery += fmt.Sprintf(" AND %s = $%d", colmun, argIndex)
-		args = append(args, value)
-		argIndex++
+		baseQuery, args = appendFilter(baseQuery, args, colmun, value)
 	}
 
 	return baseQuery, args
 }
 
+// GenerateSampleRateCountQuery generates a SQL query that counts the logs matching the filters per sample
+// rate they were ingested at, for estimating true totals. Logs stored without sampling count at rate 1.
+// Parameters:
+//   - filters: A map containing column names as keys and filter values as values.
+// Returns:
+//   - A string representing the SQL query with filters applied.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateSampleRateCountQuery(filters map[string]interface{}) (string, []interface{}) {
+	baseQuery := "SELECT COALESCE(sample_rate, 1) AS sample_rate, COUNT(*) FROM " + LogsReadSource() + " WHERE 1=1"
+	var args []interface{}
+
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		baseQuery, args = appendFilter(baseQuery, args, key, filters[key])
+	}
+
+	baseQuery += " GROUP BY COALESCE(sample_rate, 1)"
+	return baseQuery, args
+}
+
 func GetCount() (string) {//, paginationFilter models.Pagination, dateFilter models.TimeFilter
 	// Base query string to count logs
 	baseQuery := "SELECT COUNT(*) FROM logs;"
@@ -116,29 +246,210 @@ func GetCount() (string) {//, paginationFilter models.Pagination, dateFilter mod
 	return baseQuery
 }
 
-// GenerateDeleteQuery generates a SQL query to delete logs from the database based on the provided filters.
+// GenerateDeleteQuery generates a SQL query to delete logs from the database based on the provided filters
+// and date range.
 // Parameters:
 //   - filters: A map containing column names as keys and filter values as values.
+//   - dateFilter: A TimeFilter model containing start and end date for filtering logs.
 // Returns:
 //   - A string representing the SQL DELETE query with filters applied.
 //   - A slice of interface{} containing the values to be bound to the prepared statement.
-func GenerateDeleteQuery(filters map[string]interface{}) (string, []interface{}) {
+func GenerateDeleteQuery(filters map[string]interface{}, dateFilter models.TimeFilter) (string, []interface{}) {
 	// Base query string to delete logs
 	baseQuery := "DELETE FROM logs WHERE 1=1"
-	var args []interface{}
-	argIndex := 1
+	if ConfigData.DedupStrings {
+		// Filters on user agent or referer must match the joined values, so select the ids through the view
+		baseQuery = "DELETE FROM logs WHERE id IN (SELECT id FROM " + DB_LOGS_RESOLVED_VIEW + " WHERE 1=1"
+	}
 
-	// Add filters to the query
-	for column, value := range filters {
-		baseQuery += fmt.Sprintf(" AND %s = $%d", column, argIndex)
-		args = append(args, value)
-		argIndex++
+	// Add filters and the date range to the query
+	baseQuery, args := appendFiltersAndDates(baseQuery, nil, filters, dateFilter)
+	if ConfigData.DedupStrings {
+		baseQuery += ")"
 	}
 
 	// Return the query and the parameters
 	return baseQuery, args
 }
 
+// GenerateDeleteCountQuery generates a SQL query that counts the logs a delete with the same filters and
+// date range would remove.
+// Parameters:
+//   - filters: A map containing column names as keys and filter values as values.
+//   - dateFilter: A TimeFilter model containing start and end date for filtering logs.
+// Returns:
+//   - A string representing the SQL query with filters applied.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateDeleteCountQuery(filters map[string]interface{}, dateFilter models.TimeFilter) (string, []interface{}) {
+	return appendFiltersAndDates("SELECT COUNT(*) FROM "+LogsReadSource()+" WHERE 1=1", nil, filters, dateFilter)
+}
+
+// GenerateDeleteSampleQuery generates a SQL query that reads the first logs, oldest first, that a delete with
+// the same filters and date range would remove, so a dry run can show them without deleting anything.
+// Parameters:
+//   - filters: A map containing column names as keys and filter values as values.
+//   - dateFilter: A TimeFilter model containing start and end date for filtering logs.
+//   - limit: The maximum number of logs to read.
+// Returns:
+//   - A string representing the SQL query with filters applied.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateDeleteSampleQuery(filters map[string]interface{}, dateFilter models.TimeFilter, limit int) (string, []interface{}) {
+	query, args := GenerateExportQuery(filters, dateFilter)
+	args = append(args, limit)
+	return query + " LIMIT " + Placeholder(len(args)), args
+}
+
+// GenerateExportQuery generates a SQL query that reads every log matching the filters and date range,
+// oldest first, for exports that stream the whole result instead of paging through it.
+// Parameters:
+//   - filters: A map containing column names as keys and filter values as values.
+//   - dateFilter: A TimeFilter model containing start and end date for filtering logs.
+// Returns:
+//   - A string representing the SQL query with filters applied.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateExportQuery(filters map[string]interface{}, dateFilter models.TimeFilter) (string, []interface{}) {
+	baseQuery := "SELECT id, remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for, ingested_at, response_time, server_name FROM " + LogsReadSource() + " WHERE 1=1"
+	baseQuery, args := appendFiltersAndDates(baseQuery, nil, filters, dateFilter)
+
+	baseQuery += " ORDER BY time_local ASC, id ASC"
+	return baseQuery, args
+}
+
+// appendFiltersAndDates appends a condition for every filter, in key order, followed by the date range,
+// binding their values after the given args.
+func appendFiltersAndDates(query string, args []interface{}, filters map[string]interface{}, dateFilter models.TimeFilter) (string, []interface{}) {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		query, args = appendFilter(query, args, key, filters[key])
+	}
+	if dateFilter.Start_time != nil {
+		args = append(args, dateFilter.Start_time.UTC().Format(time.RFC3339Nano))
+		query += " AND time_local >= " + Placeholder(len(args))
+	}
+	if dateFilter.End_time != nil {
+		args = append(args, dateFilter.End_time.UTC().Format(time.RFC3339Nano))
+		query += " AND time_local <= " + Placeholder(len(args))
+	}
+	return query, args
+}
+
+// GenerateStatusAggregateQuery generates a SQL query that counts the logs matching the filters and date
+// range per HTTP status code, lowest status first.
+// Parameters:
+//   - filters: A map containing column names as keys and filter values as values.
+//   - dateFilter: A TimeFilter model containing start and end date for filtering logs.
+// Returns:
+//   - A string representing the SQL query with filters applied.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateStatusAggregateQuery(filters map[string]interface{}, dateFilter models.TimeFilter) (string, []interface{}) {
+	baseQuery := "SELECT status, COUNT(*) FROM " + LogsReadSource() + " WHERE 1=1"
+	baseQuery, args := appendFiltersAndDates(baseQuery, nil, filters, dateFilter)
+
+	baseQuery += " GROUP BY status ORDER BY status"
+	return baseQuery, args
+}
+
+// GenerateTopIPsQuery generates a SQL query that reads the remote addresses with the most logs matching
+// the filters and date range, busiest first.
+// Parameters:
+//   - filters: A map containing column names as keys and filter values as values.
+//   - dateFilter: A TimeFilter model containing start and end date for filtering logs.
+//   - limit: The maximum number of addresses to read.
+// Returns:
+//   - A string representing the SQL query with filters applied.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateTopIPsQuery(filters map[string]interface{}, dateFilter models.TimeFilter, limit int) (string, []interface{}) {
+	baseQuery := "SELECT remote_addr, COUNT(*) c FROM " + LogsReadSource() + " WHERE 1=1"
+	baseQuery, args := appendFiltersAndDates(baseQuery, nil, filters, dateFilter)
+
+	args = append(args, limit)
+	baseQuery += " GROUP BY remote_addr ORDER BY c DESC, remote_addr LIMIT " + Placeholder(len(args))
+	return baseQuery, args
+}
+
+// timeSeriesBucketFormats truncates time_local to each interval on MySQL, which has no date_trunc.
+var timeSeriesBucketFormats = map[string]string{
+	TIME_SERIES_MINUTE: "%Y-%m-%d %H:%i:00",
+	TIME_SERIES_HOUR:   "%Y-%m-%d %H:00:00",
+	TIME_SERIES_DAY:    "%Y-%m-%d 00:00:00",
+}
+
+// GenerateTimeSeriesQuery generates a SQL query that counts the logs matching the filters and date range
+// per interval, oldest bucket first. Buckets without logs are left out.
+// Parameters:
+//   - filters: A map containing column names as keys and filter values as values.
+//   - dateFilter: A TimeFilter model containing start and end date for filtering logs.
+//   - interval: The bucket size, TIME_SERIES_MINUTE, TIME_SERIES_HOUR or TIME_SERIES_DAY, as returned by
+//     GetTimeSeriesInterval. It is written into the query, so it must not come from the request unchecked.
+// Returns:
+//   - A string representing the SQL query with filters applied.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateTimeSeriesQuery(filters map[string]interface{}, dateFilter models.TimeFilter, interval string) (string, []interface{}) {
+	bucket := fmt.Sprintf("date_trunc('%s', time_local)", interval)
+	if DBDriver == DB_DRIVER_MYSQL {
+		bucket = fmt.Sprintf("TIMESTAMP(DATE_FORMAT(time_local, '%s'))", timeSeriesBucketFormats[interval])
+	}
+	baseQuery := "SELECT " + bucket + " bucket, COUNT(*) FROM " + LogsReadSource() + " WHERE 1=1"
+	baseQuery, args := appendFiltersAndDates(baseQuery, nil, filters, dateFilter)
+
+	baseQuery += " GROUP BY bucket ORDER BY bucket"
+	return baseQuery, args
+}
+
+// GenerateGetByIDQuery generates a SQL query that reads a single log by id. The raw_line column is
+// only selected while PARSER_STORE_RAW_LINE is enabled.
+// Parameters:
+//   - id: The id of the log to read.
+//   - tenant: The tenant the log must belong to, "" for an unscoped read.
+// Returns:
+//   - A string representing the SQL query.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateGetByIDQuery(id int, tenant string) (string, []interface{}) {
+	columns := "id, remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for, ingested_at, response_time, server_name"
+	if ConfigData.StoreRawLine {
+		columns += ", raw_line"
+	}
+	query, args := "SELECT "+columns+" FROM "+LogsReadSource()+" WHERE id = "+Placeholder(1), []interface{}{id}
+	if tenant != "" {
+		query += " AND tenant_id = " + Placeholder(2)
+		args = append(args, tenant)
+	}
+	return query, args
+}
+
+// logInsertColumns lists the columns written by GenerateAddQuery, in the order their values are appended.
+var logInsertColumns = []string{
+	"remote_addr", "remote_user", "time_local", "request", "status", "body_bytes_sent",
+	"http_referer", "http_user_agent", "http_x_forwarded_for",
+	"request_method", "request_path", "request_protocol", "response_time",
+	"server_name",
+}
+
+// insertColumns returns the logInsertColumns, followed by raw_line while PARSER_STORE_RAW_LINE is enabled,
+// sample_rate while ingestion sampling is, tenant_id while tenants are configured and dedup_key while
+// PARSER_IDEMPOTENT_INSERTS is enabled.
+func insertColumns() []string {
+	columns := append([]string(nil), logInsertColumns...)
+	if ConfigData.StoreRawLine {
+		columns = append(columns, "raw_line")
+	}
+	if Sampling() {
+		columns = append(columns, "sample_rate")
+	}
+	if Multitenant() {
+		columns = append(columns, "tenant_id")
+	}
+	if ConfigData.IdempotentInserts {
+		columns = append(columns, "dedup_key")
+	}
+	return columns
+}
+
 // GenerateAddQuery generates a SQL query to insert new logs into the database.
 // Parameters:
 //   - logs: A slice of Log models containing log entries to be inserted into the database.
@@ -146,27 +457,155 @@ func GenerateDeleteQuery(filters map[string]interface{}) (string, []interface{})
 //   - A string representing the SQL INSERT query with placeholders for values.
 //   - A slice of interface{} containing the values to be bound to the prepared statement.
 func GenerateAddQuery(logs []models.Log) (string, []interface{}) {
+	return generateInsertQuery(GenerateAddRows(logs))
+}
+
+// GenerateAddRows returns the columns written for new logs and the values of each log for them,
+// in the same order, as used by GenerateAddQuery and by COPY.
+func GenerateAddRows(logs []models.Log) ([]string, [][]interface{}) {
+	rows := make([][]interface{}, len(logs))
+	for i, logEntry := range logs {
+		rows[i] = logInsertValues(logEntry)
+	}
+	return insertColumns(), rows
+}
+
+// GenerateDedupAddQuery generates a SQL query to insert new logs that reference their user agent and
+// referer by lookup table id instead of storing the strings, used when PARSER_DEDUP_STRINGS is enabled.
+// Empty strings, which have no lookup row, are stored with a NULL id.
+// Parameters:
+//   - logs: A slice of Log models containing log entries to be inserted into the database.
+//   - userAgentIDs: The user_agents id of each user agent in logs.
+//   - refererIDs: The referers id of each referer in logs.
+// Returns:
+//   - A string representing the SQL INSERT query with placeholders for values.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateDedupAddQuery(logs []models.Log, userAgentIDs map[string]int, refererIDs map[string]int) (string, []interface{}) {
+	return generateInsertQuery(GenerateDedupAddRows(logs, userAgentIDs, refererIDs))
+}
+
+// GenerateDedupAddRows is GenerateAddRows for GenerateDedupAddQuery: user agents and referers are
+// written as their lookup table ids.
+func GenerateDedupAddRows(logs []models.Log, userAgentIDs map[string]int, refererIDs map[string]int) ([]string, [][]interface{}) {
+	columns := append(insertColumns(), "http_user_agent_id", "http_referer_id")
+
+	rows := make([][]interface{}, len(logs))
+	for i, logEntry := range logs {
+		userAgent, referer := logEntry.HttpUserAgent, logEntry.HttpReferer
+		logEntry.HttpUserAgent, logEntry.HttpReferer = "", ""
+		rows[i] = append(logInsertValues(logEntry), lookupID(userAgentIDs, userAgent), lookupID(refererIDs, referer))
+	}
+	return columns, rows
+}
+
+// logInsertValues returns the values of a log for the insertColumns, in the same order.
+func logInsertValues(logEntry models.Log) []interface{} {
+	requestLine := ParseRequestLine(logEntry.Request)
+	values := []interface{}{logEntry.RemoteAddr, logEntry.RemoteUser, logEntry.TimeLocal, 
+		logEntry.Request, logEntry.Status, logEntry.BodyBytesSent, 
+		logEntry.HttpReferer, logEntry.HttpUserAgent, logEntry.HttpXForwardedFor,
+		requestLine.Method, requestLine.Path, requestLine.Protocol, logEntry.ResponseTime,
+		logEntry.ServerName}
+	if ConfigData.StoreRawLine {
+		values = append(values, logEntry.RawLine)
+	}
+	if Sampling() {
+		values = append(values, ConfigData.SampleRate)
+	}
+	if Multitenant() {
+		values = append(values, logEntry.TenantID)
+	}
+	if ConfigData.IdempotentInserts {
+		values = append(values, logEntry.DedupKey)
+	}
+	return values
+}
+
+func lookupID(ids map[string]int, value string) interface{} {
+	if id, ok := ids[value]; ok {
+		return id
+	}
+	return nil
+}
+
+// generateInsertQuery builds a multi-row INSERT into logs with one placeholder per value, skipping the
+// logs already stored while PARSER_IDEMPOTENT_INSERTS is enabled.
+func generateInsertQuery(columns []string, rows [][]interface{}) (string, []interface{}) {
 	// Base query string to insert logs
 	query := `
-		INSERT INTO logs (remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for)
+		INSERT INTO logs (` + strings.Join(columns, ", ") + `)
 		VALUES `
 	
 	var values []interface{}
-	for i, logEntry := range logs {
+	for i, row := range rows {
 		// Placeholder for each log entry
-		placeholder := fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", 
-			i*9+1, i*9+2, i*9+3, i*9+4, i*9+5, i*9+6, i*9+7, i*9+8, i*9+9)
-		query += placeholder
+		placeholders := make([]string, len(columns))
+		for j := range placeholders {
+			placeholders[j] = Placeholder(i*len(columns) + j + 1)
+		}
+		query += "(" + strings.Join(placeholders, ", ") + ")"
 		// Add log entry values to the values slice
-		if i < len(logs)-1 {
+		if i < len(rows)-1 {
 			query += ", "
 		}
-
-		values = append(values, logEntry.RemoteAddr, logEntry.RemoteUser, logEntry.TimeLocal, 
-			logEntry.Request, logEntry.Status, logEntry.BodyBytesSent, 
-			logEntry.HttpReferer, logEntry.HttpUserAgent, logEntry.HttpXForwardedFor)
+		values = append(values, row...)
 	}
+	query += insertConflictClause()
 	
 	// Return the query and the values
 	return query, values 
 }
+
+// GenerateReenrichSelectQuery generates a SQL query that pages through logs lacking request-line
+// enrichment, in id order, starting after the given cursor.
+// Parameters:
+//   - filters: A map containing column names as keys and filter values as values.
+//   - cursor: The id of the last row already processed (0 to start from the beginning).
+//   - limit: The maximum number of rows to return.
+// Returns:
+//   - A string representing the SQL SELECT query returning id and request.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateReenrichSelectQuery(filters map[string]interface{}, cursor int, limit int) (string, []interface{}) {
+	baseQuery := "SELECT id, request FROM " + LogsReadSource() + " WHERE request_method IS NULL AND id > " + Placeholder(1)
+	args := []interface{}{cursor}
+
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		baseQuery, args = appendFilter(baseQuery, args, key, filters[key])
+	}
+	argIndex := len(args) + 1
+
+	baseQuery += " ORDER BY id LIMIT " + Placeholder(argIndex)
+	args = append(args, limit)
+
+	return baseQuery, args
+}
+
+// GenerateReenrichUpdateQuery generates a single UPDATE that writes the derived request-line
+// columns for a batch of rows. It uses UPDATE ... FROM (VALUES ...), so it is Postgres only.
+// Parameters:
+//   - ids: The ids of the rows to update.
+//   - lines: The request lines derived for each id, in the same order.
+// Returns:
+//   - A string representing the SQL UPDATE query with placeholders for values.
+//   - A slice of interface{} containing the values to be bound to the prepared statement.
+func GenerateReenrichUpdateQuery(ids []int, lines []models.RequestLine) (string, []interface{}) {
+	query := "UPDATE logs AS l SET request_method = v.request_method, request_path = v.request_path, request_protocol = v.request_protocol FROM (VALUES "
+
+	var values []interface{}
+	for i, id := range ids {
+		if i > 0 {
+			query += ", "
+		}
+		query += fmt.Sprintf("($%d::int, $%d, $%d, $%d)", i*4+1, i*4+2, i*4+3, i*4+4)
+		values = append(values, id, lines[i].Method, lines[i].Path, lines[i].Protocol)
+	}
+	query += ") AS v(id, request_method, request_path, request_protocol) WHERE l.id = v.id"
+
+	return query, values
+}
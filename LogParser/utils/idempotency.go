@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// DB_DEDUP_KEY_INDEX is the unique index on the dedup_key of the logs, created on startup while
+// PARSER_IDEMPOTENT_INSERTS is enabled. It includes time_local, which a partitioned table requires of
+// its unique indexes; the key already hashes the line holding the time.
+const DB_DEDUP_KEY_INDEX string = "CREATE UNIQUE INDEX IF NOT EXISTS idx_logs_dedup_key ON logs (dedup_key, time_local);"
+
+// DedupKey returns the dedup_key of a log line posted for tenant: the hex SHA-256 of both, so the same
+// line posted again yields the same key, while the same line posted by another tenant does not.
+func DedupKey(tenant string, line string) string {
+	sum := sha256.Sum256([]byte(tenant + "\x00" + line))
+	return hex.EncodeToString(sum[:])
+}
+
+// insertConflictClause returns the clause appended to log inserts while PARSER_IDEMPOTENT_INSERTS is
+// enabled, which skips the rows whose dedup_key is already stored, and "" otherwise.
+func insertConflictClause() string {
+	if !ConfigData.IdempotentInserts {
+		return ""
+	}
+	if DBDriver == DB_DRIVER_MYSQL {
+		// A no-op update leaves the stored row untouched and counts no affected row
+		return " ON DUPLICATE KEY UPDATE id = id"
+	}
+	return " ON CONFLICT DO NOTHING"
+}
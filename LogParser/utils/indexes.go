@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// INDEXABLE_COLUMNS are the logs columns PARSER_INDEXED_COLUMNS may name.
+var INDEXABLE_COLUMNS = []string{
+	"remote_addr", "remote_user", "time_local", "request", "status", "body_bytes_sent",
+	"http_referer", "http_user_agent", "http_x_forwarded_for", "ingested_at",
+	"request_method", "request_path", "request_protocol", "response_time", "server_name", "tenant_id",
+}
+
+// REQUIRED_INDEXED_COLUMNS are indexed whatever PARSER_INDEXED_COLUMNS names, for the paging by time_local
+// and the aggregates by status to perform.
+var REQUIRED_INDEXED_COLUMNS = []string{"time_local", "status"}
+
+// ParseIndexedColumns splits a comma separated list of column names, dropping blanks and repeats.
+func ParseIndexedColumns(value string) []string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, column := range strings.Split(value, ",") {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if column != "" && !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// ValidateIndexedColumns checks that every column is one of the INDEXABLE_COLUMNS.
+func ValidateIndexedColumns(columns []string) error {
+	for _, column := range columns {
+		known := false
+		for _, indexable := range INDEXABLE_COLUMNS {
+			if column == indexable {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("column '%s' cannot be indexed, expected one of %s", column, strings.Join(INDEXABLE_COLUMNS, ", "))
+		}
+	}
+	return nil
+}
+
+// IndexName returns the name of the index on a logs column, e.g. idx_time_local.
+func IndexName(column string) string {
+	return "idx_" + column
+}
+
+// GenerateIndexStatements returns an idempotent CREATE INDEX statement for each column.
+func GenerateIndexStatements(columns []string) []string {
+	statements := make([]string, 0, len(columns))
+	for _, column := range columns {
+		statements = append(statements, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s);", IndexName(column), DB_TABLE_NAME, column))
+	}
+	return statements
+}
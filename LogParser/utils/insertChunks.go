@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"LogParser/models"
+	"fmt"
+)
+
+// ValidateInsertChunking checks that the chunk size and the auto-tuner bounds are positive,
+// ordered, and no larger than INSERT_MAX_CHUNK_SIZE.
+func ValidateInsertChunking(config models.Config) error {
+	if config.InsertChunkSize <= 0 || config.InsertChunkSize > INSERT_MAX_CHUNK_SIZE {
+		return fmt.Errorf("chunk size %d is not between 1 and %d", config.InsertChunkSize, INSERT_MAX_CHUNK_SIZE)
+	}
+	if config.InsertChunkMin <= 0 || config.InsertChunkMax > INSERT_MAX_CHUNK_SIZE || config.InsertChunkMin > config.InsertChunkMax {
+		return fmt.Errorf("chunk bounds [%d, %d] must be ordered and between 1 and %d", config.InsertChunkMin, config.InsertChunkMax, INSERT_MAX_CHUNK_SIZE)
+	}
+	return nil
+}
+
+// InsertChunkLimit returns the most logs one INSERT can write: each log binds a value per insert column,
+// up to 20 with every optional column enabled, and Postgres binds at most MAX_QUERY_PARAMETERS values
+// per statement.
+func InsertChunkLimit() int {
+	columns := len(insertColumns())
+	if ConfigData.DedupStrings {
+		// The user agent and referer ids
+		columns += 2
+	}
+	return MAX_QUERY_PARAMETERS / columns
+}
+
+// ChunkLogs splits logs into consecutive chunks of at most size logs. The chunks share the
+// backing array of logs.
+func ChunkLogs(logs []models.Log, size int) [][]models.Log {
+	if size <= 0 {
+		size = len(logs)
+	}
+	var chunks [][]models.Log
+	for start := 0; start < len(logs); start += size {
+		end := start + size
+		if end > len(logs) {
+			end = len(logs)
+		}
+		chunks = append(chunks, logs[start:end])
+	}
+	return chunks
+}
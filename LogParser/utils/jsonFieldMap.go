@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"LogParser/models"
+	"fmt"
+	"strings"
+)
+
+// ParseJSONFieldMap parses a mapping of the form "src=dst,src2=dst2" as used in the
+// PARSER_JSON_FIELD_MAP environment variable. Malformed pairs are skipped.
+// Returns nil when the input is empty. The mapping lets upstreams keep their own key names
+// (e.g. "client_ip") while the parser stores them under the Log model's json field names
+// (e.g. "remote_addr").
+func ParseJSONFieldMap(value string) map[string]string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	mapping := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		src, dst := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if src == "" || dst == "" {
+			continue
+		}
+		mapping[src] = dst
+	}
+	return mapping
+}
+
+// ValidateJSONFieldMap checks that every mapping target is a known Log field and that
+// each target is fed by at most one source key, so required fields can't be ambiguously mapped.
+func ValidateJSONFieldMap(mapping map[string]string) error {
+	known := make(map[string]bool, len(models.LogJSONFields))
+	for _, field := range models.LogJSONFields {
+		known[field] = true
+	}
+
+	targets := make(map[string]string, len(mapping))
+	for src, dst := range mapping {
+		if !known[dst] {
+			return fmt.Errorf("key '%s' is mapped to unknown log field '%s'", src, dst)
+		}
+		if other, exists := targets[dst]; exists {
+			return fmt.Errorf("log field '%s' is mapped from both '%s' and '%s'", dst, other, src)
+		}
+		targets[dst] = src
+	}
+	return nil
+}
+
+// ApplyJSONFieldMap returns a copy of the decoded JSON object with mapped keys renamed to
+// their target Log field names. Keys that are not part of the mapping are kept as they are,
+// so upstreams already using the model's field names need no mapping at all.
+func ApplyJSONFieldMap(object map[string]interface{}, mapping map[string]string) map[string]interface{} {
+	renamed := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		if _, mapped := mapping[key]; !mapped {
+			renamed[key] = value
+		}
+	}
+	for src, dst := range mapping {
+		if value, ok := object[src]; ok {
+			renamed[dst] = value
+		}
+	}
+	return renamed
+}
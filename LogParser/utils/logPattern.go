@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// DEFAULT_LOG_PATTERN matches the built-in line formats. The Common Log Format ends after the body bytes
+// sent and the combined format after the user agent; with $http_x_forwarded_for present, nginx's
+// $request_time and a quoted $server_name may be appended.
+const DEFAULT_LOG_PATTERN string = `^(?P<remote_addr>[\d\.]+) - (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] "(?P<request>.*?)" ` +
+	`(?P<status>\d{3}) (?P<body_bytes_sent>\d+)(?: "(?P<http_referer>.*?)" "(?P<http_user_agent>.*?)"` +
+	`(?: "(?P<http_x_forwarded_for>.*?)"(?: (?P<response_time>\d+(?:\.\d+)?|-))?(?: "(?P<server_name>[^"]*)")?)?)?$`
+
+// LOG_PATTERN_REQUIRED_GROUPS are the named groups every log pattern must capture.
+var LOG_PATTERN_REQUIRED_GROUPS = []string{"remote_addr", "time_local", "request", "status"}
+
+// logPattern is the compiled pattern lines are parsed with, swapped whole by SetLogPattern.
+var logPattern atomic.Pointer[regexp.Regexp]
+
+func init() {
+	logPattern.Store(regexp.MustCompile(DEFAULT_LOG_PATTERN))
+}
+
+// CompileLogPattern compiles pattern and checks that it captures every group of LOG_PATTERN_REQUIRED_GROUPS.
+func CompileLogPattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range LOG_PATTERN_REQUIRED_GROUPS {
+		if re.SubexpIndex(group) < 0 {
+			return nil, fmt.Errorf("pattern has no named group %q, it needs %v", group, LOG_PATTERN_REQUIRED_GROUPS)
+		}
+	}
+	return re, nil
+}
+
+// SetLogPattern swaps in pattern as the one lines are parsed with, or DEFAULT_LOG_PATTERN when it is
+// empty. The pattern is only compiled when it changed; an invalid one leaves the current pattern in place.
+func SetLogPattern(pattern string) error {
+	if pattern == "" {
+		pattern = DEFAULT_LOG_PATTERN
+	}
+	if LogPattern().String() == pattern {
+		return nil
+	}
+	re, err := CompileLogPattern(pattern)
+	if err != nil {
+		return err
+	}
+	logPattern.Store(re)
+	return nil
+}
+
+// LogPattern returns the pattern lines are parsed with.
+func LogPattern() *regexp.Regexp {
+	return logPattern.Load()
+}
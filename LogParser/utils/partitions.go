@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MonthStart returns the first instant of t's month in UTC.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// PartitionName returns the name of the partition holding the logs of month's month, e.g. "logs_y2025m04".
+func PartitionName(month time.Time) string {
+	month = MonthStart(month)
+	return fmt.Sprintf("%s_y%04dm%02d", DB_TABLE_NAME, month.Year(), int(month.Month()))
+}
+
+// ParsePartitionName returns the month a partition name produced by PartitionName stands for.
+// Other names, such as the default partition, report false.
+func ParsePartitionName(name string) (time.Time, bool) {
+	var year, month int
+	var rest string
+	n, _ := fmt.Sscanf(name, DB_TABLE_NAME+"_y%04dm%02d%s", &year, &month, &rest)
+	if n != 2 || month < 1 || month > 12 || name != PartitionName(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)) {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// GenerateCreatePartitionQuery generates the statement creating the partition for month's month.
+func GenerateCreatePartitionQuery(month time.Time) string {
+	from := MonthStart(month)
+	to := from.AddDate(0, 1, 0)
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s');",
+		PartitionName(from), DB_TABLE_NAME, from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// GenerateMoveDefaultRowsQuery generates the statement moving the logs of month's month out of the
+// default partition, into a temporary table dropped when the transaction commits. Postgres refuses to
+// create the partition of a month while the default partition holds logs of it.
+func GenerateMoveDefaultRowsQuery(month time.Time) string {
+	from := MonthStart(month)
+	to := from.AddDate(0, 1, 0)
+	return fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS WITH moved AS (DELETE FROM %s WHERE time_local >= '%s' AND time_local < '%s' RETURNING *) SELECT * FROM moved;",
+		DB_MOVED_LOGS_TABLE, DB_DEFAULT_PARTITION, from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// GenerateDropPartitionQuery generates the statement dropping a partition.
+func GenerateDropPartitionQuery(name string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s;", name)
+}
+
+// ExpiredPartitions returns, oldest first, the monthly partitions among names that only hold
+// logs older than cutoff. A partition still holding any log at or after cutoff is kept whole.
+func ExpiredPartitions(names []string, cutoff time.Time) []string {
+	var expired []string
+	for _, name := range names {
+		month, ok := ParsePartitionName(name)
+		if ok && !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
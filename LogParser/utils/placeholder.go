@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DBDriver is the database driver queries are generated for, DB_DRIVER or DB_DRIVER_MYSQL.
+// It is set by connection.InitDB once the database configuration is loaded.
+var DBDriver = DB_DRIVER
+
+// Placeholder returns the placeholder binding the n-th argument of a query, counting from 1: $n for
+// Postgres and ? for MySQL. A ? binds the arguments in the order they appear in the query, so a value
+// used twice has to be bound twice.
+func Placeholder(n int) string {
+	if DBDriver == DB_DRIVER_MYSQL {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// numberedPlaceholderRe matches the $n placeholders of the query constants.
+var numberedPlaceholderRe = regexp.MustCompile(`\$\d+`)
+
+// DriverQuery returns query, one of the constants written with $n placeholders, for the driver: on
+// MySQL each $n becomes a ?. The placeholders have to appear in order, each one once.
+func DriverQuery(query string) string {
+	if DBDriver == DB_DRIVER_MYSQL {
+		return numberedPlaceholderRe.ReplaceAllLiteralString(query, "?")
+	}
+	return query
+}
+
+// likeOperator returns the case-insensitive LIKE of the driver. MySQL has no ILIKE, its LIKE already
+// ignores case with the default collations.
+func likeOperator() string {
+	if DBDriver == DB_DRIVER_MYSQL {
+		return "LIKE"
+	}
+	return "ILIKE"
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"LogParser/models"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// STANDARD_METHODS are the HTTP methods of RFC 9110 and RFC 5789 (PATCH) that are always known.
+var STANDARD_METHODS = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"}
+
+// ParseRequestLine splits a request line such as "GET /index.html HTTP/1.1" into its method,
+// path and protocol. Missing parts are left empty, so a malformed request still yields a
+// (partially) enriched row instead of being retried forever.
+func ParseRequestLine(request string) models.RequestLine {
+	parts := strings.Fields(request)
+	var line models.RequestLine
+	if len(parts) > 0 {
+		var known bool
+		line.Method, known = NormalizeMethod(parts[0])
+		line.Method = truncate(line.Method, 16)
+		line.UnknownMethod = !known
+	}
+	if len(parts) > 1 {
+		line.Path = truncate(parts[1], 255)
+	}
+	if len(parts) > 2 {
+		line.Protocol = truncate(parts[2], 16)
+	}
+	return line
+}
+
+// truncate cuts s to at most n bytes so it fits the column it is stored in. The cut backs off to
+// the start of the rune it falls in, so a multi-byte character is never split into invalid UTF-8,
+// which Postgres would reject.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// NormalizeMethod upper-cases a request method and reports whether it is one of the STANDARD_METHODS
+// or the extension methods configured in PARSER_EXTRA_METHODS.
+func NormalizeMethod(method string) (string, bool) {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	for _, known := range STANDARD_METHODS {
+		if method == known {
+			return method, true
+		}
+	}
+	for _, known := range ConfigData.ExtraMethods {
+		if method == known {
+			return method, true
+		}
+	}
+	return method, false
+}
+
+// ParseMethods splits a comma separated list of extension methods, such as WebDAV's
+// "PROPFIND,MKCOL", into upper-cased method names, dropping blanks.
+func ParseMethods(value string) []string {
+	var methods []string
+	for _, method := range strings.Split(value, ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// ValidateMethods checks that every extension method is made of letters, an HTTP token the
+// request_method column can hold.
+func ValidateMethods(methods []string) error {
+	for _, method := range methods {
+		if method == "" || len(method) > 16 || strings.Trim(method, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return fmt.Errorf("invalid method '%s', expected at most 16 letters", method)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"LogParser/models"
+	"fmt"
+	"strings"
+)
+
+// ParseRequiredFields parses a comma-separated field list as used in the PARSER_REQUIRED_FIELDS
+// environment variable, e.g. "remote_addr,status,time_local". Empty entries are skipped.
+func ParseRequiredFields(value string) []string {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// ValidateRequiredFields checks that every required field is a known Log field.
+func ValidateRequiredFields(fields []string) error {
+	known := make(map[string]bool, len(models.LogJSONFields))
+	for _, field := range models.LogJSONFields {
+		known[field] = true
+	}
+
+	for _, field := range fields {
+		if !known[field] {
+			return fmt.Errorf("unknown log field '%s'", field)
+		}
+	}
+	return nil
+}
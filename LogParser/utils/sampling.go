@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"LogParser/models"
+	"fmt"
+)
+
+// RateCount is the number of stored logs that were ingested at one sample rate.
+type RateCount struct {
+	SampleRate float64
+	Count      int
+}
+
+// ValidateSampleRate checks that the sample rate is a fraction of logs kept, greater than 0 and at most 1.
+func ValidateSampleRate(rate float64) error {
+	if rate <= 0 || rate > 1 {
+		return fmt.Errorf("sample rate %v is not greater than 0 and at most 1", rate)
+	}
+	return nil
+}
+
+// Sampling reports whether ingestion sampling is enabled, that is PARSER_SAMPLE_RATE is below 1.
+func Sampling() bool {
+	return ConfigData.SampleRate > 0 && ConfigData.SampleRate < 1
+}
+
+// SampleLogs keeps each log with probability rate, drawing from random, which returns values in [0, 1).
+// The kept logs share the backing array of logs and keep their order. A rate of 1 or more keeps every log.
+func SampleLogs(logs []models.Log, rate float64, random func() float64) []models.Log {
+	if rate >= 1 {
+		return logs
+	}
+	kept := logs[:0]
+	for _, logEntry := range logs {
+		if random() < rate {
+			kept = append(kept, logEntry)
+		}
+	}
+	return kept
+}
+
+// EstimateCount scales stored counts back up to an estimate of the true number of logs: each log
+// stored at sample rate r stands for 1/r logs. Logs stored without sampling have a rate of 1.
+func EstimateCount(counts []RateCount) float64 {
+	var estimate float64
+	for _, count := range counts {
+		if count.SampleRate <= 0 {
+			continue
+		}
+		estimate += float64(count.Count) / count.SampleRate
+	}
+	return estimate
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// logsTableRe matches the reads from the logs table rewritten by ScopeQueryToTenant.
+var logsTableRe = regexp.MustCompile(`\bFROM ` + DB_TABLE_NAME + `\b`)
+
+// tenantKey is the context key under which the tenant of a request is stored.
+type tenantKey struct{}
+
+// Multitenant reports whether tenants are configured, in which case every log and stats request
+// is scoped to the tenant of its API key.
+func Multitenant() bool {
+	return len(ConfigData.Tenants) > 0
+}
+
+// TenantForKey returns the tenant the API key belongs to. Keys are compared in constant time.
+func TenantForKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	tenant, found := "", false
+	for candidate, id := range ConfigData.Tenants {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			tenant, found = id, true
+		}
+	}
+	return tenant, found
+}
+
+// WithTenant returns a copy of ctx carrying the tenant a request is scoped to.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant stored by WithTenant, or "" for an unscoped request.
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// ValidateTenants checks that every API key is set and maps to a tenant id that fits the tenant_id column.
+func ValidateTenants(tenants map[string]string) error {
+	for key, tenant := range tenants {
+		if key == "" {
+			return fmt.Errorf("tenant %q has an empty API key", tenant)
+		}
+		if tenant == "" || len(tenant) > TENANT_ID_MAX_LENGTH {
+			return fmt.Errorf("tenant id %q must be between 1 and %d characters", tenant, TENANT_ID_MAX_LENGTH)
+		}
+	}
+	return nil
+}
+
+// ScopeToTenant returns the relation to select from in place of relation, narrowed to the rows of tenant,
+// and args with the tenant appended for the placeholder it binds. Without a tenant both are returned unchanged.
+// With ? placeholders the tenant binds in order, so the relation must follow any placeholder already in args.
+func ScopeToTenant(relation string, tenant string, args []interface{}) (string, []interface{}) {
+	if tenant == "" {
+		return relation, args
+	}
+	args = append(args, tenant)
+	return fmt.Sprintf("(SELECT * FROM %s WHERE tenant_id = %s) AS %s", relation, Placeholder(len(args)), relation), args
+}
+
+// ScopeQueryToTenant rewrites query so its reads from the logs table only see the rows of tenant, see
+// ScopeToTenant. Without a tenant both are returned unchanged.
+func ScopeQueryToTenant(query string, tenant string, args []interface{}) (string, []interface{}) {
+	if tenant == "" {
+		return query, args
+	}
+	if DBDriver == DB_DRIVER_MYSQL {
+		return scopeQueryToTenantInOrder(query, tenant, args)
+	}
+	source, args := ScopeToTenant(DB_TABLE_NAME, tenant, args)
+	return logsTableRe.ReplaceAllLiteralString(query, "FROM "+source), args
+}
+
+// scopeQueryToTenantInOrder is ScopeQueryToTenant for ? placeholders, which bind in the order they appear:
+// the tenant is bound once per read from the logs table, between the args of the placeholders around it.
+func scopeQueryToTenantInOrder(query string, tenant string, args []interface{}) (string, []interface{}) {
+	source, _ := ScopeToTenant(DB_TABLE_NAME, tenant, nil)
+
+	var scoped strings.Builder
+	var scopedArgs []interface{}
+	last, bound := 0, 0
+	for _, match := range logsTableRe.FindAllStringIndex(query, -1) {
+		before := min(bound+strings.Count(query[last:match[0]], "?"), len(args))
+		scopedArgs = append(append(scopedArgs, args[bound:before]...), tenant)
+		scoped.WriteString(query[last:match[0]] + "FROM " + source)
+		last, bound = match[1], before
+	}
+	scoped.WriteString(query[last:])
+	return scoped.String(), append(scopedArgs, args[bound:]...)
+}
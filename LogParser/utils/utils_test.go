@@ -3,14 +3,18 @@ package utils
 import (
 	"LogParser/logger"
 	"LogParser/models"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -213,13 +217,13 @@ func TestGenerateFilteredGetQuery(t *testing.T) {
 	query, args := GenerateFilteredGetQuery(filters, paginationFilter, dateFilter)
 
 	// Expected query string
-	expectedQuery := `SELECT remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for FROM logs WHERE 1=1 AND status = $1 AND request = $2 AND time_local >= $3 AND time_local <= $4 LIMIT $5`
+	expectedQuery := `SELECT id, remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for, ingested_at, response_time, server_name FROM logs WHERE 1=1 AND request = $1 AND status = $2 AND time_local >= $3 AND time_local <= $4 ORDER BY time_local DESC, id DESC LIMIT $5`
 
 	// Assert that the query matches
 	assert.Equal(t, expectedQuery, query)
 
 	// Assert that the args are correctly constructed
-	expectedArgs := []interface{}{"200", "/api/v1/logs", "2022-03-01T00:00:00Z", "2022-03-02T00:00:00Z", 10}
+	expectedArgs := []interface{}{"/api/v1/logs", "200", "2022-03-01T00:00:00Z", "2022-03-02T00:00:00Z", 10}
 	assert.Equal(t, expectedArgs, args)
 }
 
@@ -251,19 +255,142 @@ func TestGenerateDeleteQuery(t *testing.T) {
 	}
 
 	// Call the function
-	query, args := GenerateDeleteQuery(filters)
+	query, args := GenerateDeleteQuery(filters, models.TimeFilter{})
 
-	// Expected query string
-	expectedQuery := `DELETE FROM logs WHERE 1=1 AND status = $1 AND request = $2`
+	// Expected query string, filters in key order
+	expectedQuery := `DELETE FROM logs WHERE 1=1 AND request = $1 AND status = $2`
 
 	// Assert that the query matches
 	assert.Equal(t, expectedQuery, query)
 
 	// Assert that the args are correctly constructed
-	expectedArgs := []interface{}{"500", "/api/v1/deleteLogs"}
+	expectedArgs := []interface{}{"/api/v1/deleteLogs", "500"}
 	assert.Equal(t, expectedArgs, args)
 }
 
+func TestGenerateDeleteQuery_TimeRange(t *testing.T) {
+	start := time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, time.April, 11, 0, 0, 0, 0, time.UTC)
+
+	query, args := GenerateDeleteQuery(map[string]interface{}{"status": 500}, models.TimeFilter{Start_time: &start, End_time: &end})
+	assert.Equal(t, "DELETE FROM logs WHERE 1=1 AND status = $1 AND time_local >= $2 AND time_local <= $3", query)
+	assert.Equal(t, []interface{}{500, "2025-04-10T00:00:00Z", "2025-04-11T00:00:00Z"}, args)
+
+	// Everything before a date
+	query, args = GenerateDeleteQuery(map[string]interface{}{}, models.TimeFilter{End_time: &end})
+	assert.Equal(t, "DELETE FROM logs WHERE 1=1 AND time_local <= $1", query)
+	assert.Equal(t, []interface{}{"2025-04-11T00:00:00Z"}, args)
+
+	query, args = GenerateDeleteCountQuery(map[string]interface{}{}, models.TimeFilter{End_time: &end})
+	assert.Equal(t, "SELECT COUNT(*) FROM logs WHERE 1=1 AND time_local <= $1", query)
+	assert.Equal(t, []interface{}{"2025-04-11T00:00:00Z"}, args)
+}
+
+func TestGenerateQueries_StoreRawLine(t *testing.T) {
+	defer func(store bool) { ConfigData.StoreRawLine = store }(ConfigData.StoreRawLine)
+	raw := `127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`
+	logs := []models.Log{{RemoteAddr: "127.0.0.1", Request: "GET /home HTTP/1.1", RawLine: &raw}}
+
+	ConfigData.StoreRawLine = true
+	query, args := GenerateAddQuery(logs)
+	assert.Contains(t, query, "server_name, raw_line)")
+	assert.Len(t, args, 15)
+	assert.Equal(t, &raw, args[14])
+	query, args = GenerateDedupAddQuery(logs, nil, nil)
+	assert.Contains(t, query, "server_name, raw_line, http_user_agent_id, http_referer_id)")
+	assert.Len(t, args, 17)
+	query, args = GenerateGetByIDQuery(7, "")
+	assert.Equal(t, "SELECT id, remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for, ingested_at, response_time, server_name, raw_line FROM logs WHERE id = $1", query)
+	assert.Equal(t, []interface{}{7}, args)
+
+	ConfigData.StoreRawLine = false
+	query, args = GenerateAddQuery(logs)
+	assert.NotContains(t, query, "raw_line")
+	assert.Len(t, args, 14)
+	query, _ = GenerateGetByIDQuery(7, "")
+	assert.NotContains(t, query, "raw_line")
+}
+
+func TestEstimateCount(t *testing.T) {
+	// A stored count of 100 at a 10% sample stands for about 1000 logs
+	assert.InDelta(t, 1000, EstimateCount([]RateCount{{SampleRate: 0.1, Count: 100}}), 1e-9)
+	// Logs stored before sampling was enabled count once
+	assert.InDelta(t, 1040, EstimateCount([]RateCount{{SampleRate: 0.1, Count: 100}, {SampleRate: 0.25, Count: 5}, {SampleRate: 1, Count: 20}}), 1e-9)
+	assert.Zero(t, EstimateCount(nil))
+}
+
+func TestSampleLogs(t *testing.T) {
+	logs := []models.Log{{RemoteAddr: "1"}, {RemoteAddr: "2"}, {RemoteAddr: "3"}, {RemoteAddr: "4"}}
+	draws := []float64{0.05, 0.5, 0.09, 0.99}
+	next := 0
+	random := func() float64 {
+		next++
+		return draws[next-1]
+	}
+
+	kept := SampleLogs(append([]models.Log(nil), logs...), 0.1, random)
+	assert.Equal(t, []models.Log{{RemoteAddr: "1"}, {RemoteAddr: "3"}}, kept)
+	assert.Equal(t, logs, SampleLogs(logs, 1, nil))
+}
+
+func TestValidateSampleRate(t *testing.T) {
+	assert.NoError(t, ValidateSampleRate(1))
+	assert.NoError(t, ValidateSampleRate(0.1))
+	assert.Error(t, ValidateSampleRate(0))
+	assert.Error(t, ValidateSampleRate(1.5))
+}
+
+func TestParseCORSOrigins(t *testing.T) {
+	assert.Equal(t, []string{"https://dashboard.example.com", "http://localhost:3000"}, ParseCORSOrigins(" https://dashboard.example.com/, ,http://localhost:3000"))
+	assert.Nil(t, ParseCORSOrigins(""))
+}
+
+func TestValidateCORSOrigins(t *testing.T) {
+	assert.NoError(t, ValidateCORSOrigins(nil))
+	assert.NoError(t, ValidateCORSOrigins([]string{"*", "https://dashboard.example.com", "http://localhost:3000"}))
+	assert.Error(t, ValidateCORSOrigins([]string{"dashboard.example.com"}))
+	assert.Error(t, ValidateCORSOrigins([]string{"https://dashboard.example.com/stats"}))
+	assert.Error(t, ValidateCORSOrigins([]string{"ftp://dashboard.example.com"}))
+}
+
+func TestGenerateQueries_Sampling(t *testing.T) {
+	defer func(rate float64) { ConfigData.SampleRate = rate }(ConfigData.SampleRate)
+	logs := []models.Log{{RemoteAddr: "127.0.0.1", Request: "GET /home HTTP/1.1"}}
+
+	ConfigData.SampleRate = 0.1
+	query, args := GenerateAddQuery(logs)
+	assert.Contains(t, query, "server_name, sample_rate)")
+	assert.Len(t, args, 15)
+	assert.Equal(t, 0.1, args[14])
+
+	ConfigData.SampleRate = 1
+	query, args = GenerateAddQuery(logs)
+	assert.NotContains(t, query, "sample_rate")
+	assert.Len(t, args, 14)
+
+	query, args = GenerateSampleRateCountQuery(map[string]interface{}{"status": "200", "remote_addr": "127.0.0.1"})
+	assert.Equal(t, "SELECT COALESCE(sample_rate, 1) AS sample_rate, COUNT(*) FROM logs WHERE 1=1 AND remote_addr = $1 AND status = $2 GROUP BY COALESCE(sample_rate, 1)", query)
+	assert.Equal(t, []interface{}{"127.0.0.1", "200"}, args)
+}
+
+func TestIndexedColumns(t *testing.T) {
+	columns := ParseIndexedColumns(" Status, remote_addr,,status")
+	assert.Equal(t, []string{"status", "remote_addr"}, columns)
+	assert.NoError(t, ValidateIndexedColumns(columns))
+	assert.Error(t, ValidateIndexedColumns([]string{"status", "raw_line"}))
+
+	// Exactly the configured indexes are generated
+	assert.Equal(t, []string{
+		"CREATE INDEX IF NOT EXISTS idx_status ON logs (status);",
+		"CREATE INDEX IF NOT EXISTS idx_remote_addr ON logs (remote_addr);",
+	}, GenerateIndexStatements(columns))
+	assert.Empty(t, GenerateIndexStatements(nil))
+	assert.Equal(t, []string{
+		"CREATE INDEX IF NOT EXISTS idx_time_local ON logs (time_local);",
+		"CREATE INDEX IF NOT EXISTS idx_ingested_at ON logs (ingested_at);",
+	}, GenerateIndexStatements(ParseIndexedColumns(PARSER_INDEXED_COLUMNS)))
+}
+
 func TestGenerateAddQuery(t *testing.T) {
 	// Create sample logs
 	logs := []models.Log{
@@ -285,14 +412,14 @@ func TestGenerateAddQuery(t *testing.T) {
 
 	// Expected query string
 	expectedQuery := `
-		INSERT INTO logs (remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+		INSERT INTO logs (remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for, request_method, request_path, request_protocol, response_time, server_name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
 	
 	// Assert that the query matches
 	assert.Contains(t, query, expectedQuery)//"INSERT INTO logs (remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for) VALUES"
 
 	// Assert that the args are correctly constructed
-	assert.Len(t, args, 9) // There should be 9 values in the args slice
+	assert.Len(t, args, 14) // There should be 14 values in the args slice
 	assert.Equal(t, "192.168.1.1", args[0])
 	assert.Equal(t, "user1", args[1])
 	//assert.Equal(t, logs[0].TimeLocal.UTC().Format(time.RFC3339), args[2].(string))
@@ -302,6 +429,191 @@ func TestGenerateAddQuery(t *testing.T) {
 	assert.Equal(t, "https://example.com", args[6])
 	assert.Equal(t, "Mozilla/5.0", args[7])
 	assert.Equal(t, "192.168.1.2", args[8])
+	assert.Equal(t, "/API/V1/LOGS", args[9])
+	assert.Equal(t, "", args[10])
+	assert.Equal(t, "", args[11])
+}
+
+func TestGenerateAddQuery_Idempotent(t *testing.T) {
+	defer func(enabled bool) { ConfigData.IdempotentInserts = enabled }(ConfigData.IdempotentInserts)
+	defer func(driver string) { DBDriver = driver }(DBDriver)
+	ConfigData.IdempotentInserts = true
+	DBDriver = DB_DRIVER
+	logs := []models.Log{
+		{RemoteAddr: "10.0.0.1", DedupKey: "key-1"},
+		{RemoteAddr: "10.0.0.2", DedupKey: "key-2"},
+	}
+
+	query, args := GenerateAddQuery(logs)
+	assert.Contains(t, query, "server_name, dedup_key)")
+	assert.True(t, strings.HasSuffix(query, "($16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30) ON CONFLICT DO NOTHING"), query)
+	assert.Len(t, args, 30)
+	assert.Equal(t, "key-1", args[14])
+	assert.Equal(t, "key-2", args[29])
+
+	DBDriver = DB_DRIVER_MYSQL
+	query, _ = GenerateAddQuery(logs)
+	assert.True(t, strings.HasSuffix(query, " ON DUPLICATE KEY UPDATE id = id"), query)
+
+	ConfigData.IdempotentInserts = false
+	query, args = GenerateAddQuery(logs)
+	assert.NotContains(t, query, "dedup_key")
+	assert.NotContains(t, query, "ON DUPLICATE KEY")
+	assert.Len(t, args, 28)
+}
+
+func TestDedupKey(t *testing.T) {
+	line := `127.0.0.1 - - [17/Mar/2025:13:30:20 +0530] "GET /home HTTP/1.1" 200 500 "-" "Mozilla/5.0" "-"`
+
+	key := DedupKey("", line)
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, DedupKey("", line), "the same line has the same key")
+	assert.NotEqual(t, key, DedupKey("", line+" "))
+	assert.NotEqual(t, key, DedupKey("tenant-a", line), "tenants do not share keys")
+	assert.NotEqual(t, DedupKey("tenant-a", line), DedupKey("tenant-b", line))
+}
+
+func TestGenerateDedupAddQuery(t *testing.T) {
+	logs := []models.Log{
+		{RemoteAddr: "10.0.0.1", Request: "GET / HTTP/1.1", Status: 200, HttpReferer: "https://example.com", HttpUserAgent: "Mozilla/5.0"},
+		{RemoteAddr: "10.0.0.2", Request: "GET / HTTP/1.1", Status: 200, HttpReferer: "", HttpUserAgent: "Mozilla/5.0"},
+	}
+
+	query, args := GenerateDedupAddQuery(logs, map[string]int{"Mozilla/5.0": 4}, map[string]int{"https://example.com": 9})
+
+	assert.Contains(t, query, "http_x_forwarded_for, request_method, request_path, request_protocol, response_time, server_name, http_user_agent_id, http_referer_id)")
+	assert.Contains(t, query, "($17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32)")
+	assert.Len(t, args, 32)
+	// The inline strings are left empty and the ids reference the lookup rows
+	assert.Equal(t, []interface{}{"", "", 4, 9}, []interface{}{args[6], args[7], args[14], args[15]})
+	assert.Equal(t, []interface{}{"", "", 4, nil}, []interface{}{args[22], args[23], args[30], args[31]})
+}
+
+func TestLogsReadSource(t *testing.T) {
+	defer func(enabled bool) { ConfigData.DedupStrings = enabled }(ConfigData.DedupStrings)
+
+	ConfigData.DedupStrings = false
+	assert.Equal(t, "logs", LogsReadSource())
+	query, _ := GenerateDeleteQuery(map[string]interface{}{"http_user_agent": "curl/8.0"}, models.TimeFilter{})
+	assert.Equal(t, "DELETE FROM logs WHERE 1=1 AND http_user_agent = $1", query)
+
+	ConfigData.DedupStrings = true
+	assert.Equal(t, "logs_resolved", LogsReadSource())
+	query, _ = GenerateFilteredGetQuery(map[string]interface{}{"http_user_agent": "curl/8.0"}, models.Pagination{Limit: 10}, models.TimeFilter{})
+	assert.Contains(t, query, "FROM logs_resolved WHERE 1=1 AND http_user_agent = $1")
+	query, _ = GenerateDeleteQuery(map[string]interface{}{"http_user_agent": "curl/8.0"}, models.TimeFilter{})
+	assert.Equal(t, "DELETE FROM logs WHERE id IN (SELECT id FROM logs_resolved WHERE 1=1 AND http_user_agent = $1)", query)
+}
+
+func TestChunkLogs(t *testing.T) {
+	logs := make([]models.Log, 7)
+	chunks := ChunkLogs(logs, 3)
+	assert.Len(t, chunks, 3)
+	assert.Equal(t, []int{3, 3, 1}, []int{len(chunks[0]), len(chunks[1]), len(chunks[2])})
+
+	assert.Len(t, ChunkLogs(logs, 0), 1)
+	assert.Empty(t, ChunkLogs(nil, 3))
+}
+
+// TestInsertChunkLimit checks that the rows of an INSERT are capped so that their values stay within
+// MAX_QUERY_PARAMETERS, counting the optional columns.
+func TestInsertChunkLimit(t *testing.T) {
+	defer func(config models.Config) { ConfigData = config }(ConfigData)
+	ConfigData.StoreRawLine, ConfigData.IdempotentInserts, ConfigData.DedupStrings = false, false, false
+	ConfigData.SampleRate, ConfigData.Tenants = 1, nil
+	assert.Equal(t, MAX_QUERY_PARAMETERS/14, InsertChunkLimit())
+
+	ConfigData.StoreRawLine, ConfigData.IdempotentInserts, ConfigData.DedupStrings = true, true, true
+	ConfigData.SampleRate = 0.5
+	limit := InsertChunkLimit()
+	assert.Equal(t, MAX_QUERY_PARAMETERS/19, limit)
+	assert.Less(t, limit, INSERT_MAX_CHUNK_SIZE)
+
+	columns, rows := GenerateDedupAddRows(make([]models.Log, limit), nil, nil)
+	assert.LessOrEqual(t, len(columns)*len(rows), MAX_QUERY_PARAMETERS)
+}
+
+func TestValidateInsertChunking(t *testing.T) {
+	valid := models.Config{InsertChunkSize: 1000, InsertChunkMin: 100, InsertChunkMax: 4000}
+	assert.NoError(t, ValidateInsertChunking(valid))
+
+	tooLarge := valid
+	tooLarge.InsertChunkSize = INSERT_MAX_CHUNK_SIZE + 1
+	assert.Error(t, ValidateInsertChunking(tooLarge))
+
+	unordered := valid
+	unordered.InsertChunkMin, unordered.InsertChunkMax = 500, 200
+	assert.Error(t, ValidateInsertChunking(unordered))
+}
+
+func TestParseRequestLine(t *testing.T) {
+	assert.Equal(t, models.RequestLine{Method: "GET", Path: "/index.html", Protocol: "HTTP/1.1"}, ParseRequestLine("GET /index.html HTTP/1.1"))
+	assert.Equal(t, models.RequestLine{Method: "POST", Path: "/login"}, ParseRequestLine("post /login"))
+	assert.Equal(t, models.RequestLine{Method: "-", UnknownMethod: true}, ParseRequestLine("-"))
+	assert.Equal(t, models.RequestLine{}, ParseRequestLine(""))
+
+	// A long path is cut before the multi-byte character straddling the column size
+	path := "/" + strings.Repeat("a", 253) + "é"
+	line := ParseRequestLine("GET " + path + " HTTP/1.1")
+	assert.Equal(t, path[:254], line.Path)
+	assert.True(t, utf8.ValidString(line.Path))
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate("abc", 5))
+	assert.Equal(t, "ab", truncate("abc", 2))
+	assert.Equal(t, "a", truncate("aé", 2))
+	assert.Equal(t, "aé", truncate("aé", 3))
+	assert.Equal(t, "", truncate("日本", 2))
+	assert.Equal(t, "日", truncate("日本", 5))
+}
+
+func TestNormalizeMethod(t *testing.T) {
+	defer func(methods []string) { ConfigData.ExtraMethods = methods }(ConfigData.ExtraMethods)
+	ConfigData.ExtraMethods = nil
+
+	method, known := NormalizeMethod("get")
+	assert.Equal(t, "GET", method)
+	assert.True(t, known)
+
+	// Extension methods are unknown until configured
+	method, known = NormalizeMethod("propfind")
+	assert.Equal(t, "PROPFIND", method)
+	assert.False(t, known)
+	assert.True(t, ParseRequestLine("propfind /dav/ HTTP/1.1").UnknownMethod)
+
+	ConfigData.ExtraMethods = ParseMethods(" propfind, MKCOL,,")
+	assert.Equal(t, []string{"PROPFIND", "MKCOL"}, ConfigData.ExtraMethods)
+	_, known = NormalizeMethod("propfind")
+	assert.True(t, known)
+	assert.False(t, ParseRequestLine("propfind /dav/ HTTP/1.1").UnknownMethod)
+	_, known = NormalizeMethod("BREW")
+	assert.False(t, known)
+}
+
+func TestValidateMethods(t *testing.T) {
+	assert.NoError(t, ValidateMethods([]string{"PROPFIND", "MKCOL"}))
+	assert.NoError(t, ValidateMethods(nil))
+	assert.Error(t, ValidateMethods([]string{"GET /"}))
+	assert.Error(t, ValidateMethods([]string{"VERYLONGMETHODNAMEX"}))
+}
+
+func TestGenerateFiltersMap_RequestMethod(t *testing.T) {
+	filters := GenerateFiltersMap(createMockRequest(map[string]string{"request_method": "get"}))
+	assert.Equal(t, "GET", filters["request_method"])
+}
+
+func TestGenerateReenrichQueries(t *testing.T) {
+	query, args := GenerateReenrichSelectQuery(map[string]interface{}{"status": 404}, 10, 100)
+	assert.Equal(t, "SELECT id, request FROM logs WHERE request_method IS NULL AND id > $1 AND status = $2 ORDER BY id LIMIT $3", query)
+	assert.Equal(t, []interface{}{10, 404, 100}, args)
+
+	query, args = GenerateReenrichUpdateQuery([]int{11, 12}, []models.RequestLine{
+		{Method: "GET", Path: "/a", Protocol: "HTTP/1.1"},
+		{Method: "POST", Path: "/b", Protocol: "HTTP/2"},
+	})
+	assert.Equal(t, "UPDATE logs AS l SET request_method = v.request_method, request_path = v.request_path, request_protocol = v.request_protocol FROM (VALUES ($1::int, $2, $3, $4), ($5::int, $6, $7, $8)) AS v(id, request_method, request_path, request_protocol) WHERE l.id = v.id", query)
+	assert.Equal(t, []interface{}{11, "GET", "/a", "HTTP/1.1", 12, "POST", "/b", "HTTP/2"}, args)
 }
 
 func TestGetCount(t *testing.T) {
@@ -330,6 +642,196 @@ func createMockRequest(queryParams map[string]string) *http.Request {
 	return req
 }
 
+func TestGenerateFiltersMap_ResponseTimeRange(t *testing.T) {
+	req := createMockRequest(map[string]string{"response_time_min": "0.5", "response_time_max": "2", "status": "200"})
+	filters := GenerateFiltersMap(req)
+	assert.Equal(t, 0.5, filters["response_time_min"])
+	assert.Equal(t, 2.0, filters["response_time_max"])
+
+	query, args := GenerateFilteredGetQuery(filters, models.Pagination{Limit: 10}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND response_time <= $1 AND response_time >= $2 AND status = $3 ORDER BY")
+	assert.Equal(t, []interface{}{2.0, 0.5, 200, 10}, args)
+
+	// Values that are not numbers are ignored, like the other numeric filters
+	filters = GenerateFiltersMap(createMockRequest(map[string]string{"response_time_min": "fast"}))
+	assert.Empty(t, filters)
+}
+
+func TestGenerateFilteredGetQuery_StatusAndBytesRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		where  string
+		args   []interface{}
+	}{
+		{"status min only", map[string]string{"status_min": "400"}, "WHERE 1=1 AND status >= $1 ORDER BY", []interface{}{400, 10}},
+		{"status max only", map[string]string{"status_max": "399"}, "WHERE 1=1 AND status <= $1 ORDER BY", []interface{}{399, 10}},
+		{"status both", map[string]string{"status_min": "400", "status_max": "599"},
+			"WHERE 1=1 AND status <= $1 AND status >= $2 ORDER BY", []interface{}{599, 400, 10}},
+		{"bytes min only", map[string]string{"bytes_min": "1024"}, "WHERE 1=1 AND body_bytes_sent >= $1 ORDER BY", []interface{}{1024, 10}},
+		{"bytes max only", map[string]string{"bytes_max": "0"}, "WHERE 1=1 AND body_bytes_sent <= $1 ORDER BY", []interface{}{0, 10}},
+		{"bytes both", map[string]string{"bytes_min": "100", "bytes_max": "5000"},
+			"WHERE 1=1 AND body_bytes_sent <= $1 AND body_bytes_sent >= $2 ORDER BY", []interface{}{5000, 100, 10}},
+		{"ranges with exact status", map[string]string{"status": "404", "status_min": "400", "bytes_max": "512"},
+			"WHERE 1=1 AND body_bytes_sent <= $1 AND status = $2 AND status >= $3 ORDER BY", []interface{}{512, 404, 400, 10}},
+		{"not numbers are ignored", map[string]string{"status_min": "4xx", "bytes_max": "big"}, "WHERE 1=1 ORDER BY", []interface{}{10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := GenerateFiltersMap(createMockRequest(tt.params))
+			query, args := GenerateFilteredGetQuery(filters, models.Pagination{Limit: 10}, models.TimeFilter{})
+			assert.Contains(t, query, tt.where)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+}
+
+func TestGenerateFiltersMap_StatusList(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		filter interface{}
+		where  string
+		args   []interface{}
+	}{
+		{"single value", "404", 404, "WHERE 1=1 AND status = $1 ORDER BY", []interface{}{404, 10}},
+		{"list", "404,500,502", []int{404, 500, 502}, "WHERE 1=1 AND status IN ($1,$2,$3) ORDER BY", []interface{}{404, 500, 502, 10}},
+		{"invalid entries dropped", "404, abc,,502", []int{404, 502}, "WHERE 1=1 AND status IN ($1,$2) ORDER BY", []interface{}{404, 502, 10}},
+		{"one valid entry", "5xx,503", 503, "WHERE 1=1 AND status = $1 ORDER BY", []interface{}{503, 10}},
+		{"no valid entry", "abc,", nil, "WHERE 1=1 ORDER BY", []interface{}{10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := GenerateFiltersMap(createMockRequest(map[string]string{"status": tt.status}))
+			assert.Equal(t, tt.filter, filters["status"])
+			query, args := GenerateFilteredGetQuery(filters, models.Pagination{Limit: 10}, models.TimeFilter{})
+			assert.Contains(t, query, tt.where)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+
+	// Placeholders after the list continue from it
+	filters := GenerateFiltersMap(createMockRequest(map[string]string{"status": "500,502", "server_name": "api"}))
+	query, args := GenerateFilteredGetQuery(filters, models.Pagination{Limit: 10}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND server_name = $1 AND status IN ($2,$3) ORDER BY time_local DESC, id DESC LIMIT $4")
+	assert.Equal(t, []interface{}{"api", 500, 502, 10}, args)
+}
+
+func TestGenerateFilteredQueries_Like(t *testing.T) {
+	filters := GenerateFiltersMap(createMockRequest(map[string]string{"request_like": "/api/", "user_agent_like": "Mozilla"}))
+	assert.Equal(t, map[string]interface{}{"request_like": "/api/", "user_agent_like": "Mozilla"}, filters)
+
+	query, args := GenerateFilteredGetQuery(filters, models.Pagination{Limit: 10}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND request ILIKE $1 AND http_user_agent ILIKE $2 ORDER BY")
+	assert.Equal(t, []interface{}{"%/api/%", "%Mozilla%", 10}, args)
+
+	query, args = GenerateFilteredCountQuery(filters)
+	assert.Contains(t, query, "request ILIKE $")
+	assert.Contains(t, query, "http_user_agent ILIKE $")
+	assert.ElementsMatch(t, []interface{}{"%/api/%", "%Mozilla%"}, args)
+
+	// Wildcards in the input match literally
+	filters = GenerateFiltersMap(createMockRequest(map[string]string{"request_like": `50%_off\sale`}))
+	query, args = GenerateFilteredGetQuery(filters, models.Pagination{Limit: 10}, models.TimeFilter{})
+	assert.Contains(t, query, "AND request ILIKE $1 ORDER BY")
+	assert.Equal(t, []interface{}{`%50\%\_off\\sale%`, 10}, args)
+}
+
+func TestGenerateFiltersMap_ServerName(t *testing.T) {
+	filters := GenerateFiltersMap(createMockRequest(map[string]string{"server_name": "api.example.com", "status": "500"}))
+	assert.Equal(t, "api.example.com", filters["server_name"])
+
+	query, args := GenerateFilteredGetQuery(filters, models.Pagination{Limit: 10}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND server_name = $1 AND status = $2 ORDER BY")
+	assert.Equal(t, []interface{}{"api.example.com", 500, 10}, args)
+
+	// Logs without a server name are stored with a NULL server_name
+	serverName := "api.example.com"
+	_, args = GenerateAddQuery([]models.Log{{ServerName: &serverName}, {}})
+	assert.Equal(t, &serverName, args[13])
+	assert.Nil(t, args[27])
+}
+
+// TestGenerateFiltersMap_Tenant checks that a request scoped to a tenant is always filtered on it, whatever
+// its query asks for, and that the queries built for it only reach its rows.
+func TestGenerateFiltersMap_Tenant(t *testing.T) {
+	defer func(tenants map[string]string) { ConfigData.Tenants = tenants }(ConfigData.Tenants)
+	ConfigData.Tenants = map[string]string{"key-a": "tenant-a", "key-b": "tenant-b"}
+
+	r := createMockRequest(map[string]string{"tenant_id": "tenant-b", "status": "500"})
+	assert.NotContains(t, GenerateFiltersMap(r), "tenant_id")
+
+	r = r.WithContext(WithTenant(r.Context(), "tenant-a"))
+	filters := GenerateFiltersMap(r)
+	assert.Equal(t, "tenant-a", filters["tenant_id"])
+
+	query, args := GenerateFilteredGetQuery(filters, models.Pagination{Limit: 10}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND status = $1 AND tenant_id = $2 ORDER BY")
+	assert.Equal(t, []interface{}{500, "tenant-a", 10}, args)
+
+	query, args = GenerateGetByIDQuery(7, "tenant-a")
+	assert.True(t, strings.HasSuffix(query, " WHERE id = $1 AND tenant_id = $2"), query)
+	assert.Equal(t, []interface{}{7, "tenant-a"}, args)
+
+	// Ingested logs are stored with their tenant
+	query, args = GenerateAddQuery([]models.Log{{TenantID: "tenant-a"}})
+	assert.Contains(t, query, "server_name, tenant_id)")
+	assert.Equal(t, "tenant-a", args[len(args)-1])
+}
+
+func TestSetLogPattern(t *testing.T) {
+	defer func() { assert.NoError(t, SetLogPattern("")) }()
+	assert.Equal(t, DEFAULT_LOG_PATTERN, LogPattern().String())
+
+	custom := `^(?P<remote_addr>\S+) (?P<time_local>\S+) (?P<request>"[^"]*") (?P<status>\d{3})$`
+	assert.NoError(t, SetLogPattern(custom))
+	assert.Equal(t, custom, LogPattern().String())
+	compiled := LogPattern()
+	assert.NoError(t, SetLogPattern(custom))
+	assert.Same(t, compiled, LogPattern(), "an unchanged pattern should not be compiled again")
+
+	// Invalid patterns leave the current one in place
+	assert.EqualError(t, SetLogPattern(`^(?P<remote_addr>\S+) (?P<request>.*)$`),
+		`pattern has no named group "time_local", it needs [remote_addr time_local request status]`)
+	assert.Error(t, SetLogPattern(`^(?P<remote_addr>\S+`))
+	assert.Same(t, compiled, LogPattern())
+
+	assert.NoError(t, SetLogPattern(""))
+	assert.Equal(t, DEFAULT_LOG_PATTERN, LogPattern().String())
+}
+
+func TestTenants(t *testing.T) {
+	defer func(tenants map[string]string) { ConfigData.Tenants = tenants }(ConfigData.Tenants)
+	ConfigData.Tenants = nil
+	assert.False(t, Multitenant())
+
+	ConfigData.Tenants = map[string]string{"key-a": "tenant-a"}
+	assert.True(t, Multitenant())
+	tenant, ok := TenantForKey("key-a")
+	assert.True(t, ok)
+	assert.Equal(t, "tenant-a", tenant)
+	_, ok = TenantForKey("key-b")
+	assert.False(t, ok)
+	_, ok = TenantForKey("")
+	assert.False(t, ok)
+
+	assert.NoError(t, ValidateTenants(ConfigData.Tenants))
+	assert.EqualError(t, ValidateTenants(map[string]string{"key": ""}), `tenant id "" must be between 1 and 64 characters`)
+	assert.EqualError(t, ValidateTenants(map[string]string{"": "tenant-a"}), `tenant "tenant-a" has an empty API key`)
+
+	query, args := ScopeQueryToTenant(QUERY_COUNT_SINCE, "", []interface{}{"since"})
+	assert.Equal(t, QUERY_COUNT_SINCE, query)
+	assert.Equal(t, []interface{}{"since"}, args)
+
+	query, args = ScopeQueryToTenant(QUERY_COUNT_SINCE, "tenant-a", []interface{}{"since"})
+	assert.Equal(t, "SELECT COUNT(*) FROM (SELECT * FROM logs WHERE tenant_id = $2) AS logs WHERE time_local >= $1", query)
+	assert.Equal(t, []interface{}{"since", "tenant-a"}, args)
+
+	// Other relations are left alone
+	query, _ = ScopeQueryToTenant("SELECT * FROM logs_resolved", "tenant-a", nil)
+	assert.Equal(t, "SELECT * FROM logs_resolved", query)
+}
+
 func TestGenerateFiltersMap(t *testing.T) {
 	// Setup query parameters for the test
 	queryParams := map[string]string{
@@ -357,24 +859,26 @@ func TestGenerateFiltersMap(t *testing.T) {
 }
 
 func TestGetPaginationParams(t *testing.T) {
+	cursorTime := time.Date(2025, time.April, 10, 10, 30, 0, 500, time.UTC)
+
 	// Setup query parameters for pagination
 	queryParams := map[string]string{
-		"page":   "2",
 		"limit":  "20",
-		"cursor": "2025-04-10T10:30:00Z",
+		"cursor": EncodeCursor(cursorTime, 2),
 	}
 
 	// Create mock HTTP request
 	req := createMockRequest(queryParams)
 
 	// Call the function
-	pagination := GetPaginationParams(req)
+	pagination, err := GetPaginationParams(req)
 
 	// Assert that pagination is parsed correctly
-	assert.Equal(t, 2, pagination.CursorID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *pagination.CursorID)
 	assert.Equal(t, 20, pagination.Limit)
 	assert.NotNil(t, pagination.Cursor)
-	assert.Equal(t, time.Date(2025, time.April, 10, 10, 30, 0, 0, time.UTC), *pagination.Cursor)
+	assert.Equal(t, cursorTime, *pagination.Cursor)
 }
 
 func TestGetPaginationParamsWithDefaults(t *testing.T) {
@@ -382,12 +886,271 @@ func TestGetPaginationParamsWithDefaults(t *testing.T) {
 	req := createMockRequest(map[string]string{})
 
 	// Call the function
-	pagination := GetPaginationParams(req)
+	pagination, err := GetPaginationParams(req)
 
 	// Assert that default pagination values are used
-	assert.Equal(t, 1, pagination.CursorID)
+	assert.NoError(t, err)
+	assert.Nil(t, pagination.CursorID)
 	assert.Equal(t, 10, pagination.Limit)
-	assert.NotNil(t, pagination.Cursor)
+	assert.Nil(t, pagination.Cursor)
+}
+
+func TestGetPaginationParamsRejectsRawCursor(t *testing.T) {
+	req := createMockRequest(map[string]string{"cursor": "2025-04-10T10:30:00Z", "id": "2"})
+
+	_, err := GetPaginationParams(req)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestGetCursorBy(t *testing.T) {
+	cursorBy, err := GetCursorBy(createMockRequest(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, CURSOR_BY_TIME, cursorBy)
+
+	cursorBy, err = GetCursorBy(createMockRequest(map[string]string{"cursor_by": "id"}))
+	assert.NoError(t, err)
+	assert.Equal(t, CURSOR_BY_ID, cursorBy)
+
+	_, err = GetCursorBy(createMockRequest(map[string]string{"cursor_by": "ingested_at"}))
+	assert.EqualError(t, err, "invalid cursor_by: 'ingested_at'. Expected time or id")
+}
+
+func TestGetSort(t *testing.T) {
+	sortBy, order, err := GetSort(createMockRequest(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"time_local", "desc"}, []string{sortBy, order})
+
+	sortBy, order, err = GetSort(createMockRequest(map[string]string{"sort_by": "body_bytes_sent", "order": "ASC"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"body_bytes_sent", "asc"}, []string{sortBy, order})
+
+	_, _, err = GetSort(createMockRequest(map[string]string{"sort_by": "status; DROP TABLE logs"}))
+	assert.EqualError(t, err, "invalid sort_by: 'status; DROP TABLE logs'. Expected one of time_local, status, body_bytes_sent")
+	_, _, err = GetSort(createMockRequest(map[string]string{"sort_by": "remote_addr"}))
+	assert.Error(t, err)
+	_, _, err = GetSort(createMockRequest(map[string]string{"order": "sideways"}))
+	assert.EqualError(t, err, "invalid order: 'sideways'. Expected asc or desc")
+}
+
+func TestGenerateFilteredGetQuery_Sort(t *testing.T) {
+	query, args := GenerateFilteredGetQuery(nil, models.Pagination{Limit: 5}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 ORDER BY time_local DESC, id DESC LIMIT $1")
+	assert.Equal(t, []interface{}{5}, args)
+
+	query, _ = GenerateFilteredGetQuery(map[string]interface{}{"status": 500}, models.Pagination{Limit: 5, SortBy: "body_bytes_sent", Order: ORDER_ASC}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND status = $1 ORDER BY body_bytes_sent ASC, id ASC LIMIT $2")
+
+	query, _ = GenerateFilteredGetQuery(nil, models.Pagination{Limit: 5, SortBy: "status", Order: ORDER_DESC}, models.TimeFilter{})
+	assert.Contains(t, query, "ORDER BY status DESC, id DESC LIMIT $1")
+
+	// Anything outside the whitelist never reaches the query
+	query, _ = GenerateFilteredGetQuery(nil, models.Pagination{Limit: 5, SortBy: "id; DROP TABLE logs", Order: "sideways"}, models.TimeFilter{})
+	assert.Contains(t, query, "ORDER BY time_local DESC, id DESC LIMIT $1")
+	assert.NotContains(t, query, "DROP")
+
+	// Ascending time pages forward from the cursor
+	cursorTime := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	cursorID := 42
+	query, args = GenerateFilteredGetQuery(nil, models.Pagination{Limit: 5, Cursor: &cursorTime, CursorID: &cursorID, SortBy: SORT_BY_TIME, Order: ORDER_ASC}, models.TimeFilter{})
+	assert.Contains(t, query, "time_local > $1 OR (time_local = $1 AND id > $2)")
+	assert.Contains(t, query, "ORDER BY time_local ASC, id ASC LIMIT $3")
+	assert.Equal(t, []interface{}{"2025-04-10T10:00:00Z", &cursorID, 5}, args)
+
+	// The previous page is read in the reverse order
+	query, _ = GenerateFilteredGetQuery(nil, models.Pagination{Limit: 5, Cursor: &cursorTime, CursorID: &cursorID, SortBy: SORT_BY_TIME, Order: ORDER_ASC, Direction: DIRECTION_PREV}, models.TimeFilter{})
+	assert.Contains(t, query, "time_local < $1 OR (time_local = $1 AND id < $2)")
+	assert.Contains(t, query, "ORDER BY time_local DESC, id DESC LIMIT $3")
+}
+
+func TestPaginationLinks(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://logs.example.com/logs?status=404&cursor=old", nil)
+	next, prev := "n+1", "p/1"
+
+	assert.Equal(t, `<http://logs.example.com/logs?cursor=n%2B1&status=404>; rel="next"`, PaginationLinks(req, &next, nil))
+	assert.Equal(t, "", PaginationLinks(req, nil, nil))
+
+	req.Header.Set("X-Forwarded-Proto", "https")
+	assert.Equal(t, `<https://logs.example.com/logs?cursor=n%2B1&status=404>; rel="next", <https://logs.example.com/logs?cursor=p%2F1&direction=prev&status=404>; rel="prev"`,
+		PaginationLinks(req, &next, &prev))
+}
+
+func TestGenerateFilteredGetQuery_CursorByID(t *testing.T) {
+	cursorTime := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	cursorID := 42
+
+	query, args := GenerateFilteredGetQuery(map[string]interface{}{"status": 200}, models.Pagination{Limit: 5, CursorBy: CURSOR_BY_ID}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND status = $1 ORDER BY id ASC LIMIT $2")
+	assert.Equal(t, []interface{}{200, 5}, args)
+
+	// Only the id of the cursor is used; its time plays no part in ingestion order
+	query, args = GenerateFilteredGetQuery(nil, models.Pagination{Limit: 5, Cursor: &cursorTime, CursorID: &cursorID, CursorBy: CURSOR_BY_ID}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND id > $1 ORDER BY id ASC LIMIT $2")
+	assert.NotContains(t, query, "time_local <")
+	assert.Equal(t, []interface{}{42, 5}, args)
+
+	// The previous page walks back through the ids
+	query, args = GenerateFilteredGetQuery(nil, models.Pagination{Limit: 5, Cursor: &cursorTime, CursorID: &cursorID, CursorBy: CURSOR_BY_ID, Direction: DIRECTION_PREV}, models.TimeFilter{})
+	assert.Contains(t, query, "WHERE 1=1 AND id < $1 ORDER BY id DESC LIMIT $2")
+	assert.Equal(t, []interface{}{42, 5}, args)
+}
+
+// storedLog is a row of the simulated logs table used to check how each cursor_by pages through it.
+type storedLog struct {
+	id        int
+	timeLocal time.Time
+}
+
+// pageStoredLogs applies the keyset condition, ordering and limit that GenerateFilteredGetQuery
+// emits for the pagination to the simulated table.
+func pageStoredLogs(table []storedLog, pagination models.Pagination) []storedLog {
+	var page []storedLog
+	for _, row := range table {
+		if pagination.CursorID != nil {
+			if pagination.CursorBy == CURSOR_BY_ID && row.id <= *pagination.CursorID {
+				continue
+			}
+			if pagination.CursorBy == CURSOR_BY_TIME && pagination.Order != ORDER_ASC && !(row.timeLocal.Before(*pagination.Cursor) ||
+				(row.timeLocal.Equal(*pagination.Cursor) && row.id < *pagination.CursorID)) {
+				continue
+			}
+			if pagination.CursorBy == CURSOR_BY_TIME && pagination.Order == ORDER_ASC && !(row.timeLocal.After(*pagination.Cursor) ||
+				(row.timeLocal.Equal(*pagination.Cursor) && row.id > *pagination.CursorID)) {
+				continue
+			}
+		}
+		page = append(page, row)
+	}
+	sort.Slice(page, func(i, j int) bool {
+		if pagination.CursorBy == CURSOR_BY_ID {
+			return page[i].id < page[j].id
+		}
+		if !page[i].timeLocal.Equal(page[j].timeLocal) {
+			return page[i].timeLocal.After(page[j].timeLocal) != (pagination.Order == ORDER_ASC)
+		}
+		return (page[i].id > page[j].id) != (pagination.Order == ORDER_ASC)
+	})
+	if len(page) > pagination.Limit {
+		page = page[:pagination.Limit]
+	}
+	return page
+}
+
+// TestCursorBy_OutOfOrderArrivals pages through logs whose event times are out of order while a
+// late log, stamped earlier than the newest logs already stored, arrives after the first page.
+// Paging by id returns every row exactly once; paging by time never sees the late log.
+func TestCursorBy_OutOfOrderArrivals(t *testing.T) {
+	start := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	for cursorBy, orderBy := range map[string]string{CURSOR_BY_TIME: "ORDER BY time_local DESC, id DESC", CURSOR_BY_ID: "ORDER BY id ASC"} {
+		query, _ := GenerateFilteredGetQuery(nil, models.Pagination{Limit: 2, CursorBy: cursorBy}, models.TimeFilter{})
+		assert.Contains(t, query, orderBy, "The simulation must order rows like the generated query")
+	}
+
+	readAll := func(cursorBy string) []int {
+		table := []storedLog{
+			{1, start.Add(10 * time.Minute)},
+			{2, start.Add(5 * time.Minute)},
+			{3, start.Add(20 * time.Minute)},
+			{4, start.Add(15 * time.Minute)},
+		}
+		pagination := models.Pagination{Limit: 2, CursorBy: cursorBy}
+		var seen []int
+		for pages := 0; pages < 10; pages++ {
+			page := pageStoredLogs(table, pagination)
+			if pages == 0 {
+				table = append(table, storedLog{5, start.Add(17 * time.Minute)})
+			}
+			if len(page) == 0 {
+				break
+			}
+			for _, row := range page {
+				seen = append(seen, row.id)
+			}
+			last := page[len(page)-1]
+			pagination.Cursor, pagination.CursorID = &last.timeLocal, &last.id
+		}
+		return seen
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, readAll(CURSOR_BY_ID), "Paging by id should return every row exactly once")
+	assert.Equal(t, []int{3, 4, 1, 2}, readAll(CURSOR_BY_TIME), "Paging by time skips the late log stamped after the cursor")
+}
+
+// TestCursorBy_SharedTimestamps pages through logs written in bursts sharing one timestamp, in both
+// orders, with pages that end in the middle of a burst. The id breaking ties, every row is returned
+// exactly once.
+func TestCursorBy_SharedTimestamps(t *testing.T) {
+	start := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	var table []storedLog
+	for id := 1; id <= 8; id++ {
+		// Ids 1-3, 4-6 and 7-8 share a timestamp
+		table = append(table, storedLog{id, start.Add(time.Duration((id-1)/3) * time.Second)})
+	}
+
+	readAll := func(order string) []int {
+		query, _ := GenerateFilteredGetQuery(nil, models.Pagination{Limit: 3, SortBy: SORT_BY_TIME, Order: order}, models.TimeFilter{})
+		assert.Contains(t, query, map[string]string{ORDER_ASC: "ORDER BY time_local ASC, id ASC", ORDER_DESC: "ORDER BY time_local DESC, id DESC"}[order],
+			"The simulation must order rows like the generated query")
+
+		pagination := models.Pagination{Limit: 3, CursorBy: CURSOR_BY_TIME, SortBy: SORT_BY_TIME, Order: order}
+		var seen []int
+		for pages := 0; pages < 10; pages++ {
+			page := pageStoredLogs(table, pagination)
+			if len(page) == 0 {
+				break
+			}
+			for _, row := range page {
+				seen = append(seen, row.id)
+			}
+			// The cursor goes through its encoding, as it does between requests
+			last := page[len(page)-1]
+			cursorTime, cursorID, err := DecodeCursor(EncodeCursor(last.timeLocal, last.id))
+			assert.NoError(t, err)
+			pagination.Cursor, pagination.CursorID = &cursorTime, &cursorID
+		}
+		return seen
+	}
+
+	assert.Equal(t, []int{8, 7, 6, 5, 4, 3, 2, 1}, readAll(ORDER_DESC))
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8}, readAll(ORDER_ASC))
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursorTime := time.Date(2025, time.March, 17, 8, 0, 20, 250123000, time.UTC)
+
+	decodedTime, id, err := DecodeCursor(EncodeCursor(cursorTime, 42))
+	assert.NoError(t, err)
+	assert.Equal(t, cursorTime, decodedTime)
+	assert.Equal(t, 42, id)
+
+	// Times in other zones are normalised to UTC but keep the same instant
+	decodedTime, _, err = DecodeCursor(EncodeCursor(cursorTime.In(time.FixedZone("IST", 19800)), 42))
+	assert.NoError(t, err)
+	assert.True(t, cursorTime.Equal(decodedTime))
+}
+
+func TestCursorTampered(t *testing.T) {
+	cursor := EncodeCursor(time.Date(2025, time.March, 17, 8, 0, 20, 0, time.UTC), 42)
+	payload, signature, _ := strings.Cut(cursor, ".")
+
+	// Re-encoded payload with a different id but the original signature
+	forged := base64.RawURLEncoding.EncodeToString([]byte("2025-03-17T08:00:20Z|1")) + "." + signature
+
+	for _, tampered := range []string{
+		forged,
+		payload + "." + signature[:len(signature)-2] + "AA",
+		payload,
+		"not-a-cursor",
+		"",
+	} {
+		_, _, err := DecodeCursor(tampered)
+		assert.ErrorIs(t, err, ErrInvalidCursor, tampered)
+	}
+
+	// A cursor signed with another secret is rejected too
+	defer func() { ConfigData.CursorSecret = "" }()
+	ConfigData.CursorSecret = "rotated"
+	_, _, err := DecodeCursor(cursor)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
 }
 
 func TestGetDateFilters(t *testing.T) {
@@ -460,4 +1223,201 @@ func TestGetDateFiltersWithDefaultValues(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, timeFilters.Start_time)
 	assert.Nil(t, timeFilters.End_time)
-}
\ No newline at end of file
+}
+
+func TestParseJSONFieldMap(t *testing.T) {
+	mapping := ParseJSONFieldMap(" client_ip = remote_addr ,status_code=status,broken,=status")
+	assert.Equal(t, map[string]string{"client_ip": "remote_addr", "status_code": "status"}, mapping)
+
+	assert.Nil(t, ParseJSONFieldMap(""))
+}
+
+func TestValidateJSONFieldMap(t *testing.T) {
+	assert.NoError(t, ValidateJSONFieldMap(nil))
+	assert.NoError(t, ValidateJSONFieldMap(map[string]string{"client_ip": "remote_addr", "status_code": "status"}))
+
+	err := ValidateJSONFieldMap(map[string]string{"client_ip": "remote_address"})
+	assert.EqualError(t, err, "key 'client_ip' is mapped to unknown log field 'remote_address'")
+
+	err = ValidateJSONFieldMap(map[string]string{"ip": "remote_addr", "client_ip": "remote_addr"})
+	assert.Error(t, err)
+}
+
+func TestApplyJSONFieldMap(t *testing.T) {
+	object := map[string]interface{}{"client_ip": "10.0.0.1", "request": "GET / HTTP/1.1"}
+	renamed := ApplyJSONFieldMap(object, map[string]string{"client_ip": "remote_addr"})
+
+	assert.Equal(t, map[string]interface{}{"remote_addr": "10.0.0.1", "request": "GET / HTTP/1.1"}, renamed)
+}
+
+func TestParseRequiredFields(t *testing.T) {
+	assert.Equal(t, []string{"remote_addr", "status", "time_local"}, ParseRequiredFields(" remote_addr, status,,time_local "))
+	assert.Nil(t, ParseRequiredFields(""))
+
+	assert.NoError(t, ValidateRequiredFields(ParseRequiredFields(PARSER_REQUIRED_FIELDS)))
+	assert.Error(t, ValidateRequiredFields([]string{"remote_addr", "client_ip"}))
+}
+
+func TestGenerateExportQuery(t *testing.T) {
+	start := time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	query, args := GenerateExportQuery(map[string]interface{}{"status": 500, "remote_addr": "10.0.0.1"}, models.TimeFilter{Start_time: &start, End_time: &end})
+
+	assert.Equal(t, "SELECT id, remote_addr, remote_user, time_local, request, status, body_bytes_sent, http_referer, http_user_agent, http_x_forwarded_for, ingested_at, response_time, server_name FROM logs WHERE 1=1 AND remote_addr = $1 AND status = $2 AND time_local >= $3 AND time_local <= $4 ORDER BY time_local ASC, id ASC", query)
+	assert.Equal(t, []interface{}{"10.0.0.1", 500, "2025-04-10T00:00:00Z", "2025-04-11T00:00:00Z"}, args)
+}
+
+func TestGenerateStatusAggregateQuery(t *testing.T) {
+	start := time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	query, args := GenerateStatusAggregateQuery(map[string]interface{}{"remote_addr": "10.0.0.1"}, models.TimeFilter{Start_time: &start, End_time: &end})
+	assert.Equal(t, "SELECT status, COUNT(*) FROM logs WHERE 1=1 AND remote_addr = $1 AND time_local >= $2 AND time_local <= $3 GROUP BY status ORDER BY status", query)
+	assert.Equal(t, []interface{}{"10.0.0.1", "2025-04-10T00:00:00Z", "2025-04-11T00:00:00Z"}, args)
+
+	query, args = GenerateStatusAggregateQuery(map[string]interface{}{}, models.TimeFilter{})
+	assert.Equal(t, "SELECT status, COUNT(*) FROM logs WHERE 1=1 GROUP BY status ORDER BY status", query)
+	assert.Empty(t, args)
+}
+
+func TestGenerateTopIPsQuery(t *testing.T) {
+	start := time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)
+
+	query, args := GenerateTopIPsQuery(map[string]interface{}{"status": 404}, models.TimeFilter{Start_time: &start}, 10)
+	assert.Equal(t, "SELECT remote_addr, COUNT(*) c FROM logs WHERE 1=1 AND status = $1 AND time_local >= $2 GROUP BY remote_addr ORDER BY c DESC, remote_addr LIMIT $3", query)
+	assert.Equal(t, []interface{}{404, "2025-04-10T00:00:00Z", 10}, args)
+}
+
+func TestUnknownFilterKeys(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/logs?statuss=500&status=404&pretty=true&limit=5&remote_adr=10.0.0.1", nil)
+	assert.Equal(t, []string{"remote_adr", "statuss"}, UnknownFilterKeys(r, "limit"))
+	assert.Equal(t, []string{"limit", "remote_adr", "statuss"}, UnknownFilterKeys(r))
+
+	r = httptest.NewRequest(http.MethodGet, "/logs?status_min=400&request_like=api&response_time_max=1.5", nil)
+	assert.Empty(t, UnknownFilterKeys(r))
+}
+
+func TestGenerateTimeSeriesQuery(t *testing.T) {
+	start := time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, interval := range []string{TIME_SERIES_MINUTE, TIME_SERIES_HOUR, TIME_SERIES_DAY} {
+		query, args := GenerateTimeSeriesQuery(map[string]interface{}{"status": 500}, models.TimeFilter{Start_time: &start}, interval)
+		assert.Equal(t, "SELECT date_trunc('"+interval+"', time_local) bucket, COUNT(*) FROM logs WHERE 1=1 AND status = $1 AND time_local >= $2 GROUP BY bucket ORDER BY bucket", query)
+		assert.Equal(t, []interface{}{500, "2025-04-10T00:00:00Z"}, args)
+	}
+
+	defer func(driver string) { DBDriver = driver }(DBDriver)
+	DBDriver = DB_DRIVER_MYSQL
+	query, args := GenerateTimeSeriesQuery(map[string]interface{}{}, models.TimeFilter{}, TIME_SERIES_HOUR)
+	assert.Equal(t, "SELECT TIMESTAMP(DATE_FORMAT(time_local, '%Y-%m-%d %H:00:00')) bucket, COUNT(*) FROM logs WHERE 1=1 GROUP BY bucket ORDER BY bucket", query)
+	assert.Empty(t, args)
+}
+
+func TestGetTimeSeriesInterval(t *testing.T) {
+	tests := map[string]string{
+		"":       TIME_SERIES_HOUR,
+		"1m":     TIME_SERIES_MINUTE,
+		"minute": TIME_SERIES_MINUTE,
+		"1h":     TIME_SERIES_HOUR,
+		"hour":   TIME_SERIES_HOUR,
+		"1d":     TIME_SERIES_DAY,
+		"day":    TIME_SERIES_DAY,
+	}
+	for param, expected := range tests {
+		interval, err := GetTimeSeriesInterval(httptest.NewRequest(http.MethodGet, "/stats/timeseries?interval="+param, nil))
+		assert.NoError(t, err, param)
+		assert.Equal(t, expected, interval, param)
+	}
+
+	for _, param := range []string{"week", "5m", "minute'); DROP TABLE logs; --"} {
+		_, err := GetTimeSeriesInterval(httptest.NewRequest(http.MethodGet, "/stats/timeseries?interval="+url.QueryEscape(param), nil))
+		assert.Error(t, err, param)
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	defer func(driver string) { DBDriver = driver }(DBDriver)
+
+	DBDriver = DB_DRIVER
+	assert.Equal(t, "$1", Placeholder(1))
+	assert.Equal(t, "$12", Placeholder(12))
+
+	DBDriver = DB_DRIVER_MYSQL
+	assert.Equal(t, "?", Placeholder(1))
+	assert.Equal(t, "?", Placeholder(12))
+}
+
+func TestDriverQuery(t *testing.T) {
+	defer func(driver string) { DBDriver = driver }(DBDriver)
+
+	DBDriver = DB_DRIVER
+	assert.Equal(t, QUERY_SELECT_BATCH, DriverQuery(QUERY_SELECT_BATCH))
+
+	DBDriver = DB_DRIVER_MYSQL
+	assert.Equal(t, "SELECT inserted, rejected FROM ingested_batches WHERE batch_id = ? AND processed_at >= ?", DriverQuery(QUERY_SELECT_BATCH))
+	assert.Equal(t, "DELETE FROM logs WHERE remote_addr = ?", DriverQuery(QUERY_DELETE_LOGS_BY_IP))
+}
+
+func TestGenerateQueries_MySQLPlaceholders(t *testing.T) {
+	defer func(driver string) { DBDriver = driver }(DBDriver)
+	DBDriver = DB_DRIVER_MYSQL
+	start := time.Date(2025, time.April, 10, 0, 0, 0, 0, time.UTC)
+
+	query, args := GenerateTopIPsQuery(map[string]interface{}{"status": []int{404, 500}, "request_like": "api"}, models.TimeFilter{Start_time: &start}, 10)
+	assert.Equal(t, "SELECT remote_addr, COUNT(*) c FROM logs WHERE 1=1 AND request LIKE ? AND status IN (?,?) AND time_local >= ? GROUP BY remote_addr ORDER BY c DESC, remote_addr LIMIT ?", query)
+	assert.Equal(t, []interface{}{"%api%", 404, 500, "2025-04-10T00:00:00Z", 10}, args)
+
+	query, args = GenerateGetByIDQuery(7, "tenant-a")
+	assert.Contains(t, query, "WHERE id = ? AND tenant_id = ?")
+	assert.Equal(t, []interface{}{7, "tenant-a"}, args)
+
+	query, args = GenerateAddQuery([]models.Log{{RemoteAddr: "10.0.0.1"}, {RemoteAddr: "10.0.0.2"}})
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(insertColumns())), ", ") + ")"
+	assert.Contains(t, query, "VALUES "+placeholders+", "+placeholders)
+	assert.Len(t, args, 2*len(insertColumns()))
+
+	// The cursor is used twice and so bound twice
+	cursorTime := time.Date(2025, time.April, 10, 10, 0, 0, 0, time.UTC)
+	cursorID := 42
+	query, args = GenerateFilteredGetQuery(map[string]interface{}{"status": 200}, models.Pagination{Limit: 5, Cursor: &cursorTime, CursorID: &cursorID, SortBy: SORT_BY_TIME}, models.TimeFilter{})
+	assert.Contains(t, query, "AND status = ? AND (")
+	assert.Contains(t, query, "time_local < ? OR (time_local = ? AND id < ?)")
+	assert.Contains(t, query, "ORDER BY time_local DESC, id DESC LIMIT ?")
+	assert.NotContains(t, query, "$")
+	assert.Equal(t, []interface{}{200, "2025-04-10T10:00:00Z", "2025-04-10T10:00:00Z", &cursorID, 5}, args)
+
+	// The tenant is bound where its read appears, ahead of the placeholders after it
+	query, args = ScopeQueryToTenant("SELECT COUNT(*) FROM logs WHERE time_local >= ?", "tenant-a", []interface{}{"since"})
+	assert.Equal(t, "SELECT COUNT(*) FROM (SELECT * FROM logs WHERE tenant_id = ?) AS logs WHERE time_local >= ?", query)
+	assert.Equal(t, []interface{}{"tenant-a", "since"}, args)
+
+	query, args = ScopeQueryToTenant("SELECT ? AS label, COUNT(*) FROM logs WHERE status = ? AND id IN (SELECT id FROM logs WHERE status = ?)", "tenant-a", []interface{}{"l", 500, 404})
+	assert.Equal(t, "SELECT ? AS label, COUNT(*) FROM (SELECT * FROM logs WHERE tenant_id = ?) AS logs WHERE status = ? AND id IN (SELECT id FROM (SELECT * FROM logs WHERE tenant_id = ?) AS logs WHERE status = ?)", query)
+	assert.Equal(t, []interface{}{"l", "tenant-a", 500, "tenant-a", 404}, args)
+}
+
+func TestGenerateCreatePartitionQuery(t *testing.T) {
+	month := time.Date(2025, time.December, 17, 23, 0, 0, 0, time.FixedZone("IST", 19800))
+
+	assert.Equal(t, "logs_y2025m12", PartitionName(month))
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS logs_y2025m12 PARTITION OF logs FOR VALUES FROM ('2025-12-01T00:00:00Z') TO ('2026-01-01T00:00:00Z');", GenerateCreatePartitionQuery(month))
+	assert.Equal(t, "DROP TABLE IF EXISTS logs_y2025m12;", GenerateDropPartitionQuery("logs_y2025m12"))
+
+	parsed, ok := ParsePartitionName("logs_y2025m12")
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC), parsed)
+	for _, name := range []string{"logs_default", "logs_y2025m13", "logs_y2025m12_old", "other_y2025m12"} {
+		_, ok := ParsePartitionName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	names := []string{"logs_y2025m03", "logs_default", "logs_y2025m01", "logs_y2025m02", "logs_y2025m04"}
+	cutoff := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []string{"logs_y2025m01", "logs_y2025m02"}, ExpiredPartitions(names, cutoff))
+
+	// March straddles the cutoff and is kept whole
+	assert.Equal(t, []string{"logs_y2025m01", "logs_y2025m02"}, ExpiredPartitions(names, cutoff.Add(10*24*time.Hour)))
+}
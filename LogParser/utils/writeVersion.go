@@ -0,0 +1,16 @@
+package utils
+
+import "sync/atomic"
+
+var writeVersion atomic.Uint64
+
+// WriteVersion returns the current write version. It changes every time logs are inserted or removed.
+func WriteVersion() uint64 {
+	return writeVersion.Load()
+}
+
+// BumpWriteVersion records that logs were inserted or removed, so results cached under an
+// earlier version are no longer served.
+func BumpWriteVersion() {
+	writeVersion.Add(1)
+}